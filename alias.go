@@ -0,0 +1,84 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// maxAliasDepth is the longest chain of aliases followed by a read.
+const maxAliasDepth = 8
+
+// Alias makes alias a key whose reads with Get resolve to the string value of
+// target, at the cost of one extra indexed lookup, e.g. so old device IDs keep
+// working for a grace period after a rename. The alias is a key of type
+// "alias" in its own right: Set or Del on it replaces or removes the alias,
+// not the target, and Expire on it bounds the grace period. target need not
+// exist; reads of the alias then fail with ErrKeyNotFound. An existing key
+// named alias is replaced.
+//
+// Aliases may point to aliases, up to a chain of 8. Alias returns
+// ErrAliasCycle if target leads back to alias or the chain would be longer.
+func (s *Store) Alias(alias, target string) error {
+	defer s.observe("alias", time.Now())
+
+	alias = s.canonicalKey(alias)
+	target = s.canonicalKey(target)
+	if err := checkReserved(alias); err != nil {
+		return err
+	}
+
+	if target == "" {
+		return fmt.Errorf("alias %q in table %q needs a target", alias, s.table)
+	}
+	if err := s.Sync(); err != nil {
+		return err
+	}
+
+	aliasSQL := fmt.Sprintf(`
+	INSERT INTO %s (key, value, type, expires_at, version, created_at, updated_at, codec, transforms) VALUES (?1, ?2, 'alias', NULL, %s, ?3, ?3, 0, NULL)
+	ON CONFLICT(key) DO UPDATE SET
+		value = excluded.value, type = 'alias', expires_at = NULL,
+		version = version + 1, updated_at = excluded.updated_at, codec = 0, transforms = NULL;`, s.quoteTable(), firstVersionSQL(s.table))
+
+	err := s.update(func(tx *sql.Tx) error {
+		now := s.now().Unix()
+		depth := 1
+		for next := target; ; depth++ {
+			if next == alias || depth > maxAliasDepth {
+				return ErrAliasCycle
+			}
+			var err error
+			if next, err = s.aliasTarget(tx, next, now); err != nil {
+				return err
+			}
+			if next == "" {
+				break // Not an alias: the chain ends here
+			}
+		}
+		if _, err := tx.Exec(aliasSQL, alias, []byte(target), now); err != nil {
+			return fmt.Errorf("failed to set alias %q in table %q: %w", alias, s.table, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.notify.publish(alias, "set")
+	return nil
+}
+
+// aliasTarget returns the target of key if it is a live alias, or "".
+func (s *Store) aliasTarget(tx *sql.Tx, key string, now int64) (string, error) {
+	var target []byte
+	targetSQL := fmt.Sprintf(`
+	SELECT value FROM %s WHERE key = ? AND type = 'alias' AND (expires_at IS NULL OR expires_at >= ?);`, s.quoteTable())
+	err := tx.QueryRow(targetSQL, key, now).Scan(&target)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve alias %q in table %q: %w", key, s.table, err)
+	}
+	return string(target), nil
+}
@@ -0,0 +1,58 @@
+package mkvstore
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestAlias tests alias resolution, chains and cycle detection.
+func TestAlias(t *testing.T) {
+	store, _ := setupFileStore(t)
+	store.Set("device:new", "online", 0)
+
+	if err := store.Alias("device:old", "device:new"); err != nil {
+		t.Fatalf("Alias failed: %v", err)
+	}
+	if v, err := store.Get("device:old"); err != nil || v != "online" {
+		t.Errorf("Get(alias) = %q, %v; expected online", v, err)
+	}
+	store.Set("device:new", "offline", 0)
+	if v, _ := store.Get("device:old"); v != "offline" {
+		t.Errorf("Expected alias to follow writes to its target, got %q", v)
+	}
+
+	if err := store.Alias("device:older", "device:old"); err != nil {
+		t.Fatalf("Alias of an alias failed: %v", err)
+	}
+	if v, _ := store.Get("device:older"); v != "offline" {
+		t.Errorf("Expected chained alias to resolve, got %q", v)
+	}
+	if err := store.Alias("device:new", "device:older"); !errors.Is(err, ErrAliasCycle) {
+		t.Errorf("Expected ErrAliasCycle, got %v", err)
+	}
+	if err := store.Alias("self", "self"); !errors.Is(err, ErrAliasCycle) {
+		t.Errorf("Expected ErrAliasCycle for a self alias, got %v", err)
+	}
+	if v, _ := store.Get("device:new"); v != "offline" {
+		t.Errorf("Expected rejected alias to leave the key alone, got %q", v)
+	}
+
+	for i := range maxAliasDepth {
+		if err := store.Alias(fmt.Sprintf("chain:%d", i+1), fmt.Sprintf("chain:%d", i)); err != nil {
+			t.Fatalf("Alias of chain:%d failed: %v", i+1, err)
+		}
+	}
+	if err := store.Alias("chain:too-long", fmt.Sprintf("chain:%d", maxAliasDepth)); !errors.Is(err, ErrAliasCycle) {
+		t.Errorf("Expected ErrAliasCycle for an overlong chain, got %v", err)
+	}
+
+	store.Del("device:new")
+	if _, err := store.Get("device:old"); err != ErrKeyNotFound {
+		t.Errorf("Expected dangling alias to read as not found, got %v", err)
+	}
+	store.Del("device:old")
+	if _, err := store.Get("device:older"); err != ErrKeyNotFound {
+		t.Errorf("Expected alias to a deleted alias to read as not found, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errArchived is returned inside a transaction that found an archived stub,
+// for the caller to restore the key and try again.
+var errArchived = errors.New("key is archived")
+
+// Append appends suffix to the string value of key and returns the length of
+// the new value in bytes, like Redis APPEND, e.g. for small per-device logs.
+// A missing or expired key is created with suffix as its value and the
+// default TTL of its prefix, if any (see WithPrefixTTL); an existing key
+// keeps its TTL. The read and the write happen in one transaction, so
+// concurrent appends are never lost. Aliases are not followed.
+// Returns ErrWrongType if key holds another type.
+func (s *Store) Append(key, suffix string) (int, error) {
+	defer s.observe("append", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return 0, err
+	}
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+
+	for range 2 {
+		var value string
+		var expiresAt interface{}
+		err := s.update(func(tx *sql.Tx) error {
+			now := s.now()
+			var stored []byte
+			var codec byte
+			var transforms sql.NullString
+			var keyType string
+			var oldExpiresAt sql.NullInt64
+			readSQL := fmt.Sprintf(`SELECT value, codec, transforms, type, expires_at FROM %s WHERE key = ?;`, s.quoteTable())
+			err := tx.QueryRowContext(s.ctx, readSQL, key).Scan(&stored, &codec, &transforms, &keyType, &oldExpiresAt)
+			live := err == nil && (!oldExpiresAt.Valid || oldExpiresAt.Int64 >= now.Unix())
+			switch {
+			case err != nil && err != sql.ErrNoRows:
+				return fmt.Errorf("failed to read key %q in table %q: %w", key, s.table, err)
+			case !live:
+				value = suffix
+				if ttl := s.effectiveTTL(key, 0); ttl > 0 {
+					expiresAt = now.Add(ttl).Unix()
+				}
+			case keyType == "archived":
+				return errArchived
+			case keyType != "string":
+				return ErrWrongType
+			default:
+				old, err := s.decodeValue(stored, codec, transforms)
+				if err != nil {
+					return fmt.Errorf("failed to read key %q in table %q: %w", key, s.table, err)
+				}
+				value = old + suffix
+				if oldExpiresAt.Valid {
+					expiresAt = oldExpiresAt.Int64
+				}
+			}
+
+			enc, err := s.encodeValue(key, value)
+			if err != nil {
+				return fmt.Errorf("failed to append to key %q in table %q: %w", key, s.table, err)
+			}
+			if !live {
+				// Replaces an expired row, which then starts a new life
+				_, err = tx.ExecContext(s.ctx, fmt.Sprintf(`DELETE FROM %s WHERE key = ?;`, s.quoteTable()), key)
+				if err != nil {
+					return fmt.Errorf("failed to append to key %q in table %q: %w", key, s.table, err)
+				}
+			}
+			_, err = tx.ExecContext(s.ctx, s.setSQL(), key, enc.data, expiresAt, now.Unix(), enc.codec, enc.transforms)
+			if err != nil {
+				return fmt.Errorf("failed to append to key %q in table %q: %w", key, s.table, err)
+			}
+			return nil
+		})
+		if err == errArchived {
+			// Bring the value back from the archive and try again
+			if err := s.restoreArchived(key); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		s.trackExpiry(key, expiresAt)
+		s.notify.publish(key, "append")
+		return len(value), nil
+	}
+	return 0, ErrWrongType // Still archived
+}
@@ -0,0 +1,39 @@
+package mkvstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestAppend tests that Append creates, extends and keeps the TTL of values.
+func TestAppend(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	if n, err := store.Append("new", "a"); err != nil || n != 1 {
+		t.Fatalf("Append to a missing key = %d, %v, expected 1", n, err)
+	}
+	store.Set("log", "a", time.Hour)
+	if n, err := store.Append("log", "bc"); err != nil || n != 3 {
+		t.Errorf("Append = %d, %v, expected 3", n, err)
+	}
+	if value, _ := store.Get("log"); value != "abc" {
+		t.Errorf("Get = %q, expected abc", value)
+	}
+	if ttl, _ := store.TTL("log"); ttl <= 0 {
+		t.Errorf("TTL = %v, expected Append to keep it", ttl)
+	}
+
+	store.db.Exec(`UPDATE "test_kv_data_file" SET expires_at = ? WHERE key = 'log';`, time.Now().Add(-time.Minute).Unix())
+	if n, err := store.Append("log", "new"); err != nil || n != 3 {
+		t.Errorf("Append to an expired key = %d, %v, expected 3", n, err)
+	}
+	if ttl, _ := store.TTL("log"); ttl != -1 {
+		t.Errorf("TTL = %v, expected a recreated key without TTL", ttl)
+	}
+
+	store.HSet("h", "f", "v")
+	if _, err := store.Append("h", "x"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Append to a hash = %v, expected ErrWrongType", err)
+	}
+}
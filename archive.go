@@ -0,0 +1,149 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ErrArchiveDisabled is returned by ArchiveColdKeys when WithArchiveTiering
+// was not given at Open.
+var ErrArchiveDisabled = errors.New("archive tiering is not enabled")
+
+// archiveColumns are the columns moved between a table and its archive.
+const archiveColumns = `key, value, type, expires_at, version, created_at, updated_at, codec, transforms, meta, accessed_at`
+
+// ArchivePolicy configures WithArchiveTiering.
+type ArchivePolicy struct {
+	// Alias is the attached database receiving cold keys (see AttachDatabase).
+	Alias string
+
+	// After is how long a string key must go unread and unwritten to be
+	// archived.
+	After time.Duration
+
+	// Interval is how often cold keys are archived. Defaults to After / 10.
+	Interval time.Duration
+}
+
+// WithArchiveTiering keeps the database small and fast by moving string keys
+// not read nor written for policy.After into the database attached as
+// policy.Alias, as the "archive" maintenance task. Each archived key leaves a
+// stub behind, so Exists, TTL and Keys still see it; reads through Get serve
+// the archived value and restore it to the database in the background. Set
+// and Del replace or remove the key as usual.
+//
+// Reads record their time in the accessed_at column at most ten times per
+// After, which costs an occasional background write. Keys are only archived
+// once the archive is attached; runs before that fail with an error shown by
+// MaintenanceStatus.
+func WithArchiveTiering(policy ArchivePolicy) Option {
+	return func(o *options) {
+		if policy.Interval <= 0 {
+			policy.Interval = policy.After / 10
+		}
+		o.archive = &policy
+	}
+}
+
+// scheduleArchive schedules the "archive" maintenance task if configured.
+func (s *Store) scheduleArchive() error {
+	p := s.opts.archive
+	if p == nil {
+		return nil
+	}
+	if p.After <= 0 {
+		return errors.New("archive tiering needs a positive After duration")
+	}
+	return s.schedule(MaintenanceTask{Name: "archive", Interval: p.Interval, Run: func(context.Context) error {
+		_, err := s.ArchiveColdKeys()
+		return err
+	}})
+}
+
+// ArchiveColdKeys moves the string keys not read nor written for the After
+// duration of WithArchiveTiering into the archive database right away,
+// leaving stubs behind, and returns how many were archived.
+func (s *Store) ArchiveColdKeys() (int64, error) {
+	p := s.opts.archive
+	if p == nil {
+		return 0, ErrArchiveDisabled
+	}
+	if !slices.Contains(s.opts.attached.aliases(), p.Alias) {
+		return 0, fmt.Errorf("archive database %q is not attached", p.Alias)
+	}
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+
+	now := s.now()
+	cold := `type = 'string' AND max(COALESCE(accessed_at, 0), COALESCE(updated_at, 0)) < ?1 AND (expires_at IS NULL OR expires_at >= ?2)`
+	args := []interface{}{now.Add(-p.After).Unix(), now.Unix(), p.Alias}
+	var archived int64
+	err := s.update(func(tx *sql.Tx) error {
+		copySQL := fmt.Sprintf(`INSERT OR REPLACE INTO %s (%s) SELECT %s FROM %s WHERE %s;`,
+			s.archiveTable(p.Alias), archiveColumns, archiveColumns, s.quoteTable(), cold)
+		if _, err := tx.ExecContext(s.ctx, copySQL, args...); err != nil {
+			return fmt.Errorf("failed to archive cold keys of table %q: %w", s.table, err)
+		}
+		stubSQL := fmt.Sprintf(`UPDATE %s SET type = 'archived', value = ?3, codec = 0, transforms = NULL WHERE %s;`, s.quoteTable(), cold)
+		result, err := tx.ExecContext(s.ctx, stubSQL, args...)
+		if err != nil {
+			return fmt.Errorf("failed to archive cold keys of table %q: %w", s.table, err)
+		}
+		archived, _ = result.RowsAffected()
+		return nil
+	})
+	return archived, err
+}
+
+// restoreArchived moves key back from its archive if it is still a stub.
+// Reads that find a stub call it asynchronously.
+func (s *Store) restoreArchived(key string) error {
+	err := s.update(func(tx *sql.Tx) error {
+		var alias string
+		stubSQL := fmt.Sprintf(`SELECT value FROM %s WHERE key = ? AND type = 'archived';`, s.quoteTable())
+		err := tx.QueryRowContext(s.ctx, stubSQL, key).Scan(&alias)
+		if err == sql.ErrNoRows {
+			return nil // Restored, overwritten or deleted in the meantime
+		}
+		if err != nil {
+			return err
+		}
+		archive := s.archiveTable(alias)
+		restoreSQL := fmt.Sprintf(`
+		UPDATE %s SET (value, codec, transforms, type, accessed_at) =
+			(SELECT value, codec, transforms, 'string', ?2 FROM %s WHERE key = ?1)
+		WHERE key = ?1 AND EXISTS (SELECT 1 FROM %s WHERE key = ?1);`, s.quoteTable(), archive, archive)
+		if _, err := tx.ExecContext(s.ctx, restoreSQL, key, s.now().Unix()); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(s.ctx, fmt.Sprintf(`DELETE FROM %s WHERE key = ?;`, archive), key)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore archived key %q to table %q: %w", key, s.table, err)
+	}
+	return nil
+}
+
+// touchInterval returns how stale the access time of a key may get before a
+// read records it again, or 0 when access times are not tracked.
+func (s *Store) touchInterval() int64 {
+	if s.opts.archive == nil {
+		return 0
+	}
+	return max(int64(s.opts.archive.After/time.Second)/10, 1)
+}
+
+// touch records that key was just read. Reads call it asynchronously.
+func (s *Store) touch(key string) error {
+	touchSQL := fmt.Sprintf(`UPDATE %s SET accessed_at = ? WHERE key = ?;`, s.quoteTable())
+	if _, err := s.exec(context.Background(), touchSQL, s.now().Unix(), key); err != nil {
+		return fmt.Errorf("failed to record access to key %q in table %q: %w", key, s.table, err)
+	}
+	return nil
+}
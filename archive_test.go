@@ -0,0 +1,82 @@
+package mkvstore
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestArchiveTiering tests that cold keys move to the archive behind a stub
+// and come back when read.
+func TestArchiveTiering(t *testing.T) {
+	dir := t.TempDir()
+	var skew atomic.Int64 // Read by background reads and writes
+	clock := func() time.Time { return time.Now().Add(time.Duration(skew.Load())) }
+	store, err := Open(filepath.Join(dir, "hot.db"), "kv", WithClock(clock),
+		WithArchiveTiering(ArchivePolicy{Alias: "archive", After: 24 * time.Hour}))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+	if _, err := store.ArchiveColdKeys(); err == nil {
+		t.Error("Expected an error before the archive is attached")
+	}
+	if err := store.AttachDatabase(filepath.Join(dir, "archive.db"), "archive"); err != nil {
+		t.Fatalf("AttachDatabase failed: %v", err)
+	}
+
+	store.Set("cold", "frozen", 0)
+	store.Set("warm", "read", 0)
+	skew.Store(int64(48 * time.Hour))
+	store.Get("warm")
+	waitFor(t, "access time of warm", func() bool {
+		var accessed int64
+		store.db.QueryRow(fmt.Sprintf(`SELECT COALESCE(accessed_at, 0) FROM %s WHERE key = 'warm';`, store.quoteTable())).Scan(&accessed)
+		return accessed >= clock().Unix()-1
+	})
+
+	n, err := store.ArchiveColdKeys()
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 key archived, got %d, %v", n, err)
+	}
+	keyType := func(key string) string {
+		var typ string
+		store.db.QueryRow(fmt.Sprintf(`SELECT type FROM %s WHERE key = ?;`, store.quoteTable()), key).Scan(&typ)
+		return typ
+	}
+	if typ := keyType("cold"); typ != "archived" {
+		t.Errorf("Expected a stub for cold, got type %q", typ)
+	}
+	if ok, _ := store.Exists("cold"); !ok {
+		t.Error("Expected the stub to exist")
+	}
+	if keys, _ := store.Keys("*"); !slices.Equal(keys, []string{"cold", "warm"}) {
+		t.Errorf("Expected archived keys to be listed, got %v", keys)
+	}
+
+	if v, err := store.Get("cold"); err != nil || v != "frozen" {
+		t.Errorf("Expected the archived value, got %q, %v", v, err)
+	}
+	waitFor(t, "restore of cold", func() bool { return keyType("cold") == "string" })
+	if _, err := store.readArchived(store.q(), "archive", "cold"); err != ErrKeyNotFound {
+		t.Errorf("Expected the restored key to leave the archive, got %v", err)
+	}
+	if v, err := store.Get("cold"); err != nil || v != "frozen" {
+		t.Errorf("Expected the restored value, got %q, %v", v, err)
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,164 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// defaultMaxIdleConns is the database/sql default for SetMaxIdleConns.
+const defaultMaxIdleConns = 2
+
+// attachment is a database file attached to every connection of a Store.
+type attachment struct {
+	path  string
+	alias string
+}
+
+// attachments lists the databases attached with AttachDatabase. It is shared
+// by the connector, which attaches them to every new connection, and by the
+// stores of the database.
+type attachments struct {
+	mu   sync.RWMutex
+	list []attachment
+}
+
+// attach attaches the registered databases to a new connection.
+func (a *attachments) attach(conn *sqlite3.SQLiteConn) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, at := range a.list {
+		if _, err := conn.Exec(fmt.Sprintf(`ATTACH DATABASE ? AS %s;`, quoteIdent(at.alias)), []driver.Value{at.path}); err != nil {
+			return fmt.Errorf("failed to attach database %q as %q: %w", at.path, at.alias, err)
+		}
+	}
+	return nil
+}
+
+// aliases returns the aliases of the attached databases, in attach order.
+func (a *attachments) aliases() []string {
+	if a == nil {
+		return nil
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	aliases := make([]string, len(a.list))
+	for i, at := range a.list {
+		aliases[i] = at.alias
+	}
+	return aliases
+}
+
+// AttachDatabase attaches the database file at path under alias to the
+// store, e.g. an archive on external storage next to a hot database on
+// internal flash. The store's table is created in it if needed. Reads of
+// string keys missing from the store (Get, GetBytes, Exists) fall through to
+// the attached databases in attach order, and Del deletes the key from them
+// too, so an archived value never reappears once deleted. Tables opened with
+// Table share the attachments.
+//
+// SQLite attaches databases per connection: idle connections are closed so
+// the pool reopens them with the attachment, but a connection in use by
+// another goroutine at the time, or pinned by a Session, does not see it.
+// Attach databases right after Open.
+func (s *Store) AttachDatabase(path, alias string) error {
+	if databaseFile(path) == "" {
+		return errors.New("cannot attach an in-memory database")
+	}
+	if alias == "" || strings.EqualFold(alias, "main") || strings.EqualFold(alias, "temp") {
+		return fmt.Errorf("invalid database alias %q", alias)
+	}
+	a := s.opts.attached
+	if a == nil {
+		return errors.New("cannot attach a database to a store not opened with Open")
+	}
+	if slices.ContainsFunc(a.aliases(), func(other string) bool { return strings.EqualFold(other, alias) }) {
+		return fmt.Errorf("a database is already attached as %q", alias)
+	}
+
+	// Let the archive's own Open create the schema, so it is usable standalone
+	archive, err := Open(path, s.table)
+	if err != nil {
+		return fmt.Errorf("failed to attach database %q: %w", path, err)
+	}
+	archive.Close()
+
+	a.mu.Lock()
+	a.list = append(a.list, attachment{path: path, alias: alias})
+	a.mu.Unlock()
+
+	// Idle connections were opened without the attachment
+	idle := s.opts.maxIdleConns
+	if idle <= 0 {
+		idle = defaultMaxIdleConns
+	}
+	s.db.SetMaxIdleConns(0)
+	s.db.SetMaxIdleConns(idle)
+	return nil
+}
+
+// archiveTable returns the quoted name of the store's table in the database
+// attached as alias.
+func (s *Store) archiveTable(alias string) string {
+	return quoteIdent(alias) + "." + s.quoteTable()
+}
+
+// isMissingTable reports whether err is SQLite reporting a missing table, as
+// for tables opened with Table after the archive was attached.
+func isMissingTable(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "no such table")
+}
+
+// getArchived reads the string value of key from the attached databases.
+// Returns ErrKeyNotFound if none holds it live.
+func (s *Store) getArchived(key string) (string, error) {
+	for _, alias := range s.opts.attached.aliases() {
+		value, err := s.readArchived(s.q(), alias, key)
+		if err != ErrKeyNotFound {
+			return value, err
+		}
+	}
+	return "", ErrKeyNotFound
+}
+
+// readArchived reads the string value of key from the database attached as
+// alias using q.
+// Returns ErrKeyNotFound if the database does not hold it live.
+func (s *Store) readArchived(q queryer, alias, key string) (string, error) {
+	var stored []byte
+	var codec byte
+	var transforms sql.NullString
+	getSQL := fmt.Sprintf(`
+	SELECT value, codec, transforms FROM %s
+	WHERE key = ? AND type = 'string' AND (expires_at IS NULL OR expires_at >= ?);`, s.archiveTable(alias))
+	err := q.QueryRowContext(s.queryCtx(), getSQL, key, s.now().Unix()).Scan(&stored, &codec, &transforms)
+	if err == sql.ErrNoRows || isMissingTable(err) {
+		return "", ErrKeyNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get key %q from table %q of database %q: %w", key, s.table, alias, err)
+	}
+	value, err := s.decodeValue(stored, codec, transforms)
+	if err != nil {
+		return "", fmt.Errorf("failed to get key %q from table %q of database %q: %w", key, s.table, alias, err)
+	}
+	return value, nil
+}
+
+// delArchived deletes key from the attached databases.
+func (s *Store) delArchived(key string) error {
+	for _, alias := range s.opts.attached.aliases() {
+		delSQL := fmt.Sprintf(`DELETE FROM %s WHERE key = ?;`, s.archiveTable(alias))
+		if _, err := s.exec(context.Background(), delSQL, key); err != nil && !isMissingTable(err) {
+			return fmt.Errorf("failed to delete key %q from table %q of database %q: %w", key, s.table, alias, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package mkvstore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestAttachDatabase tests read fallthrough to an attached archive, shadowing
+// by the hot database and deletion from both.
+func TestAttachDatabase(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "archive.db")
+	archive, err := Open(archivePath, "kv")
+	if err != nil {
+		t.Fatalf("Open of archive failed: %v", err)
+	}
+	archive.Set("old", "archived", 0)
+	archive.Set("both", "archived", 0)
+	archive.Close()
+
+	store, err := Open(filepath.Join(dir, "hot.db"), "kv")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+	if err := store.AttachDatabase(archivePath, "archive"); err != nil {
+		t.Fatalf("AttachDatabase failed: %v", err)
+	}
+
+	if v, err := store.Get("old"); err != nil || v != "archived" {
+		t.Errorf("Expected Get to fall through to the archive, got %q, %v", v, err)
+	}
+	if ok, err := store.Exists("old"); err != nil || !ok {
+		t.Errorf("Expected Exists to fall through to the archive, got %v, %v", ok, err)
+	}
+	store.Set("both", "hot", 0)
+	if v, err := store.Get("both"); err != nil || v != "hot" {
+		t.Errorf("Expected the hot value to shadow the archive, got %q, %v", v, err)
+	}
+
+	if err := store.Del("old"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	if _, err := store.Get("old"); err != ErrKeyNotFound {
+		t.Errorf("Expected deleted key to be gone from the archive too, got %v", err)
+	}
+
+	other, err := store.Table("other")
+	if err != nil {
+		t.Fatalf("Table failed: %v", err)
+	}
+	defer other.Close()
+	if _, err := other.Get("old"); err != ErrKeyNotFound {
+		t.Errorf("Expected a miss for a table missing from the archive, got %v", err)
+	}
+
+	if err := store.AttachDatabase(archivePath, "Archive"); err == nil {
+		t.Error("Expected an error for an alias already in use")
+	}
+	if err := store.AttachDatabase(archivePath, "main"); err == nil {
+		t.Error("Expected an error for the main alias")
+	}
+}
@@ -0,0 +1,163 @@
+package mkvstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recordingSink collects backup records in memory.
+type recordingSink struct {
+	records []BackupRecord
+}
+
+func (r *recordingSink) WriteRecord(rec BackupRecord) error {
+	r.records = append(r.records, rec)
+	return nil
+}
+
+// TestIncrementalBackup tests that only keys changed since the last backup are shipped.
+func TestIncrementalBackup(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "cdc.db"), "test_kv_cdc", WithChangeLog())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	store.Set("a", "1", 0)
+	store.Set("b", "2", 0)
+	store.Set("a", "3", 0) // Second change to the same key
+
+	sink := &recordingSink{}
+	seq, n, err := store.IncrementalBackup(context.Background(), sink, 0)
+	if err != nil {
+		t.Fatalf("IncrementalBackup failed: %v", err)
+	}
+	if n != 2 || len(sink.records) != 2 {
+		t.Fatalf("Expected 2 records, got %d: %+v", n, sink.records)
+	}
+	if rec := sink.records[1]; rec.Key != "a" || rec.Value != "3" || rec.Deleted {
+		t.Errorf("Expected latest state of key a last, got %+v", rec)
+	}
+
+	store.Del("b")
+	store.Set("c", "4", 0)
+
+	var buf bytes.Buffer
+	seq2, n, err := store.IncrementalBackup(context.Background(), NewJSONLSink(&buf), seq)
+	if err != nil {
+		t.Fatalf("Second IncrementalBackup failed: %v", err)
+	}
+	if n != 2 || seq2 <= seq {
+		t.Fatalf("Expected 2 records and an advanced sequence, got %d records, seq %d -> %d", n, seq, seq2)
+	}
+
+	dec := json.NewDecoder(&buf)
+	var first BackupRecord
+	if err := dec.Decode(&first); err != nil {
+		t.Fatalf("Failed to decode JSONL record: %v", err)
+	}
+	if first.Key != "b" || !first.Deleted {
+		t.Errorf("Expected deletion of b, got %+v", first)
+	}
+
+	if removed, err := store.TrimChangeLog(seq2); err != nil || removed == 0 {
+		t.Errorf("TrimChangeLog returned %d, %v", removed, err)
+	}
+
+	plain, _ := setupFileStore(t)
+	if _, _, err := plain.IncrementalBackup(context.Background(), sink, 0); err != ErrChangeLogDisabled {
+		t.Errorf("Expected ErrChangeLogDisabled without WithChangeLog, got %v", err)
+	}
+}
+
+// TestChangesSince tests reading the change log after a sequence, filtered by pattern.
+func TestChangesSince(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "cdc.db"), "test_kv_cdc", WithChangeLog())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	store.Set("cfg:a", "1", 0)
+	store.Set("other", "x", 0)
+	store.Set("cfg:a", "2", 0)
+	store.Del("cfg:a")
+
+	changes, err := store.ChangesSince(0, "cfg:*", 10)
+	if err != nil {
+		t.Fatalf("ChangesSince failed: %v", err)
+	}
+	var ops []string
+	for _, c := range changes {
+		if c.Key != "cfg:a" {
+			t.Errorf("Unexpected change of key %q", c.Key)
+		}
+		ops = append(ops, c.Op)
+	}
+	if got := strings.Join(ops, ","); got != "set,set,del" {
+		t.Fatalf("Expected ops set,set,del, got %s", got)
+	}
+
+	// Resuming after the first change skips it, and limit bounds the batch
+	rest, err := store.ChangesSince(changes[0].Seq, "cfg:*", 1)
+	if err != nil {
+		t.Fatalf("ChangesSince failed: %v", err)
+	}
+	if len(rest) != 1 || rest[0].Seq != changes[1].Seq {
+		t.Errorf("Expected change %d after resuming, got %+v", changes[1].Seq, rest)
+	}
+
+	plain := setupStore(t)
+	if _, err := plain.ChangesSince(0, "*", 10); err != ErrChangeLogDisabled {
+		t.Errorf("Expected ErrChangeLogDisabled, got %v", err)
+	}
+}
+
+// TestIncrementalBackupContainers tests that backups carry the contents of
+// containers, including changes made to them directly in SQL, and that
+// Import restores them.
+func TestIncrementalBackupContainers(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "cdc.db"), "test_kv_cdc", WithChangeLog())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	store.HSet("h", "a", "1")
+	store.HSet("h", "b", "2")
+	store.RPush("l", "x", "y")
+
+	var buf bytes.Buffer
+	seq, n, err := store.IncrementalBackup(context.Background(), NewJSONLSink(&buf), 0)
+	if err != nil || n != 2 {
+		t.Fatalf("IncrementalBackup = %d records, %v, expected 2", n, err)
+	}
+	restored := setupStore(t)
+	defer restored.Close()
+	if _, err := restored.Import(&buf, ImportOptions{}); err != nil {
+		t.Fatalf("Import of the backup failed: %v", err)
+	}
+	if fields, err := restored.HGetAll("h"); err != nil || !reflect.DeepEqual(fields, map[string]string{"a": "1", "b": "2"}) {
+		t.Errorf("HGetAll of the restored hash = %v, %v", fields, err)
+	}
+	if elements, err := restored.LRange("l", 0, -1); err != nil || !reflect.DeepEqual(elements, []string{"x", "y"}) {
+		t.Errorf("LRange of the restored list = %v, %v", elements, err)
+	}
+
+	// A field removed behind the Store's back, e.g. by another process
+	if _, err := store.db.Exec(`DELETE FROM "test_kv_cdc_hash" WHERE key = 'h' AND field = 'a';`); err != nil {
+		t.Fatalf("Failed to delete field: %v", err)
+	}
+	sink := &recordingSink{}
+	if _, n, err := store.IncrementalBackup(context.Background(), sink, seq); err != nil || n != 1 {
+		t.Fatalf("IncrementalBackup after a field change = %d records, %v, expected 1", n, err)
+	}
+	if rec := sink.records[0]; rec.Key != "h" || rec.Type != "hash" || !reflect.DeepEqual(rec.Fields, []HashField{{"b", "2"}}) {
+		t.Errorf("Unexpected record of the changed hash %+v", rec)
+	}
+}
@@ -0,0 +1,161 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// BulkOption configures a bulk operation such as DelPattern or ExpirePattern.
+type BulkOption func(*bulkOptions)
+
+// bulkOptions holds the settings collected from BulkOptions.
+type bulkOptions struct {
+	dryRun bool
+	keys   *[]string
+}
+
+// DryRun makes a bulk operation report how many keys it would affect without
+// changing anything, to check a pattern before running it for real.
+func DryRun() BulkOption {
+	return func(o *bulkOptions) {
+		o.dryRun = true
+	}
+}
+
+// AffectedKeys stores the keys a bulk operation affected, or with DryRun
+// would affect, in *keys.
+func AffectedKeys(keys *[]string) BulkOption {
+	return func(o *bulkOptions) {
+		o.keys = keys
+	}
+}
+
+// bulkOpts collects opts.
+func bulkOpts(opts []BulkOption) bulkOptions {
+	var o bulkOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// bulkWrite runs the write statement stmt on the rows of the main table
+// matching where in a single statement and returns their keys. With DryRun it
+// only selects the keys.
+func (s *Store) bulkWrite(o bulkOptions, stmt, where string, args ...interface{}) ([]string, error) {
+	var keys []string
+	var err error
+	if o.dryRun {
+		keys, err = s.selectKeys(fmt.Sprintf(`SELECT key FROM %s WHERE %s;`, s.quoteTable(), where), args...)
+	} else {
+		keys, err = s.updateReturningKeys(fmt.Sprintf(`%s WHERE %s RETURNING key;`, stmt, where), args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if o.keys != nil {
+		*o.keys = keys
+	}
+	return keys, nil
+}
+
+// selectKeys runs a query returning a single key column.
+func (s *Store) selectKeys(query string, args ...interface{}) ([]string, error) {
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// updateReturningKeys runs a write statement ending in RETURNING key and
+// returns the keys it affected.
+func (s *Store) updateReturningKeys(query string, args ...interface{}) ([]string, error) {
+	var keys []string
+	err := s.update(func(tx *sql.Tx) error {
+		keys = keys[:0]
+		rows, err := tx.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+		return rows.Err()
+	})
+	return keys, err
+}
+
+// DelPattern deletes every live key matching pattern (same glob syntax as
+// Keys), whatever its type, in a single statement. Reserved keys (see
+// ReservedPrefix) are skipped. It returns the number of keys deleted. With
+// DryRun it only counts them.
+func (s *Store) DelPattern(pattern string, opts ...BulkOption) (int64, error) {
+	defer s.observe("delpattern", time.Now())
+
+	pattern = s.canonicalKey(pattern)
+
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+	delSQL := fmt.Sprintf(`DELETE FROM %s`, s.quoteTable())
+	where := `key LIKE ?1 ESCAPE '\' AND (expires_at IS NULL OR expires_at >= ?2) AND ` + notReservedSQL
+
+	o := bulkOpts(opts)
+	var keys []string
+	var err error
+	if s.opts.pacer != nil && !o.dryRun {
+		keys, err = s.deleteThrottled(s.ctx, s.quoteTable(), valueSizeSQL, where, globToSQLLike(pattern), s.now().Unix())
+		if o.keys != nil {
+			*o.keys = keys
+		}
+	} else {
+		keys, err = s.bulkWrite(o, delSQL, where, globToSQLLike(pattern), s.now().Unix())
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete keys matching %q from table %q: %w", pattern, s.table, err)
+	}
+	if !o.dryRun {
+		for _, key := range keys {
+			s.notify.publish(key, "del")
+		}
+	}
+	return int64(len(keys)), nil
+}
+
+// Flush deletes every key of the table, like Redis FLUSHDB, expired ones
+// included but reserved ones (see ReservedPrefix) excluded. It returns the
+// number of keys deleted. With DryRun it only counts them.
+func (s *Store) Flush(opts ...BulkOption) (int64, error) {
+	defer s.observe("flush", time.Now())
+
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+	o := bulkOpts(opts)
+	keys, err := s.bulkWrite(o, fmt.Sprintf(`DELETE FROM %s`, s.quoteTable()), notReservedSQL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to flush table %q: %w", s.table, err)
+	}
+	if !o.dryRun {
+		for _, key := range keys {
+			s.notify.publish(key, "del")
+		}
+	}
+	return int64(len(keys)), nil
+}
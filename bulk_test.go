@@ -0,0 +1,54 @@
+package mkvstore
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestBulkDryRun tests that dry runs report the affected keys without
+// changing them, and that the real runs then affect the same keys.
+func TestBulkDryRun(t *testing.T) {
+	store, _ := setupFileStore(t)
+	store.Set("tmp:a", "1", 0)
+	store.Set("tmp:b", "2", time.Hour)
+	store.HSet("tmp:h", "f", "v")
+	store.Set("keep", "3", 0)
+
+	var keys []string
+	if n, err := store.DelPattern("tmp:*", DryRun(), AffectedKeys(&keys)); err != nil || n != 3 {
+		t.Fatalf("DelPattern dry run = %d, %v; expected 3", n, err)
+	}
+	slices.Sort(keys)
+	if !slices.Equal(keys, []string{"tmp:a", "tmp:b", "tmp:h"}) {
+		t.Errorf("Unexpected dry run keys %v", keys)
+	}
+	if n, _ := store.ExpirePattern("tmp:*", time.Second, DryRun()); n != 3 {
+		t.Errorf("ExpirePattern dry run = %d; expected 3", n)
+	}
+	if n, _ := store.PersistPattern("tmp:*", DryRun()); n != 1 {
+		t.Errorf("PersistPattern dry run = %d; expected 1", n)
+	}
+	if n, _ := store.Flush(DryRun()); n != 4 {
+		t.Errorf("Flush dry run = %d; expected 4", n)
+	}
+	if ttl, _ := store.TTL("tmp:a"); ttl != -1 {
+		t.Errorf("Expected dry runs to leave tmp:a alone, got TTL %s", ttl)
+	}
+	if v, _ := store.HGet("tmp:h", "f"); v != "v" {
+		t.Errorf("Expected dry runs to leave the hash alone, got %q", v)
+	}
+
+	if n, err := store.DelPattern("tmp:*"); err != nil || n != 3 {
+		t.Errorf("DelPattern = %d, %v; expected 3", n, err)
+	}
+	if _, err := store.HGet("tmp:h", "f"); err != ErrKeyNotFound {
+		t.Errorf("Expected hash fields to go with the hash, got %v", err)
+	}
+	if n, err := store.Flush(); err != nil || n != 1 {
+		t.Errorf("Flush = %d, %v; expected 1", n, err)
+	}
+	if exists, _ := store.Exists("keep"); exists {
+		t.Error("Expected Flush to delete every key")
+	}
+}
@@ -0,0 +1,22 @@
+package mkvstore
+
+import (
+	"time"
+)
+
+// SetBytes stores an arbitrary binary payload, such as a protobuf message or
+// an image, at key, like Set. Values that are not valid UTF-8 are stored as
+// SQLite BLOBs, so no base64 or other escaping is needed.
+func (s *Store) SetBytes(key string, value []byte, ttl time.Duration) error {
+	return s.Set(key, string(value), ttl)
+}
+
+// GetBytes retrieves the value of key as a byte slice, like Get.
+// Returns ErrKeyNotFound if the key does not exist, is expired, or is not a string.
+func (s *Store) GetBytes(key string) ([]byte, error) {
+	value, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(value), nil
+}
@@ -0,0 +1,36 @@
+package mkvstore
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestSetBytes tests that binary values round-trip and are stored as BLOBs.
+func TestSetBytes(t *testing.T) {
+	store := setupWALStore(t)
+	payload := []byte{0x00, 0xff, 0xfe, '\n', 0x00, 0x80}
+	if err := store.SetBytes("bin", payload, time.Hour); err != nil {
+		t.Fatalf("SetBytes failed: %v", err)
+	}
+	got, err := store.GetBytes("bin")
+	if err != nil || !bytes.Equal(got, payload) {
+		t.Errorf("Expected %x, got %x, %v", payload, got, err)
+	}
+
+	var storage string
+	typeSQL := fmt.Sprintf(`SELECT typeof(value) FROM %s WHERE key = ?;`, store.quoteTable())
+	if err := store.db.QueryRow(typeSQL, "bin").Scan(&storage); err != nil || storage != "blob" {
+		t.Errorf("Expected a blob, got %q, %v", storage, err)
+	}
+
+	store.Set("text", "plain", 0)
+	if err := store.db.QueryRow(typeSQL, "text").Scan(&storage); err != nil || storage != "text" {
+		t.Errorf("Expected text values to stay text, got %q, %v", storage, err)
+	}
+
+	if _, err := store.GetBytes("missing"); err != ErrKeyNotFound {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package mkvstore
+
+import (
+	"sort"
+	"strings"
+)
+
+// KeyCanonicalization configures WithKeyCanonicalization. Steps run in field
+// order.
+type KeyCanonicalization struct {
+	// Normalize rewrites keys to a Unicode normal form, typically
+	// norm.NFC.String from golang.org/x/text/unicode/norm, so that "é"
+	// typed as one code point or as "e" and a combining accent are one key.
+	Normalize func(string) string
+
+	// Lowercase folds keys to lower case.
+	Lowercase bool
+
+	// TrimSpace removes leading and trailing white space.
+	TrimSpace bool
+}
+
+// WithKeyCanonicalization rewrites every key to a canonical form before use,
+// so that producers spelling a key differently, such as "Sensor:1" and
+// "sensor:1 ", share one key instead of creating ghost duplicates. It applies
+// to every operation taking keys, and to the patterns and prefixes of Keys,
+// Scan, Subscribe and the other pattern operations. Keys come back in their
+// canonical form, from Keys as from MGet. Hash fields are not keys and are
+// left alone.
+//
+// Keys already stored are not rewritten and become unreachable if not
+// canonical: enable it on a new table, or rename such keys first through a
+// Store opened without it.
+func WithKeyCanonicalization(c KeyCanonicalization) Option {
+	return func(o *options) {
+		o.canon = &c
+	}
+}
+
+// canonicalKey returns the canonical form of key, or of a pattern or prefix
+// (see WithKeyCanonicalization).
+func (s *Store) canonicalKey(key string) string {
+	c := s.opts.canon
+	if c == nil {
+		return key
+	}
+	if c.Normalize != nil {
+		key = c.Normalize(key)
+	}
+	if c.Lowercase {
+		key = strings.ToLower(key)
+	}
+	if c.TrimSpace {
+		key = strings.TrimSpace(key)
+	}
+	return key
+}
+
+// CanonicalKey returns the canonical form of key, or of a pattern or prefix,
+// as the store writes it and reports it in notifications (see
+// WithKeyCanonicalization). Without canonicalization it returns key.
+func (s *Store) CanonicalKey(key string) string {
+	return s.canonicalKey(key)
+}
+
+// canonicalKeys returns keys in canonical form, or keys itself when
+// canonicalization is not configured.
+func (s *Store) canonicalKeys(keys []string) []string {
+	if s.opts.canon == nil {
+		return keys
+	}
+	canonical := make([]string, len(keys))
+	for i, key := range keys {
+		canonical[i] = s.canonicalKey(key)
+	}
+	return canonical
+}
+
+// canonicalPairs returns pairs with its keys in canonical form, or pairs
+// itself when canonicalization is not configured. Of keys with the same
+// canonical form, the value of the greatest original key wins.
+func (s *Store) canonicalPairs(pairs map[string]string) map[string]string {
+	if s.opts.canon == nil {
+		return pairs
+	}
+	keys := make([]string, 0, len(pairs))
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // Deterministic winner on collisions
+	canonical := make(map[string]string, len(pairs))
+	for _, key := range keys {
+		canonical[s.canonicalKey(key)] = pairs[key]
+	}
+	return canonical
+}
@@ -0,0 +1,61 @@
+package mkvstore
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestKeyCanonicalization tests that differently spelled keys share one
+// canonical key across operations and patterns.
+func TestKeyCanonicalization(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "canon.db")
+	composed := func(key string) string { return strings.ReplaceAll(key, "e\u0301", "\u00e9") } // NFC of "é" only
+	store, err := Open(dbPath, "test_kv_canon", WithKeyCanonicalization(KeyCanonicalization{
+		Normalize: composed,
+		Lowercase: true,
+		TrimSpace: true,
+	}))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	store.Set(" Sensor:1 ", "a", 0)
+	store.Set("sensor:1", "b", 0)
+	store.Set("Cafe\u0301", "c", 0)
+	if value, err := store.Get("SENSOR:1"); err != nil || value != "b" {
+		t.Errorf("Get = %q, %v, expected the value of the canonical key", value, err)
+	}
+	if value, err := store.Get("caf\u00e9 "); err != nil || value != "c" {
+		t.Errorf("Get of the composed key = %q, %v", value, err)
+	}
+
+	keys, err := store.Keys("SENSOR:*")
+	if err != nil {
+		t.Fatalf("Keys failed: %v", err)
+	}
+	if expected := []string{"sensor:1"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Keys = %v, expected %v", keys, expected)
+	}
+
+	store.MSet(map[string]string{"Batch:A": "1", "batch:b ": "2"}, 0)
+	values, err := store.MGet("BATCH:a", "batch:B")
+	if err != nil {
+		t.Fatalf("MGet failed: %v", err)
+	}
+	if expected := map[string]string{"batch:a": "1", "batch:b": "2"}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("MGet = %v, expected %v", values, expected)
+	}
+
+	store.HSet("Device", "Field", "x")
+	if value, err := store.HGet("device", "Field"); err != nil || value != "x" {
+		t.Errorf("HGet = %q, %v, expected hash fields to keep their case", value, err)
+	}
+
+	store.Del(" SENSOR:1")
+	if exists, _ := store.Exists("sensor:1"); exists {
+		t.Error("Expected Del of a differently spelled key to delete the canonical key")
+	}
+}
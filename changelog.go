@@ -0,0 +1,165 @@
+package mkvstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WithChangeLog records every insert, update and delete on the store's table
+// in a change log table (<table>_changes) maintained by SQLite triggers, so
+// changes made by other processes sharing the file are captured too. Changes
+// to the fields, elements, members and entries of hashes, lists, sets, sorted
+// sets and streams are recorded as changes of their key, so a single write to
+// one may be logged more than once. The log feeds IncrementalBackup. Use
+// TrimChangeLog to bound its size.
+func WithChangeLog() Option {
+	return func(o *options) {
+		o.changeLog = true
+	}
+}
+
+// changesTable returns the name of the change log table.
+func (s *Store) changesTable() string {
+	return changesTableName(s.table)
+}
+
+// changesTableName returns the name of the change log table of table.
+func changesTableName(table string) string {
+	return table + "_changes"
+}
+
+// createChangeLog creates the change log table and the triggers feeding it.
+func (s *Store) createChangeLog() error {
+	changes := quoteIdent(s.changesTable())
+	now := `CAST(strftime('%s', 'now') AS INTEGER)`
+
+	statements := []string{
+		fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			key TEXT NOT NULL,
+			op TEXT NOT NULL, -- 'set' or 'del'
+			changed_at INTEGER NOT NULL -- Unix timestamp
+		);`, changes),
+		fmt.Sprintf(`
+		CREATE TRIGGER IF NOT EXISTS %s AFTER INSERT ON %s BEGIN
+			INSERT INTO %s (key, op, changed_at) VALUES (NEW.key, 'set', %s);
+		END;`, quoteIdent(s.table+"_cdc_insert"), s.quoteTable(), changes, now),
+		fmt.Sprintf(`
+		CREATE TRIGGER IF NOT EXISTS %s AFTER UPDATE ON %s BEGIN
+			INSERT INTO %s (key, op, changed_at) SELECT OLD.key, 'del', %s WHERE OLD.key IS NOT NEW.key;
+			INSERT INTO %s (key, op, changed_at) VALUES (NEW.key, 'set', %s);
+		END;`, quoteIdent(s.table+"_cdc_update"), s.quoteTable(), changes, now, changes, now),
+		fmt.Sprintf(`
+		CREATE TRIGGER IF NOT EXISTS %s AFTER DELETE ON %s BEGIN
+			INSERT INTO %s (key, op, changed_at) VALUES (OLD.key, 'del', %s);
+		END;`, quoteIdent(s.table+"_cdc_delete"), s.quoteTable(), changes, now),
+	}
+
+	// A container changes with its contents, as long as it exists: contents
+	// dropped along with their key are covered by the deletion of its row
+	children := []string{hashTableName(s.table), listTableName(s.table), setTableName(s.table), zsetTableName(s.table), streamTableName(s.table)}
+	for _, child := range children {
+		for _, event := range []struct{ name, row string }{{"insert", "NEW"}, {"update", "NEW"}, {"delete", "OLD"}} {
+			statements = append(statements, fmt.Sprintf(`
+			CREATE TRIGGER IF NOT EXISTS %s AFTER %s ON %s
+			WHEN EXISTS (SELECT 1 FROM %s WHERE key = %s.key) BEGIN
+				INSERT INTO %s (key, op, changed_at) VALUES (%s.key, 'set', %s);
+			END;`, quoteIdent(child+"_cdc_"+event.name), strings.ToUpper(event.name), quoteIdent(child),
+				s.quoteTable(), event.row, changes, event.row, now))
+		}
+	}
+
+	for _, stmt := range statements {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create change log for table %q: %w", s.table, err)
+		}
+	}
+	return nil
+}
+
+// ChangeSeq returns the sequence number of the latest recorded change, or 0
+// if the change log is empty. Requires WithChangeLog.
+func (s *Store) ChangeSeq() (int64, error) {
+	if !s.opts.changeLog {
+		return 0, ErrChangeLogDisabled
+	}
+	var seq int64
+	seqSQL := fmt.Sprintf(`SELECT COALESCE(MAX(seq), 0) FROM %s;`, quoteIdent(s.changesTable()))
+	if err := s.queryRow(seqSQL).Scan(&seq); err != nil {
+		return 0, fmt.Errorf("failed to read change log sequence for table %q: %w", s.table, err)
+	}
+	return seq, nil
+}
+
+// TrimChangeLog deletes change log entries with a sequence number up to and
+// including uptoSeq, typically the sequence returned by the last successful
+// IncrementalBackup. It returns the number of entries removed.
+func (s *Store) TrimChangeLog(uptoSeq int64) (int64, error) {
+	if !s.opts.changeLog {
+		return 0, ErrChangeLogDisabled
+	}
+	if s.opts.pacer != nil {
+		trimmed, err := s.deleteThrottled(s.ctx, quoteIdent(s.changesTable()), `length(key)`, `seq <= ?`, uptoSeq)
+		if err != nil {
+			return int64(len(trimmed)), fmt.Errorf("failed to trim change log for table %q: %w", s.table, err)
+		}
+		return int64(len(trimmed)), nil
+	}
+	trimSQL := fmt.Sprintf(`DELETE FROM %s WHERE seq <= ?;`, quoteIdent(s.changesTable()))
+	result, err := s.exec(context.Background(), trimSQL, uptoSeq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to trim change log for table %q: %w", s.table, err)
+	}
+	return result.RowsAffected()
+}
+
+// Change is an entry of the change log.
+type Change struct {
+	Seq  int64
+	Key  string
+	Op   string // "set" or "del"
+	Time time.Time
+}
+
+// ChangesSince returns up to limit change log entries after sequence sinceSeq
+// for keys matching pattern (glob syntax as Keys), oldest first. Unlike
+// IncrementalBackup, every change is returned, not just the latest per key.
+// Pass the Seq of the last entry seen to resume, e.g. after a reconnect.
+// Entries removed by TrimChangeLog are not returned. Requires WithChangeLog.
+func (s *Store) ChangesSince(sinceSeq int64, pattern string, limit int) ([]Change, error) {
+	if !s.opts.changeLog {
+		return nil, ErrChangeLogDisabled
+	}
+	pattern = s.canonicalKey(pattern)
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+
+	changesSQL := fmt.Sprintf(`
+	SELECT seq, key, op, changed_at FROM %s
+	WHERE seq > ? AND key LIKE ? ESCAPE '\' AND %s
+	ORDER BY seq LIMIT ?;`, quoteIdent(s.changesTable()), notReservedSQL)
+	rows, err := s.query(changesSQL, sinceSeq, globToSQLLike(pattern), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query change log for table %q: %w", s.table, err)
+	}
+	defer rows.Close()
+
+	var changes []Change
+	for rows.Next() {
+		var c Change
+		var changedAt int64
+		if err := rows.Scan(&c.Seq, &c.Key, &c.Op, &changedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan change row in table %q: %w", s.table, err)
+		}
+		c.Time = time.Unix(changedAt, 0)
+		changes = append(changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through change rows in table %q: %w", s.table, err)
+	}
+	return changes, nil
+}
@@ -0,0 +1,67 @@
+package mkvstore
+
+import (
+	"fmt"
+	"time"
+)
+
+// CheckpointMode selects how aggressively a WAL checkpoint runs.
+// See https://www.sqlite.org/pragma.html#pragma_wal_checkpoint.
+type CheckpointMode string
+
+const (
+	// CheckpointPassive checkpoints as many frames as possible without waiting
+	// for readers or writers.
+	CheckpointPassive CheckpointMode = "PASSIVE"
+	// CheckpointFull waits for writers and checkpoints every frame in the WAL.
+	CheckpointFull CheckpointMode = "FULL"
+	// CheckpointRestart is like CheckpointFull and also waits for readers so
+	// the next writer restarts the WAL from the beginning.
+	CheckpointRestart CheckpointMode = "RESTART"
+	// CheckpointTruncate is like CheckpointRestart and also truncates the WAL
+	// file to zero bytes, reclaiming its disk space.
+	CheckpointTruncate CheckpointMode = "TRUNCATE"
+)
+
+// CheckpointResult is the outcome of a WAL checkpoint.
+type CheckpointResult struct {
+	Busy         bool  // True if the checkpoint could not complete because of concurrent access
+	LogFrames    int64 // Number of frames in the WAL, -1 if the database is not in WAL mode
+	Checkpointed int64 // Number of frames copied back into the database, -1 if not in WAL mode
+}
+
+// Checkpoint runs a WAL checkpoint with the given mode.
+// It is a no-op (reporting -1 frames) if the database is not in WAL journal mode.
+func (s *Store) Checkpoint(mode CheckpointMode) (CheckpointResult, error) {
+	defer s.observe("checkpoint", time.Now())
+
+	switch mode {
+	case CheckpointPassive, CheckpointFull, CheckpointRestart, CheckpointTruncate:
+	default:
+		return CheckpointResult{}, fmt.Errorf("invalid checkpoint mode %q", mode)
+	}
+
+	var busy int
+	var result CheckpointResult
+	row := s.db.QueryRow(fmt.Sprintf(`PRAGMA wal_checkpoint(%s);`, mode))
+	if err := row.Scan(&busy, &result.LogFrames, &result.Checkpointed); err != nil {
+		return CheckpointResult{}, fmt.Errorf("failed to run %s checkpoint: %w", mode, err)
+	}
+	result.Busy = busy != 0
+	return result, nil
+}
+
+// autoCheckpoint truncates the WAL if it has grown to at least threshold
+// bytes. It is the run function of the checkpoint maintenance task (see
+// WithAutoCheckpoint).
+func (s *Store) autoCheckpoint(threshold int64) error {
+	stats, err := s.DiskStats()
+	if err != nil {
+		return err
+	}
+	if stats.WALSize < threshold {
+		return nil
+	}
+	_, err = s.Checkpoint(CheckpointTruncate)
+	return err
+}
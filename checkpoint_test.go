@@ -0,0 +1,82 @@
+package mkvstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setupWALStore opens a file-based store in WAL journal mode with the given options.
+func setupWALStore(t *testing.T, opts ...Option) *Store {
+	dbPath := filepath.Join(t.TempDir(), "wal.db")
+	store, err := Open("file:"+dbPath+"?_journal_mode=WAL", "test_kv_wal", opts...)
+	if err != nil {
+		t.Fatalf("Failed to open WAL store at %q: %v", dbPath, err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+	})
+	return store
+}
+
+// TestCheckpoint tests manual WAL checkpoints.
+func TestCheckpoint(t *testing.T) {
+	store := setupWALStore(t)
+
+	for i := 0; i < 50; i++ {
+		if err := store.Set("key", "value", 0); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	stats, err := store.DiskStats()
+	if err != nil {
+		t.Fatalf("DiskStats failed: %v", err)
+	}
+	if stats.WALSize == 0 {
+		t.Fatalf("WAL file should not be empty after writes")
+	}
+
+	result, err := store.Checkpoint(CheckpointTruncate)
+	if err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	if result.Busy || result.LogFrames != 0 {
+		t.Errorf("TRUNCATE checkpoint returned unexpected result: %+v", result)
+	}
+
+	info, err := os.Stat(store.filePath() + "-wal")
+	if err != nil {
+		t.Fatalf("Failed to stat WAL file: %v", err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("WAL file should be truncated, got %d bytes", info.Size())
+	}
+
+	if _, err = store.Checkpoint("BOGUS"); err == nil {
+		t.Errorf("Checkpoint with an invalid mode should fail")
+	}
+}
+
+// TestAutoCheckpoint tests that the background routine truncates the WAL.
+func TestAutoCheckpoint(t *testing.T) {
+	store := setupWALStore(t, WithAutoCheckpoint(20*time.Millisecond, 1))
+
+	if err := store.Set("key", "value", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		stats, err := store.DiskStats()
+		if err != nil {
+			t.Fatalf("DiskStats failed: %v", err)
+		}
+		if stats.WALSize == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("WAL was not truncated by the auto checkpoint routine")
+}
@@ -1,13 +1,17 @@
 package mkvstore
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"time"
 )
 
-// RunCleanup starts a background goroutine to periodically delete expired keys.
-// Call this after opening the store. The routine stops when Store.Close() is called.
+// RunCleanup schedules the periodic deletion of expired keys as the "cleanup"
+// task of the maintenance scheduler (see MaintenanceStatus), replacing the
+// interval of a cleanup already scheduled. Call this after opening the store.
+// Cleanup stops when Store.Close() is called, which also interrupts a sweep in
+// progress. A sweep running longer than interval is aborted and retried on the
+// next run.
 // interval is the frequency of the cleanup runs.
 func (s *Store) RunCleanup(interval time.Duration) {
 	if s.db == nil {
@@ -21,31 +25,87 @@ func (s *Store) RunCleanup(interval time.Duration) {
 		return
 	}
 
-	ticker := time.NewTicker(interval)
-	go func() {
-		defer ticker.Stop()
-		fmt.Printf("mkvstore: starting background cleanup for table %q every %s\n", s.table, interval)
-
-		// Dynamically build the SQL statement for cleanup
-		deleteExpiredSQL := fmt.Sprintf(`DELETE FROM %s WHERE expires_at IS NOT NULL AND expires_at < ?;`, s.quoteTable())
-
-		for {
-			select {
-			case <-s.ctx.Done():
-				fmt.Printf("mkvstore: background cleanup for table %q stopped\n", s.table)
-				return // Context cancelled, stop the goroutine
-			case <-ticker.C:
-				now := time.Now().Unix()
-				result, err := s.db.Exec(deleteExpiredSQL, now)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "mkvstore: background cleanup error for table %q: %v\n", s.table, err)
-					continue // Continue with the next tick
-				}
-				rowsAffected, _ := result.RowsAffected()
-				if rowsAffected > 0 {
-					fmt.Printf("mkvstore: background cleanup deleted %d expired keys from table %q\n", rowsAffected, s.table)
-				}
-			}
-		}
-	}()
+	err := s.schedule(MaintenanceTask{Name: "cleanup", Interval: interval, Run: s.runCleanup})
+	if err != nil {
+		fmt.Printf("mkvstore: cleanup not started: %v\n", err)
+		return
+	}
+	fmt.Printf("mkvstore: starting background cleanup for table %q every %s\n", s.table, interval)
+	s.cleanup.update(func(st *CleanupStatus) { st.Running, st.Interval = true, interval })
+	context.AfterFunc(s.ctx, func() {
+		s.cleanup.update(func(st *CleanupStatus) { st.Running = false })
+	})
+}
+
+// runCleanup is the run function of the cleanup maintenance task.
+func (s *Store) runCleanup(ctx context.Context) error {
+	start := time.Now()
+	rowsAffected, err := s.sweepExpired(ctx)
+	if s.ctx.Err() != nil {
+		return nil // Closed mid-sweep
+	}
+	s.emit(CleanupRunEvent{Table: s.table, Deleted: rowsAffected, Duration: time.Since(start), Err: err})
+	if err != nil {
+		s.cleanup.update(func(st *CleanupStatus) {
+			st.LastRun, st.LastDeleted, st.LastError = time.Now(), rowsAffected, err.Error()
+		})
+		return err
+	}
+	s.cleanup.update(func(st *CleanupStatus) { st.LastRun, st.LastDeleted, st.LastError = time.Now(), rowsAffected, "" })
+	if rowsAffected > 0 {
+		fmt.Printf("mkvstore: background cleanup deleted %d expired keys from table %q\n", rowsAffected, s.table)
+	}
+	return nil
+}
+
+// sweepExpired deletes expired keys and hash fields, and hashes left without
+// fields. The statements run under ctx, so cancelling it interrupts a long
+// sweep. It returns the number of expired keys deleted.
+func (s *Store) sweepExpired(ctx context.Context) (int64, error) {
+	now := s.now().Unix()
+
+	// Dynamically build the SQL statement for cleanup
+	expired, cutoff := s.expiredSQL(now)
+	if s.opts.pacer != nil {
+		return s.sweepExpiredThrottled(ctx, expired, cutoff)
+	}
+	deleteExpiredSQL := fmt.Sprintf(`DELETE FROM %s WHERE %s;`, s.quoteTable(), expired)
+	result, err := s.exec(ctx, deleteExpiredSQL, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+
+	// Expired hash fields go too, and with them hashes left without fields
+	deleteExpiredFieldsSQL := fmt.Sprintf(`DELETE FROM %s WHERE %s;`, s.quoteHashTable(), expired)
+	if _, err := s.exec(ctx, deleteExpiredFieldsSQL, cutoff); err != nil {
+		return rowsAffected, fmt.Errorf("hash fields: %w", err)
+	}
+	deleteEmptyHashesSQL := fmt.Sprintf(`
+	DELETE FROM %s WHERE type = 'hash' AND NOT EXISTS (SELECT 1 FROM %s h WHERE h.key = %s.key);`,
+		s.quoteTable(), s.quoteHashTable(), s.quoteTable())
+	if _, err := s.exec(ctx, deleteEmptyHashesSQL); err != nil {
+		return rowsAffected, fmt.Errorf("hashes: %w", err)
+	}
+	return rowsAffected, nil
+}
+
+// sweepExpiredThrottled is sweepExpired paced by the deletion throttle (see
+// WithDeletionThrottle).
+func (s *Store) sweepExpiredThrottled(ctx context.Context, expired string, cutoff int64) (int64, error) {
+	keys, err := s.deleteThrottled(ctx, s.quoteTable(), valueSizeSQL, expired, cutoff)
+	rowsAffected := int64(len(keys))
+	if err != nil {
+		return rowsAffected, err
+	}
+	if _, err := s.deleteThrottled(ctx, s.quoteHashTable(), valueSizeSQL, expired, cutoff); err != nil {
+		return rowsAffected, fmt.Errorf("hash fields: %w", err)
+	}
+	deleteEmptyHashesSQL := fmt.Sprintf(`
+	DELETE FROM %s WHERE type = 'hash' AND NOT EXISTS (SELECT 1 FROM %s h WHERE h.key = %s.key);`,
+		s.quoteTable(), s.quoteHashTable(), s.quoteTable())
+	if _, err := s.exec(ctx, deleteEmptyHashesSQL); err != nil {
+		return rowsAffected, fmt.Errorf("hashes: %w", err)
+	}
+	return rowsAffected, nil
 }
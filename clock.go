@@ -0,0 +1,22 @@
+package mkvstore
+
+import "time"
+
+// WithClock makes the store read the current time from now when setting and
+// checking expirations and timestamps, e.g. to expire keys in tests without
+// sleeping. Latency measurements always use the wall clock. Note that
+// timestamps are written to the database, so other processes sharing the file
+// see times from this clock.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.clock = now
+	}
+}
+
+// now returns the current time from the store's clock (see WithClock).
+func (s *Store) now() time.Time {
+	if s.opts.clock != nil {
+		return s.opts.clock()
+	}
+	return time.Now()
+}
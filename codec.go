@@ -0,0 +1,61 @@
+package mkvstore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec serializes Go values to and from the bytes stored in the value column.
+// Implementations must be safe for concurrent use.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec encodes values as JSON. It is the default codec: human-readable,
+// usable from json_extract in SQL, and compatible across languages.
+type JSONCodec struct{}
+
+// Marshal implements Codec.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+// Unmarshal implements Codec.
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// GobCodec encodes values with encoding/gob. It round-trips Go types exactly
+// but is only readable from Go, and every value carries its type description.
+type GobCodec struct{}
+
+// Marshal implements Codec.
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal implements Codec.
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// MsgpackCodec encodes values as MessagePack, a compact binary format that
+// is typically smaller and faster than JSON while staying cross-language.
+type MsgpackCodec struct{}
+
+// Marshal implements Codec.
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) { return msgpack.Marshal(v) }
+
+// Unmarshal implements Codec.
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error { return msgpack.Unmarshal(data, v) }
+
+// WithCodec sets the codec used by SetAny and GetAny. Defaults to JSONCodec.
+func WithCodec(c Codec) Option {
+	return func(o *options) {
+		o.codec = c
+	}
+}
@@ -0,0 +1,117 @@
+package mkvstore
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CodecStats summarizes the work of one compressor (see WithCompression) or
+// pipeline transformer (see WithTransformers) since the store was opened, to
+// tell whether it is worth its CPU cost on the hardware at hand.
+type CodecStats struct {
+	Name string // Transformer name; "compress:<id>" for WithCompression compressors
+
+	Encodes      int64         // Values encoded on write
+	EncodeErrors int64         // Encodes that failed, failing the write
+	EncodeTime   time.Duration // Total time spent encoding
+	BytesIn      int64         // Bytes before encoding
+	BytesOut     int64         // Bytes after encoding, as stored
+	Skipped      int64         // Compressed values stored as is because they did not shrink
+
+	Decodes      int64         // Values decoded on read
+	DecodeErrors int64         // Decodes that failed, e.g. on corrupt or tampered data
+	DecodeTime   time.Duration // Total time spent decoding
+}
+
+// BytesSaved returns how many bytes encoding saved in total: negative for
+// transformers that add overhead, such as encryption or checksums.
+func (c CodecStats) BytesSaved() int64 {
+	return c.BytesIn - c.BytesOut
+}
+
+// codecStats collects CodecStats by codec name.
+type codecStats struct {
+	mu    sync.Mutex
+	stats map[string]*CodecStats
+}
+
+// compressorName returns the codec name under which compressor id is counted,
+// the same as its pipeline stage (see CompressTransformer).
+func compressorName(id byte) string {
+	return "compress:" + strconv.Itoa(int(id))
+}
+
+// get returns the stats of name, creating them. c.mu must be held.
+func (c *codecStats) get(name string) *CodecStats {
+	st, ok := c.stats[name]
+	if !ok {
+		st = &CodecStats{Name: name}
+		c.stats[name] = st
+	}
+	return st
+}
+
+// encoded records an encode of in bytes into out bytes by name, or its failure.
+func (c *codecStats) encoded(name string, start time.Time, in, out int, err error) {
+	if c == nil {
+		return
+	}
+	d := time.Since(start)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.get(name)
+	st.Encodes++
+	st.EncodeTime += d
+	if err != nil {
+		st.EncodeErrors++
+		return
+	}
+	st.BytesIn += int64(in)
+	st.BytesOut += int64(out)
+}
+
+// skipped records that a compression by name, already recorded as an encode
+// of size bytes into size bytes, was discarded because it did not shrink.
+func (c *codecStats) skipped(name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(name).Skipped++
+}
+
+// decoded records a decode by name, or its failure.
+func (c *codecStats) decoded(name string, start time.Time, err error) {
+	if c == nil {
+		return
+	}
+	d := time.Since(start)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.get(name)
+	st.Decodes++
+	st.DecodeTime += d
+	if err != nil {
+		st.DecodeErrors++
+	}
+}
+
+// CodecStats returns the statistics of every compressor and transformer used
+// by this store since it was opened, sorted by name.
+func (s *Store) CodecStats() []CodecStats {
+	c := s.codecs
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := make([]CodecStats, 0, len(c.stats))
+	for _, st := range c.stats {
+		stats = append(stats, *st)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
@@ -0,0 +1,37 @@
+package mkvstore
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestCodecStats tests the statistics of a compressor and a transformer,
+// including skipped compressions and decode errors.
+func TestCodecStats(t *testing.T) {
+	aesGCM, err := NewAESGCMTransformer(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("NewAESGCMTransformer failed: %v", err)
+	}
+	store := setupWALStore(t, WithCompression(CompressionGzip, 1), WithTransformers(aesGCM))
+
+	store.Set("big", strings.Repeat("telemetry ", 100), 0)
+	store.Set("tiny", "x", 0) // Grows when gzipped
+	store.Get("big")
+	store.db.Exec(`UPDATE "` + store.table + `" SET value = x'00' WHERE key = 'tiny';`)
+	if _, err := store.Get("tiny"); err == nil {
+		t.Fatal("Expected tampered value to fail to decode")
+	}
+
+	stats := store.CodecStats()
+	if len(stats) != 2 || stats[0].Name != "aes-gcm" || stats[1].Name != "compress:1" {
+		t.Fatalf("Expected aes-gcm and compress:1 stats, got %+v", stats)
+	}
+	aes, gzip := stats[0], stats[1]
+	if gzip.Encodes != 2 || gzip.Skipped != 1 || gzip.Decodes != 1 || gzip.BytesSaved() <= 0 {
+		t.Errorf("Unexpected gzip stats %+v", gzip)
+	}
+	if aes.Encodes != 2 || aes.Decodes != 2 || aes.DecodeErrors != 1 || aes.BytesSaved() >= 0 {
+		t.Errorf("Unexpected aes-gcm stats %+v", aes)
+	}
+}
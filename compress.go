@@ -0,0 +1,174 @@
+package mkvstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Compressor compresses and decompresses stored values.
+// Implementations must be safe for concurrent use.
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+const (
+	// CompressionNone marks values stored uncompressed. It cannot be registered.
+	CompressionNone byte = 0
+	// CompressionGzip is the ID of the built-in gzip compressor.
+	CompressionGzip byte = 1
+)
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[byte]Compressor{
+		CompressionGzip: gzipCompressor{},
+	}
+)
+
+// RegisterCompressor makes a compressor available under id, for example to add
+// zstd, snappy or a device-specific codec. The id is stored with every value
+// compressed by it, so it must never be reused for a different format. IDs
+// below 16 are reserved for compressors built into this package.
+// RegisterCompressor panics if id is CompressionNone, c is nil, or id is
+// already registered; call it from an init function.
+func RegisterCompressor(id byte, c Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+
+	if id == CompressionNone {
+		panic("mkvstore: RegisterCompressor with reserved id 0")
+	}
+	if c == nil {
+		panic("mkvstore: RegisterCompressor compressor is nil")
+	}
+	if _, dup := compressors[id]; dup {
+		panic(fmt.Sprintf("mkvstore: RegisterCompressor called twice for id %d", id))
+	}
+	compressors[id] = c
+}
+
+// lookupCompressor returns the compressor registered under id.
+func lookupCompressor(id byte) (Compressor, error) {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+
+	c, ok := compressors[id]
+	if !ok {
+		return nil, fmt.Errorf("no compressor registered for id %d", id)
+	}
+	return c, nil
+}
+
+// WithCompression compresses values of at least minSize bytes with the
+// compressor registered under id before storing them. Values that do not
+// shrink are stored uncompressed. Reads decompress transparently using the
+// compressor ID recorded on each row, so stores can switch compressors
+// without rewriting existing data. SizeOf, Usage and other size reports
+// return stored (compressed) sizes.
+func WithCompression(id byte, minSize int) Option {
+	return func(o *options) {
+		o.compression = id
+		o.compressionMinSize = minSize
+	}
+}
+
+// encodedValue is a value in the form written to the table.
+type encodedValue struct {
+	data       interface{}    // string for plain text values, []byte for binary ones or once compressed or transformed
+	codec      byte           // Compressor ID applied by WithCompression
+	transforms sql.NullString // Transformer names applied by the pipeline (see WithTransformers)
+}
+
+// encodeValue prepares the value of key for storage: it is compressed first
+// (see WithCompression), then passed through the pipeline configured for key.
+func (s *Store) encodeValue(key, value string) (encodedValue, error) {
+	enc := encodedValue{data: value}
+	data := []byte(value)
+	if !utf8.ValidString(value) {
+		enc.data = data // Stored as a BLOB so SQL never sees invalid text
+	}
+
+	if id := s.opts.compression; id != CompressionNone && len(value) >= s.opts.compressionMinSize {
+		c, err := lookupCompressor(id)
+		if err != nil {
+			return encodedValue{}, err
+		}
+		start := time.Now()
+		compressed, err := c.Compress(data)
+		if err != nil {
+			s.codecs.encoded(compressorName(id), start, len(data), 0, err)
+			return encodedValue{}, fmt.Errorf("failed to compress value with compressor %d: %w", id, err)
+		}
+		if len(compressed) < len(data) { // Otherwise not worth it
+			s.codecs.encoded(compressorName(id), start, len(data), len(compressed), nil)
+			data, enc.data, enc.codec = compressed, compressed, id
+		} else {
+			s.codecs.encoded(compressorName(id), start, len(data), len(data), nil)
+			s.codecs.skipped(compressorName(id))
+		}
+	}
+
+	if len(s.pipelineFor(key)) > 0 {
+		transformed, transforms, err := s.applyPipeline(key, data)
+		if err != nil {
+			return encodedValue{}, err
+		}
+		enc.data, enc.transforms = transformed, transforms
+	}
+	return enc, nil
+}
+
+// decodeValue reverses encodeValue for a value read from the table.
+func (s *Store) decodeValue(stored []byte, codec byte, transforms sql.NullString) (string, error) {
+	stored, err := s.reversePipeline(stored, transforms)
+	if err != nil {
+		return "", err
+	}
+	if codec == CompressionNone {
+		return string(stored), nil
+	}
+	c, err := lookupCompressor(codec)
+	if err != nil {
+		return "", err
+	}
+	start := time.Now()
+	data, err := c.Decompress(stored)
+	s.codecs.decoded(compressorName(codec), start, err)
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress value with compressor %d: %w", codec, err)
+	}
+	return string(data), nil
+}
+
+// gzipCompressor is the built-in compressor registered as CompressionGzip.
+type gzipCompressor struct{}
+
+// Compress implements Compressor.
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress implements Compressor.
+func (gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
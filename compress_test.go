@@ -0,0 +1,98 @@
+package mkvstore
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// reverseCompressor is a toy compressor used to exercise the registry.
+type reverseCompressor struct{}
+
+func (reverseCompressor) Compress(data []byte) ([]byte, error) {
+	out := bytes.Clone(data[:len(data)/2]) // "Compresses" by keeping half and reversing it
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+func (reverseCompressor) Decompress(data []byte) ([]byte, error) {
+	return nil, fmt.Errorf("lossy")
+}
+
+func init() {
+	RegisterCompressor(200, reverseCompressor{})
+}
+
+// TestCompression tests transparent compression and the per-row codec ID.
+func TestCompression(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "compress.db")
+	store, err := Open(dbPath, "test_kv_gzip", WithCompression(CompressionGzip, 64))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	big := strings.Repeat("telemetry ", 100)
+	store.Set("big", big, 0)
+	store.Set("small", "tiny", 0)
+
+	if value, err := store.Get("big"); err != nil || value != big {
+		t.Fatalf("Get of compressed value failed: %v", err)
+	}
+	size, _ := store.SizeOf("big")
+	if size >= int64(len(big)) {
+		t.Errorf("Stored size %d should be smaller than the raw size %d", size, len(big))
+	}
+
+	var codec int
+	store.db.QueryRow(`SELECT codec FROM "test_kv_gzip" WHERE key = 'small';`).Scan(&codec)
+	if codec != int(CompressionNone) {
+		t.Errorf("Values below the minimum size should be stored uncompressed, got codec %d", codec)
+	}
+
+	// A store without compression still reads compressed rows
+	plain, err := Open(dbPath, "test_kv_gzip")
+	if err != nil {
+		t.Fatalf("Open without compression failed: %v", err)
+	}
+	defer plain.Close()
+	seen := 0
+	plain.ForEach(ScanOptions{}, func(key, value string) error {
+		if key == "big" && value == big {
+			seen++
+		}
+		return nil
+	})
+	if seen != 1 {
+		t.Errorf("ForEach should return the decompressed value")
+	}
+
+	// Rows written with a registered third-party compressor carry its ID
+	custom, err := Open(dbPath, "test_kv_gzip", WithCompression(200, 0))
+	if err != nil {
+		t.Fatalf("Open with custom compressor failed: %v", err)
+	}
+	defer custom.Close()
+	custom.Set("custom", "abcdef", 0)
+	if _, err := custom.Get("custom"); err == nil || !strings.Contains(err.Error(), "lossy") {
+		t.Errorf("Get should use the registered compressor to decode, got %v", err)
+	}
+}
+
+// TestRegisterCompressorPanics tests registry misuse.
+func TestRegisterCompressorPanics(t *testing.T) {
+	for _, id := range []byte{CompressionNone, CompressionGzip} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterCompressor(%d) should panic", id)
+				}
+			}()
+			RegisterCompressor(id, reverseCompressor{})
+		}()
+	}
+}
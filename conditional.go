@@ -0,0 +1,133 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// firstVersionSQL returns the SQL expression of the version of a key newly
+// created in table: one above every version a deleted key of the table had,
+// as recorded by triggers in the schema table, so a key deleted and created
+// again never repeats a version a reader may still hold.
+func firstVersionSQL(table string) string {
+	return fmt.Sprintf(`(COALESCE((SELECT version_floor FROM %s WHERE table_name = %s), 0) + 1)`, quoteIdent(schemaTable), sqlLiteral(table))
+}
+
+// GetIfChanged returns the string value and version of key if its version
+// differs from version, so pollers can cheaply ask whether a key changed
+// since they last read it, like an HTTP conditional GET with an ETag. The
+// value is only read from the database when it changed. If it did not,
+// changed is false, value is empty and newVersion equals version. Pass a
+// version of 0 to always read the value; versions grow with every write and
+// never repeat for a key, even once it is deleted and created again (see
+// Meta.Version). Aliases are followed, and the version is the target's.
+// Returns ErrKeyNotFound if the key does not exist or is
+// expired, and ErrWrongType if it is not a string.
+func (s *Store) GetIfChanged(key string, version int64) (value string, newVersion int64, changed bool, err error) {
+	defer s.observe("getifchanged", time.Now())
+
+	key = s.canonicalKey(key)
+
+	if err := s.Sync(); err != nil {
+		return "", 0, false, err
+	}
+
+	getSQL := fmt.Sprintf(`
+	SELECT CASE WHEN version != ?2 OR type IN ('alias', 'archived') THEN value END, codec, transforms, type, expires_at, version
+	FROM %s WHERE key = ?1;`, s.quoteTable())
+
+	for range maxAliasDepth + 1 {
+		var stored []byte
+		var codec byte
+		var transforms sql.NullString
+		var keyType string
+		var expiresAt sql.NullInt64
+		err := s.queryRow(getSQL, key, version).Scan(&stored, &codec, &transforms, &keyType, &expiresAt, &newVersion)
+		if err == sql.ErrNoRows {
+			return "", 0, false, ErrKeyNotFound
+		}
+		if err != nil {
+			return "", 0, false, fmt.Errorf("failed to get key %q from table %q: %w", key, s.table, err)
+		}
+		if expiresAt.Valid && s.now().Unix() > expiresAt.Int64 {
+			go s.purgeExpired(key) // Delete asynchronously, ignore error here
+			return "", 0, false, ErrKeyNotFound
+		}
+
+		switch keyType {
+		case "alias":
+			key = string(stored)
+			continue
+		case "string", "archived":
+		default:
+			return "", 0, false, ErrWrongType
+		}
+		if newVersion == version {
+			return "", version, false, nil
+		}
+		if keyType == "archived" {
+			value, err := s.readArchived(s.q(), string(stored), key)
+			if err == nil {
+				go s.restoreArchived(key) // Restore asynchronously, ignore error here
+			}
+			return value, newVersion, err == nil, err
+		}
+		value, err := s.decodeValue(stored, codec, transforms)
+		if err != nil {
+			return "", 0, false, fmt.Errorf("failed to get key %q from table %q: %w", key, s.table, err)
+		}
+		return value, newVersion, true, nil
+	}
+	return "", 0, false, ErrAliasCycle
+}
+
+// Entry is a key with its string value and version, as seen by WaitForChange.
+type Entry struct {
+	Key     string
+	Value   string
+	Version int64 // 0 if the key does not exist
+}
+
+// WaitForChange blocks until the version of key differs from sinceVersion and
+// returns the key as it is then, turning polling loops into efficient waits.
+// Deleting or expiring the key counts as a change to version 0, so passing a
+// sinceVersion of 0 waits for the key to exist. A key created again never
+// repeats a version, so a waiter that missed the deletion still wakes. Writes through this Store wake
+// the wait at once; changes made by other processes sharing the file are
+// noticed within a second. Returns ctx.Err() once ctx is done, and
+// ErrWrongType if the key holds another type.
+func (s *Store) WaitForChange(ctx context.Context, key string, sinceVersion int64) (Entry, error) {
+	key = s.canonicalKey(key)
+
+	// Subscribe before the first attempt so a write in between is not missed
+	wake, unsubscribe := s.notify.subscribe(key)
+	defer unsubscribe()
+
+	poll := time.NewTicker(blockingPollInterval)
+	defer poll.Stop()
+
+	for {
+		value, version, changed, err := s.GetIfChanged(key, sinceVersion)
+		switch {
+		case err == ErrKeyNotFound:
+			if sinceVersion != 0 {
+				return Entry{Key: key}, nil
+			}
+		case err != nil:
+			return Entry{}, err
+		case changed:
+			return Entry{Key: key, Value: value, Version: version}, nil
+		}
+
+		select {
+		case <-wake:
+		case <-poll.C:
+		case <-s.ctx.Done():
+			return Entry{}, errStoreClosed
+		case <-ctx.Done():
+			return Entry{}, ctx.Err()
+		}
+	}
+}
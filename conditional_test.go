@@ -0,0 +1,119 @@
+package mkvstore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestGetIfChanged tests version-conditional reads.
+func TestGetIfChanged(t *testing.T) {
+	store, _ := setupFileStore(t)
+	store.Set("k", "v1", 0)
+
+	value, version, changed, err := store.GetIfChanged("k", 0)
+	if err != nil || !changed || value != "v1" || version != 1 {
+		t.Fatalf("GetIfChanged(k, 0) = %q, %d, %t, %v; expected v1, 1, true", value, version, changed, err)
+	}
+	value, version, changed, err = store.GetIfChanged("k", version)
+	if err != nil || changed || value != "" || version != 1 {
+		t.Errorf("GetIfChanged(k, 1) = %q, %d, %t, %v; expected unchanged", value, version, changed, err)
+	}
+
+	store.Set("k", "v2", 0)
+	store.Alias("alias", "k")
+	value, version, changed, err = store.GetIfChanged("alias", 1)
+	if err != nil || !changed || value != "v2" || version != 2 {
+		t.Errorf("GetIfChanged(alias, 1) = %q, %d, %t, %v; expected v2, 2, true", value, version, changed, err)
+	}
+
+	if _, _, _, err := store.GetIfChanged("missing", 0); err != ErrKeyNotFound {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+	store.HSet("h", "f", "v")
+	if _, _, _, err := store.GetIfChanged("h", 0); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+// TestGetIfChangedRecreated tests that a key deleted, expired or renamed over
+// and then written again never repeats a version a reader holds.
+func TestGetIfChangedRecreated(t *testing.T) {
+	now := time.Now()
+	store := setupWALStore(t, WithClock(func() time.Time { return now }))
+
+	store.Set("k", "v1", 0)
+	_, old, _, _ := store.GetIfChanged("k", 0)
+	store.Del("k")
+	store.Set("k", "v2", 0)
+	value, version, changed, err := store.GetIfChanged("k", old)
+	if err != nil || !changed || value != "v2" || version <= old {
+		t.Errorf("GetIfChanged(k, %d) after delete and set = %q, %d, %t, %v; expected v2 at a newer version", old, value, version, changed, err)
+	}
+
+	store.Set("k", "v3", time.Second)
+	_, old, _, _ = store.GetIfChanged("k", 0)
+	now = now.Add(2 * time.Second)
+	if _, err := store.sweepExpired(context.Background()); err != nil {
+		t.Fatalf("sweepExpired failed: %v", err)
+	}
+	if _, err := store.Incr("k"); err != nil {
+		t.Fatalf("Incr failed: %v", err)
+	}
+	value, version, changed, err = store.GetIfChanged("k", old)
+	if err != nil || !changed || value != "1" || version <= old {
+		t.Errorf("GetIfChanged(k, %d) after expiry and incr = %q, %d, %t, %v; expected 1 at a newer version", old, value, version, changed, err)
+	}
+
+	store.Set("src", "v4", 0)
+	_, old, _, _ = store.GetIfChanged("k", 0)
+	if err := store.Rename("src", "k"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	value, version, changed, err = store.GetIfChanged("k", old)
+	if err != nil || !changed || value != "v4" || version <= old {
+		t.Errorf("GetIfChanged(k, %d) after rename = %q, %d, %t, %v; expected v4 at a newer version", old, value, version, changed, err)
+	}
+}
+
+// TestWaitForChange tests that waits end on writes and deletion, and on ctx.
+func TestWaitForChange(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		store.Set("k", "v1", 0)
+	}()
+	entry, err := store.WaitForChange(context.Background(), "k", 0)
+	if err != nil || entry != (Entry{Key: "k", Value: "v1", Version: 1}) {
+		t.Fatalf("WaitForChange(k, 0) = %+v, %v; expected v1 at version 1", entry, err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		store.Del("k")
+	}()
+	entry, err = store.WaitForChange(context.Background(), "k", 1)
+	if err != nil || entry != (Entry{Key: "k"}) {
+		t.Errorf("Expected deletion to end the wait with version 0, got %+v, %v", entry, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := store.WaitForChange(ctx, "k", 0); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// A waiter that missed a delete and re-create is not left waiting on a
+	// reused version
+	store.Set("k", "v2", 0)
+	_, old, _, _ := store.GetIfChanged("k", 0)
+	store.Del("k")
+	store.Set("k", "v3", 0)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	entry, err = store.WaitForChange(ctx, "k", old)
+	if err != nil || entry.Value != "v3" || entry.Version <= old {
+		t.Errorf("WaitForChange(k, %d) after delete and set = %+v, %v; expected v3 at a newer version", old, entry, err)
+	}
+}
@@ -0,0 +1,43 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql/driver"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// connector opens SQLite connections for a Store's pool and runs the
+// per-connection pragmas that cannot be expressed as DSN parameters.
+type connector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+// newConnector returns a connector for dsn that executes pragmas on every new
+// connection and attaches the databases of attached.
+func newConnector(dsn string, pragmas []string, attached *attachments) *connector {
+	drv := &sqlite3.SQLiteDriver{}
+	drv.ConnectHook = func(conn *sqlite3.SQLiteConn) error {
+		for _, pragma := range pragmas {
+			if _, err := conn.Exec(pragma, nil); err != nil {
+				return err
+			}
+		}
+		if attached != nil {
+			return attached.attach(conn)
+		}
+		return nil
+	}
+	return &connector{dsn: dsn, driver: drv}
+}
+
+// Connect implements driver.Connector.
+func (c *connector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+// Driver implements driver.Connector.
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
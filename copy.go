@@ -0,0 +1,71 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// Copy copies the value, type and TTL of src to dst in one transaction, like
+// Redis COPY, e.g. to keep the previous value of a key before modifying it.
+// Hash fields and list elements are copied too. If dst exists it is only
+// replaced when replace is true; otherwise Copy returns false. A replaced dst
+// keeps counting its versions.
+// Returns ErrKeyNotFound if src does not exist or is expired.
+func (s *Store) Copy(src, dst string, replace bool) (bool, error) {
+	src, dst = s.canonicalKey(src), s.canonicalKey(dst)
+	if err := checkReserved(src, dst); err != nil {
+		return false, err
+	}
+	if src == dst {
+		return false, fmt.Errorf("failed to copy key %q in table %q: source and destination are the same", src, s.table)
+	}
+	if err := s.Sync(); err != nil {
+		return false, err
+	}
+	defer s.observe("copy", time.Now())
+
+	now := s.now().Unix()
+	var expiresAt sql.NullInt64
+	copied := false
+	err := s.update(func(tx *sql.Tx) error {
+		checkSQL := fmt.Sprintf(`SELECT expires_at FROM %s WHERE key = ?;`, s.quoteTable())
+		err := tx.QueryRowContext(s.ctx, checkSQL, src).Scan(&expiresAt)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to copy key %q in table %q: %w", src, s.table, err)
+		}
+		if err == sql.ErrNoRows || (expiresAt.Valid && now > expiresAt.Int64) {
+			return fmt.Errorf("failed to copy key %q in table %q: %w", src, s.table, ErrKeyNotFound)
+		}
+
+		if !replace {
+			var exists int
+			existsSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE key = ? AND (expires_at IS NULL OR expires_at >= ?);`, s.quoteTable())
+			if err := tx.QueryRowContext(s.ctx, existsSQL, dst, now).Scan(&exists); err != nil {
+				return fmt.Errorf("failed to copy key %q to %q in table %q: %w", src, dst, s.table, err)
+			}
+			if exists > 0 {
+				return nil
+			}
+		}
+
+		// An empty suffix turns the source key into dst
+		source := `m.key = ?1 AND (m.expires_at IS NULL OR m.expires_at >= ?2)`
+		keys, err := s.copyKeys(tx, source, []interface{}{src, now, dst, utf8.RuneCountInString(src) + 1})
+		if err != nil {
+			return fmt.Errorf("failed to copy key %q to %q in table %q: %w", src, dst, s.table, err)
+		}
+		copied = len(keys) > 0
+		return nil
+	})
+	if err != nil || !copied {
+		return false, err
+	}
+
+	if expiresAt.Valid {
+		s.trackExpiry(dst, expiresAt.Int64)
+	}
+	s.notify.publish(dst, "copy_to")
+	return true, nil
+}
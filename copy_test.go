@@ -0,0 +1,59 @@
+package mkvstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestCopy tests copying strings and hashes with their TTL, with and without
+// replacing the destination.
+func TestCopy(t *testing.T) {
+	store := setupStore(t)
+
+	store.Set("src", "v1", time.Minute)
+	ok, err := store.Copy("src", "dst", false)
+	if err != nil || !ok {
+		t.Fatalf("Copy = %v, %v", ok, err)
+	}
+	if v, _ := store.Get("dst"); v != "v1" {
+		t.Errorf("Expected dst to be v1, got %q", v)
+	}
+	if ttl, _ := store.TTL("dst"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("Expected dst to keep the TTL of src, got %v", ttl)
+	}
+
+	// The copy is independent of the source
+	store.Set("src", "v2", 0)
+	if ok, err := store.Copy("src", "dst", false); err != nil || ok {
+		t.Errorf("Copy over an existing key without replace = %v, %v", ok, err)
+	}
+	if v, _ := store.Get("dst"); v != "v1" {
+		t.Errorf("Expected dst to stay v1, got %q", v)
+	}
+	if ok, err := store.Copy("src", "dst", true); err != nil || !ok {
+		t.Errorf("Copy with replace = %v, %v", ok, err)
+	}
+	if v, _ := store.Get("dst"); v != "v2" {
+		t.Errorf("Expected dst to be v2, got %q", v)
+	}
+	if ttl, _ := store.TTL("dst"); ttl >= 0 {
+		t.Errorf("Expected dst to lose its TTL, got %v", ttl)
+	}
+
+	store.HSet("h", "f", "1")
+	if ok, err := store.Copy("h", "dst", true); err != nil || !ok {
+		t.Fatalf("Copy of a hash = %v, %v", ok, err)
+	}
+	store.HSet("h", "g", "2")
+	if all, _ := store.HGetAll("dst"); len(all) != 1 || all["f"] != "1" {
+		t.Errorf("Expected the copied hash to hold f=1, got %v", all)
+	}
+
+	if _, err := store.Copy("missing", "dst", true); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if _, err := store.Copy("src", "src", true); err == nil {
+		t.Error("Expected copying a key onto itself to fail")
+	}
+}
@@ -0,0 +1,128 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// ErrOverflow is returned when incrementing a counter would overflow a
+// 64-bit signed integer.
+var ErrOverflow = errors.New("increment or decrement would overflow")
+
+// Incr increments the integer stored at key by one and returns the new value,
+// like IncrBy with a delta of 1.
+func (s *Store) Incr(key string) (int64, error) {
+	return s.IncrBy(key, 1)
+}
+
+// Decr decrements the integer stored at key by one and returns the new value,
+// like IncrBy with a delta of -1.
+func (s *Store) Decr(key string) (int64, error) {
+	return s.IncrBy(key, -1)
+}
+
+// IncrBy adds delta to the integer stored at key as a decimal string and
+// returns the new value, in a single statement, so processes sharing the
+// database never lose an update. A missing or expired key is created with
+// the value delta and the prefix default TTL (see WithPrefixTTL), or none; an
+// existing key keeps its TTL. Counters are stored as plain text, bypassing
+// compression and transformers: an integer that Set stored compressed or
+// transformed is rewritten as plain text by the first increment. Aliases are
+// not followed.
+// Returns ErrWrongType if key holds another type or a value that is not an
+// integer, and ErrOverflow if the result does not fit in an int64.
+func (s *Store) IncrBy(key string, delta int64) (int64, error) {
+	defer s.observe("incrby", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return 0, err
+	}
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+
+	// An expired row counts as missing. Otherwise the upsert only applies to
+	// plain integers with room for delta, and returns no row for the rest.
+	expired := `expires_at IS NOT NULL AND expires_at < ?2`
+	incrSQL := fmt.Sprintf(`
+	INSERT INTO %s (key, value, type, expires_at, version, created_at, updated_at) VALUES (?1, CAST(?3 AS TEXT), 'string', ?6, %s, ?2, ?2)
+	ON CONFLICT(key) DO UPDATE SET
+		value = CASE WHEN %s THEN CAST(?3 AS TEXT) ELSE CAST(CAST(value AS INTEGER) + ?3 AS TEXT) END,
+		expires_at = CASE WHEN %s THEN ?6 ELSE expires_at END,
+		created_at = CASE WHEN %s THEN ?2 ELSE created_at END,
+		type = 'string', codec = 0, transforms = NULL, meta = CASE WHEN %s THEN NULL ELSE meta END,
+		version = version + 1, updated_at = ?2
+	WHERE %s OR (type = 'string' AND codec = 0 AND transforms IS NULL
+		AND typeof(value) = 'text' AND CAST(CAST(value AS INTEGER) AS TEXT) = value
+		AND CASE WHEN ?3 >= 0 THEN CAST(value AS INTEGER) <= ?4 - ?3 ELSE CAST(value AS INTEGER) >= ?5 - ?3 END)
+	RETURNING CAST(value AS INTEGER), expires_at;`, s.quoteTable(), firstVersionSQL(s.table), expired, expired, expired, expired, expired)
+
+	for range 3 {
+		var value int64
+		var expiresAt sql.NullInt64
+		now := s.now().Unix()
+		created := s.defaultExpiresAt(key, now)
+		err := s.update(func(tx *sql.Tx) error {
+			return tx.QueryRowContext(context.Background(), incrSQL, key, now, delta, int64(math.MaxInt64), int64(math.MinInt64), created).Scan(&value, &expiresAt)
+		})
+		if err == nil {
+			if at, ok := created.(int64); ok && expiresAt.Valid && expiresAt.Int64 == at {
+				s.trackExpiry(key, at)
+			}
+			s.notify.publish(key, "incrby")
+			return value, nil
+		}
+		if err != sql.ErrNoRows {
+			return 0, fmt.Errorf("failed to increment key %q in table %q: %w", key, s.table, err)
+		}
+
+		// Tell why the key was left alone
+		var keyType string
+		var stored []byte
+		var codec byte
+		var transforms sql.NullString
+		whySQL := fmt.Sprintf(`SELECT type, value, codec, transforms FROM %s WHERE key = ?;`, s.quoteTable())
+		if err := s.queryRow(whySQL, key).Scan(&keyType, &stored, &codec, &transforms); err != nil {
+			return 0, fmt.Errorf("failed to increment key %q in table %q: %w", key, s.table, err)
+		}
+		if keyType == "archived" {
+			// Bring the counter back from the archive and try again
+			if err := s.restoreArchived(key); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if keyType != "string" {
+			return 0, ErrWrongType
+		}
+		if codec == CompressionNone && !transforms.Valid {
+			if _, err := strconv.ParseInt(string(stored), 10, 64); err == nil {
+				return 0, ErrOverflow
+			}
+			return 0, ErrWrongType
+		}
+
+		// Set stored an integer compressed or transformed: store it as plain
+		// text, unless it changed meanwhile, and try again
+		decoded, err := s.decodeValue(stored, codec, transforms)
+		if err != nil {
+			return 0, fmt.Errorf("failed to increment key %q in table %q: %w", key, s.table, err)
+		}
+		if _, err := strconv.ParseInt(decoded, 10, 64); err != nil {
+			return 0, ErrWrongType
+		}
+		plainSQL := fmt.Sprintf(`
+		UPDATE %s SET value = ?, codec = 0, transforms = NULL
+		WHERE key = ? AND type = 'string' AND value = ? AND codec = ? AND transforms IS ?;`, s.quoteTable())
+		if _, err := s.exec(s.ctx, plainSQL, decoded, key, stored, codec, transforms); err != nil {
+			return 0, fmt.Errorf("failed to increment key %q in table %q: %w", key, s.table, err)
+		}
+	}
+	return 0, ErrWrongType // Still archived or rewritten meanwhile
+}
@@ -0,0 +1,97 @@
+package mkvstore
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestIncrBy tests counters: creation, TTL preservation, type errors and
+// overflow.
+func TestIncrBy(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	if n, err := store.Incr("c"); err != nil || n != 1 {
+		t.Fatalf("Incr of a missing key = %d, %v, expected 1", n, err)
+	}
+	if n, err := store.IncrBy("c", 41); err != nil || n != 42 {
+		t.Errorf("IncrBy = %d, %v, expected 42", n, err)
+	}
+	if n, err := store.Decr("c"); err != nil || n != 41 {
+		t.Errorf("Decr = %d, %v, expected 41", n, err)
+	}
+	if value, _ := store.Get("c"); value != "41" {
+		t.Errorf("Get = %q, expected 41", value)
+	}
+
+	store.Set("ttl", "5", time.Hour)
+	store.Incr("ttl")
+	if ttl, _ := store.TTL("ttl"); ttl <= 0 {
+		t.Errorf("TTL = %v, expected Incr to keep it", ttl)
+	}
+	store.db.Exec(`UPDATE "test_kv_data_file" SET expires_at = ? WHERE key = 'ttl';`, time.Now().Add(-time.Minute).Unix())
+	if n, err := store.Incr("ttl"); err != nil || n != 1 {
+		t.Errorf("Incr of an expired key = %d, %v, expected 1", n, err)
+	}
+
+	store.Set("text", "abc", 0)
+	if _, err := store.Incr("text"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Incr of text = %v, expected ErrWrongType", err)
+	}
+	store.HSet("h", "f", "1")
+	if _, err := store.Incr("h"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Incr of a hash = %v, expected ErrWrongType", err)
+	}
+	store.Set("max", strconv.FormatInt(math.MaxInt64, 10), 0)
+	if _, err := store.Incr("max"); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Incr past MaxInt64 = %v, expected ErrOverflow", err)
+	}
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 25 {
+				if _, err := store.Incr("shared"); err != nil {
+					t.Errorf("Incr failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if value, _ := store.Get("shared"); value != "100" {
+		t.Errorf("Concurrent Incr calls gave %q, expected 100", value)
+	}
+}
+
+// TestIncrByTransformed tests counters over integers that Set stored through
+// the transformer pipeline.
+func TestIncrByTransformed(t *testing.T) {
+	aesGCM, err := NewAESGCMTransformer(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("NewAESGCMTransformer failed: %v", err)
+	}
+	store := setupWALStore(t, WithTransformers(aesGCM))
+
+	store.Set("c", "5", 0)
+	if n, err := store.Incr("c"); err != nil || n != 6 {
+		t.Fatalf("Incr of a transformed integer = %d, %v, expected 6", n, err)
+	}
+	if value, err := store.Get("c"); err != nil || value != "6" {
+		t.Errorf("Get = %q, %v, expected 6", value, err)
+	}
+
+	store.Set("max", strconv.FormatInt(math.MaxInt64, 10), 0)
+	if _, err := store.Incr("max"); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Incr past MaxInt64 = %v, expected ErrOverflow", err)
+	}
+	store.Set("text", "abc", 0)
+	if _, err := store.Incr("text"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Incr of transformed text = %v, expected ErrWrongType", err)
+	}
+}
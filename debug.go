@@ -0,0 +1,140 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// slowOpHistory is the number of slow operations kept by WithSlowOpLog.
+const slowOpHistory = 64
+
+// SlowOp is an operation that took longer than the WithSlowOpLog threshold.
+type SlowOp struct {
+	Op      string        `json:"op"`
+	Latency time.Duration `json:"latency"`
+	Time    time.Time     `json:"time"`
+}
+
+// WithSlowOpLog keeps the last 64 operations taking longer than threshold,
+// reported by SlowOps and the debug handler.
+func WithSlowOpLog(threshold time.Duration) Option {
+	return func(o *options) {
+		o.slowOpThreshold = threshold
+	}
+}
+
+// slowOpLog is a ring buffer of slow operations.
+type slowOpLog struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	ops       []SlowOp
+	next      int
+}
+
+// record adds the operation to the log if it was slow.
+func (l *slowOpLog) record(op string, d time.Duration) {
+	if d < l.threshold {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry := SlowOp{Op: op, Latency: d, Time: time.Now()}
+	if len(l.ops) < slowOpHistory {
+		l.ops = append(l.ops, entry)
+	} else {
+		l.ops[l.next] = entry
+	}
+	l.next = (l.next + 1) % slowOpHistory
+}
+
+// SlowOps returns the recorded slow operations, oldest first. It returns nil
+// unless the store was opened with WithSlowOpLog.
+func (s *Store) SlowOps() []SlowOp {
+	l := s.slowOps
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.ops) < slowOpHistory {
+		return append([]SlowOp(nil), l.ops...)
+	}
+	return append(append([]SlowOp(nil), l.ops[l.next:]...), l.ops[:l.next]...)
+}
+
+// CleanupStatus describes the background cleanup started by RunCleanup.
+type CleanupStatus struct {
+	Running     bool          `json:"running"`
+	Interval    time.Duration `json:"interval"`
+	LastRun     time.Time     `json:"last_run"`
+	LastDeleted int64         `json:"last_deleted"` // Keys deleted by the last run
+	LastError   string        `json:"last_error,omitempty"`
+}
+
+// cleanupState tracks the background cleanup for CleanupStatus.
+type cleanupState struct {
+	mu     sync.Mutex
+	status CleanupStatus
+}
+
+// update applies fn to the cleanup status under the lock.
+func (c *cleanupState) update(fn func(*CleanupStatus)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fn(&c.status)
+}
+
+// CleanupStatus reports whether background cleanup is running and the
+// outcome of its last run.
+func (s *Store) CleanupStatus() CleanupStatus {
+	s.cleanup.mu.Lock()
+	defer s.cleanup.mu.Unlock()
+	return s.cleanup.status
+}
+
+// debugStats is the document served at /debug/store.
+type debugStats struct {
+	Table   string                  `json:"table"`
+	Path    string                  `json:"path"`
+	Pool    sql.DBStats             `json:"pool"`
+	Cleanup CleanupStatus           `json:"cleanup"`
+	Tasks   []MaintenanceTaskStatus `json:"maintenance,omitempty"`
+	Disk    *DiskStats              `json:"disk,omitempty"`
+	SlowOps []SlowOp                `json:"slow_ops,omitempty"`
+	Latency []LatencyHistogram      `json:"latency,omitempty"`
+	Codecs  []CodecStats            `json:"codecs,omitempty"`
+}
+
+// DebugHandler returns a handler for field debugging, to be mounted by an
+// HTTP server, e.g. behind an SSH tunnel. It serves /debug/store, a JSON
+// page of live connection pool usage, cleanup and maintenance status, disk
+// usage, slow operations (see WithSlowOpLog), latency histograms and codec
+// statistics (see CodecStats). server.DebugHandler adds the net/http/pprof
+// profiles. The handler exposes internals, so never mount it on a publicly
+// reachable listener.
+func (s *Store) DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/store", func(w http.ResponseWriter, r *http.Request) {
+		stats := debugStats{
+			Table:   s.table,
+			Path:    s.path,
+			Pool:    s.db.Stats(),
+			Cleanup: s.CleanupStatus(),
+			Tasks:   s.MaintenanceStatus(),
+			SlowOps: s.SlowOps(),
+			Latency: s.LatencyHistograms(),
+			Codecs:  s.CodecStats(),
+		}
+		if disk, err := s.DiskStats(); err == nil {
+			stats.Disk = &disk
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(stats)
+	})
+	return mux
+}
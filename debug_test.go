@@ -0,0 +1,57 @@
+package mkvstore
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSlowOpLog tests that only operations over the threshold are kept, in a bounded ring.
+func TestSlowOpLog(t *testing.T) {
+	l := &slowOpLog{threshold: time.Millisecond}
+	l.record("fast", time.Microsecond)
+	for i := 0; i < slowOpHistory+5; i++ {
+		l.record("slow", time.Duration(i+1)*time.Millisecond)
+	}
+
+	store := &Store{slowOps: l}
+	ops := store.SlowOps()
+	if len(ops) != slowOpHistory {
+		t.Fatalf("Expected %d slow ops, got %d", slowOpHistory, len(ops))
+	}
+	if ops[0].Latency != 6*time.Millisecond || ops[len(ops)-1].Latency != (slowOpHistory+5)*time.Millisecond {
+		t.Errorf("Expected oldest-first ring contents, got %s .. %s", ops[0].Latency, ops[len(ops)-1].Latency)
+	}
+}
+
+// TestDebugHandler tests the /debug/store page.
+func TestDebugHandler(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "debug.db"), "test_kv_debug", WithSlowOpLog(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+	store.Set("a", "1", 0)
+
+	rec := httptest.NewRecorder()
+	store.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/store", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	var stats debugStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if stats.Table != "test_kv_debug" || len(stats.SlowOps) == 0 || stats.Disk == nil {
+		t.Errorf("Unexpected debug stats %+v", stats)
+	}
+
+	rec = httptest.NewRecorder()
+	store.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected no pprof from the store's handler, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,75 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// EnsureDefaults sets every key of defaults that does not exist, or has
+// expired, to its value and leaves existing keys alone, whatever their type.
+// It replaces racy Exists+Set loops when provisioning settings on first boot.
+// All keys are written in one transaction. Default TTLs by prefix apply as
+// for Set with a ttl of 0 (see WithPrefixTTL). It returns the keys created,
+// in key order.
+func (s *Store) EnsureDefaults(defaults map[string]string) ([]string, error) {
+	defer s.observe("ensuredefaults", time.Now())
+
+	defaults = s.canonicalPairs(defaults)
+
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(defaults))
+	for key := range defaults {
+		keys = append(keys, key)
+	}
+	if err := checkReserved(keys...); err != nil {
+		return nil, err
+	}
+	slices.Sort(keys)
+
+	// An expired key counts as missing and is replaced as if it were new
+	insertSQL := fmt.Sprintf(`
+	INSERT INTO %s (key, value, type, expires_at, version, created_at, updated_at, codec, transforms) VALUES (?1, ?2, 'string', ?3, %s, ?4, ?4, ?5, ?6)
+	ON CONFLICT(key) DO UPDATE SET
+		value = excluded.value, type = 'string', expires_at = excluded.expires_at, version = version + 1,
+		created_at = excluded.created_at, updated_at = excluded.updated_at, codec = excluded.codec, transforms = excluded.transforms
+	WHERE expires_at IS NOT NULL AND expires_at < ?4;`, s.quoteTable(), firstVersionSQL(s.table))
+
+	var created []string
+	var expirations []interface{}
+	err := s.update(func(tx *sql.Tx) error {
+		created, expirations = created[:0], expirations[:0]
+		now := s.now()
+		for _, key := range keys {
+			var expiresAt interface{} // NULL for no expiration
+			if ttl := s.effectiveTTL(key, 0); ttl > 0 {
+				expiresAt = now.Add(ttl).Unix()
+			}
+			enc, err := s.encodeValue(key, defaults[key])
+			if err != nil {
+				return fmt.Errorf("failed to set default for key %q in table %q: %w", key, s.table, err)
+			}
+			result, err := tx.Exec(insertSQL, key, enc.data, expiresAt, now.Unix(), enc.codec, enc.transforms)
+			if err != nil {
+				return fmt.Errorf("failed to set default for key %q in table %q: %w", key, s.table, err)
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				created = append(created, key)
+				expirations = append(expirations, expiresAt)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, key := range created {
+		s.trackExpiry(key, expirations[i])
+		s.notify.publish(key, "set")
+	}
+	return created, nil
+}
@@ -0,0 +1,49 @@
+package mkvstore
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestEnsureDefaults tests that only missing and expired keys are created.
+func TestEnsureDefaults(t *testing.T) {
+	store, _ := setupFileStore(t)
+	store.Set("existing", "custom", 0)
+	store.Set("expired", "old", time.Hour)
+	store.HSet("hash", "f", "v")
+	backdate := fmt.Sprintf(`UPDATE %s SET expires_at = ? WHERE key = 'expired';`, store.quoteTable())
+	if _, err := store.db.Exec(backdate, time.Now().Add(-time.Minute).Unix()); err != nil {
+		t.Fatalf("Failed to backdate key: %v", err)
+	}
+
+	created, err := store.EnsureDefaults(map[string]string{
+		"existing": "default",
+		"expired":  "fresh",
+		"hash":     "default",
+		"new":      "default",
+	})
+	if err != nil {
+		t.Fatalf("EnsureDefaults failed: %v", err)
+	}
+	if !slices.Equal(created, []string{"expired", "new"}) {
+		t.Errorf("Expected expired and new to be created, got %v", created)
+	}
+	if v, _ := store.Get("existing"); v != "custom" {
+		t.Errorf("Expected existing key to be left alone, got %q", v)
+	}
+	if v, _ := store.Get("expired"); v != "fresh" {
+		t.Errorf("Expected expired key to be replaced, got %q", v)
+	}
+	if ttl, _ := store.TTL("expired"); ttl != -1 {
+		t.Errorf("Expected replaced key to have no TTL, got %s", ttl)
+	}
+	if v, _ := store.HGet("hash", "f"); v != "v" {
+		t.Errorf("Expected hash to be left alone, got %q", v)
+	}
+
+	if created, _ := store.EnsureDefaults(map[string]string{"new": "again"}); len(created) != 0 {
+		t.Errorf("Expected a second call to create nothing, got %v", created)
+	}
+}
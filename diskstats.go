@@ -0,0 +1,74 @@
+package mkvstore
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DiskStats describes the on-disk footprint of the database backing a Store.
+// Sizes are in bytes. FileSize and WALSize are 0 for in-memory databases or
+// when the corresponding file does not exist.
+type DiskStats struct {
+	FileSize      int64 // Size of the main database file
+	WALSize       int64 // Size of the write-ahead log file (-wal), if any
+	PageSize      int64 // PRAGMA page_size
+	PageCount     int64 // PRAGMA page_count
+	FreelistPages int64 // PRAGMA freelist_count, pages reusable without growing the file
+}
+
+// filePath returns the filesystem path of the database file, stripping any
+// "file:" URI prefix and query parameters. It returns an empty string for
+// in-memory databases.
+func (s *Store) filePath() string {
+	return databaseFile(s.path)
+}
+
+// databaseFile returns the filesystem path of the database named by dbPath,
+// as passed to Open, or an empty string for in-memory databases.
+func databaseFile(dbPath string) string {
+	path := strings.TrimPrefix(dbPath, "file:")
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	if path == "" || path == ":memory:" || strings.Contains(dbPath, "mode=memory") {
+		return ""
+	}
+	return path
+}
+
+// DiskStats reports the database file size, WAL size, page size, page count
+// and number of free pages. Note that the pragmas describe the whole database
+// file, not just the table used by this Store.
+func (s *Store) DiskStats() (DiskStats, error) {
+	var stats DiskStats
+
+	pragmas := []struct {
+		name string
+		dest *int64
+	}{
+		{"page_size", &stats.PageSize},
+		{"page_count", &stats.PageCount},
+		{"freelist_count", &stats.FreelistPages},
+	}
+	for _, p := range pragmas {
+		if err := s.db.QueryRow("PRAGMA " + p.name + ";").Scan(p.dest); err != nil {
+			return DiskStats{}, fmt.Errorf("failed to read PRAGMA %s: %w", p.name, err)
+		}
+	}
+
+	if path := s.filePath(); path != "" {
+		if info, err := os.Stat(path); err == nil {
+			stats.FileSize = info.Size()
+		} else if !os.IsNotExist(err) {
+			return DiskStats{}, fmt.Errorf("failed to stat database file %q: %w", path, err)
+		}
+		if info, err := os.Stat(path + "-wal"); err == nil {
+			stats.WALSize = info.Size()
+		} else if !os.IsNotExist(err) {
+			return DiskStats{}, fmt.Errorf("failed to stat WAL file %q: %w", path+"-wal", err)
+		}
+	}
+
+	return stats, nil
+}
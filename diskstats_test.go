@@ -0,0 +1,23 @@
+package mkvstore
+
+import "testing"
+
+// TestDiskStats tests that page and file statistics are reported for a file-based store.
+func TestDiskStats(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	if err := store.Set("key", "value", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	stats, err := store.DiskStats()
+	if err != nil {
+		t.Fatalf("DiskStats failed: %v", err)
+	}
+	if stats.PageSize <= 0 || stats.PageCount <= 0 {
+		t.Errorf("DiskStats returned invalid page stats: %+v", stats)
+	}
+	if stats.FileSize != stats.PageSize*stats.PageCount {
+		t.Errorf("DiskStats file size %d does not match page_size*page_count %d", stats.FileSize, stats.PageSize*stats.PageCount)
+	}
+}
@@ -0,0 +1,63 @@
+package mkvstore
+
+import "net/url"
+
+// Durability selects a power-loss durability profile, trading fsync frequency
+// (and therefore flash wear and write latency) against the risk of losing
+// recent writes when power is cut.
+type Durability int
+
+const (
+	// DurabilityDefault leaves the SQLite driver defaults untouched.
+	DurabilityDefault Durability = iota
+	// DurabilityStrict uses WAL journaling with synchronous=FULL: every commit
+	// is fsynced before it returns, so acknowledged writes survive power loss.
+	DurabilityStrict
+	// DurabilityBalanced uses WAL journaling with synchronous=NORMAL: the
+	// database cannot be corrupted by power loss, but the most recent commits
+	// may be rolled back. This fsyncs far less often than DurabilityStrict.
+	DurabilityBalanced
+	// DurabilityFast keeps the journal in memory and never fsyncs. A crash or
+	// power loss can corrupt the database, so only use it for caches that live
+	// on a RAM disk or can be rebuilt from scratch.
+	DurabilityFast
+)
+
+// String returns the profile name.
+func (d Durability) String() string {
+	switch d {
+	case DurabilityDefault:
+		return "default"
+	case DurabilityStrict:
+		return "strict"
+	case DurabilityBalanced:
+		return "balanced"
+	case DurabilityFast:
+		return "fast"
+	}
+	return "unknown"
+}
+
+// apply adds the journal and synchronous connection parameters of the
+// profile to params.
+func (d Durability) apply(params url.Values) {
+	switch d {
+	case DurabilityStrict:
+		params.Set("_journal_mode", "WAL")
+		params.Set("_synchronous", "FULL")
+	case DurabilityBalanced:
+		params.Set("_journal_mode", "WAL")
+		params.Set("_synchronous", "NORMAL")
+	case DurabilityFast:
+		params.Set("_journal_mode", "MEMORY")
+		params.Set("_synchronous", "OFF")
+	}
+}
+
+// WithDurability selects the power-loss durability profile used for every
+// connection to the database. See the Durability constants for the tradeoffs.
+func WithDurability(level Durability) Option {
+	return func(o *options) {
+		o.durability = level
+	}
+}
@@ -0,0 +1,43 @@
+package mkvstore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestWithDurability tests that durability profiles set the expected pragmas.
+func TestWithDurability(t *testing.T) {
+	tests := []struct {
+		level       Durability
+		journalMode string
+		synchronous int
+	}{
+		{DurabilityStrict, "wal", 2},
+		{DurabilityBalanced, "wal", 1},
+		{DurabilityFast, "memory", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			dbPath := filepath.Join(t.TempDir(), "durability.db")
+			store, err := Open(dbPath, "test_kv_durability", WithDurability(tt.level))
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			defer store.Close()
+
+			var journalMode string
+			var synchronous int
+			if err := store.db.QueryRow("PRAGMA journal_mode;").Scan(&journalMode); err != nil {
+				t.Fatalf("Failed to read journal_mode: %v", err)
+			}
+			if err := store.db.QueryRow("PRAGMA synchronous;").Scan(&synchronous); err != nil {
+				t.Fatalf("Failed to read synchronous: %v", err)
+			}
+			if journalMode != tt.journalMode || synchronous != tt.synchronous {
+				t.Errorf("Expected journal_mode=%s synchronous=%d, got journal_mode=%s synchronous=%d",
+					tt.journalMode, tt.synchronous, journalMode, synchronous)
+			}
+		})
+	}
+}
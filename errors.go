@@ -9,4 +9,28 @@ var (
 	// ErrWrongType is returned when the key exists but is not a string type.
 	// (Future use if we add other types)
 	ErrWrongType = errors.New("operation against a key holding the wrong kind of value")
+
+	// ErrChangeLogDisabled is returned by operations that need the change log
+	// when the store was opened without WithChangeLog.
+	ErrChangeLogDisabled = errors.New("change log is not enabled for this store")
+
+	// ErrChecksumMismatch is returned when a value protected by the CRC32
+	// transformer fails verification, i.e. the stored bytes are corrupted.
+	ErrChecksumMismatch = errors.New("value checksum mismatch")
+
+	// ErrDatabaseLocked is returned by TryOpenExclusive when another process
+	// or Store holds the exclusive lock on the database file.
+	ErrDatabaseLocked = errors.New("database file is locked by another holder")
+
+	// ErrAliasCycle is returned when an alias would point back to itself,
+	// directly or through other aliases, or a chain of aliases is too long.
+	ErrAliasCycle = errors.New("alias cycle or chain too long")
+
+	// ErrReservedKey is returned when a user operation would write or delete
+	// a key under ReservedPrefix.
+	ErrReservedKey = errors.New("key is in the reserved namespace")
+
+	// ErrSingleConnection is returned under ProfileTest by operations that
+	// would pin the only connection of the pool, such as Session.
+	ErrSingleConnection = errors.New("operation would pin the only connection of the pool")
 )
@@ -0,0 +1,255 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// expireCondition restricts when a conditional expire applies, like the
+// options of Redis 7 EXPIRE.
+type expireCondition int
+
+const (
+	expireAlways expireCondition = iota // Whatever the current TTL
+	expireNX                            // Only if the key has no TTL
+	expireGT                            // Only if the new expiry is later than the current one
+	expireLT                            // Only if the new expiry is earlier than the current one
+)
+
+// sql returns the condition as an SQL expression, where ?2 is the new expiry.
+// Like Redis, a key without a TTL counts as expiring never, so GT never
+// applies to it and LT always does.
+func (c expireCondition) sql() string {
+	switch c {
+	case expireGT:
+		return `expires_at IS NOT NULL AND ?2 > expires_at`
+	case expireLT:
+		return `(expires_at IS NULL OR ?2 < expires_at)`
+	case expireNX:
+		return `expires_at IS NULL`
+	}
+	return `1`
+}
+
+// Expire sets or changes the TTL of key without rewriting its value, like
+// Redis EXPIRE. It reports whether the key exists. A ttl of 0 or negative
+// deletes the key. Works on keys of any type.
+func (s *Store) Expire(key string, ttl time.Duration) (bool, error) {
+	return s.expireIf(key, ttl, expireAlways)
+}
+
+// ExpireAt makes key expire at t without rewriting its value, like Redis
+// EXPIREAT. It reports whether the key exists. A time that is not in the
+// future deletes the key. Works on keys of any type.
+func (s *Store) ExpireAt(key string, t time.Time) (bool, error) {
+	return s.expireAtIf(key, t, expireAlways)
+}
+
+// ExpireNX sets a TTL on key only if it has none, e.g. to claim a lease
+// without overriding the TTL of an existing holder. It reports whether the TTL
+// was set. A ttl of 0 or negative deletes the key if the condition holds.
+// Works on keys of any type.
+func (s *Store) ExpireNX(key string, ttl time.Duration) (bool, error) {
+	return s.expireIf(key, ttl, expireNX)
+}
+
+// ExpireGT sets a TTL on key only if it expires later than its current TTL,
+// so heartbeats never shorten a lease. Keys without a TTL are left alone, as
+// they already never expire. It reports whether the TTL was set. Works on
+// keys of any type.
+func (s *Store) ExpireGT(key string, ttl time.Duration) (bool, error) {
+	return s.expireIf(key, ttl, expireGT)
+}
+
+// ExpireLT sets a TTL on key only if it expires earlier than its current TTL,
+// or if the key has no TTL. It reports whether the TTL was set. A ttl of 0 or
+// negative deletes the key if the condition holds. Works on keys of any type.
+func (s *Store) ExpireLT(key string, ttl time.Duration) (bool, error) {
+	return s.expireIf(key, ttl, expireLT)
+}
+
+// ExpireTime returns when key expires, like Redis EXPIRETIME, so schedulers
+// can plan around the exact time instead of a TTL measured at some point.
+// Expirations are kept to the second. It returns the zero time if the key
+// has no TTL, which IsZero reports, and ErrKeyNotFound if the key does not
+// exist or is expired. Works on keys of any type.
+func (s *Store) ExpireTime(key string) (time.Time, error) {
+	defer s.observe("expiretime", time.Now())
+
+	key = s.canonicalKey(key)
+	if w, found, err := s.bufferedValue(key); found {
+		if err != nil {
+			return time.Time{}, err
+		}
+		if expiresAt, ok := w.expiresAt.(int64); ok {
+			return time.Unix(expiresAt, 0), nil
+		}
+		return time.Time{}, nil
+	}
+
+	var expiresAt sql.NullInt64
+	expireTimeSQL := fmt.Sprintf(`SELECT expires_at FROM %s WHERE key = ?;`, s.quoteTable())
+	err := s.queryRow(expireTimeSQL, key).Scan(&expiresAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, ErrKeyNotFound
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get expiration of key %q in table %q: %w", key, s.table, err)
+	}
+	if !expiresAt.Valid {
+		return time.Time{}, nil
+	}
+	if s.now().Unix() > expiresAt.Int64 {
+		go s.purgeExpired(key) // Delete asynchronously, ignore error here
+		return time.Time{}, ErrKeyNotFound
+	}
+	return time.Unix(expiresAt.Int64, 0), nil
+}
+
+// expireIf sets the expiry of key to now + ttl if the key exists and cond
+// holds (see expireAtIf).
+func (s *Store) expireIf(key string, ttl time.Duration, cond expireCondition) (bool, error) {
+	return s.expireAtIf(key, s.now().Add(ttl), cond)
+}
+
+// expireAtIf sets the expiry of key to at in a single conditional statement if
+// the key exists and cond holds. An expiry that is not in the future deletes
+// the key instead, like Redis.
+func (s *Store) expireAtIf(key string, at time.Time, cond expireCondition) (bool, error) {
+	defer s.observe("expire", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return false, err
+	}
+
+	if err := s.Sync(); err != nil {
+		return false, err
+	}
+	now := s.now()
+	expiresAt := at.Unix()
+
+	op := "expire"
+	expireSQL := fmt.Sprintf(`
+	UPDATE %s SET expires_at = ?2, version = version + 1, updated_at = ?3
+	WHERE key = ?1 AND (expires_at IS NULL OR expires_at >= ?3) AND %s;`, s.quoteTable(), cond.sql())
+	expired := !at.After(now)
+	if expired {
+		op = "del"
+		expireSQL = fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE key = ?1 AND (expires_at IS NULL OR expires_at >= ?3) AND %s;`, s.quoteTable(), cond.sql())
+	}
+
+	result, err := s.exec(context.Background(), expireSQL, key, expiresAt, now.Unix())
+	if err != nil {
+		return false, fmt.Errorf("failed to set TTL on key %q in table %q: %w", key, s.table, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if !expired {
+		s.trackExpiry(key, expiresAt)
+	}
+	s.notify.publish(key, op)
+	return true, nil
+}
+
+// Persist removes the TTL of key, whatever its type, so it never expires,
+// like Redis PERSIST. It reports whether a TTL was removed: false if the key
+// has none or does not exist.
+func (s *Store) Persist(key string) (bool, error) {
+	defer s.observe("persist", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return false, err
+	}
+	if err := s.Sync(); err != nil {
+		return false, err
+	}
+
+	persistSQL := fmt.Sprintf(`
+	UPDATE %s SET expires_at = NULL, version = version + 1, updated_at = ?2
+	WHERE key = ?1 AND expires_at IS NOT NULL AND expires_at >= ?2;`, s.quoteTable())
+	result, err := s.exec(context.Background(), persistSQL, key, s.now().Unix())
+	if err != nil {
+		return false, fmt.Errorf("failed to persist key %q in table %q: %w", key, s.table, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	s.notify.publish(key, "persist")
+	return true, nil
+}
+
+// ExpirePattern sets a TTL on every live key matching pattern (same glob
+// syntax as Keys), whatever its type, in a single statement, e.g. to make all
+// caches under "x:*" expire in 10s during an incident. Reserved keys (see
+// ReservedPrefix) are skipped. A ttl of 0 or negative deletes the matching
+// keys. It returns the number of keys affected. With DryRun it only counts
+// them.
+func (s *Store) ExpirePattern(pattern string, ttl time.Duration, opts ...BulkOption) (int64, error) {
+	defer s.observe("expirepattern", time.Now())
+
+	pattern = s.canonicalKey(pattern)
+
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+	now := s.now()
+	expiresAt := now.Add(ttl).Unix()
+
+	op := "expire"
+	expireSQL := fmt.Sprintf(`UPDATE %s SET expires_at = ?2, version = version + 1, updated_at = ?3`, s.quoteTable())
+	if ttl <= 0 {
+		op = "del"
+		expireSQL = fmt.Sprintf(`DELETE FROM %s`, s.quoteTable())
+	}
+	where := `key LIKE ?1 ESCAPE '\' AND (expires_at IS NULL OR expires_at >= ?3) AND ` + notReservedSQL
+
+	o := bulkOpts(opts)
+	keys, err := s.bulkWrite(o, expireSQL, where, globToSQLLike(pattern), expiresAt, now.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to set TTL on keys matching %q in table %q: %w", pattern, s.table, err)
+	}
+	if !o.dryRun {
+		for _, key := range keys {
+			if ttl > 0 {
+				s.trackExpiry(key, expiresAt)
+			}
+			s.notify.publish(key, op)
+		}
+	}
+	return int64(len(keys)), nil
+}
+
+// PersistPattern removes the TTL of every live key matching pattern (same
+// glob syntax as Keys), whatever its type, in a single statement, e.g. to pin
+// a namespace during an investigation. Reserved keys are skipped. It returns
+// the number of keys that had a TTL. With DryRun it only counts them.
+func (s *Store) PersistPattern(pattern string, opts ...BulkOption) (int64, error) {
+	defer s.observe("persistpattern", time.Now())
+
+	pattern = s.canonicalKey(pattern)
+
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+	persistSQL := fmt.Sprintf(`UPDATE %s SET expires_at = NULL, version = version + 1, updated_at = ?2`, s.quoteTable())
+	where := `key LIKE ?1 ESCAPE '\' AND expires_at IS NOT NULL AND expires_at >= ?2 AND ` + notReservedSQL
+
+	o := bulkOpts(opts)
+	keys, err := s.bulkWrite(o, persistSQL, where, globToSQLLike(pattern), s.now().Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to persist keys matching %q in table %q: %w", pattern, s.table, err)
+	}
+	if !o.dryRun {
+		for _, key := range keys {
+			s.notify.publish(key, "persist")
+		}
+	}
+	return int64(len(keys)), nil
+}
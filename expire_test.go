@@ -0,0 +1,171 @@
+package mkvstore
+
+import (
+	"testing"
+	"time"
+)
+
+// TestConditionalExpire tests the NX, GT and LT conditions.
+func TestConditionalExpire(t *testing.T) {
+	store, _ := setupFileStore(t)
+	store.Set("persistent", "v", 0)
+	store.Set("volatile", "v", time.Hour)
+
+	tests := []struct {
+		name     string
+		expire   func(string, time.Duration) (bool, error)
+		key      string
+		ttl      time.Duration
+		expected bool
+	}{
+		{"NX without TTL", store.ExpireNX, "persistent", time.Hour, true},
+		{"NX with TTL", store.ExpireNX, "volatile", time.Minute, false},
+		{"GT shorter", store.ExpireGT, "volatile", time.Minute, false},
+		{"GT longer", store.ExpireGT, "volatile", 2 * time.Hour, true},
+		{"LT longer", store.ExpireLT, "volatile", 3 * time.Hour, false},
+		{"LT shorter", store.ExpireLT, "volatile", time.Minute, true},
+		{"missing key", store.ExpireLT, "missing", time.Minute, false},
+	}
+	for _, tt := range tests {
+		if ok, err := tt.expire(tt.key, tt.ttl); err != nil || ok != tt.expected {
+			t.Errorf("%s: got %v, %v; expected %v", tt.name, ok, err, tt.expected)
+		}
+	}
+	if ttl, _ := store.TTL("volatile"); ttl > time.Minute || ttl < 58*time.Second {
+		t.Errorf("Expected TTL of about a minute after LT, got %s", ttl)
+	}
+
+	// GT leaves keys without a TTL alone, LT gives them one
+	store.Set("p2", "v", 0)
+	if ok, _ := store.ExpireGT("p2", time.Hour); ok {
+		t.Error("Expected ExpireGT not to apply to a key without TTL")
+	}
+	if ok, _ := store.ExpireLT("p2", time.Hour); !ok {
+		t.Error("Expected ExpireLT to apply to a key without TTL")
+	}
+
+	// A non-positive TTL deletes the key when the condition holds
+	store.Set("gone", "v", 0)
+	if ok, err := store.ExpireNX("gone", 0); err != nil || !ok {
+		t.Fatalf("ExpireNX(0) = %v, %v; expected true", ok, err)
+	}
+	if exists, _ := store.Exists("gone"); exists {
+		t.Error("Expected key to be deleted by a non-positive TTL")
+	}
+}
+
+// TestExpire tests changing the TTL of existing keys of any type.
+func TestExpire(t *testing.T) {
+	store, _ := setupFileStore(t)
+	store.Set("a", "v", time.Hour)
+	store.HSet("h", "f", "v")
+
+	if ok, err := store.Expire("a", time.Minute); err != nil || !ok {
+		t.Fatalf("Expire = %v, %v; expected true", ok, err)
+	}
+	if ttl, _ := store.TTL("a"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("Expected TTL of about 1m, got %s", ttl)
+	}
+	if v, _ := store.Get("a"); v != "v" {
+		t.Errorf("Expected value kept, got %q", v)
+	}
+	if ok, err := store.Expire("missing", time.Minute); err != nil || ok {
+		t.Errorf("Expire of a missing key = %v, %v; expected false", ok, err)
+	}
+
+	if ok, err := store.ExpireAt("h", time.Now().Add(time.Hour)); err != nil || !ok {
+		t.Fatalf("ExpireAt = %v, %v; expected true", ok, err)
+	}
+	if ok, err := store.ExpireAt("h", time.Now().Add(-time.Second)); err != nil || !ok {
+		t.Fatalf("ExpireAt in the past = %v, %v; expected true", ok, err)
+	}
+	if _, err := store.HGet("h", "f"); err != ErrKeyNotFound {
+		t.Errorf("Expected hash deleted by an expiry in the past, got %v", err)
+	}
+}
+
+// TestExpirePattern tests bulk TTL updates and deletion by pattern.
+func TestExpirePattern(t *testing.T) {
+	store, _ := setupFileStore(t)
+	store.Set("cache:a", "1", 0)
+	store.Set("cache:b", "2", time.Hour)
+	store.HSet("cache:h", "f", "v")
+	store.Set("config", "keep", 0)
+
+	n, err := store.ExpirePattern("cache:*", 10*time.Second)
+	if err != nil || n != 3 {
+		t.Fatalf("ExpirePattern = %d, %v; expected 3", n, err)
+	}
+	for _, key := range []string{"cache:a", "cache:b"} {
+		if ttl, _ := store.TTL(key); ttl <= 0 || ttl > 10*time.Second {
+			t.Errorf("Expected TTL of about 10s on %q, got %s", key, ttl)
+		}
+	}
+	if ttl, _ := store.TTL("config"); ttl != -1 {
+		t.Errorf("Expected config to keep no TTL, got %s", ttl)
+	}
+
+	if n, err := store.ExpirePattern("cache:?", 0); err != nil || n != 3 {
+		t.Errorf("ExpirePattern with ttl 0 = %d, %v; expected 3 deletions", n, err)
+	}
+	if exists, _ := store.Exists("cache:a"); exists {
+		t.Error("Expected cache:a to be deleted")
+	}
+}
+
+// TestExpireTime tests reading absolute expiration times.
+func TestExpireTime(t *testing.T) {
+	store, _ := setupFileStore(t)
+	at := time.Now().Add(time.Hour).Truncate(time.Second)
+	store.Set("volatile", "v", 0)
+	store.ExpireAt("volatile", at)
+	store.Set("persistent", "v", 0)
+
+	if got, err := store.ExpireTime("volatile"); err != nil || !got.Equal(at) {
+		t.Errorf("ExpireTime = %v, %v; expected %v", got, err, at)
+	}
+	if got, err := store.ExpireTime("persistent"); err != nil || !got.IsZero() {
+		t.Errorf("ExpireTime of a key without TTL = %v, %v; expected the zero time", got, err)
+	}
+	if _, err := store.ExpireTime("missing"); err != ErrKeyNotFound {
+		t.Errorf("ExpireTime of a missing key should return ErrKeyNotFound, got %v", err)
+	}
+}
+
+// TestPersist tests removing the TTL of a single key.
+func TestPersist(t *testing.T) {
+	store, _ := setupFileStore(t)
+	store.Set("volatile", "v", time.Hour)
+	store.Set("persistent", "v", 0)
+
+	if ok, err := store.Persist("volatile"); err != nil || !ok {
+		t.Fatalf("Persist = %v, %v; expected true", ok, err)
+	}
+	if ttl, _ := store.TTL("volatile"); ttl != -1 {
+		t.Errorf("Expected no TTL after Persist, got %s", ttl)
+	}
+	if ok, err := store.Persist("persistent"); err != nil || ok {
+		t.Errorf("Persist of a key without TTL = %v, %v; expected false", ok, err)
+	}
+	if ok, err := store.Persist("missing"); err != nil || ok {
+		t.Errorf("Persist of a missing key = %v, %v; expected false", ok, err)
+	}
+}
+
+// TestPersistPattern tests bulk TTL removal by pattern.
+func TestPersistPattern(t *testing.T) {
+	store, _ := setupFileStore(t)
+	store.Set("pin:a", "1", time.Hour)
+	store.Set("pin:b", "2", 0)
+	store.Set("other", "3", time.Hour)
+
+	if n, err := store.PersistPattern("pin:*"); err != nil || n != 1 {
+		t.Fatalf("PersistPattern = %d, %v; expected 1", n, err)
+	}
+	if ttl, _ := store.TTL("pin:a"); ttl != -1 {
+		t.Errorf("Expected pin:a to have no TTL, got %s", ttl)
+	}
+	if ttl, _ := store.TTL("other"); ttl <= 0 {
+		t.Errorf("Expected other to keep its TTL, got %s", ttl)
+	}
+}
@@ -0,0 +1,93 @@
+package mkvstore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WithExpiryBuckets groups expirations into buckets of size (rounded to whole
+// seconds, at least one) with an index on the bucket number of every key and
+// hash field with a TTL. Background cleanup then drops whole buckets that
+// ended before now through an index range scan instead of checking every row,
+// which matters for high-churn TTL workloads. Keys in the current bucket are
+// removed by a later sweep once it ends; reads never return expired keys
+// either way.
+//
+// The index is created at Open, and indexes for other bucket sizes are
+// dropped, so every process sharing the file should use the same size.
+func WithExpiryBuckets(size time.Duration) Option {
+	return func(o *options) {
+		o.expiryBucket = size
+	}
+}
+
+// bucketSeconds returns the expiry bucket size in seconds, or 0 if expirations
+// are not bucketed.
+func (s *Store) bucketSeconds() int64 {
+	if s.opts.expiryBucket <= 0 {
+		return 0
+	}
+	return max(int64(s.opts.expiryBucket/time.Second), 1)
+}
+
+// bucketIndexPrefix returns the name prefix of the expiry bucket indexes of table.
+func bucketIndexPrefix(table string) string {
+	return table + "_expiry_bucket_"
+}
+
+// createExpiryBucketIndexes creates the partial expression indexes on the
+// bucket numbers of the main and hash tables and drops those left over from
+// other bucket sizes.
+func (s *Store) createExpiryBucketIndexes() error {
+	size := s.bucketSeconds()
+	for _, table := range []string{s.table, hashTableName(s.table)} {
+		prefix := bucketIndexPrefix(table)
+		name := fmt.Sprintf("%s%d", prefix, size)
+
+		rows, err := s.db.Query(`SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND name LIKE ? ESCAPE '\';`,
+			table, prefixToSQLLike(prefix))
+		if err != nil {
+			return fmt.Errorf("failed to list expiry bucket indexes of table %q: %w", table, err)
+		}
+		var stale []string
+		for rows.Next() {
+			var existing string
+			if err := rows.Scan(&existing); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to list expiry bucket indexes of table %q: %w", table, err)
+			}
+			if _, err := strconv.Atoi(strings.TrimPrefix(existing, prefix)); err == nil && existing != name {
+				stale = append(stale, existing)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to list expiry bucket indexes of table %q: %w", table, err)
+		}
+
+		for _, index := range stale {
+			if _, err := s.db.Exec(fmt.Sprintf(`DROP INDEX IF EXISTS %s;`, quoteIdent(index))); err != nil {
+				return fmt.Errorf("failed to drop expiry bucket index %q: %w", index, err)
+			}
+		}
+		createSQL := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (expires_at / %d) WHERE expires_at IS NOT NULL;`,
+			quoteIdent(name), quoteIdent(table), size)
+		if _, err := s.db.Exec(createSQL); err != nil {
+			return fmt.Errorf("failed to create expiry bucket index on table %q: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// expiredSQL returns the WHERE condition and its argument selecting rows to
+// delete as expired at now: whole buckets that ended before now when
+// expirations are bucketed, otherwise every row past its expiry.
+func (s *Store) expiredSQL(now int64) (string, int64) {
+	if size := s.bucketSeconds(); size > 0 {
+		// Matches the index expression, so SQLite scans only past buckets
+		return fmt.Sprintf(`expires_at IS NOT NULL AND expires_at / %d < ?`, size), now / size
+	}
+	return `expires_at IS NOT NULL AND expires_at < ?`, now
+}
@@ -0,0 +1,82 @@
+package mkvstore
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExpiryBuckets tests that cleanup drops past buckets through the bucket
+// index and that changing the bucket size replaces the index.
+func TestExpiryBuckets(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "buckets.db")
+	store, err := Open(dbPath, "kv", WithExpiryBuckets(time.Minute))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	store.Set("old", "v", time.Hour)
+	store.Set("live", "v", time.Hour)
+	store.Set("forever", "v", 0)
+	backdate := fmt.Sprintf(`UPDATE %s SET expires_at = ? WHERE key = ?;`, store.quoteTable())
+	if _, err := store.db.Exec(backdate, time.Now().Add(-2*time.Minute).Unix(), "old"); err != nil {
+		t.Fatalf("Failed to backdate key: %v", err)
+	}
+
+	expired, cutoff := store.expiredSQL(time.Now().Unix())
+	plan := explainPlan(t, store, fmt.Sprintf(`DELETE FROM %s WHERE %s;`, store.quoteTable(), expired), cutoff)
+	if !strings.Contains(plan, "kv_expiry_bucket_60") {
+		t.Errorf("Expected cleanup to use the bucket index, got plan %q", plan)
+	}
+
+	if n, err := store.sweepExpired(context.Background()); err != nil || n != 1 {
+		t.Errorf("sweepExpired = %d, %v; expected 1", n, err)
+	}
+	if keys, _ := store.Keys("*"); len(keys) != 2 {
+		t.Errorf("Expected live keys to survive cleanup, got %v", keys)
+	}
+	store.Close()
+
+	store, err = Open(dbPath, "kv", WithExpiryBuckets(10*time.Second))
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer store.Close()
+	var names []string
+	rows, err := store.db.Query(`SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = 'kv' AND name LIKE 'kv_expiry%';`)
+	if err != nil {
+		t.Fatalf("Failed to list indexes: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		names = append(names, name)
+	}
+	if len(names) != 1 || names[0] != "kv_expiry_bucket_10" {
+		t.Errorf("Expected only the 10s bucket index, got %v", names)
+	}
+}
+
+// explainPlan returns the details of the query plan for query, joined by newlines.
+func explainPlan(t *testing.T, store *Store, query string, args ...interface{}) string {
+	t.Helper()
+	rows, err := store.db.Query("EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		t.Fatalf("EXPLAIN QUERY PLAN failed: %v", err)
+	}
+	defer rows.Close()
+	var details []string
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			t.Fatalf("Failed to scan plan row: %v", err)
+		}
+		details = append(details, detail)
+	}
+	return strings.Join(details, "\n")
+}
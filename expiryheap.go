@@ -0,0 +1,145 @@
+package mkvstore
+
+import (
+	"container/heap"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// WithProactiveExpiry keeps an in-memory min-heap of upcoming expirations,
+// rebuilt from the table at Open and updated by writes through this Store, so
+// keys are deleted within milliseconds of expiring instead of on the next
+// cleanup tick or read. onExpired, if not nil, is called with the key of
+// every key deleted because it expired, whether by the heap or by a read
+// that found it expired; it runs on a background goroutine and must not
+// block for long.
+//
+// The heap holds one entry per key with a TTL, so memory grows with the
+// number of such keys. Expirations set by other processes sharing the file
+// are only picked up at the next Open. Keys expire by whole seconds, like
+// reads; wall-clock timers are used even with WithClock.
+func WithProactiveExpiry(onExpired func(key string)) Option {
+	return func(o *options) {
+		o.proactiveExpiry = true
+		o.onExpired = onExpired
+	}
+}
+
+// expiryEntry is a key due to expire once the time passes expiresAt.
+type expiryEntry struct {
+	key       string
+	expiresAt int64 // Unix seconds
+}
+
+// expiryEntries is a min-heap of expiryEntry ordered by expiresAt.
+type expiryEntries []expiryEntry
+
+func (h expiryEntries) Len() int           { return len(h) }
+func (h expiryEntries) Less(i, j int) bool { return h[i].expiresAt < h[j].expiresAt }
+func (h expiryEntries) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expiryEntries) Push(x any)        { *h = append(*h, x.(expiryEntry)) }
+func (h *expiryEntries) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// expiryHeap tracks upcoming expirations. Entries are not removed when a key
+// is overwritten or deleted; the deletion they trigger only removes keys that
+// are still expired, so stale entries are harmless.
+type expiryHeap struct {
+	mu      sync.Mutex
+	entries expiryEntries
+	wake    chan struct{} // Signals a new earliest deadline
+}
+
+// trackExpiry records that key expires after expiresAt (Unix seconds), when
+// proactive expiry is enabled.
+func (s *Store) trackExpiry(key string, expiresAt interface{}) {
+	at, ok := expiresAt.(int64)
+	if s.expiry == nil || !ok {
+		return
+	}
+	e := s.expiry
+	e.mu.Lock()
+	heap.Push(&e.entries, expiryEntry{key: key, expiresAt: at})
+	earliest := e.entries[0].expiresAt == at
+	e.mu.Unlock()
+
+	if earliest {
+		select {
+		case e.wake <- struct{}{}:
+		default: // Already signalled
+		}
+	}
+}
+
+// startExpiryHeap loads the expirations of the table into the heap and starts
+// the goroutine deleting keys as they expire.
+func (s *Store) startExpiryHeap() error {
+	e := &expiryHeap{wake: make(chan struct{}, 1)}
+
+	rows, err := s.db.Query(fmt.Sprintf(`SELECT key, expires_at FROM %s WHERE expires_at IS NOT NULL;`, s.quoteTable()))
+	if err != nil {
+		return fmt.Errorf("failed to load expirations of table %q: %w", s.table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry expiryEntry
+		if err := rows.Scan(&entry.key, &entry.expiresAt); err != nil {
+			return fmt.Errorf("failed to load expirations of table %q: %w", s.table, err)
+		}
+		e.entries = append(e.entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load expirations of table %q: %w", s.table, err)
+	}
+	heap.Init(&e.entries)
+
+	s.expiry = e
+	go s.runExpiryHeap()
+	return nil
+}
+
+// runExpiryHeap deletes keys as their deadlines pass until the store is closed.
+func (s *Store) runExpiryHeap() {
+	e := s.expiry
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		// Collect what is due and find the next deadline
+		var due []string
+		wait := time.Hour
+		e.mu.Lock()
+		now := s.now().Unix()
+		for len(e.entries) > 0 && e.entries[0].expiresAt < now {
+			due = append(due, heap.Pop(&e.entries).(expiryEntry).key)
+		}
+		if len(e.entries) > 0 {
+			// A key expires once a full second has passed its expires_at
+			wait = time.Until(time.Unix(e.entries[0].expiresAt+1, 0))
+		}
+		e.mu.Unlock()
+
+		for _, key := range due {
+			if err := s.purgeExpired(key); err != nil && s.ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "mkvstore: failed to expire key %q in table %q: %v\n", key, s.table, err)
+			}
+		}
+		if len(due) > 0 {
+			continue // More may have become due meanwhile
+		}
+
+		timer.Reset(max(wait, time.Millisecond))
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-e.wake: // Recompute the deadline
+		case <-timer.C:
+		}
+	}
+}
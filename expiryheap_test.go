@@ -0,0 +1,58 @@
+package mkvstore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestProactiveExpiry tests that keys are deleted and reported shortly after
+// expiring, including keys loaded from the table at Open.
+func TestProactiveExpiry(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "heap.db")
+	seed, err := Open(dbPath, "kv")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	seed.Set("loaded", "v", time.Second)
+	seed.Close()
+
+	expired := make(chan string, 4)
+	store, err := Open(dbPath, "kv", WithProactiveExpiry(func(key string) { expired <- key }))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+	store.Set("written", "v", time.Second)
+	store.Set("overwritten", "v", time.Second)
+	store.Set("overwritten", "v", 0) // Its heap entry is now stale
+
+	got := make(map[string]bool)
+	timeout := time.After(4 * time.Second)
+	for len(got) < 2 {
+		select {
+		case key := <-expired:
+			got[key] = true
+		case <-timeout:
+			t.Fatalf("Timed out waiting for expirations, got %v", got)
+		}
+	}
+	if !got["loaded"] || !got["written"] {
+		t.Errorf("Expected loaded and written to expire, got %v", got)
+	}
+
+	// Deleted without any read or cleanup tick
+	var n int
+	store.db.QueryRow(`SELECT COUNT(*) FROM kv WHERE key IN ('loaded', 'written');`).Scan(&n)
+	if n != 0 {
+		t.Errorf("Expected expired rows to be deleted, %d remain", n)
+	}
+	if v, err := store.Get("overwritten"); err != nil || v != "v" {
+		t.Errorf("Get(overwritten) = %q, %v; expected the key to survive", v, err)
+	}
+	select {
+	case key := <-expired:
+		t.Errorf("Unexpected expiration of %q", key)
+	default:
+	}
+}
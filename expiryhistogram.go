@@ -0,0 +1,69 @@
+package mkvstore
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Labels of ExpiryHistogram besides the buckets.
+const (
+	ExpiryExpired = "expired" // Expired keys not cleaned up yet
+	ExpiryLater   = "later"   // Keys expiring after the last bucket
+)
+
+// ExpiryHistogram counts the keys with a TTL by when they expire, in one
+// aggregate query, e.g. to size the interval of WithCleanup. buckets are upper
+// bounds from now, in any order and rounded up to whole seconds; each key is
+// counted under the String of the first bound it expires within. Keys past
+// the last bound are counted under ExpiryLater, and keys already expired but
+// not cleaned up yet under ExpiryExpired. Keys without a TTL are not counted.
+// Every label is present in the result, with 0 if no key falls in it.
+func (s *Store) ExpiryHistogram(buckets []time.Duration) (map[string]int64, error) {
+	bounds := slices.Clone(buckets)
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+	if len(bounds) > 0 && bounds[0] <= 0 {
+		return nil, fmt.Errorf("failed to build expiry histogram of table %q: bucket %s is not positive", s.table, bounds[0])
+	}
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+	defer s.observe("expiryhistogram", time.Now())
+
+	now := s.now().Unix()
+	histogram := map[string]int64{ExpiryExpired: 0, ExpiryLater: 0}
+	args := []interface{}{now, ExpiryExpired}
+	var cases strings.Builder
+	for _, bound := range bounds {
+		label := bound.String()
+		histogram[label] = 0
+		seconds := int64((bound + time.Second - 1) / time.Second)
+		cases.WriteString(" WHEN expires_at <= ? THEN ?")
+		args = append(args, now+seconds, label)
+	}
+	args = append(args, ExpiryLater)
+
+	histogramSQL := fmt.Sprintf(`
+	SELECT CASE WHEN expires_at < ? THEN ?%s ELSE ? END AS bucket, COUNT(*)
+	FROM %s WHERE expires_at IS NOT NULL AND %s
+	GROUP BY bucket;`, cases.String(), s.quoteTable(), notReservedSQL)
+	rows, err := s.query(histogramSQL, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expiry histogram of table %q: %w", s.table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var label string
+		var n int64
+		if err := rows.Scan(&label, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan expiry histogram of table %q: %w", s.table, err)
+		}
+		histogram[label] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through expiry histogram of table %q: %w", s.table, err)
+	}
+	return histogram, nil
+}
@@ -0,0 +1,37 @@
+package mkvstore
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestExpiryHistogram tests counting keys by when they expire.
+func TestExpiryHistogram(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	store := setupWALStore(t, WithClock(func() time.Time { return now }))
+
+	ttls := []time.Duration{10 * time.Second, 30 * time.Second, time.Minute, 90 * time.Second, time.Hour, 2 * time.Hour, 48 * time.Hour}
+	for i, ttl := range ttls {
+		store.Set(fmt.Sprintf("key%d", i), "value", ttl)
+	}
+	store.Set("persistent", "value", 0)
+	if _, err := store.AcquireLock("job", time.Minute); err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	now = now.Add(20 * time.Second) // key0 expires
+
+	histogram, err := store.ExpiryHistogram([]time.Duration{time.Hour, time.Minute, time.Hour})
+	if err != nil {
+		t.Fatalf("ExpiryHistogram failed: %v", err)
+	}
+	want := map[string]int64{ExpiryExpired: 1, "1m0s": 2, "1h0m0s": 2, ExpiryLater: 2}
+	if !reflect.DeepEqual(histogram, want) {
+		t.Errorf("ExpiryHistogram = %v, expected %v", histogram, want)
+	}
+
+	if _, err := store.ExpiryHistogram([]time.Duration{0}); err == nil {
+		t.Error("Expected a zero bucket to be rejected")
+	}
+}
@@ -0,0 +1,42 @@
+package mkvstore
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExplainKeys reports how Keys would run pattern: the generated SQL, with the
+// LIKE pattern inlined so it can be pasted into the sqlite3 shell, and
+// SQLite's query plan, one step per line, indented by nesting. A "SCAN" step
+// means every row of the table is read, which is what makes Keys slow on
+// large tables.
+func (s *Store) ExplainKeys(pattern string) (string, string, error) {
+	pattern = s.canonicalKey(pattern)
+	sqlPattern := globToSQLLike(pattern)
+	query := s.keysSQL()
+	inlined := strings.Replace(query, "?", "'"+strings.ReplaceAll(sqlPattern, "'", "''")+"'", 1)
+
+	rows, err := s.query("EXPLAIN QUERY PLAN "+query, sqlPattern)
+	if err != nil {
+		return inlined, "", fmt.Errorf("failed to explain keys query for pattern %q in table %q: %w", pattern, s.table, err)
+	}
+	defer rows.Close()
+
+	depth := map[int]int{0: -1} // Plan step id -> nesting level
+	var plan strings.Builder
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			return inlined, "", fmt.Errorf("failed to scan query plan row for table %q: %w", s.table, err)
+		}
+		depth[id] = depth[parent] + 1
+		plan.WriteString(strings.Repeat("  ", depth[id]))
+		plan.WriteString(detail)
+		plan.WriteByte('\n')
+	}
+	if err := rows.Err(); err != nil {
+		return inlined, "", fmt.Errorf("error iterating through query plan rows for table %q: %w", s.table, err)
+	}
+	return inlined, plan.String(), nil
+}
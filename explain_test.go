@@ -0,0 +1,22 @@
+package mkvstore
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestExplainKeys tests that the SQL and query plan are reported.
+func TestExplainKeys(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	sql, plan, err := store.ExplainKeys("*:it's_1")
+	if err != nil {
+		t.Fatalf("ExplainKeys failed: %v", err)
+	}
+	if !strings.Contains(sql, `LIKE '%:it''s\_1' ESCAPE`) {
+		t.Errorf("Expected inlined LIKE pattern, got %q", sql)
+	}
+	if !strings.Contains(plan, "SCAN") {
+		t.Errorf("Expected a table scan for a leading wildcard, got %q", plan)
+	}
+}
@@ -0,0 +1,150 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrLockHeld is returned by AcquireLock when the lock is held by another
+	// owner whose lease has not expired.
+	ErrLockHeld = errors.New("lock is held")
+
+	// ErrStaleToken is returned by SetWithFence when a write carrying a newer
+	// fencing token already reached the key.
+	ErrStaleToken = errors.New("fencing token is stale")
+)
+
+// Reserved keys of the lock and fencing bookkeeping.
+const (
+	fenceCounterKey = ReservedPrefix + "fence"      // Last fencing token handed out
+	lockKeyPrefix   = ReservedPrefix + "lock:"      // Lease of each lock, holding its token
+	fencedKeyPrefix = ReservedPrefix + "fence:key:" // Newest token written to each key
+)
+
+// AcquireLock takes the lock name for ttl and returns a fencing token, a
+// number persisted in the store that is greater than every token handed out
+// before, by any lock. A holder that pauses past its lease, e.g. in a long GC
+// or a suspended VM, may still believe it holds the lock after another took
+// it over; passing the token to SetWithFence makes the store reject its late
+// writes. Release the lock with ReleaseLock, or let the lease expire.
+// Returns ErrLockHeld if another holder's lease has not expired.
+func (s *Store) AcquireLock(name string, ttl time.Duration) (int64, error) {
+	defer s.observe("acquirelock", time.Now())
+
+	if ttl <= 0 {
+		return 0, fmt.Errorf("failed to acquire lock %q: lease must be positive", name)
+	}
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+
+	lockKey := lockKeyPrefix + name
+	now := s.now()
+	var token int64
+	err := s.update(func(tx *sql.Tx) error {
+		var expiresAt sql.NullInt64
+		checkSQL := fmt.Sprintf(`SELECT expires_at FROM %s WHERE key = ?;`, s.quoteTable())
+		err := tx.QueryRowContext(s.ctx, checkSQL, lockKey).Scan(&expiresAt)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil && (!expiresAt.Valid || now.Unix() <= expiresAt.Int64) {
+			return ErrLockHeld
+		}
+
+		nextSQL := fmt.Sprintf(`
+		INSERT INTO %s (key, value, type, expires_at, version, created_at, updated_at) VALUES (?1, '1', 'string', NULL, 1, ?2, ?2)
+		ON CONFLICT(key) DO UPDATE SET value = CAST(CAST(value AS INTEGER) + 1 AS TEXT), version = version + 1, updated_at = ?2
+		RETURNING CAST(value AS INTEGER);`, s.quoteTable())
+		if err := tx.QueryRowContext(s.ctx, nextSQL, fenceCounterKey, now.Unix()).Scan(&token); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(s.ctx, s.setSQL(), lockKey, strconv.FormatInt(token, 10), now.Add(ttl).Unix(), now.Unix(), 0, nil)
+		return err
+	})
+	if errors.Is(err, ErrLockHeld) {
+		return 0, fmt.Errorf("failed to acquire lock %q: %w", name, err)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire lock %q in table %q: %w", name, s.table, err)
+	}
+	s.trackExpiry(lockKey, now.Add(ttl).Unix())
+	return token, nil
+}
+
+// ReleaseLock releases the lock name if it is still held with token. A lock
+// whose lease expired or that another holder took over is left alone, and
+// ReleaseLock returns false.
+func (s *Store) ReleaseLock(name string, token int64) (bool, error) {
+	defer s.observe("releaselock", time.Now())
+
+	if err := s.Sync(); err != nil {
+		return false, err
+	}
+	releaseSQL := fmt.Sprintf(`DELETE FROM %s WHERE key = ? AND value = ? AND (expires_at IS NULL OR expires_at >= ?);`, s.quoteTable())
+	result, err := s.exec(s.ctx, releaseSQL, lockKeyPrefix+name, strconv.FormatInt(token, 10), s.now().Unix())
+	if err != nil {
+		return false, fmt.Errorf("failed to release lock %q in table %q: %w", name, s.table, err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// SetWithFence sets the string value of key without expiration, like Set,
+// unless a write carrying a newer fencing token from AcquireLock already
+// reached key. The newest token is remembered per key for as long as the key
+// exists, so a stale holder cannot overwrite the work of its successor;
+// deleting or renaming the key forgets it.
+// Returns an error wrapping ErrStaleToken if token is older than the newest.
+func (s *Store) SetWithFence(key, value string, token int64) error {
+	defer s.observe("setwithfence", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return err
+	}
+	if err := s.Sync(); err != nil {
+		return err
+	}
+
+	enc, err := s.encodeValue(key, value)
+	if err != nil {
+		return fmt.Errorf("failed to set key %q in table %q: %w", key, s.table, err)
+	}
+	var expiresAt interface{} // NULL for no expiration
+	if ttl := s.effectiveTTL(key, 0); ttl > 0 {
+		expiresAt = s.now().Add(ttl).Unix()
+	}
+
+	fenceKey := fencedKeyPrefix + key
+	err = s.update(func(tx *sql.Tx) error {
+		var newest int64
+		newestSQL := fmt.Sprintf(`SELECT CAST(value AS INTEGER) FROM %s WHERE key = ?;`, s.quoteTable())
+		err := tx.QueryRowContext(s.ctx, newestSQL, fenceKey).Scan(&newest)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil && token < newest {
+			return fmt.Errorf("%w: %d is older than %d", ErrStaleToken, token, newest)
+		}
+
+		now := s.now().Unix()
+		if token != newest {
+			if _, err := tx.ExecContext(s.ctx, s.setSQL(), fenceKey, strconv.FormatInt(token, 10), nil, now, 0, nil); err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(s.ctx, s.setSQL(), key, enc.data, expiresAt, now, enc.codec, enc.transforms)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set key %q in table %q: %w", key, s.table, err)
+	}
+	s.trackExpiry(key, expiresAt)
+	s.notify.publish(key, "set")
+	return nil
+}
@@ -0,0 +1,118 @@
+package mkvstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestAcquireLock tests lock leases and the growth of fencing tokens.
+func TestAcquireLock(t *testing.T) {
+	now := time.Now()
+	store := setupWALStore(t, WithClock(func() time.Time { return now }))
+
+	first, err := store.AcquireLock("leader", time.Minute)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	if _, err := store.AcquireLock("leader", time.Minute); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("Expected ErrLockHeld, got %v", err)
+	}
+
+	// Another lock gets a newer token from the same sequence
+	other, err := store.AcquireLock("other", time.Minute)
+	if err != nil || other <= first {
+		t.Errorf("AcquireLock(other) = %d, %v, expected a token above %d", other, err, first)
+	}
+
+	// The lease expires and a new holder takes over with a newer token
+	now = now.Add(2 * time.Minute)
+	second, err := store.AcquireLock("leader", time.Minute)
+	if err != nil || second <= other {
+		t.Fatalf("AcquireLock after expiry = %d, %v", second, err)
+	}
+	if ok, err := store.ReleaseLock("leader", first); err != nil || ok {
+		t.Errorf("ReleaseLock with the old token = %v, %v", ok, err)
+	}
+	if ok, err := store.ReleaseLock("leader", second); err != nil || !ok {
+		t.Errorf("ReleaseLock = %v, %v", ok, err)
+	}
+	if _, err := store.AcquireLock("leader", time.Minute); err != nil {
+		t.Errorf("AcquireLock after release failed: %v", err)
+	}
+}
+
+// TestSetWithFence tests that writes carrying stale tokens are rejected.
+func TestSetWithFence(t *testing.T) {
+	store := setupStore(t)
+	old, _ := store.AcquireLock("job", time.Minute)
+	store.ReleaseLock("job", old)
+	newer, _ := store.AcquireLock("job", time.Minute)
+
+	if err := store.SetWithFence("result", "from new holder", newer); err != nil {
+		t.Fatalf("SetWithFence failed: %v", err)
+	}
+	if err := store.SetWithFence("result", "again", newer); err != nil {
+		t.Errorf("SetWithFence with the same token failed: %v", err)
+	}
+	if err := store.SetWithFence("result", "from paused holder", old); !errors.Is(err, ErrStaleToken) {
+		t.Errorf("Expected ErrStaleToken, got %v", err)
+	}
+	if v, _ := store.Get("result"); v != "again" {
+		t.Errorf("Expected the stale write to be rejected, got %q", v)
+	}
+
+	// Deleting the key forgets its token along with it
+	store.Del("result")
+	if n := countRows(t, store); n != 2 {
+		t.Errorf("Expected only the token counter and the lease left, got %d rows", n)
+	}
+	if err := store.SetWithFence("result", "late", old); err != nil {
+		t.Errorf("SetWithFence after delete failed: %v", err)
+	}
+}
+
+// TestFenceStateHidden tests that lock and fencing bookkeeping stays out of
+// key listings and mirrors, so a mirror imports into a fresh store.
+func TestFenceStateHidden(t *testing.T) {
+	store := setupStore(t)
+	token, _ := store.AcquireLock("job", time.Minute)
+	if err := store.SetWithFence("result", "done", token); err != nil {
+		t.Fatalf("SetWithFence failed: %v", err)
+	}
+
+	if keys, _ := store.Keys("*"); len(keys) != 1 || keys[0] != "result" {
+		t.Errorf("Keys(*) = %v, expected only result", keys)
+	}
+	if all, _ := store.GetAll("*"); len(all) != 1 {
+		t.Errorf("GetAll(*) = %v, expected only result", all)
+	}
+	if keys, _, _ := store.Scan("", "*", 10); len(keys) != 1 {
+		t.Errorf("Scan = %v, expected only result", keys)
+	}
+	if n, _, _ := store.Usage(""); n != 1 {
+		t.Errorf("Usage counted %d keys, expected 1", n)
+	}
+
+	var mirror bytes.Buffer
+	if err := store.MirrorTo(context.Background(), &mirror, MirrorJSONL); err != nil {
+		t.Fatalf("MirrorTo failed: %v", err)
+	}
+	fresh, err := Open(":memory:", "test_kv_import")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer fresh.Close()
+	report, err := fresh.Import(&mirror, ImportOptions{})
+	if err != nil {
+		t.Fatalf("Import of the mirror failed: %v", err)
+	}
+	if len(report.Created) != 1 || len(report.Failed) != 0 {
+		t.Errorf("Expected 1 imported record, got %+v", report)
+	}
+	if v, _ := fresh.Get("result"); v != "done" {
+		t.Errorf("Expected result imported, got %q", v)
+	}
+}
@@ -0,0 +1,384 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// errStoreClosed is returned by buffered writes issued after Close.
+var errStoreClosed = errors.New("store is closed")
+
+// FlashWearConfig configures the flash-wear reduction mode enabled by
+// WithFlashWearReduction. Zero fields take the documented defaults.
+type FlashWearConfig struct {
+	// FlushInterval is how often buffered writes are committed in a single
+	// transaction. Defaults to 20ms, or 5s when WriteBehind is set.
+	FlushInterval time.Duration
+
+	// MaxPending triggers an early flush once this many keys are buffered.
+	// Defaults to 1000.
+	MaxPending int
+
+	// CheckpointPages is the wal_autocheckpoint threshold, in pages, used by
+	// the connection that commits buffered writes. Defaults to 10000, ten times
+	// the SQLite default, so the WAL is copied back into the database less often.
+	CheckpointPages int
+
+	// WriteBehind makes Set and Del return as soon as the write is buffered
+	// instead of waiting for it to be committed. Buffered values are served
+	// from memory by Get, Exists and TTL and written to disk on the next flush,
+	// on Sync or on Close. Writes acknowledged but not yet flushed are lost if
+	// the process crashes, unless Journal is set. A failed flush keeps its
+	// writes buffered, and journaled, for the next one.
+	WriteBehind bool
+
+	// Journal makes WriteBehind append every write to a journal file next to
+	// the database before acknowledging it. The journal is replayed at the
+	// next Open, so acknowledged writes survive a process crash; they survive
+	// a power loss only with JournalSync. It has no effect without WriteBehind
+	// or on in-memory databases.
+	Journal bool
+
+	// JournalSync fsyncs the journal before each write is acknowledged, trading
+	// the latency WriteBehind saves for durability against power loss.
+	JournalSync bool
+}
+
+// WithFlashWearReduction reduces write amplification on SD cards and eMMC by
+// coalescing Set and Del calls into group commits on a dedicated connection
+// with a raised WAL checkpoint threshold. Repeated writes to the same key
+// between two flushes reach the disk only once. Without WriteBehind, Set and
+// Del still block until their group commit completes, so acknowledged writes
+// are as durable as the configured Durability profile allows.
+func WithFlashWearReduction(cfg FlashWearConfig) Option {
+	return func(o *options) {
+		if cfg.FlushInterval <= 0 {
+			cfg.FlushInterval = 20 * time.Millisecond
+			if cfg.WriteBehind {
+				cfg.FlushInterval = 5 * time.Second
+			}
+		}
+		if cfg.MaxPending <= 0 {
+			cfg.MaxPending = 1000
+		}
+		if cfg.CheckpointPages <= 0 {
+			cfg.CheckpointPages = 10000
+		}
+		o.flashWear = &cfg
+	}
+}
+
+// pendingWrite is a buffered mutation of a single key.
+type pendingWrite struct {
+	deleted   bool
+	value     string
+	expiresAt interface{} // int64 Unix timestamp or nil for no expiration
+}
+
+// writeBuffer coalesces writes in memory and commits them in batches.
+type writeBuffer struct {
+	s   *Store
+	cfg FlashWearConfig
+
+	mu       sync.Mutex
+	pending  map[string]pendingWrite
+	inflight map[string]pendingWrite // Batch being committed, still served by get
+	waiters  []chan error            // Callers blocked until the next commit (group commit)
+	closed   bool
+	journal  *writeJournal // nil unless FlashWearConfig.Journal applies
+
+	kick chan struct{} // Requests an immediate flush
+	done chan struct{} // Closed when the flusher goroutine has exited
+}
+
+// startWriteBuffer pins a connection for committing buffered writes and
+// starts the flusher goroutine.
+func (s *Store) startWriteBuffer(cfg FlashWearConfig) error {
+	conn, err := s.db.Conn(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to reserve write connection: %w", err)
+	}
+	if _, err = conn.ExecContext(context.Background(), fmt.Sprintf(`PRAGMA wal_autocheckpoint = %d;`, cfg.CheckpointPages)); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to set wal_autocheckpoint: %w", err)
+	}
+
+	wb := &writeBuffer{
+		s:       s,
+		cfg:     cfg,
+		pending: make(map[string]pendingWrite),
+		kick:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	if path := journalPath(s.path, s.table); cfg.WriteBehind && cfg.Journal && path != "" {
+		if err := wb.replayJournal(conn, path); err != nil {
+			conn.Close()
+			return err
+		}
+		if wb.journal, err = openWriteJournal(path, cfg.JournalSync); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	s.wb = wb
+
+	go wb.run(conn)
+	return nil
+}
+
+// run commits buffered writes every FlushInterval or when kicked, and once
+// more before exiting when the buffer is closed.
+func (wb *writeBuffer) run(conn *sql.Conn) {
+	defer close(wb.done)
+	defer conn.Close()
+
+	ticker := time.NewTicker(wb.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-wb.kick:
+		}
+
+		wb.mu.Lock()
+		pending, waiters, closed := wb.pending, wb.waiters, wb.closed
+		wb.pending, wb.waiters = make(map[string]pendingWrite), nil
+		wb.inflight = pending
+		var sealed bool
+		var sealErr error
+		if wb.journal != nil {
+			sealed, sealErr = wb.journal.seal()
+		}
+		wb.mu.Unlock()
+		if sealErr != nil {
+			fmt.Fprintf(os.Stderr, "mkvstore: %v\n", sealErr)
+		}
+
+		err := wb.commit(conn, pending)
+		wb.mu.Lock()
+		switch {
+		case err == nil && sealed:
+			wb.journal.release()
+		case err != nil && wb.cfg.WriteBehind:
+			// Acknowledged writes are retried with the next batch, behind the
+			// newer writes of the same keys, and stay journaled until then
+			for key, w := range pending {
+				if _, ok := wb.pending[key]; !ok {
+					wb.pending[key] = w
+				}
+			}
+			if sealed {
+				if err := wb.journal.restore(); err != nil {
+					fmt.Fprintf(os.Stderr, "mkvstore: %v\n", err)
+				}
+			}
+		}
+		// The batch is committed, or back in pending, so reads no longer need it
+		wb.inflight = nil
+		wb.mu.Unlock()
+		if err != nil && len(waiters) == 0 {
+			fmt.Fprintf(os.Stderr, "mkvstore: failed to flush %d buffered writes for table %q: %v\n", len(pending), wb.s.table, err)
+		}
+		for _, w := range waiters {
+			w <- err
+		}
+
+		if closed {
+			if wb.journal != nil {
+				wb.journal.close()
+			}
+			return
+		}
+	}
+}
+
+// replayJournal commits the writes left in the journal at path by a process
+// that exited before flushing them, then removes the journal.
+func (wb *writeBuffer) replayJournal(conn *sql.Conn, path string) error {
+	pending, err := readJournal(path)
+	if err != nil {
+		return err
+	}
+	if err := wb.commit(conn, pending); err != nil {
+		return fmt.Errorf("failed to replay write journal %q: %w", path, err)
+	}
+	for _, file := range []string{path + ".flushing", path} {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove write journal %q: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// commit writes a batch of buffered mutations in one transaction.
+func (wb *writeBuffer) commit(conn *sql.Conn, pending map[string]pendingWrite) error {
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if wb.s.wq != nil {
+		// Serialized writes go through the writer goroutine instead
+		return wb.s.wq.do(func(tx *sql.Tx) error { return wb.write(tx, pending) })
+	}
+
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin flush transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op after a successful Commit
+
+	if err := wb.write(tx, pending); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit flush transaction: %w", err)
+	}
+	return nil
+}
+
+// write applies a batch of buffered mutations within tx.
+func (wb *writeBuffer) write(tx *sql.Tx, pending map[string]pendingWrite) error {
+	ctx := context.Background()
+	var err error
+	setSQL := wb.s.setSQL()
+	delSQL := fmt.Sprintf(`DELETE FROM %s WHERE key = ?;`, wb.s.quoteTable())
+	now := wb.s.now().Unix()
+
+	for key, w := range pending {
+		if w.deleted {
+			_, err = tx.ExecContext(ctx, delSQL, key)
+		} else {
+			var enc encodedValue
+			if enc, err = wb.s.encodeValue(key, w.value); err == nil {
+				_, err = tx.ExecContext(ctx, setSQL, key, enc.data, w.expiresAt, now, enc.codec, enc.transforms)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to flush key %q to table %q: %w", key, wb.s.table, err)
+		}
+	}
+	return nil
+}
+
+// put buffers a mutation and, unless running write-behind, waits for the
+// group commit that includes it.
+func (wb *writeBuffer) put(key string, w pendingWrite) error {
+	return wb.putAll(map[string]pendingWrite{key: w})
+}
+
+// putAll buffers several mutations at once, so they are committed together,
+// and waits for that commit unless running write-behind.
+func (wb *writeBuffer) putAll(writes map[string]pendingWrite) error {
+	wb.mu.Lock()
+	if wb.closed {
+		wb.mu.Unlock()
+		return errStoreClosed
+	}
+	if wb.journal != nil {
+		if err := wb.journal.append(writes); err != nil {
+			wb.mu.Unlock()
+			return err
+		}
+	}
+	for key, w := range writes {
+		wb.pending[key] = w
+	}
+	var wait chan error
+	if !wb.cfg.WriteBehind {
+		wait = make(chan error, 1)
+		wb.waiters = append(wb.waiters, wait)
+	}
+	full := len(wb.pending) >= wb.cfg.MaxPending
+	wb.mu.Unlock()
+
+	if full {
+		wb.flushSoon()
+	}
+	if wait == nil {
+		return nil
+	}
+	return <-wait
+}
+
+// get returns the buffered mutation for key, if any, including one in the
+// batch being committed, which is not yet visible in the database.
+func (wb *writeBuffer) get(key string) (pendingWrite, bool) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	if w, ok := wb.pending[key]; ok {
+		return w, true
+	}
+	w, ok := wb.inflight[key]
+	return w, ok
+}
+
+// flushSoon asks the flusher to commit without waiting for the next tick.
+func (wb *writeBuffer) flushSoon() {
+	select {
+	case wb.kick <- struct{}{}:
+	default: // A flush is already requested
+	}
+}
+
+// sync commits all buffered writes and waits for the commit to finish.
+func (wb *writeBuffer) sync() error {
+	wb.mu.Lock()
+	if wb.closed {
+		wb.mu.Unlock()
+		return nil
+	}
+	wait := make(chan error, 1)
+	wb.waiters = append(wb.waiters, wait)
+	wb.mu.Unlock()
+
+	wb.flushSoon()
+	return <-wait
+}
+
+// close flushes the remaining writes and stops the flusher goroutine.
+func (wb *writeBuffer) close() {
+	wb.mu.Lock()
+	already := wb.closed
+	wb.closed = true
+	wb.mu.Unlock()
+
+	if !already {
+		wb.flushSoon()
+	}
+	<-wb.done
+}
+
+// Sync commits all writes buffered by WithFlashWearReduction to the database.
+// It is a no-op when the mode is not enabled.
+func (s *Store) Sync() error {
+	if s.wb == nil {
+		return nil
+	}
+	return s.wb.sync()
+}
+
+// bufferedValue resolves key against the write buffer. found reports whether
+// the buffer holds the authoritative state of the key; when it does, err is
+// ErrKeyNotFound for deleted or expired keys.
+func (s *Store) bufferedValue(key string) (w pendingWrite, found bool, err error) {
+	if s.wb == nil {
+		return pendingWrite{}, false, nil
+	}
+	w, found = s.wb.get(key)
+	if !found {
+		return pendingWrite{}, false, nil
+	}
+	if w.deleted {
+		return w, true, ErrKeyNotFound
+	}
+	if expiresAt, ok := w.expiresAt.(int64); ok && s.now().Unix() > expiresAt {
+		return w, true, ErrKeyNotFound
+	}
+	return w, true, nil
+}
@@ -0,0 +1,271 @@
+package mkvstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countRows returns the number of rows physically stored in the store's table.
+func countRows(t *testing.T, store *Store) int {
+	var n int
+	if err := store.db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %s;`, store.quoteTable())).Scan(&n); err != nil {
+		t.Fatalf("Failed to count rows: %v", err)
+	}
+	return n
+}
+
+// TestFlashWearGroupCommit tests that concurrent writes are committed before Set returns.
+func TestFlashWearGroupCommit(t *testing.T) {
+	store := setupWALStore(t, WithFlashWearReduction(FlashWearConfig{}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := store.Set(fmt.Sprintf("key:%d", i), "value", 0); err != nil {
+				t.Errorf("Set failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := countRows(t, store); n != 50 {
+		t.Errorf("Expected 50 committed rows after Set returned, got %d", n)
+	}
+
+	if err := store.Del("key:0"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	if n := countRows(t, store); n != 49 {
+		t.Errorf("Expected 49 committed rows after Del returned, got %d", n)
+	}
+}
+
+// TestFlashWearWriteBehind tests buffered reads, Sync and the final flush on Close.
+func TestFlashWearWriteBehind(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "writebehind.db")
+	store, err := Open(dbPath, "test_kv_wb", WithFlashWearReduction(FlashWearConfig{
+		FlushInterval: time.Hour,
+		WriteBehind:   true,
+	}))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	store.Set("a", "1", 0)
+	store.Set("b", "2", time.Hour)
+	store.Set("c", "3", 0)
+	store.Del("c")
+
+	if n := countRows(t, store); n != 0 {
+		t.Errorf("Expected no committed rows before flush, got %d", n)
+	}
+	if value, err := store.Get("a"); err != nil || value != "1" {
+		t.Errorf("Get should serve buffered value, got %q, %v", value, err)
+	}
+	if _, err := store.Get("c"); err != ErrKeyNotFound {
+		t.Errorf("Get of buffered delete should return ErrKeyNotFound, got %v", err)
+	}
+	if ttl, err := store.TTL("b"); err != nil || ttl <= 0 {
+		t.Errorf("TTL should serve buffered expiry, got %s, %v", ttl, err)
+	}
+
+	if err := store.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if n := countRows(t, store); n != 2 {
+		t.Errorf("Expected 2 committed rows after Sync, got %d", n)
+	}
+
+	store.Set("d", "4", 0)
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reopened, err := Open(dbPath, "test_kv_wb")
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer reopened.Close()
+	if value, err := reopened.Get("d"); err != nil || value != "4" {
+		t.Errorf("Write buffered before Close was lost, got %q, %v", value, err)
+	}
+}
+
+// TestFlashWearReadDuringFlush tests that acknowledged write-behind writes
+// stay readable while the batch holding them is being committed.
+func TestFlashWearReadDuringFlush(t *testing.T) {
+	store := setupWALStore(t, WithFlashWearReduction(FlashWearConfig{
+		FlushInterval: time.Hour,
+		MaxPending:    1 << 20,
+		WriteBehind:   true,
+	}))
+
+	for round := 0; round < 5; round++ {
+		key := fmt.Sprintf("hot:%d", round)
+		store.Set(key, "value", 0)
+		for i := 0; i < 2000; i++ {
+			store.Set(fmt.Sprintf("filler:%d:%d", round, i), "value", 0)
+		}
+
+		stop := make(chan struct{})
+		var misses, reads int
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				reads++
+				if value, err := store.Get(key); err != nil || value != "value" {
+					misses++
+				}
+			}
+		}()
+		if err := store.Sync(); err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+		close(stop)
+		wg.Wait()
+		if misses > 0 {
+			t.Fatalf("Round %d: %d of %d reads missed an acknowledged write during the flush", round, misses, reads)
+		}
+	}
+}
+
+// TestFlashWearJournal tests that journaled write-behind writes are replayed
+// at Open after a crash, skipping torn records, whether last or followed by
+// good ones.
+func TestFlashWearJournal(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "journal.db")
+	cfg := WithFlashWearReduction(FlashWearConfig{
+		FlushInterval: time.Hour,
+		WriteBehind:   true,
+		Journal:       true,
+	})
+	store, err := Open(dbPath, "test_kv_journal", cfg)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	store.Set("a", "1", 0)
+	store.Set("b", "2", time.Hour)
+	store.Set("c", "3", 0)
+	store.Del("c")
+
+	// Keep the journal as a crash before the flush would have left it
+	journal := journalPath(dbPath, "test_kv_journal")
+	data, err := os.ReadFile(journal)
+	if err != nil {
+		t.Fatalf("Failed to read journal: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := os.Stat(journal); !os.IsNotExist(err) {
+		t.Errorf("Expected the journal to be removed on Close, got %v", err)
+	}
+
+	reset, err := Open(dbPath, "test_kv_journal")
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	reset.Flush()
+	reset.Close()
+	// A failed append tore d mid-file, e was acknowledged after it, and a
+	// crash tore f at the end
+	torn := append(data, "{\"k\":\"d\",\"v\":\"4\n{\"k\":\"e\",\"v\":\"NQ==\"}\n{\"k\":\"f\",\"v\":\"6"...)
+	if err := os.WriteFile(journal, torn, 0o644); err != nil {
+		t.Fatalf("Failed to write journal: %v", err)
+	}
+
+	replayed, err := Open(dbPath, "test_kv_journal", cfg)
+	if err != nil {
+		t.Fatalf("Open with journal failed: %v", err)
+	}
+	defer replayed.Close()
+	if n := countRows(t, replayed); n != 3 {
+		t.Errorf("Expected 3 rows replayed from the journal, got %d", n)
+	}
+	if value, err := replayed.Get("a"); err != nil || value != "1" {
+		t.Errorf("Expected replayed a = 1, got %q, %v", value, err)
+	}
+	if value, err := replayed.Get("e"); err != nil || value != "5" {
+		t.Errorf("Expected the record after the torn one replayed, got %q, %v", value, err)
+	}
+	if ttl, err := replayed.TTL("b"); err != nil || ttl <= 0 {
+		t.Errorf("Expected replayed TTL on b, got %s, %v", ttl, err)
+	}
+	for _, key := range []string{"d", "f"} {
+		if _, err := replayed.Get(key); err != ErrKeyNotFound {
+			t.Errorf("Expected the torn record of %s to be ignored, got %v", key, err)
+		}
+	}
+	if _, err := os.Stat(journal); err != nil {
+		t.Errorf("Expected a fresh journal after replay, got %v", err)
+	}
+}
+
+// TestFlashWearJournalFailedFlush tests that the writes of a failed flush
+// stay buffered and journaled, and are replayed at the next Open.
+func TestFlashWearJournalFailedFlush(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "journal.db")
+	cfg := WithFlashWearReduction(FlashWearConfig{
+		FlushInterval: time.Hour,
+		WriteBehind:   true,
+		Journal:       true,
+	})
+	store, err := Open(dbPath, "test_kv_journal", cfg)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	failSQL := `CREATE TRIGGER fail_flush BEFORE INSERT ON test_kv_journal BEGIN SELECT RAISE(ABORT, 'disk full'); END;`
+	if _, err := store.db.Exec(failSQL); err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+
+	store.Set("a", "1", 0)
+	store.Set("b", "1", 0)
+	if err := store.Sync(); err == nil {
+		t.Fatal("Expected Sync to fail")
+	}
+	store.Set("b", "2", 0)
+	if value, err := store.Get("a"); err != nil || value != "1" {
+		t.Errorf("Expected a to stay buffered after the failed flush, got %q, %v", value, err)
+	}
+	store.Close() // Fails to flush again
+
+	plain, err := Open(dbPath, "test_kv_journal")
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	if _, err := plain.db.Exec(`DROP TRIGGER fail_flush;`); err != nil {
+		t.Fatalf("Failed to drop trigger: %v", err)
+	}
+	if n := countRows(t, plain); n != 0 {
+		t.Errorf("Expected no committed rows, got %d", n)
+	}
+	plain.Close()
+
+	replayed, err := Open(dbPath, "test_kv_journal", cfg)
+	if err != nil {
+		t.Fatalf("Open with journal failed: %v", err)
+	}
+	defer replayed.Close()
+	for key, want := range map[string]string{"a": "1", "b": "2"} {
+		if value, err := replayed.Get(key); err != nil || value != want {
+			t.Errorf("Expected replayed %s = %s, got %q, %v", key, want, value, err)
+		}
+	}
+	if n := countRows(t, replayed); n != 2 {
+		t.Errorf("Expected 2 rows replayed from the journal, got %d", n)
+	}
+}
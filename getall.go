@@ -0,0 +1,78 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// GetAll returns every live string key matching pattern (same glob syntax as
+// Keys) with its value, reserved keys excluded. Keys and values are read by a single query, so unlike
+// Keys followed by one Get per key, the result is a consistent snapshot.
+func (s *Store) GetAll(pattern string) (map[string]string, error) {
+	defer s.observe("getall", time.Now())
+
+	result := make(map[string]string)
+	err := s.getAll(pattern, func(key, value string) error {
+		result[key] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetAllFunc is the streaming variant of GetAll: it calls fn for every live
+// string key matching pattern, in key order, without collecting the result in
+// memory. Rows come from a single query, so fn sees a consistent snapshot;
+// iteration stops at the first error returned by fn, which GetAllFunc
+// returns. fn must not write to the store if the pool is limited to a single
+// connection, since the query holds it until iteration ends. For very large
+// result sets prefer ForEach, which reads in batches.
+func (s *Store) GetAllFunc(pattern string, fn func(key, value string) error) error {
+	defer s.observe("getallfunc", time.Now())
+
+	return s.getAll(pattern, fn)
+}
+
+// getAll calls fn for every live string key matching pattern, for GetAll and
+// GetAllFunc.
+func (s *Store) getAll(pattern string, fn func(key, value string) error) error {
+	pattern = s.canonicalKey(pattern)
+	if err := s.Sync(); err != nil {
+		return err
+	}
+
+	getAllSQL := fmt.Sprintf(`
+	SELECT key, value, codec, transforms FROM %s
+	WHERE key LIKE ? ESCAPE '\' AND type = 'string' AND (expires_at IS NULL OR expires_at >= ?) AND %s
+	ORDER BY key;`, s.quoteTable(), notReservedSQL)
+
+	rows, err := s.query(getAllSQL, globToSQLLike(pattern), s.now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to query keys with pattern %q from table %q: %w", pattern, s.table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var stored []byte
+		var codec byte
+		var transforms sql.NullString
+		if err := rows.Scan(&key, &stored, &codec, &transforms); err != nil {
+			return fmt.Errorf("failed to scan key row in table %q: %w", s.table, err)
+		}
+		value, err := s.decodeValue(stored, codec, transforms)
+		if err != nil {
+			return fmt.Errorf("failed to decode key %q in table %q: %w", key, s.table, err)
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating through keys rows in table %q: %w", s.table, err)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package mkvstore
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestGetAll tests that matching live keys are returned with their values.
+func TestGetAll(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	store.Set("cfg:a", "1", 0)
+	store.Set("cfg:b", "2", time.Hour)
+	store.Set("cfg:expired", "3", time.Hour)
+	store.Set("other", "4", 0)
+	store.db.Exec(`UPDATE "test_kv_data_file" SET expires_at = ? WHERE key = 'cfg:expired';`, time.Now().Add(-time.Minute).Unix())
+
+	all, err := store.GetAll("cfg:*")
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	if expected := map[string]string{"cfg:a": "1", "cfg:b": "2"}; !reflect.DeepEqual(all, expected) {
+		t.Errorf("GetAll = %v, expected %v", all, expected)
+	}
+
+	stop := errors.New("stop")
+	var seen []string
+	err = store.GetAllFunc("cfg:*", func(key, value string) error {
+		seen = append(seen, key)
+		return stop
+	})
+	if !errors.Is(err, stop) || len(seen) != 1 || seen[0] != "cfg:a" {
+		t.Errorf("Expected iteration to stop after cfg:a, got %v, %v", seen, err)
+	}
+}
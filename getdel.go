@@ -0,0 +1,52 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// GetDel returns the string value of key and deletes the key in the same
+// transaction, like Redis GETDEL, so two processes sharing the database never
+// both get the value. An alias is followed for the value and deleted itself.
+// Returns ErrKeyNotFound if the key does not exist or is expired, and
+// ErrWrongType if it is not a string.
+func (s *Store) GetDel(key string) (string, error) {
+	defer s.observe("getdel", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return "", err
+	}
+	if err := s.Sync(); err != nil {
+		return "", err
+	}
+
+	var value string
+	err := s.update(func(tx *sql.Tx) error {
+		var err error
+		if value, err = s.getString(tx, key); err != nil {
+			return err
+		}
+		delSQL := fmt.Sprintf(`DELETE FROM %s WHERE key = ?;`, s.quoteTable())
+		if _, err := tx.ExecContext(s.ctx, delSQL, key); err != nil {
+			return fmt.Errorf("failed to delete key %q from table %q: %w", key, s.table, err)
+		}
+		return nil
+	})
+	if err == ErrKeyNotFound {
+		// Maybe only in an attached database
+		if value, err = s.getArchived(key); err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	}
+
+	// Archived copies go too, so the value never reappears
+	if err := s.delArchived(key); err != nil {
+		return "", err
+	}
+	s.notify.publish(key, "del")
+	return value, nil
+}
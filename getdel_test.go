@@ -0,0 +1,52 @@
+package mkvstore
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// TestGetDel tests that GetDel returns the value and deletes the key, and
+// that concurrent callers never both get it.
+func TestGetDel(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	store.Set("k", "v", 0)
+	if value, err := store.GetDel("k"); err != nil || value != "v" {
+		t.Fatalf("GetDel = %q, %v, expected v", value, err)
+	}
+	if exists, _ := store.Exists("k"); exists {
+		t.Error("Expected GetDel to delete the key")
+	}
+	if _, err := store.GetDel("k"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("GetDel of a missing key = %v, expected ErrKeyNotFound", err)
+	}
+
+	store.HSet("h", "f", "v")
+	if _, err := store.GetDel("h"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("GetDel of a hash = %v, expected ErrWrongType", err)
+	}
+	if exists, _ := store.Exists("h"); !exists {
+		t.Error("Expected GetDel to leave a hash key alone")
+	}
+
+	store.Set("once", "v", 0)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	got := 0
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.GetDel("once"); err == nil {
+				mu.Lock()
+				got++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if got != 1 {
+		t.Errorf("%d concurrent GetDel calls got the value, expected 1", got)
+	}
+}
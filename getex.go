@@ -0,0 +1,66 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// GetEx returns the string value of key and sets its TTL to ttl in the same
+// statement, like Redis GETEX, e.g. for sliding session expiration. A ttl of 0
+// or negative removes the expiration instead. Aliases are followed for the
+// value, while the TTL is set on the alias itself.
+// Returns ErrKeyNotFound if the key does not exist or is expired, and
+// ErrWrongType if it is not a string.
+func (s *Store) GetEx(key string, ttl time.Duration) (string, error) {
+	defer s.observe("getex", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return "", err
+	}
+	if err := s.Sync(); err != nil {
+		return "", err
+	}
+	now := s.now()
+	var expiresAt interface{} // NULL for no expiration
+	op := "persist"
+	if ttl > 0 {
+		expiresAt = now.Add(ttl).Unix()
+		op = "expire"
+	}
+
+	var stored []byte
+	var codec byte
+	var transforms sql.NullString
+	var keyType string
+	getExSQL := fmt.Sprintf(`
+	UPDATE %s SET expires_at = ?2, version = version + 1, updated_at = ?3
+	WHERE key = ?1 AND type IN ('string', 'alias', 'archived') AND (expires_at IS NULL OR expires_at >= ?3)
+	RETURNING value, codec, transforms, type;`, s.quoteTable())
+	err := s.update(func(tx *sql.Tx) error {
+		return tx.QueryRowContext(context.Background(), getExSQL, key, expiresAt, now.Unix()).Scan(&stored, &codec, &transforms, &keyType)
+	})
+	if err == sql.ErrNoRows {
+		// Tell a key of another type from a missing one
+		if _, err := s.liveKey(s.q(), key, "string", now.Unix()); err != nil {
+			return "", err
+		}
+		return "", ErrKeyNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get and set TTL of key %q in table %q: %w", key, s.table, err)
+	}
+	s.trackExpiry(key, expiresAt)
+	s.notify.publish(key, op)
+
+	if keyType != "string" {
+		return s.getString(s.q(), key) // Follow the alias or read the archive
+	}
+	value, err := s.decodeValue(stored, codec, transforms)
+	if err != nil {
+		return "", fmt.Errorf("failed to get key %q from table %q: %w", key, s.table, err)
+	}
+	return value, nil
+}
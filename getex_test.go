@@ -0,0 +1,36 @@
+package mkvstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestGetEx tests that GetEx returns the value while setting or removing the
+// TTL.
+func TestGetEx(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	store.Set("session", "data", time.Minute)
+	if value, err := store.GetEx("session", time.Hour); err != nil || value != "data" {
+		t.Fatalf("GetEx = %q, %v, expected data", value, err)
+	}
+	if ttl, _ := store.TTL("session"); ttl <= time.Minute {
+		t.Errorf("TTL = %v, expected it extended to an hour", ttl)
+	}
+
+	if value, err := store.GetEx("session", 0); err != nil || value != "data" {
+		t.Fatalf("GetEx without TTL = %q, %v, expected data", value, err)
+	}
+	if ttl, _ := store.TTL("session"); ttl != -1 {
+		t.Errorf("TTL = %v, expected the expiration removed", ttl)
+	}
+
+	if _, err := store.GetEx("missing", time.Hour); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("GetEx of a missing key = %v, expected ErrKeyNotFound", err)
+	}
+	store.HSet("h", "f", "v")
+	if _, err := store.GetEx("h", time.Hour); !errors.Is(err, ErrWrongType) {
+		t.Errorf("GetEx of a hash = %v, expected ErrWrongType", err)
+	}
+}
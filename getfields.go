@@ -0,0 +1,149 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// GetFields returns selected fields of the JSON values of the live string
+// keys matching pattern (same glob syntax as Keys), in key order: one map per
+// key, holding the key under "key" and the field at each of jsonPaths (SQLite
+// JSON paths such as "$.name" or "$.tags[0]") under the path, decoded as by
+// encoding/json, or nil if absent. Fields are extracted by SQLite with the
+// -> operator, so only they leave the database; values that are compressed or
+// transformed are decoded first and cost a query each. Values that are not
+// valid JSON are skipped.
+func (s *Store) GetFields(pattern string, jsonPaths []string) ([]map[string]any, error) {
+	pattern = s.canonicalKey(pattern)
+	if len(jsonPaths) == 0 {
+		return nil, errors.New("GetFields needs at least one JSON path")
+	}
+	for _, path := range jsonPaths {
+		if path == "key" || !strings.HasPrefix(path, "$") {
+			return nil, fmt.Errorf("invalid JSON path %q", path)
+		}
+	}
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+
+	// Plain values are projected in SQL; encoded ones come back whole
+	fields := make([]string, len(jsonPaths))
+	args := make([]interface{}, 0, len(jsonPaths)+2)
+	args = append(args, globToSQLLike(pattern), s.now().Unix())
+	for i, path := range jsonPaths {
+		fields[i] = fmt.Sprintf(", CASE WHEN plain THEN value -> ?%d END", i+3)
+		args = append(args, path)
+	}
+	getFieldsSQL := fmt.Sprintf(`
+	SELECT key, plain, CASE WHEN NOT plain THEN value END, codec, transforms%s
+	FROM (SELECT key, value, codec, transforms, codec = 0 AND transforms IS NULL AS plain FROM %s
+		WHERE key LIKE ?1 ESCAPE '\' AND type = 'string' AND (expires_at IS NULL OR expires_at >= ?2))
+	WHERE NOT plain OR json_valid(value)
+	ORDER BY key;`, strings.Join(fields, ""), s.quoteTable())
+
+	rows, err := s.query(getFieldsSQL, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fields of keys with pattern %q from table %q: %w", pattern, s.table, err)
+	}
+	defer rows.Close()
+
+	var result []map[string]any
+	encoded := make(map[int]string) // Index in result of encoded values, to project afterwards
+	for rows.Next() {
+		var key string
+		var plain bool
+		var stored []byte
+		var codec byte
+		var transforms sql.NullString
+		extracted := make([]sql.NullString, len(jsonPaths))
+		dest := []interface{}{&key, &plain, &stored, &codec, &transforms}
+		for i := range extracted {
+			dest = append(dest, &extracted[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan fields row in table %q: %w", s.table, err)
+		}
+
+		if !plain {
+			value, err := s.decodeValue(stored, codec, transforms)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode key %q in table %q: %w", key, s.table, err)
+			}
+			encoded[len(result)] = value
+			result = append(result, map[string]any{"key": key})
+			continue
+		}
+		entry, err := projectFields(key, jsonPaths, extracted)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fields of key %q in table %q: %w", key, s.table, err)
+		}
+		result = append(result, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through fields rows in table %q: %w", s.table, err)
+	}
+	rows.Close() // Release the connection before projecting encoded values
+
+	valid := result[:0]
+	for i, entry := range result {
+		if value, ok := encoded[i]; ok {
+			key := entry["key"].(string)
+			if entry, err = s.projectValue(key, value, jsonPaths); err != nil {
+				return nil, err
+			}
+			if entry == nil {
+				continue // Not JSON
+			}
+		}
+		valid = append(valid, entry)
+	}
+	return valid, nil
+}
+
+// projectValue extracts jsonPaths from a decoded value with SQLite, returning
+// nil if the value is not valid JSON.
+func (s *Store) projectValue(key, value string, jsonPaths []string) (map[string]any, error) {
+	fields := make([]string, len(jsonPaths))
+	args := []interface{}{value}
+	for i, path := range jsonPaths {
+		fields[i] = fmt.Sprintf(", CASE WHEN json_valid(?1) THEN ?1 -> ?%d END", i+2)
+		args = append(args, path)
+	}
+	var valid bool
+	extracted := make([]sql.NullString, len(jsonPaths))
+	dest := []interface{}{&valid}
+	for i := range extracted {
+		dest = append(dest, &extracted[i])
+	}
+	projectSQL := fmt.Sprintf(`SELECT json_valid(?1)%s;`, strings.Join(fields, ""))
+	if err := s.queryRow(projectSQL, args...).Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to read fields of key %q in table %q: %w", key, s.table, err)
+	}
+	if !valid {
+		return nil, nil
+	}
+	entry, err := projectFields(key, jsonPaths, extracted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fields of key %q in table %q: %w", key, s.table, err)
+	}
+	return entry, nil
+}
+
+// projectFields decodes the JSON texts extracted for jsonPaths into a map.
+func projectFields(key string, jsonPaths []string, extracted []sql.NullString) (map[string]any, error) {
+	entry := map[string]any{"key": key}
+	for i, path := range jsonPaths {
+		var field any
+		if extracted[i].Valid {
+			if err := json.Unmarshal([]byte(extracted[i].String), &field); err != nil {
+				return nil, err
+			}
+		}
+		entry[path] = field
+	}
+	return entry, nil
+}
@@ -0,0 +1,43 @@
+package mkvstore
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestGetFields tests that selected JSON fields of matching values are
+// returned, whether the values are stored plain or compressed.
+func TestGetFields(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "fields.db")
+	store, err := Open(dbPath, "test_kv_fields", WithCompression(CompressionGzip, 64))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	store.Set("dev:1", `{"name":"pump","temp":21.5,"tags":["a","b"]}`, 0)
+	store.Set("dev:2", `{"name":"fan","note":"`+strings.Repeat("x", 100)+`"}`, 0) // Compressed
+	store.Set("dev:3", "not json", 0)
+	store.Set("other", `{"name":"skipped"}`, 0)
+
+	fields, err := store.GetFields("dev:*", []string{"$.name", "$.temp", "$.tags[1]"})
+	if err != nil {
+		t.Fatalf("GetFields failed: %v", err)
+	}
+	expected := []map[string]any{
+		{"key": "dev:1", "$.name": "pump", "$.temp": 21.5, "$.tags[1]": "b"},
+		{"key": "dev:2", "$.name": "fan", "$.temp": nil, "$.tags[1]": nil},
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("GetFields = %v, expected %v", fields, expected)
+	}
+
+	if _, err := store.GetFields("dev:*", nil); err == nil {
+		t.Error("Expected GetFields without paths to fail")
+	}
+	if _, err := store.GetFields("dev:*", []string{"name"}); err == nil {
+		t.Error("Expected GetFields with an invalid path to fail")
+	}
+}
@@ -2,4 +2,17 @@ module github.com/hootrhino/microkvstore
 
 go 1.23.3
 
-require github.com/mattn/go-sqlite3 v1.14.28
+require (
+	github.com/mattn/go-sqlite3 v1.14.28
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	google.golang.org/grpc v1.75.0
+	google.golang.org/protobuf v1.36.6
+)
+
+require (
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	golang.org/x/net v0.41.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/text v0.26.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250707201910-8d1bb00bc6a7 // indirect
+)
@@ -0,0 +1,530 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// Hashes are stored as a row of type 'hash' in the store's table, carrying the
+// key's expiry and version, plus one row per field in <table>_hash. Every
+// field can have its own expiry (see HExpire).
+
+// hashTableName returns the name of the table holding the fields of hashes in table.
+func hashTableName(table string) string {
+	return table + "_hash"
+}
+
+// quoteHashTable returns the hash field table name safely quoted for SQL.
+func (s *Store) quoteHashTable() string {
+	return quoteIdent(hashTableName(s.table))
+}
+
+// liveKey reports whether key holds a value of keyType that has not expired.
+// Returns ErrWrongType if key holds another type.
+func (s *Store) liveKey(q queryer, key, keyType string, now int64) (bool, error) {
+	var storedType string
+	var expiresAt sql.NullInt64
+	typeSQL := fmt.Sprintf(`SELECT type, expires_at FROM %s WHERE key = ?;`, s.quoteTable())
+	err := q.QueryRowContext(s.ctx, typeSQL, key).Scan(&storedType, &expiresAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read key %q in table %q: %w", key, s.table, err)
+	}
+	if expiresAt.Valid && now > expiresAt.Int64 {
+		return false, nil
+	}
+	if storedType != keyType {
+		return false, ErrWrongType
+	}
+	return true, nil
+}
+
+// liveHash reports whether key holds a hash that has not expired.
+// Returns ErrWrongType if key holds another type.
+func (s *Store) liveHash(q queryer, key string, now int64) (bool, error) {
+	return s.liveKey(q, key, "hash", now)
+}
+
+// touchKey creates the row of a container key of keyType (whose elements live
+// in a child table), with the prefix default TTL, or bumps its version, within
+// tx. An expired key of any type is replaced. Returns ErrWrongType if key
+// holds another type.
+func (s *Store) touchKey(tx *sql.Tx, key, keyType string, now int64) error {
+	purgeSQL := fmt.Sprintf(`DELETE FROM %s WHERE key = ? AND expires_at IS NOT NULL AND expires_at < ?;`, s.quoteTable())
+	if _, err := tx.ExecContext(s.ctx, purgeSQL, key, now); err != nil {
+		return fmt.Errorf("failed to delete expired key %q in table %q: %w", key, s.table, err)
+	}
+	live, err := s.liveKey(tx, key, keyType, now)
+	if err != nil {
+		return err
+	}
+	var expiresAt interface{} // Existing keys keep theirs
+	if !live {
+		expiresAt = s.defaultExpiresAt(key, now)
+	}
+	touchSQL := fmt.Sprintf(`
+	INSERT INTO %s (key, value, type, expires_at, version, created_at, updated_at) VALUES (?1, NULL, ?2, ?4, %s, ?3, ?3)
+	ON CONFLICT(key) DO UPDATE SET version = version + 1, updated_at = excluded.updated_at;`, s.quoteTable(), firstVersionSQL(s.table))
+	if _, err := tx.ExecContext(s.ctx, touchSQL, key, keyType, now, expiresAt); err != nil {
+		return fmt.Errorf("failed to update %s %q in table %q: %w", keyType, key, s.table, err)
+	}
+	s.trackExpiry(key, expiresAt) // Harmless if the transaction is rolled back
+	return nil
+}
+
+// HSet sets field in the hash stored at key to value, creating the hash if
+// needed. Overwriting a field clears its TTL.
+// Returns ErrWrongType if key holds another type.
+func (s *Store) HSet(key, field, value string) error {
+	defer s.observe("hset", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return err
+	}
+	if err := s.Sync(); err != nil {
+		return err
+	}
+	enc, err := s.encodeValue(key, value)
+	if err != nil {
+		return fmt.Errorf("failed to set field %q of hash %q in table %q: %w", field, key, s.table, err)
+	}
+
+	err = s.update(func(tx *sql.Tx) error {
+		if err := s.touchKey(tx, key, "hash", s.now().Unix()); err != nil {
+			return err
+		}
+		hsetSQL := fmt.Sprintf(`
+		INSERT INTO %s (key, field, value, codec, transforms, expires_at) VALUES (?, ?, ?, ?, ?, NULL)
+		ON CONFLICT(key, field) DO UPDATE SET
+			value = excluded.value, codec = excluded.codec, transforms = excluded.transforms, expires_at = NULL;`, s.quoteHashTable())
+		if _, err := tx.ExecContext(s.ctx, hsetSQL, key, field, enc.data, enc.codec, enc.transforms); err != nil {
+			return fmt.Errorf("failed to set field %q of hash %q in table %q: %w", field, key, s.table, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.notify.publish(key, "hset")
+	return nil
+}
+
+// HGet returns the value of field in the hash stored at key.
+// Returns ErrKeyNotFound if the key or field does not exist or is expired,
+// and ErrWrongType if key holds another type.
+func (s *Store) HGet(key, field string) (string, error) {
+	defer s.observe("hget", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := s.Sync(); err != nil {
+		return "", err
+	}
+	now := s.now().Unix()
+	if ok, err := s.liveHash(s.q(), key, now); !ok {
+		if err == nil {
+			err = ErrKeyNotFound
+		}
+		return "", err
+	}
+
+	var stored []byte
+	var codec byte
+	var transforms sql.NullString
+	var expiresAt sql.NullInt64
+	hgetSQL := fmt.Sprintf(`SELECT value, codec, transforms, expires_at FROM %s WHERE key = ? AND field = ?;`, s.quoteHashTable())
+	err := s.queryRow(hgetSQL, key, field).Scan(&stored, &codec, &transforms, &expiresAt)
+	if err == sql.ErrNoRows {
+		return "", ErrKeyNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get field %q of hash %q from table %q: %w", field, key, s.table, err)
+	}
+	if expiresAt.Valid && now > expiresAt.Int64 {
+		go s.purgeExpiredField(key, field) // Delete asynchronously, ignore error here
+		return "", ErrKeyNotFound
+	}
+
+	value, err := s.decodeValue(stored, codec, transforms)
+	if err != nil {
+		return "", fmt.Errorf("failed to get field %q of hash %q from table %q: %w", field, key, s.table, err)
+	}
+	return value, nil
+}
+
+// HGetAll returns all fields and values of the hash stored at key. It returns
+// an empty map if the key does not exist. Returns ErrWrongType if key holds
+// another type.
+func (s *Store) HGetAll(key string) (map[string]string, error) {
+	defer s.observe("hgetall", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+	now := s.now().Unix()
+	fields := make(map[string]string)
+	if ok, err := s.liveHash(s.q(), key, now); !ok {
+		return fields, err
+	}
+
+	hgetallSQL := fmt.Sprintf(`
+	SELECT field, value, codec, transforms FROM %s
+	WHERE key = ? AND (expires_at IS NULL OR expires_at >= ?);`, s.quoteHashTable())
+	rows, err := s.query(hgetallSQL, key, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hash %q from table %q: %w", key, s.table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var field string
+		var stored []byte
+		var codec byte
+		var transforms sql.NullString
+		if err := rows.Scan(&field, &stored, &codec, &transforms); err != nil {
+			return nil, fmt.Errorf("failed to scan field of hash %q in table %q: %w", key, s.table, err)
+		}
+		value, err := s.decodeValue(stored, codec, transforms)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get field %q of hash %q from table %q: %w", field, key, s.table, err)
+		}
+		fields[field] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through fields of hash %q in table %q: %w", key, s.table, err)
+	}
+	return fields, nil
+}
+
+// HLen returns the number of live fields in the hash stored at key, or 0 if
+// the key does not exist. Returns ErrWrongType if key holds another type.
+func (s *Store) HLen(key string) (int, error) {
+	defer s.observe("hlen", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+	now := s.now().Unix()
+	if ok, err := s.liveHash(s.q(), key, now); !ok {
+		return 0, err
+	}
+
+	var n int
+	hlenSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE key = ? AND (expires_at IS NULL OR expires_at >= ?);`, s.quoteHashTable())
+	if err := s.queryRow(hlenSQL, key, now).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count fields of hash %q in table %q: %w", key, s.table, err)
+	}
+	return n, nil
+}
+
+// HDel removes field from the hash stored at key and reports whether it
+// existed. The hash is deleted once its last field is removed.
+// Returns ErrWrongType if key holds another type.
+func (s *Store) HDel(key, field string) (bool, error) {
+	defer s.observe("hdel", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return false, err
+	}
+	if err := s.Sync(); err != nil {
+		return false, err
+	}
+	now := s.now().Unix()
+
+	var deleted bool
+	var expiresAt sql.NullInt64
+	err := s.update(func(tx *sql.Tx) error {
+		if ok, err := s.liveHash(tx, key, now); !ok {
+			return err
+		}
+
+		hdelSQL := fmt.Sprintf(`DELETE FROM %s WHERE key = ? AND field = ? RETURNING expires_at;`, s.quoteHashTable())
+		err := tx.QueryRowContext(s.ctx, hdelSQL, key, field).Scan(&expiresAt)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete field %q of hash %q from table %q: %w", field, key, s.table, err)
+		}
+		deleted = true
+
+		// Drop the hash with its last field, otherwise record the change on it
+		var parentSQL string
+		if n, err := s.countFields(tx, key); err != nil {
+			return err
+		} else if n == 0 {
+			parentSQL = fmt.Sprintf(`DELETE FROM %s WHERE key = ?1;`, s.quoteTable())
+		} else {
+			parentSQL = fmt.Sprintf(`UPDATE %s SET version = version + 1, updated_at = ?2 WHERE key = ?1;`, s.quoteTable())
+		}
+		if _, err := tx.ExecContext(s.ctx, parentSQL, key, now); err != nil {
+			return fmt.Errorf("failed to update hash %q in table %q: %w", key, s.table, err)
+		}
+		return nil
+	})
+	if err != nil || !deleted {
+		return false, err
+	}
+
+	// A field that had already expired was not there to delete
+	if expiresAt.Valid && now > expiresAt.Int64 {
+		return false, nil
+	}
+	s.notify.publish(key, "hdel")
+	return true, nil
+}
+
+// purgeExpiredField deletes field of hash key if it is still expired, and the
+// hash with its last field. Like purgeExpired, it leaves fields written in
+// the meantime alone.
+func (s *Store) purgeExpiredField(key, field string) error {
+	now := s.now().Unix()
+	return s.update(func(tx *sql.Tx) error {
+		purgeSQL := fmt.Sprintf(`
+		DELETE FROM %s WHERE key = ? AND field = ? AND expires_at IS NOT NULL AND expires_at < ?;`, s.quoteHashTable())
+		result, err := tx.ExecContext(s.ctx, purgeSQL, key, field, now)
+		if err != nil {
+			return fmt.Errorf("failed to delete expired field %q of hash %q from table %q: %w", field, key, s.table, err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return nil
+		}
+		if n, err := s.countFields(tx, key); err != nil || n > 0 {
+			return err
+		}
+		parentSQL := fmt.Sprintf(`DELETE FROM %s WHERE key = ? AND type = 'hash';`, s.quoteTable())
+		if _, err := tx.ExecContext(s.ctx, parentSQL, key); err != nil {
+			return fmt.Errorf("failed to delete hash %q from table %q: %w", key, s.table, err)
+		}
+		return nil
+	})
+}
+
+// countFields returns the number of field rows, expired or not, of hash key.
+func (s *Store) countFields(q queryer, key string) (int, error) {
+	var n int
+	countSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE key = ?;`, s.quoteHashTable())
+	if err := q.QueryRowContext(s.ctx, countSQL, key).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count fields of hash %q in table %q: %w", key, s.table, err)
+	}
+	return n, nil
+}
+
+// HExpire sets a TTL on field in the hash stored at key, so fields such as
+// per-sensor last-seen values can expire independently of the hash. A ttl of
+// 0 or negative removes the field's TTL. It reports whether the field exists.
+// Returns ErrWrongType if key holds another type.
+func (s *Store) HExpire(key, field string, ttl time.Duration) (bool, error) {
+	defer s.observe("hexpire", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return false, err
+	}
+	if err := s.Sync(); err != nil {
+		return false, err
+	}
+	now := s.now()
+
+	var expiresAt interface{} // NULL removes the TTL
+	if ttl > 0 {
+		expiresAt = now.Add(ttl).Unix()
+	}
+
+	var updated bool
+	err := s.update(func(tx *sql.Tx) error {
+		if ok, err := s.liveHash(tx, key, now.Unix()); !ok {
+			return err
+		}
+
+		hexpireSQL := fmt.Sprintf(`
+		UPDATE %s SET expires_at = ?
+		WHERE key = ? AND field = ? AND (expires_at IS NULL OR expires_at >= ?);`, s.quoteHashTable())
+		result, err := tx.ExecContext(s.ctx, hexpireSQL, expiresAt, key, field, now.Unix())
+		if err != nil {
+			return fmt.Errorf("failed to set TTL on field %q of hash %q in table %q: %w", field, key, s.table, err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return nil
+		}
+		updated = true
+
+		touchSQL := fmt.Sprintf(`UPDATE %s SET version = version + 1, updated_at = ? WHERE key = ?;`, s.quoteTable())
+		if _, err := tx.ExecContext(s.ctx, touchSQL, now.Unix(), key); err != nil {
+			return fmt.Errorf("failed to update hash %q in table %q: %w", key, s.table, err)
+		}
+		return nil
+	})
+	if err != nil || !updated {
+		return false, err
+	}
+	s.notify.publish(key, "hexpire")
+	return true, nil
+}
+
+// HTTL returns the remaining time to live of field in the hash stored at key,
+// with the same conventions as TTL: -1 if the field has no TTL, and
+// ErrKeyNotFound if the key or field does not exist or is expired.
+func (s *Store) HTTL(key, field string) (time.Duration, error) {
+	defer s.observe("httl", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+	now := s.now()
+	if ok, err := s.liveHash(s.q(), key, now.Unix()); !ok {
+		if err == nil {
+			err = ErrKeyNotFound
+		}
+		return 0, err
+	}
+
+	var expiresAt sql.NullInt64
+	httlSQL := fmt.Sprintf(`SELECT expires_at FROM %s WHERE key = ? AND field = ?;`, s.quoteHashTable())
+	err := s.queryRow(httlSQL, key, field).Scan(&expiresAt)
+	if err == sql.ErrNoRows {
+		return 0, ErrKeyNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get TTL of field %q of hash %q in table %q: %w", field, key, s.table, err)
+	}
+	if !expiresAt.Valid {
+		return -1, nil
+	}
+
+	expiryTime := time.Unix(expiresAt.Int64, 0)
+	if expiryTime.Before(now) {
+		go s.purgeExpiredField(key, field) // Delete asynchronously, ignore error here
+		return 0, ErrKeyNotFound
+	}
+	return expiryTime.Sub(now), nil
+}
+
+// HashField is a field and its value, as returned by HScan and carried by
+// mirrors and backup records.
+type HashField struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+}
+
+// HScan incrementally iterates over the live fields of the hash stored at key
+// that match the glob pattern match (same syntax as Keys, empty matches all),
+// returning at most count fields per call in field order. Pass an empty
+// cursor to start; the returned cursor is passed to the next call and is
+// empty once the iteration is complete. Returns ErrWrongType if key holds
+// another type.
+func (s *Store) HScan(key, cursor, match string, count int) ([]HashField, string, error) {
+	defer s.observe("hscan", time.Now())
+
+	key = s.canonicalKey(key)
+	if count <= 0 {
+		count = 10 // Redis HSCAN default COUNT
+	}
+	if match == "" {
+		match = "*"
+	}
+	if err := s.Sync(); err != nil {
+		return nil, "", err
+	}
+	now := s.now().Unix()
+	if ok, err := s.liveHash(s.q(), key, now); !ok {
+		return nil, "", err
+	}
+
+	hscanSQL := fmt.Sprintf(`
+	SELECT field, value, codec, transforms FROM %s
+	WHERE key = ? AND field > ? AND field LIKE ? ESCAPE '\' AND (expires_at IS NULL OR expires_at >= ?)
+	ORDER BY field LIMIT ?;`, s.quoteHashTable())
+	rows, err := s.query(hscanSQL, key, cursor, globToSQLLike(match), now, count)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to scan hash %q in table %q: %w", key, s.table, err)
+	}
+	defer rows.Close()
+
+	var fields []HashField
+	for rows.Next() {
+		var f HashField
+		var stored []byte
+		var codec byte
+		var transforms sql.NullString
+		if err := rows.Scan(&f.Field, &stored, &codec, &transforms); err != nil {
+			return nil, "", fmt.Errorf("failed to scan field of hash %q in table %q: %w", key, s.table, err)
+		}
+		if f.Value, err = s.decodeValue(stored, codec, transforms); err != nil {
+			return nil, "", fmt.Errorf("failed to get field %q of hash %q from table %q: %w", f.Field, key, s.table, err)
+		}
+		fields = append(fields, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("error iterating through fields of hash %q in table %q: %w", key, s.table, err)
+	}
+
+	if len(fields) < count {
+		return fields, "", nil
+	}
+	return fields, fields[len(fields)-1].Field, nil
+}
+
+// HRandField returns random field names from the hash stored at key, for
+// sampling large hashes. Like Redis HRANDFIELD, a positive n returns up to n
+// distinct fields, and a negative n returns exactly -n fields that may repeat.
+// It returns nil if the key does not exist. Returns ErrWrongType if key holds
+// another type.
+func (s *Store) HRandField(key string, n int) ([]string, error) {
+	defer s.observe("hrandfield", time.Now())
+
+	key = s.canonicalKey(key)
+	if n == 0 {
+		return nil, nil
+	}
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+	now := s.now().Unix()
+	if ok, err := s.liveHash(s.q(), key, now); !ok {
+		return nil, err
+	}
+
+	// Distinct samples come straight from SQLite; repeated ones are drawn from all fields
+	limit := n
+	if n < 0 {
+		limit = -1 // No limit
+	}
+	randSQL := fmt.Sprintf(`
+	SELECT field FROM %s WHERE key = ? AND (expires_at IS NULL OR expires_at >= ?)
+	ORDER BY random() LIMIT ?;`, s.quoteHashTable())
+	rows, err := s.query(randSQL, key, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample hash %q in table %q: %w", key, s.table, err)
+	}
+	defer rows.Close()
+
+	var fields []string
+	for rows.Next() {
+		var field string
+		if err := rows.Scan(&field); err != nil {
+			return nil, fmt.Errorf("failed to scan field of hash %q in table %q: %w", key, s.table, err)
+		}
+		fields = append(fields, field)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through fields of hash %q in table %q: %w", key, s.table, err)
+	}
+
+	if n > 0 || len(fields) == 0 {
+		return fields, nil
+	}
+	sample := make([]string, -n)
+	for i := range sample {
+		sample[i] = fields[rand.IntN(len(fields))]
+	}
+	return sample, nil
+}
@@ -0,0 +1,157 @@
+package mkvstore
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// expireField backdates the expiry of a hash field so it reads as expired.
+func expireField(t *testing.T, store *Store, key, field string) {
+	t.Helper()
+	expireSQL := fmt.Sprintf(`UPDATE %s SET expires_at = ? WHERE key = ? AND field = ?;`, store.quoteHashTable())
+	if _, err := store.db.Exec(expireSQL, time.Now().Add(-time.Minute).Unix(), key, field); err != nil {
+		t.Fatalf("Failed to backdate field %q: %v", field, err)
+	}
+}
+
+// TestHashSetGetDel tests basic hash field operations.
+func TestHashSetGetDel(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	store.HSet("device:1", "temp", "21.5")
+	store.HSet("device:1", "hum", "40")
+	if v, err := store.HGet("device:1", "temp"); err != nil || v != "21.5" {
+		t.Errorf("HGet(temp) = %q, %v; expected 21.5", v, err)
+	}
+	if _, err := store.HGet("device:1", "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound for missing field, got %v", err)
+	}
+	if all, err := store.HGetAll("device:1"); err != nil || len(all) != 2 || all["hum"] != "40" {
+		t.Errorf("HGetAll = %v, %v", all, err)
+	}
+
+	if _, err := store.Get("device:1"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from Get on a hash, got %v", err)
+	}
+	store.Set("plain", "v", 0)
+	if err := store.HSet("plain", "f", "v"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from HSet on a string, got %v", err)
+	}
+
+	store.HDel("device:1", "temp")
+	store.HDel("device:1", "hum")
+	if exists, _ := store.Exists("device:1"); exists {
+		t.Error("Expected hash to be deleted with its last field")
+	}
+}
+
+// TestHashOverwriteDropsFields tests that replacing a hash drops its fields.
+func TestHashOverwriteDropsFields(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	store.HSet("h", "f", "v")
+	store.Set("h", "string now", 0)
+	if n, _ := store.countFields(store.db, "h"); n != 0 {
+		t.Errorf("Expected fields to be dropped on overwrite, %d left", n)
+	}
+
+	store.Del("h")
+	store.HSet("h", "f", "v")
+	store.Del("h")
+	if n, _ := store.countFields(store.db, "h"); n != 0 {
+		t.Errorf("Expected fields to be dropped on delete, %d left", n)
+	}
+}
+
+// TestHExpire tests per-field TTLs.
+func TestHExpire(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	store.HSet("device:1", "sensor:a", "1")
+	store.HSet("device:1", "sensor:b", "2")
+
+	if ok, err := store.HExpire("device:1", "sensor:a", time.Hour); err != nil || !ok {
+		t.Fatalf("HExpire = %v, %v; expected true", ok, err)
+	}
+	if ok, _ := store.HExpire("device:1", "missing", time.Hour); ok {
+		t.Error("Expected HExpire on a missing field to return false")
+	}
+	if ttl, err := store.HTTL("device:1", "sensor:a"); err != nil || ttl <= 59*time.Minute {
+		t.Errorf("HTTL(sensor:a) = %s, %v; expected about 1h", ttl, err)
+	}
+	if ttl, _ := store.HTTL("device:1", "sensor:b"); ttl != -1 {
+		t.Errorf("HTTL(sensor:b) = %s, expected -1", ttl)
+	}
+
+	expireField(t, store, "device:1", "sensor:a")
+	if _, err := store.HGet("device:1", "sensor:a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected expired field to be gone, got %v", err)
+	}
+	if n, _ := store.HLen("device:1"); n != 1 {
+		t.Errorf("HLen = %d, expected 1", n)
+	}
+	if v, _ := store.HGet("device:1", "sensor:b"); v != "2" {
+		t.Errorf("Expected other field to survive, got %q", v)
+	}
+
+	// Writing a field clears its TTL
+	store.HExpire("device:1", "sensor:b", time.Hour)
+	store.HSet("device:1", "sensor:b", "3")
+	if ttl, _ := store.HTTL("device:1", "sensor:b"); ttl != -1 {
+		t.Errorf("Expected HSet to clear the field TTL, got %s", ttl)
+	}
+}
+
+// TestHScan tests incremental iteration over hash fields.
+func TestHScan(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	for i := 0; i < 25; i++ {
+		store.HSet("big", fmt.Sprintf("f%02d", i), fmt.Sprint(i))
+	}
+	store.HSet("big", "other", "x")
+
+	var seen []HashField
+	cursor := ""
+	for calls := 0; ; calls++ {
+		if calls > 10 {
+			t.Fatal("HScan did not terminate")
+		}
+		page, next, err := store.HScan("big", cursor, "f*", 10)
+		if err != nil {
+			t.Fatalf("HScan failed: %v", err)
+		}
+		seen = append(seen, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(seen) != 25 || seen[3] != (HashField{"f03", "3"}) {
+		t.Errorf("Expected 25 f* fields in order, got %d: %v", len(seen), seen)
+	}
+}
+
+// TestHRandField tests random field sampling.
+func TestHRandField(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	store.HSet("h", "a", "1")
+	store.HSet("h", "b", "2")
+	store.HSet("h", "c", "3")
+
+	if fields, err := store.HRandField("h", 2); err != nil || len(fields) != 2 || fields[0] == fields[1] {
+		t.Errorf("HRandField(2) = %v, %v; expected 2 distinct fields", fields, err)
+	}
+	if fields, _ := store.HRandField("h", 10); len(fields) != 3 {
+		t.Errorf("HRandField(10) = %v, expected all 3 fields", fields)
+	}
+	if fields, _ := store.HRandField("h", -7); len(fields) != 7 {
+		t.Errorf("HRandField(-7) = %v, expected 7 fields", fields)
+	}
+	if fields, _ := store.HRandField("missing", 2); len(fields) != 0 {
+		t.Errorf("HRandField on a missing key = %v, expected none", fields)
+	}
+}
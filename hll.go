@@ -0,0 +1,328 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+// HyperLogLogs are strings holding a HyperLogLog sketch of 2^12 registers,
+// for a standard error of about 1.6% at any cardinality. A sketch with few
+// registers set is stored sparse, 3 bytes per register, and one with many
+// dense, 6 bits per register, so it never takes more than about 3 KiB.
+const (
+	hllPrecision = 12
+	hllRegisters = 1 << hllPrecision
+	hllDenseSize = hllRegisters * 6 / 8
+
+	hllMagic  = "MKHL"
+	hllSparse = 'S' // Followed by (uint16 index, uint8 rank) entries by index
+	hllDense  = 'D' // Followed by the 6-bit registers, packed big-endian
+)
+
+// hllSketch holds the registers of a HyperLogLog, the maximum rank seen per
+// bucket of hashes.
+type hllSketch [hllRegisters]uint8
+
+// hllHash hashes element to 64 bits that stay the same across processes and
+// versions, so sketches stored by one are valid for all. FNV-1a is mixed with
+// the SplitMix64 finalizer to spread its bits.
+func hllHash(element string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(element))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// add records element and reports whether a register changed.
+func (h *hllSketch) add(element string) bool {
+	x := hllHash(element)
+	index := x >> (64 - hllPrecision)
+	// The guard bit caps the rank when the remaining bits are all zero
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h[index] {
+		h[index] = rank
+		return true
+	}
+	return false
+}
+
+// merge makes h count the elements of other too and reports whether a
+// register changed.
+func (h *hllSketch) merge(other *hllSketch) bool {
+	changed := false
+	for i, rank := range other {
+		if rank > h[i] {
+			h[i] = rank
+			changed = true
+		}
+	}
+	return changed
+}
+
+// count estimates the number of distinct elements, correcting small
+// cardinalities by linear counting.
+func (h *hllSketch) count() int64 {
+	const m = float64(hllRegisters)
+	alpha := 0.7213 / (1 + 1.079/m)
+	sum, zeros := 0.0, 0
+	for _, rank := range h {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
+
+// encode returns the stored form of h, sparse if smaller.
+func (h *hllSketch) encode() string {
+	set := 0
+	for _, rank := range h {
+		if rank > 0 {
+			set++
+		}
+	}
+	var b strings.Builder
+	b.WriteString(hllMagic)
+	if set*3 < hllDenseSize {
+		b.WriteByte(hllSparse)
+		for i, rank := range h {
+			if rank > 0 {
+				b.Write(binary.BigEndian.AppendUint16(nil, uint16(i)))
+				b.WriteByte(rank)
+			}
+		}
+		return b.String()
+	}
+	b.WriteByte(hllDense)
+	packed := make([]byte, hllDenseSize)
+	for i, rank := range h {
+		bit := i * 6
+		word := uint16(rank) << (10 - bit%8)
+		packed[bit/8] |= byte(word >> 8)
+		if bit/8+1 < len(packed) {
+			packed[bit/8+1] |= byte(word)
+		}
+	}
+	b.Write(packed)
+	return b.String()
+}
+
+// decodeHLL parses the stored form of a sketch. Returns ErrWrongType if value
+// is not one.
+func decodeHLL(value string) (*hllSketch, error) {
+	body, ok := strings.CutPrefix(value, hllMagic)
+	if !ok || body == "" {
+		return nil, fmt.Errorf("%w: not a HyperLogLog", ErrWrongType)
+	}
+	h := new(hllSketch)
+	data := body[1:]
+	switch body[0] {
+	case hllSparse:
+		if len(data)%3 != 0 {
+			return nil, fmt.Errorf("%w: corrupt sparse HyperLogLog", ErrWrongType)
+		}
+		for i := 0; i < len(data); i += 3 {
+			index := binary.BigEndian.Uint16([]byte(data[i : i+2]))
+			if int(index) >= hllRegisters {
+				return nil, fmt.Errorf("%w: corrupt sparse HyperLogLog", ErrWrongType)
+			}
+			h[index] = data[i+2]
+		}
+	case hllDense:
+		if len(data) != hllDenseSize {
+			return nil, fmt.Errorf("%w: corrupt dense HyperLogLog", ErrWrongType)
+		}
+		for i := range h {
+			bit := i * 6
+			word := uint16(data[bit/8]) << 8
+			if bit/8+1 < len(data) {
+				word |= uint16(data[bit/8+1])
+			}
+			h[i] = uint8(word>>(10-bit%8)) & 0x3f
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown HyperLogLog encoding", ErrWrongType)
+	}
+	return h, nil
+}
+
+// readHLL reads the sketch stored at key using q, following aliases, or an
+// empty one if the key does not exist.
+func (s *Store) readHLL(q queryer, key string) (*hllSketch, error) {
+	value, err := s.getString(q, key)
+	if err == ErrKeyNotFound {
+		return new(hllSketch), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeHLL(value)
+}
+
+// PFAdd adds elements to the HyperLogLog stored at key, creating it if needed
+// with the default TTL of its prefix, if any (see WithPrefixTTL), and reports
+// whether its estimate may have changed, like Redis PFADD. An existing key
+// keeps its TTL. The sketch takes at most about 3 KiB however many elements
+// are added, e.g. to count unique client IDs per day on small devices.
+// Returns ErrWrongType if key holds anything but a HyperLogLog.
+func (s *Store) PFAdd(key string, elements ...string) (bool, error) {
+	defer s.observe("pfadd", time.Now())
+	return s.updateHLL(key, "pfadd", func(tx *sql.Tx, h *hllSketch, created bool) (bool, error) {
+		changed := created
+		for _, element := range elements {
+			if h.add(element) {
+				changed = true
+			}
+		}
+		return changed, nil
+	})
+}
+
+// PFCount returns the approximate number of distinct elements added to the
+// HyperLogLogs stored at keys, counting each element once across all of
+// them. Missing keys are empty. Returns ErrWrongType if a key holds anything
+// but a HyperLogLog.
+func (s *Store) PFCount(keys ...string) (int64, error) {
+	defer s.observe("pfcount", time.Now())
+
+	keys = s.canonicalKeys(keys)
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+	union := new(hllSketch)
+	for _, key := range keys {
+		h, err := s.readHLL(s.q(), key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count HyperLogLog %q in table %q: %w", key, s.table, err)
+		}
+		union.merge(h)
+	}
+	return union.count(), nil
+}
+
+// PFMerge merges the HyperLogLogs stored at sources into the one stored at
+// dest, creating it if needed, in one transaction, e.g. to roll daily
+// counts up into a weekly one. Missing sources are empty.
+// Returns ErrWrongType if a key holds anything but a HyperLogLog.
+func (s *Store) PFMerge(dest string, sources ...string) error {
+	defer s.observe("pfmerge", time.Now())
+
+	sources = s.canonicalKeys(sources)
+	_, err := s.updateHLL(dest, "pfmerge", func(tx *sql.Tx, h *hllSketch, created bool) (bool, error) {
+		for _, source := range sources {
+			other, err := s.readHLL(tx, source)
+			if err != nil {
+				return false, fmt.Errorf("failed to read HyperLogLog %q in table %q: %w", source, s.table, err)
+			}
+			h.merge(other)
+		}
+		return true, nil
+	})
+	return err
+}
+
+// updateHLL applies fn to the sketch stored at key in one transaction, like
+// Append, writing it back if fn reports a change. created tells fn that the
+// key did not exist yet. op names the event published.
+func (s *Store) updateHLL(key, op string, fn func(tx *sql.Tx, h *hllSketch, created bool) (bool, error)) (bool, error) {
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return false, err
+	}
+	if err := s.Sync(); err != nil {
+		return false, err
+	}
+
+	for range 2 {
+		var changed bool
+		var expiresAt interface{}
+		err := s.update(func(tx *sql.Tx) error {
+			now := s.now()
+			var stored []byte
+			var codec byte
+			var transforms sql.NullString
+			var keyType string
+			var oldExpiresAt sql.NullInt64
+			readSQL := fmt.Sprintf(`SELECT value, codec, transforms, type, expires_at FROM %s WHERE key = ?;`, s.quoteTable())
+			err := tx.QueryRowContext(s.ctx, readSQL, key).Scan(&stored, &codec, &transforms, &keyType, &oldExpiresAt)
+			live := err == nil && (!oldExpiresAt.Valid || oldExpiresAt.Int64 >= now.Unix())
+
+			h := new(hllSketch)
+			switch {
+			case err != nil && err != sql.ErrNoRows:
+				return fmt.Errorf("failed to read key %q in table %q: %w", key, s.table, err)
+			case !live:
+				if ttl := s.effectiveTTL(key, 0); ttl > 0 {
+					expiresAt = now.Add(ttl).Unix()
+				}
+			case keyType == "archived":
+				return errArchived
+			case keyType != "string":
+				return ErrWrongType
+			default:
+				value, err := s.decodeValue(stored, codec, transforms)
+				if err != nil {
+					return fmt.Errorf("failed to read key %q in table %q: %w", key, s.table, err)
+				}
+				if h, err = decodeHLL(value); err != nil {
+					return err
+				}
+				if oldExpiresAt.Valid {
+					expiresAt = oldExpiresAt.Int64
+				}
+			}
+
+			if changed, err = fn(tx, h, !live); err != nil || !changed {
+				return err
+			}
+			enc, err := s.encodeValue(key, h.encode())
+			if err != nil {
+				return fmt.Errorf("failed to update HyperLogLog %q in table %q: %w", key, s.table, err)
+			}
+			if !live {
+				// Replaces an expired row, which then starts a new life
+				_, err = tx.ExecContext(s.ctx, fmt.Sprintf(`DELETE FROM %s WHERE key = ?;`, s.quoteTable()), key)
+				if err != nil {
+					return fmt.Errorf("failed to update HyperLogLog %q in table %q: %w", key, s.table, err)
+				}
+			}
+			_, err = tx.ExecContext(s.ctx, s.setSQL(), key, enc.data, expiresAt, now.Unix(), enc.codec, enc.transforms)
+			if err != nil {
+				return fmt.Errorf("failed to update HyperLogLog %q in table %q: %w", key, s.table, err)
+			}
+			return nil
+		})
+		if err == errArchived {
+			// Bring the value back from the archive and try again
+			if err := s.restoreArchived(key); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if changed {
+			s.trackExpiry(key, expiresAt)
+			s.notify.publish(key, op)
+		}
+		return changed, nil
+	}
+	return false, ErrWrongType // Still archived
+}
@@ -0,0 +1,124 @@
+package mkvstore
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// TestPFAddCount tests that PFCount estimates distinct elements within the
+// expected error and that the sketch stays compact.
+func TestPFAddCount(t *testing.T) {
+	store := setupStore(t)
+	defer store.Close()
+
+	if changed, err := store.PFAdd("visitors"); err != nil || !changed {
+		t.Errorf("PFAdd creating the key = %v, %v, expected true", changed, err)
+	}
+	if n, err := store.PFCount("visitors"); err != nil || n != 0 {
+		t.Errorf("PFCount of an empty HyperLogLog = %d, %v", n, err)
+	}
+	if changed, err := store.PFAdd("visitors", "a", "b", "c"); err != nil || !changed {
+		t.Errorf("PFAdd = %v, %v, expected true", changed, err)
+	}
+	if changed, err := store.PFAdd("visitors", "a", "b"); err != nil || changed {
+		t.Errorf("PFAdd of seen elements = %v, %v, expected false", changed, err)
+	}
+	if n, err := store.PFCount("visitors"); err != nil || n != 3 {
+		t.Errorf("PFCount = %d, %v, expected 3", n, err)
+	}
+
+	for _, total := range []int{100, 10000, 100000} {
+		key := fmt.Sprintf("clients:%d", total)
+		batch := make([]string, 0, 1000)
+		for i := 0; i < total; i++ {
+			batch = append(batch, fmt.Sprintf("client-%d", i))
+			if len(batch) == cap(batch) || i == total-1 {
+				if _, err := store.PFAdd(key, batch...); err != nil {
+					t.Fatalf("PFAdd failed: %v", err)
+				}
+				batch = batch[:0]
+			}
+		}
+		n, err := store.PFCount(key)
+		if err != nil {
+			t.Fatalf("PFCount failed: %v", err)
+		}
+		if e := math.Abs(float64(n)-float64(total)) / float64(total); e > 0.05 {
+			t.Errorf("PFCount of %d elements = %d, off by %.1f%%", total, n, e*100)
+		}
+		value, err := store.Get(key)
+		if err != nil || len(value) > len(hllMagic)+1+hllDenseSize {
+			t.Errorf("HyperLogLog of %d elements takes %d bytes, %v", total, len(value), err)
+		}
+	}
+
+	if n, err := store.PFCount("missing"); err != nil || n != 0 {
+		t.Errorf("PFCount of a missing key = %d, %v", n, err)
+	}
+	store.Set("str", "value", 0)
+	if _, err := store.PFAdd("str", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from PFAdd on a plain string, got %v", err)
+	}
+	if _, err := store.PFCount("str"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from PFCount on a plain string, got %v", err)
+	}
+	store.HSet("hash", "f", "v")
+	if _, err := store.PFAdd("hash", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from PFAdd on a hash, got %v", err)
+	}
+}
+
+// TestPFMerge tests merging HyperLogLogs and counting their union.
+func TestPFMerge(t *testing.T) {
+	store := setupStore(t)
+	defer store.Close()
+
+	for i := 0; i < 3000; i++ {
+		store.PFAdd("day1", fmt.Sprintf("client-%d", i))
+		store.PFAdd("day2", fmt.Sprintf("client-%d", i+2000))
+	}
+	union, err := store.PFCount("day1", "day2")
+	if err != nil {
+		t.Fatalf("PFCount failed: %v", err)
+	}
+	if math.Abs(float64(union)-5000)/5000 > 0.05 {
+		t.Errorf("PFCount of the union = %d, expected about 5000", union)
+	}
+
+	if err := store.PFMerge("week", "day1", "day2", "missing"); err != nil {
+		t.Fatalf("PFMerge failed: %v", err)
+	}
+	if n, err := store.PFCount("week"); err != nil || n != union {
+		t.Errorf("PFCount of the merge = %d, %v, expected %d", n, err, union)
+	}
+	store.Set("str", "value", 0)
+	if err := store.PFMerge("week", "str"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType merging a plain string, got %v", err)
+	}
+}
+
+// TestPFAddKeepsTTL tests that adding to a HyperLogLog keeps its TTL and that
+// an expired one starts over.
+func TestPFAddKeepsTTL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := setupWALStore(t, WithClock(func() time.Time { return now }))
+	defer store.Close()
+
+	store.PFAdd("today", "a", "b")
+	if _, err := store.Expire("today", time.Hour); err != nil {
+		t.Fatalf("Expire failed: %v", err)
+	}
+	store.PFAdd("today", "c")
+	if ttl, err := store.TTL("today"); err != nil || ttl != time.Hour {
+		t.Errorf("TTL after PFAdd = %v, %v, expected 1h", ttl, err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	store.PFAdd("today", "d")
+	if n, err := store.PFCount("today"); err != nil || n != 1 {
+		t.Errorf("PFCount after expiry = %d, %v, expected 1", n, err)
+	}
+}
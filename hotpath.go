@@ -0,0 +1,153 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// hotStatements caches the statements of the read hot path: their SQL is
+// built once per table rather than per call, and prepared once for the
+// connection pool, which keeps Get and GetInto light on allocations.
+type hotStatements struct {
+	getSQL string // Query of readString, taking the key
+
+	mu     sync.Mutex
+	get    *sql.Stmt // getSQL prepared on the pool, nil until first used
+	closed bool
+}
+
+// newHotStatements builds the hot path statements of table.
+func newHotStatements(table string) *hotStatements {
+	return &hotStatements{
+		getSQL: fmt.Sprintf(`
+	SELECT value, codec, transforms, type, expires_at, max(COALESCE(accessed_at, 0), COALESCE(updated_at, 0))
+	FROM %s WHERE key = ?;`, quoteIdent(table)),
+	}
+}
+
+// getStmt returns getSQL prepared on db, preparing it on first use.
+func (h *hotStatements) getStmt(db *sql.DB) (*sql.Stmt, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.get == nil {
+		if h.closed {
+			return nil, sql.ErrConnDone
+		}
+		stmt, err := db.Prepare(h.getSQL)
+		if err != nil {
+			return nil, err
+		}
+		h.get = stmt
+	}
+	return h.get, nil
+}
+
+// close releases the prepared statements.
+func (h *hotStatements) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	if h.get != nil {
+		h.get.Close()
+		h.get = nil
+	}
+}
+
+// queryGet runs the readString query for key on q, through the prepared
+// statement when q is the connection pool.
+func (s *Store) queryGet(ctx context.Context, q queryer, key string) (*sql.Rows, error) {
+	if db, ok := q.(*sql.DB); ok && db == s.db {
+		stmt, err := s.hot.getStmt(db)
+		if err != nil {
+			return nil, err
+		}
+		return stmt.QueryContext(ctx, key)
+	}
+	return q.QueryContext(ctx, s.hot.getSQL, key)
+}
+
+// GetInto copies the string value of key into buf and returns its length,
+// for read-heavy callers that want to reuse one buffer across millions of
+// reads instead of allocating a string per Get. If buf is too small, nothing
+// is copied and GetInto returns the length needed with io.ErrShortBuffer.
+// Plain values are copied straight from SQLite's row buffer; compressed or
+// transformed values, aliases and archived keys take the Get path.
+// Returns ErrKeyNotFound if the key does not exist or is expired, and
+// ErrWrongType if it is not a string.
+func (s *Store) GetInto(key string, buf []byte) (int, error) {
+	defer s.observe("get", time.Now())
+
+	key = s.canonicalKey(key)
+	if w, found, err := s.bufferedValue(key); found {
+		if err != nil {
+			return 0, err
+		}
+		return copyValue(buf, w.value)
+	}
+
+	rows, err := s.queryGet(s.queryCtx(), s.q(), key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get key %q from table %q: %w", key, s.table, err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, fmt.Errorf("failed to get key %q from table %q: %w", key, s.table, err)
+		}
+		rows.Close()
+		value, err := s.getArchived(key) // Fall through to attached databases
+		if err != nil {
+			return 0, err
+		}
+		return copyValue(buf, value)
+	}
+
+	r := getRowPool.Get().(*getRow)
+	defer getRowPool.Put(r)
+	if err := rows.Scan(&r.stored, &r.codec, &r.transforms, &r.keyType, &r.expiresAt, &r.lastUsed); err != nil {
+		return 0, fmt.Errorf("failed to get key %q from table %q: %w", key, s.table, err)
+	}
+	stored, expiresAt, lastUsed := r.stored, r.expiresAt, r.lastUsed
+	if string(r.keyType) != "string" || r.codec != CompressionNone || r.transforms != nil {
+		rows.Close()
+		value, err := s.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		return copyValue(buf, value)
+	}
+	if expiresAt.Valid && s.now().Unix() > expiresAt.Int64 {
+		go s.purgeExpired(key) // Delete asynchronously, ignore error here
+		return 0, ErrKeyNotFound
+	}
+	if n := s.touchInterval(); n > 0 && s.now().Unix()-lastUsed >= n {
+		go s.touch(key) // Record asynchronously, ignore error here
+	}
+	if len(stored) > len(buf) {
+		return len(stored), io.ErrShortBuffer
+	}
+	return copy(buf, stored), nil
+}
+
+// getRow holds the columns scanned by GetInto. Rows are pooled, as values
+// scanned into must escape to the heap.
+type getRow struct {
+	stored, keyType, transforms sql.RawBytes
+	codec                       byte
+	expiresAt                   sql.NullInt64
+	lastUsed                    int64
+}
+
+var getRowPool = sync.Pool{New: func() any { return new(getRow) }}
+
+// copyValue copies value into buf like GetInto.
+func copyValue(buf []byte, value string) (int, error) {
+	if len(value) > len(buf) {
+		return len(value), io.ErrShortBuffer
+	}
+	return copy(buf, value), nil
+}
@@ -0,0 +1,44 @@
+package mkvstore
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGetInto tests that GetInto copies plain and encoded values into the
+// caller's buffer and reports short buffers.
+func TestGetInto(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "getinto.db")
+	store, err := Open(dbPath, "test_kv_getinto", WithCompression(CompressionGzip, 64))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	big := strings.Repeat("compressible ", 20)
+	store.Set("plain", "hello", 0)
+	store.Set("big", big, 0)
+	store.Alias("link", "plain")
+
+	buf := make([]byte, 512)
+	for key, expected := range map[string]string{"plain": "hello", "big": big, "link": "hello"} {
+		n, err := store.GetInto(key, buf)
+		if err != nil || string(buf[:n]) != expected {
+			t.Errorf("GetInto(%q) = %q, %v, expected %q", key, buf[:n], err, expected)
+		}
+	}
+
+	if n, err := store.GetInto("plain", make([]byte, 2)); !errors.Is(err, io.ErrShortBuffer) || n != 5 {
+		t.Errorf("GetInto with a short buffer = %d, %v, expected 5 and io.ErrShortBuffer", n, err)
+	}
+	if _, err := store.GetInto("missing", buf); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("GetInto of a missing key = %v, expected ErrKeyNotFound", err)
+	}
+	store.HSet("hash", "f", "v")
+	if _, err := store.GetInto("hash", buf); !errors.Is(err, ErrWrongType) {
+		t.Errorf("GetInto of a hash = %v, expected ErrWrongType", err)
+	}
+}
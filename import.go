@@ -0,0 +1,237 @@
+package mkvstore
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ImportOptions configures Import.
+type ImportOptions struct {
+	// Overwrite replaces keys that already exist. Otherwise they are kept
+	// and reported as skipped.
+	Overwrite bool
+
+	// ContinueOnError records failed records in the report and goes on with
+	// the next one. Otherwise Import stops at the first failure.
+	ContinueOnError bool
+}
+
+// ImportIssue is a record of an import that was skipped or failed.
+type ImportIssue struct {
+	Line   int    // Line of the record in the input, from 1
+	Key    string // Key of the record, empty if it could not be parsed
+	Reason string
+}
+
+// ImportReport is the outcome of Import, key by key, in input order.
+type ImportReport struct {
+	Created     []string
+	Overwritten []string
+	Skipped     []ImportIssue // Existing keys without Overwrite, and records already expired
+	Failed      []ImportIssue
+}
+
+// importOutcome is what importing one record did.
+type importOutcome int
+
+const (
+	importCreated importOutcome = iota
+	importOverwritten
+	importExists
+)
+
+// Import loads keys from r in the MirrorJSONL format written by MirrorTo:
+// one JSON object per line with the key, its type and its value, fields or
+// elements. Each key is written in its own transaction, replacing the whole
+// key when overwriting. The report lists what happened to every record, so
+// bulk loads from flaky sources give actionable results.
+//
+// Without ContinueOnError, Import returns the report so far and an error at
+// the first failed record; with it, the error is only for reading r.
+func (s *Store) Import(r io.Reader, opts ImportOptions) (ImportReport, error) {
+	defer s.observe("import", time.Now())
+
+	var report ImportReport
+	if err := s.Sync(); err != nil {
+		return report, err
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<30)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var k mirrorKey
+		err := json.Unmarshal(scanner.Bytes(), &k)
+		if err == nil {
+			k.Key = s.canonicalKey(k.Key)
+			if k.ExpiresAt > 0 && k.ExpiresAt < s.now().Unix() {
+				report.Skipped = append(report.Skipped, ImportIssue{Line: line, Key: k.Key, Reason: "expired"})
+				continue
+			}
+			var outcome importOutcome
+			if outcome, err = s.importKey(k, opts.Overwrite); err == nil {
+				switch outcome {
+				case importCreated:
+					report.Created = append(report.Created, k.Key)
+				case importOverwritten:
+					report.Overwritten = append(report.Overwritten, k.Key)
+				case importExists:
+					report.Skipped = append(report.Skipped, ImportIssue{Line: line, Key: k.Key, Reason: "key exists"})
+				}
+				continue
+			}
+		}
+		report.Failed = append(report.Failed, ImportIssue{Line: line, Key: k.Key, Reason: err.Error()})
+		if !opts.ContinueOnError {
+			return report, fmt.Errorf("failed to import line %d into table %q: %w", line, s.table, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return report, fmt.Errorf("failed to read import into table %q: %w", s.table, err)
+	}
+	return report, nil
+}
+
+// importKey writes the key of one import record in a transaction.
+func (s *Store) importKey(k mirrorKey, overwrite bool) (importOutcome, error) {
+	if k.Key == "" {
+		return 0, errors.New("record has no key")
+	}
+	if err := checkReserved(k.Key); err != nil {
+		return 0, err
+	}
+	op := "set"
+	switch {
+	case k.Type == "string" && k.Value != nil:
+	case k.Type == "hash" && len(k.Fields) > 0:
+		op = "hset"
+	case k.Type == "list" && len(k.Elements) > 0:
+		op = "rpush"
+	case k.Type == "set" && len(k.Members) > 0:
+		op = "sadd"
+	case k.Type == "zset" && len(k.Scored) > 0:
+		op = "zadd"
+	case k.Type == "stream" && len(k.Entries) > 0:
+		op = "xadd"
+	default:
+		return 0, fmt.Errorf("unsupported record of type %q for key %q", k.Type, k.Key)
+	}
+	var expiresAt interface{} // NULL for no expiration
+	if k.ExpiresAt > 0 {
+		expiresAt = k.ExpiresAt
+	}
+
+	now := s.now().Unix()
+	outcome := importCreated
+	err := s.update(func(tx *sql.Tx) error {
+		// An overwritten key keeps its creation time. Its versions go on
+		// above the old ones, as for any key created again, so GetIfChanged
+		// callers see the change
+		var live bool
+		createdAt := now
+		oldSQL := fmt.Sprintf(`
+		SELECT expires_at IS NULL OR expires_at >= ?2, created_at FROM %s WHERE key = ?1;`, s.quoteTable())
+		err := tx.QueryRowContext(s.ctx, oldSQL, k.Key, now).Scan(&live, &createdAt)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to read key %q in table %q: %w", k.Key, s.table, err)
+		}
+		if live && !overwrite {
+			outcome = importExists
+			return nil
+		}
+		if live {
+			outcome = importOverwritten
+		} else {
+			createdAt = now
+		}
+
+		// Triggers drop the fields or elements of the old key with its row
+		delSQL := fmt.Sprintf(`DELETE FROM %s WHERE key = ?;`, s.quoteTable())
+		if _, err := tx.ExecContext(s.ctx, delSQL, k.Key); err != nil {
+			return fmt.Errorf("failed to replace key %q in table %q: %w", k.Key, s.table, err)
+		}
+		enc := encodedValue{}
+		if k.Type == "string" {
+			if enc, err = s.encodeValue(k.Key, *k.Value); err != nil {
+				return fmt.Errorf("failed to import key %q into table %q: %w", k.Key, s.table, err)
+			}
+		}
+		insertSQL := fmt.Sprintf(`
+		INSERT INTO %s (key, value, type, expires_at, version, created_at, updated_at, codec, transforms)
+		VALUES (?, ?, ?, ?, %s, ?, ?, ?, ?);`, s.quoteTable(), firstVersionSQL(s.table))
+		_, err = tx.ExecContext(s.ctx, insertSQL, k.Key, enc.data, k.Type, expiresAt, createdAt, now, enc.codec, enc.transforms)
+		if err != nil {
+			return fmt.Errorf("failed to import key %q into table %q: %w", k.Key, s.table, err)
+		}
+
+		for _, f := range k.Fields {
+			enc, err := s.encodeValue(k.Key, f.Value)
+			if err != nil {
+				return fmt.Errorf("failed to import field %q of hash %q into table %q: %w", f.Field, k.Key, s.table, err)
+			}
+			fieldSQL := fmt.Sprintf(`
+			INSERT OR REPLACE INTO %s (key, field, value, codec, transforms, expires_at) VALUES (?, ?, ?, ?, ?, NULL);`, s.quoteHashTable())
+			if _, err := tx.ExecContext(s.ctx, fieldSQL, k.Key, f.Field, enc.data, enc.codec, enc.transforms); err != nil {
+				return fmt.Errorf("failed to import field %q of hash %q into table %q: %w", f.Field, k.Key, s.table, err)
+			}
+		}
+		for i, element := range k.Elements {
+			enc, err := s.encodeValue(k.Key, element)
+			if err != nil {
+				return fmt.Errorf("failed to import list %q into table %q: %w", k.Key, s.table, err)
+			}
+			elementSQL := fmt.Sprintf(`INSERT INTO %s (key, seq, value, codec, transforms) VALUES (?, ?, ?, ?, ?);`, s.quoteListTable())
+			if _, err := tx.ExecContext(s.ctx, elementSQL, k.Key, i+1, enc.data, enc.codec, enc.transforms); err != nil {
+				return fmt.Errorf("failed to import list %q into table %q: %w", k.Key, s.table, err)
+			}
+		}
+		for _, member := range k.Members {
+			memberSQL := fmt.Sprintf(`INSERT OR IGNORE INTO %s (key, member) VALUES (?, ?);`, s.quoteSetTable())
+			if _, err := tx.ExecContext(s.ctx, memberSQL, k.Key, member); err != nil {
+				return fmt.Errorf("failed to import set %q into table %q: %w", k.Key, s.table, err)
+			}
+		}
+		for _, m := range k.Scored {
+			if err := checkScore(m.Score); err != nil {
+				return fmt.Errorf("failed to import sorted set %q into table %q: %w", k.Key, s.table, err)
+			}
+			scoredSQL := fmt.Sprintf(`INSERT OR REPLACE INTO %s (key, member, score) VALUES (?, ?, ?);`, s.quoteZSetTable())
+			if _, err := tx.ExecContext(s.ctx, scoredSQL, k.Key, m.Member, m.Score); err != nil {
+				return fmt.Errorf("failed to import sorted set %q into table %q: %w", k.Key, s.table, err)
+			}
+		}
+		for _, entry := range k.Entries {
+			id, err := parseStreamID(entry.ID, 0)
+			if err == nil && len(entry.Fields) == 0 {
+				err = fmt.Errorf("entry %s has no fields", entry.ID)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to import stream %q into table %q: %w", k.Key, s.table, err)
+			}
+			fields, err := json.Marshal(entry.Fields)
+			if err != nil {
+				return fmt.Errorf("failed to import stream %q into table %q: %w", k.Key, s.table, err)
+			}
+			entrySQL := fmt.Sprintf(`INSERT OR REPLACE INTO %s (key, ms, seq, fields) VALUES (?, ?, ?, ?);`, s.quoteStreamTable())
+			if _, err := tx.ExecContext(s.ctx, entrySQL, k.Key, id.ms, id.seq, string(fields)); err != nil {
+				return fmt.Errorf("failed to import stream %q into table %q: %w", k.Key, s.table, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if outcome != importExists {
+		s.trackExpiry(k.Key, expiresAt)
+		s.notify.publish(k.Key, op)
+	}
+	return outcome, nil
+}
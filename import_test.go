@@ -0,0 +1,75 @@
+package mkvstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestImport tests that a JSONL mirror is imported with a report of created,
+// overwritten, skipped and failed keys.
+func TestImport(t *testing.T) {
+	source, _ := setupFileStore(t)
+	source.Set("s", "v", time.Hour)
+	source.HSet("h", "f", "1")
+	source.RPush("l", "a", "b")
+	var mirror bytes.Buffer
+	if err := source.MirrorTo(context.Background(), &mirror, MirrorJSONL); err != nil {
+		t.Fatalf("MirrorTo failed: %v", err)
+	}
+
+	store := setupStore(t)
+	store.Set("s", "old", 0)
+	report, err := store.Import(bytes.NewReader(mirror.Bytes()), ImportOptions{})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if expected := []string{"h", "l"}; !reflect.DeepEqual(report.Created, expected) {
+		t.Errorf("Created = %v, expected %v", report.Created, expected)
+	}
+	if len(report.Skipped) != 1 || report.Skipped[0].Key != "s" || report.Skipped[0].Reason != "key exists" {
+		t.Errorf("Skipped = %+v, expected the existing key s", report.Skipped)
+	}
+	if value, _ := store.HGet("h", "f"); value != "1" {
+		t.Errorf("HGet = %q, expected 1", value)
+	}
+	if n, _ := store.LLen("l"); n != 2 {
+		t.Errorf("LLen = %d, expected 2", n)
+	}
+
+	report, err = store.Import(bytes.NewReader(mirror.Bytes()), ImportOptions{Overwrite: true})
+	if err != nil || len(report.Overwritten) != 3 {
+		t.Fatalf("Import with Overwrite = %+v, %v, expected 3 keys overwritten", report, err)
+	}
+	if value, _ := store.Get("s"); value != "v" {
+		t.Errorf("Get = %q, expected the imported value", value)
+	}
+	if ttl, _ := store.TTL("s"); ttl <= 0 {
+		t.Errorf("TTL = %v, expected the imported expiration", ttl)
+	}
+
+	bad := strings.Join([]string{
+		`{"key":"a","type":"string","value":"1"}`,
+		`not json`,
+		`{"key":"__mkv:x","type":"string","value":"1"}`,
+		`{"key":"b","type":"string","value":"2"}`,
+	}, "\n")
+	report, err = store.Import(strings.NewReader(bad), ImportOptions{})
+	if err == nil || len(report.Created) != 1 || len(report.Failed) != 1 || report.Failed[0].Line != 2 {
+		t.Errorf("Import stopping on error = %+v, %v, expected to stop at line 2", report, err)
+	}
+	report, err = store.Import(strings.NewReader(bad), ImportOptions{Overwrite: true, ContinueOnError: true})
+	if err != nil || len(report.Failed) != 2 || len(report.Created) != 1 || report.Created[0] != "b" {
+		t.Errorf("Import continuing on error = %+v, %v, expected b created and 2 failures", report, err)
+	}
+	if !strings.Contains(report.Failed[1].Reason, ErrReservedKey.Error()) {
+		t.Errorf("Failure reason = %q, expected the reserved key error", report.Failed[1].Reason)
+	}
+	if _, err := store.Get("b"); errors.Is(err, ErrKeyNotFound) {
+		t.Error("Expected the records after failures to be imported")
+	}
+}
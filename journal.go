@@ -0,0 +1,201 @@
+package mkvstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// journalRecord is a buffered mutation as written to the write-behind journal.
+type journalRecord struct {
+	Key       string `json:"k"`
+	Value     []byte `json:"v,omitempty"` // base64 in JSON, so binary values survive
+	ExpiresAt *int64 `json:"e,omitempty"`
+	Deleted   bool   `json:"d,omitempty"`
+}
+
+// writeJournal is the append-only file recording the writes acknowledged by a
+// write-behind buffer but not yet committed (see FlashWearConfig.Journal).
+// Each flush seals the current file as <path>.flushing and starts a new one;
+// the sealed file is removed once its writes are committed, or put back in
+// front of the current one if the commit failed. At Open, the sealed file and
+// then the current one are replayed.
+type writeJournal struct {
+	path string
+	sync bool // fsync every record (see FlashWearConfig.JournalSync)
+	f    *os.File
+	size int64 // Bytes written to f
+	torn bool  // f ends with a partial record a failed append left behind
+}
+
+// journalPath returns the path of the write-behind journal of table in the
+// database file dbPath, or "" for in-memory databases.
+func journalPath(dbPath, table string) string {
+	path := databaseFile(dbPath)
+	if path == "" {
+		return ""
+	}
+	return path + "-" + table + ".journal"
+}
+
+// openWriteJournal opens the journal at path for appending.
+func openWriteJournal(path string, sync bool) (*writeJournal, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open write journal %q: %w", path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to open write journal %q: %w", path, err)
+	}
+	return &writeJournal{path: path, sync: sync, f: f, size: info.Size()}, nil
+}
+
+// append records buffered mutations in a single write, syncing it to disk
+// if configured, so a batch is journaled whole or not at all. A failed write
+// is truncated away, so the records appended after it stay readable.
+func (j *writeJournal) append(writes map[string]pendingWrite) error {
+	var buf []byte
+	if j.torn {
+		buf = append(buf, '\n') // Keeps the next record off the torn line
+	}
+	for key, w := range writes {
+		rec := journalRecord{Key: key, Value: []byte(w.value), Deleted: w.deleted}
+		if at, ok := w.expiresAt.(int64); ok {
+			rec.ExpiresAt = &at
+		}
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("failed to journal key %q: %w", key, err)
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	n, err := j.f.Write(buf)
+	if err == nil && j.sync {
+		err = j.f.Sync()
+	}
+	if err != nil {
+		if n > 0 {
+			if terr := j.f.Truncate(j.size); terr != nil {
+				// The torn record stays; replay skips it
+				j.size += int64(n)
+				j.torn = true
+			}
+		}
+		return fmt.Errorf("failed to journal %d writes: %w", len(writes), err)
+	}
+	j.size += int64(n)
+	j.torn = false
+	return nil
+}
+
+// seal moves the records written so far aside as <path>.flushing and starts
+// a new file. It reports whether there was anything to seal.
+func (j *writeJournal) seal() (bool, error) {
+	if j.size == 0 {
+		return false, nil
+	}
+	if j.torn {
+		j.f.Write([]byte{'\n'}) // Keeps a restore off the torn line
+	}
+	j.f.Close()
+	if err := os.Rename(j.path, j.path+".flushing"); err != nil {
+		return false, fmt.Errorf("failed to seal write journal %q: %w", j.path, err)
+	}
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return true, fmt.Errorf("failed to open write journal %q: %w", j.path, err)
+	}
+	j.f, j.size, j.torn = f, 0, false
+	return true, nil
+}
+
+// release removes the sealed file once its writes have been committed.
+func (j *writeJournal) release() {
+	if err := os.Remove(j.path + ".flushing"); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "mkvstore: failed to remove write journal %q: %v\n", j.path+".flushing", err)
+	}
+}
+
+// restore puts the records of the sealed file back in front of those written
+// since, after its writes failed to commit, so the next flush seals them
+// again. A crash midway leaves both files, which replay in the right order.
+func (j *writeJournal) restore() error {
+	sealed := j.path + ".flushing"
+	f, err := os.OpenFile(sealed, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to restore write journal %q: %w", sealed, err)
+	}
+	cur, err := os.Open(j.path)
+	if err == nil {
+		_, err = io.Copy(f, cur)
+		cur.Close()
+	}
+	if err == nil && j.sync {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore write journal %q: %w", sealed, err)
+	}
+
+	j.f.Close()
+	if err := os.Rename(sealed, j.path); err != nil {
+		return fmt.Errorf("failed to restore write journal %q: %w", sealed, err)
+	}
+	reopened, err := openWriteJournal(j.path, j.sync)
+	if err != nil {
+		return err
+	}
+	j.f, j.size = reopened.f, reopened.size
+	return nil
+}
+
+// close closes the journal, removing it if every write was committed.
+func (j *writeJournal) close() {
+	j.f.Close()
+	if j.size == 0 {
+		os.Remove(j.path)
+	}
+}
+
+// readJournal returns the mutations recorded in the sealed and current
+// journal files at path, oldest first, with the last write of each key
+// winning. Torn lines, left by a crash mid-append or by a failed append that
+// could not be truncated, are skipped: their writes were never acknowledged.
+func readJournal(path string) (map[string]pendingWrite, error) {
+	pending := make(map[string]pendingWrite)
+	for _, file := range []string{path + ".flushing", path} {
+		f, err := os.Open(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read write journal %q: %w", file, err)
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 1<<30)
+		for scanner.Scan() {
+			var rec journalRecord
+			if json.Unmarshal(scanner.Bytes(), &rec) != nil {
+				continue
+			}
+			w := pendingWrite{value: string(rec.Value), deleted: rec.Deleted}
+			if rec.ExpiresAt != nil {
+				w.expiresAt = *rec.ExpiresAt
+			}
+			pending[rec.Key] = w
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read write journal %q: %w", file, err)
+		}
+	}
+	return pending, nil
+}
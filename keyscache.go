@@ -0,0 +1,114 @@
+package mkvstore
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxKeysCacheEntries bounds the patterns whose SQL translation and results
+// are cached. The caches are emptied when full.
+const maxKeysCacheEntries = 256
+
+// WithKeysCache makes Keys remember its result for each pattern for ttl, a
+// few hundred milliseconds being enough for dashboards that poll the same
+// pattern many times per second, and makes concurrent calls with the same
+// pattern share one query. Any write made through the Store forgets every
+// result, so callers only see stale keys for writes by other processes, or
+// keys that expired within ttl.
+func WithKeysCache(ttl time.Duration) Option {
+	return func(o *options) {
+		o.keysCacheTTL = ttl
+	}
+}
+
+// keysCache caches the SQL LIKE translation of Keys patterns and, with
+// WithKeysCache, their results. Results are tagged with the write
+// generation of the notifier and only reused for the same generation.
+type keysCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	likes   map[string]string
+	results map[string]keysResult
+	calls   map[string]*keysCall // Queries in flight
+}
+
+// keysResult is a memoized result of Keys.
+type keysResult struct {
+	keys []string
+	gen  uint64
+	at   time.Time
+}
+
+// keysCall is a Keys query in flight, which callers of the same pattern and
+// generation wait for instead of running their own.
+type keysCall struct {
+	gen  uint64
+	done chan struct{}
+	keys []string
+	err  error
+}
+
+func newKeysCache(ttl time.Duration) *keysCache {
+	return &keysCache{
+		ttl:     ttl,
+		likes:   make(map[string]string),
+		results: make(map[string]keysResult),
+		calls:   make(map[string]*keysCall),
+	}
+}
+
+// like returns the SQL LIKE pattern of a glob pattern.
+func (c *keysCache) like(pattern string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if like, ok := c.likes[pattern]; ok {
+		return like
+	}
+	if len(c.likes) >= maxKeysCacheEntries {
+		clear(c.likes)
+	}
+	like := globToSQLLike(pattern)
+	c.likes[pattern] = like
+	return like
+}
+
+// do returns the keys matching pattern from a result memoized at generation
+// gen less than ttl before now, from a query in flight for the same
+// generation, or else by running query.
+func (c *keysCache) do(pattern string, gen uint64, now time.Time, query func() ([]string, error)) ([]string, error) {
+	if c.ttl <= 0 {
+		return query()
+	}
+
+	c.mu.Lock()
+	if r, ok := c.results[pattern]; ok && r.gen == gen && now.Sub(r.at) < c.ttl {
+		c.mu.Unlock()
+		return slices.Clone(r.keys), nil
+	}
+	if call, ok := c.calls[pattern]; ok && call.gen == gen {
+		c.mu.Unlock()
+		<-call.done
+		return slices.Clone(call.keys), call.err
+	}
+	call := &keysCall{gen: gen, done: make(chan struct{})}
+	c.calls[pattern] = call
+	c.mu.Unlock()
+
+	call.keys, call.err = query()
+	close(call.done)
+
+	c.mu.Lock()
+	if c.calls[pattern] == call {
+		delete(c.calls, pattern)
+	}
+	if call.err == nil {
+		if len(c.results) >= maxKeysCacheEntries {
+			clear(c.results)
+		}
+		c.results[pattern] = keysResult{keys: call.keys, gen: gen, at: now}
+	}
+	c.mu.Unlock()
+	return slices.Clone(call.keys), call.err
+}
@@ -0,0 +1,80 @@
+package mkvstore
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestKeysCache tests that Keys results are memoized until a write or until
+// they are older than the TTL.
+func TestKeysCache(t *testing.T) {
+	now := time.Now()
+	store := setupWALStore(t, WithKeysCache(500*time.Millisecond), WithClock(func() time.Time { return now }))
+	store.Set("k1", "v", 0)
+	if keys, _ := store.Keys("k*"); len(keys) != 1 {
+		t.Fatalf("Expected 1 key, got %v", keys)
+	}
+
+	// A write by another process is not seen until the result gets old
+	insertSQL := fmt.Sprintf(`INSERT INTO %s (key, value) VALUES ('k2', 'v');`, store.quoteTable())
+	if _, err := store.db.Exec(insertSQL); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if keys, _ := store.Keys("k*"); len(keys) != 1 {
+		t.Errorf("Expected the memoized result, got %v", keys)
+	}
+	now = now.Add(time.Second)
+	if keys, _ := store.Keys("k*"); len(keys) != 2 {
+		t.Errorf("Expected the result to be refreshed after the TTL, got %v", keys)
+	}
+
+	// A write through the store is seen right away
+	store.Set("k3", "v", 0)
+	keys, _ := store.Keys("k*")
+	if len(keys) != 3 {
+		t.Errorf("Expected the write to invalidate the result, got %v", keys)
+	}
+	keys[0] = "changed" // Callers get their own copy
+	if again, _ := store.Keys("k*"); again[0] == "changed" {
+		t.Error("Memoized result was modified through a returned slice")
+	}
+}
+
+// TestKeysCacheCoalescing tests that concurrent calls for one pattern share
+// a single query.
+func TestKeysCacheCoalescing(t *testing.T) {
+	c := newKeysCache(time.Minute)
+	release := make(chan struct{})
+	var queries atomic.Int32
+	query := func() ([]string, error) {
+		queries.Add(1)
+		<-release
+		return []string{"a"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if keys, err := c.do("*", 1, time.Now(), query); err != nil || len(keys) != 1 {
+				t.Errorf("do = %v, %v", keys, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond) // Let the calls pile up behind the first
+	close(release)
+	wg.Wait()
+	if n := queries.Load(); n != 1 {
+		t.Errorf("Expected 1 query, got %d", n)
+	}
+
+	// A newer generation does not reuse the result
+	c.do("*", 2, time.Now(), query)
+	if n := queries.Load(); n != 2 {
+		t.Errorf("Expected a query for the new generation, got %d queries", n)
+	}
+}
@@ -0,0 +1,94 @@
+package mkvstore
+
+import "fmt"
+
+// SortField selects the ordering of KeysSorted.
+type SortField int
+
+const (
+	// SortByKey orders keys lexicographically.
+	SortByKey SortField = iota
+	// SortByExpiry orders keys by expiration time; keys without a TTL sort
+	// as expiring last.
+	SortByExpiry
+	// SortByUpdated orders keys by the time they were last written.
+	SortByUpdated
+	// SortBySize orders keys by stored value size (see SizeOf).
+	SortBySize
+)
+
+// String returns the name of the sort field.
+func (f SortField) String() string {
+	switch f {
+	case SortByKey:
+		return "key"
+	case SortByExpiry:
+		return "expiry"
+	case SortByUpdated:
+		return "updated"
+	case SortBySize:
+		return "size"
+	default:
+		return fmt.Sprintf("SortField(%d)", int(f))
+	}
+}
+
+// KeysSorted returns live string keys matching pattern (same glob syntax as
+// Keys) ordered by the given field, ascending or descending with desc, ties
+// broken by key. A limit of 0 or less returns all matching keys. Sorting runs
+// in SQLite, so views such as "largest keys" (SortBySize, desc) or "soonest
+// to expire" (SortByExpiry) don't need a full dump.
+func (s *Store) KeysSorted(pattern string, by SortField, desc bool, limit int) ([]string, error) {
+	pattern = s.canonicalKey(pattern)
+	var orderExpr string
+	switch by {
+	case SortByKey:
+		orderExpr = "key"
+	case SortByExpiry:
+		orderExpr = "expires_at IS NULL, expires_at" // No TTL means expiring last
+	case SortByUpdated:
+		orderExpr = "updated_at"
+	case SortBySize:
+		orderExpr = "length(CAST(value AS BLOB))"
+	default:
+		return nil, fmt.Errorf("invalid sort field %s", by)
+	}
+	if desc {
+		if by == SortByExpiry {
+			orderExpr = "expires_at IS NULL DESC, expires_at DESC"
+		} else {
+			orderExpr += " DESC"
+		}
+	}
+	if limit <= 0 {
+		limit = -1 // No limit
+	}
+
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+
+	sortedSQL := fmt.Sprintf(`
+	SELECT key FROM %s
+	WHERE key LIKE ? ESCAPE '\' AND type = 'string' AND (expires_at IS NULL OR expires_at >= ?)
+	ORDER BY %s, key LIMIT ?;`, s.quoteTable(), orderExpr)
+
+	rows, err := s.query(sortedSQL, globToSQLLike(pattern), s.now().Unix(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query keys with pattern %q sorted by %s from table %q: %w", pattern, by, s.table, err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan key row in table %q: %w", s.table, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through keys rows in table %q: %w", s.table, err)
+	}
+	return keys, nil
+}
@@ -0,0 +1,45 @@
+package mkvstore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestKeysSorted tests each sort field in both directions.
+func TestKeysSorted(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	store.Set("k:a", strings.Repeat("x", 30), time.Hour)
+	store.Set("k:b", strings.Repeat("x", 10), 0)
+	store.Set("k:c", strings.Repeat("x", 20), time.Minute)
+	store.Set("other", "x", 0)
+
+	tests := []struct {
+		by       SortField
+		desc     bool
+		limit    int
+		expected []string
+	}{
+		{SortByKey, false, 0, []string{"k:a", "k:b", "k:c"}},
+		{SortByKey, true, 2, []string{"k:c", "k:b"}},
+		{SortBySize, true, 1, []string{"k:a"}},
+		{SortBySize, false, 0, []string{"k:b", "k:c", "k:a"}},
+		{SortByExpiry, false, 0, []string{"k:c", "k:a", "k:b"}},
+		{SortByExpiry, true, 0, []string{"k:b", "k:a", "k:c"}},
+	}
+	for _, tt := range tests {
+		keys, err := store.KeysSorted("k:*", tt.by, tt.desc, tt.limit)
+		if err != nil {
+			t.Fatalf("KeysSorted(%s) failed: %v", tt.by, err)
+		}
+		if !reflect.DeepEqual(keys, tt.expected) {
+			t.Errorf("KeysSorted(%s, desc=%v, limit=%d) = %v, expected %v", tt.by, tt.desc, tt.limit, keys, tt.expected)
+		}
+	}
+
+	if _, err := store.KeysSorted("*", SortField(42), false, 0); err == nil {
+		t.Error("Expected error for an invalid sort field")
+	}
+}
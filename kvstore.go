@@ -0,0 +1,82 @@
+package mkvstore
+
+import "time"
+
+// KVStore is the key-value API of Store, for code that wants to be
+// unit-tested without SQLite. Beyond plain strings it takes in the smaller
+// interfaces below, which code needing only part of the API can accept
+// instead. The mkvstoretest package provides an in-memory fake and a
+// programmable mock implementing it.
+type KVStore interface {
+	Set(key string, value string, ttl time.Duration) error
+	Get(key string) (string, error)
+	Del(key string) error
+	Exists(key string) (bool, error)
+	TTL(key string) (time.Duration, error)
+	Keys(pattern string) ([]string, error)
+	Scan(cursor string, pattern string, count int) ([]string, string, error)
+	GetAll(pattern string) (map[string]string, error)
+	Rename(from, to string) error
+	Close() error
+
+	Strings
+	Counters
+	Expirer
+	Hashes
+	Lists
+}
+
+// Strings is the conditional, batch and in-place string API of Store.
+type Strings interface {
+	SetNX(key, value string, ttl time.Duration) (bool, error)
+	SetXX(key, value string, ttl time.Duration) (bool, error)
+	MSet(pairs map[string]string, ttl time.Duration) error
+	GetDel(key string) (string, error)
+	Append(key, suffix string) (int, error)
+}
+
+// Counters is the integer counter API of Store.
+type Counters interface {
+	Incr(key string) (int64, error)
+	Decr(key string) (int64, error)
+	IncrBy(key string, delta int64) (int64, error)
+}
+
+// Expirer is the TTL API of Store, for keys of any type.
+type Expirer interface {
+	Expire(key string, ttl time.Duration) (bool, error)
+	ExpireAt(key string, t time.Time) (bool, error)
+	ExpireNX(key string, ttl time.Duration) (bool, error)
+	ExpireGT(key string, ttl time.Duration) (bool, error)
+	ExpireLT(key string, ttl time.Duration) (bool, error)
+	ExpireTime(key string) (time.Time, error)
+	Persist(key string) (bool, error)
+}
+
+// Hashes is the hash API of Store.
+type Hashes interface {
+	HSet(key, field, value string) error
+	HGet(key, field string) (string, error)
+	HGetAll(key string) (map[string]string, error)
+	HLen(key string) (int, error)
+	HDel(key, field string) (bool, error)
+}
+
+// Lists is the list API of Store.
+type Lists interface {
+	LPush(key string, values ...string) (int, error)
+	RPush(key string, values ...string) (int, error)
+	LPop(key string) (string, error)
+	RPop(key string) (string, error)
+	LRange(key string, start, stop int) ([]string, error)
+	LTrim(key string, start, stop int) error
+	LLen(key string) (int, error)
+}
+
+var _ KVStore = (*Store)(nil)
+
+// MatchPattern reports whether key matches a glob pattern as used by Keys:
+// '*' matches any sequence of characters and '?' any single character.
+func MatchPattern(pattern, key string) bool {
+	return globMatch(pattern, key)
+}
@@ -0,0 +1,105 @@
+package mkvstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// SoftLimits are the thresholds at which WithSoftLimits warns. A zero
+// threshold is not checked.
+type SoftLimits struct {
+	Keys    int64 // Live keys in the table
+	DBSize  int64 // Size of the database in bytes, page_count * page_size
+	WALSize int64 // Size of the write-ahead log file in bytes
+}
+
+// LimitWarning reports that a soft limit was reached.
+type LimitWarning struct {
+	Table     string
+	Limit     string // "keys", "db_size" or "wal_size"
+	Value     int64
+	Threshold int64
+}
+
+// WithSoftLimits checks limits every interval as the "limits" maintenance
+// task and calls onWarning when a value reaches its threshold, so operators
+// are alerted well before hard caps or evictions kick in. A warning is given
+// once per crossing: the limit is only reported again after the value has
+// dropped below the threshold. With a nil onWarning, warnings are logged to
+// stderr. The database and WAL sizes are checked by the Store returned by
+// Open only, the key count by every table opened with Table too.
+func WithSoftLimits(limits SoftLimits, interval time.Duration, onWarning func(LimitWarning)) Option {
+	return func(o *options) {
+		o.softLimits = &limits
+		o.softLimitInterval = interval
+		o.onLimitWarning = onWarning
+	}
+}
+
+// limitChecker tracks which soft limits are currently exceeded.
+type limitChecker struct {
+	mu       sync.Mutex
+	exceeded map[string]bool
+}
+
+// checkSoftLimits is the run function of the limits maintenance task. root
+// reports whether the store owns the database, and checks its file sizes.
+func (s *Store) checkSoftLimits(c *limitChecker, root bool) error {
+	limits := s.opts.softLimits
+	values := make(map[string]int64)
+	if limits.Keys > 0 {
+		var keys int64
+		countSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE expires_at IS NULL OR expires_at >= ?;`, s.quoteTable())
+		if err := s.queryRow(countSQL, s.now().Unix()).Scan(&keys); err != nil {
+			return fmt.Errorf("failed to count keys in table %q: %w", s.table, err)
+		}
+		values["keys"] = keys
+	}
+	if root && (limits.DBSize > 0 || limits.WALSize > 0) {
+		stats, err := s.DiskStats()
+		if err != nil {
+			return err
+		}
+		values["db_size"] = stats.PageCount * stats.PageSize
+		values["wal_size"] = stats.WALSize
+	}
+
+	thresholds := map[string]int64{"keys": limits.Keys, "db_size": limits.DBSize, "wal_size": limits.WALSize}
+	for _, limit := range []string{"keys", "db_size", "wal_size"} {
+		value, ok := values[limit]
+		threshold := thresholds[limit]
+		if !ok || threshold <= 0 {
+			continue
+		}
+
+		c.mu.Lock()
+		crossed := value >= threshold && !c.exceeded[limit]
+		c.exceeded[limit] = value >= threshold
+		c.mu.Unlock()
+		if !crossed {
+			continue
+		}
+
+		warning := LimitWarning{Table: s.table, Limit: limit, Value: value, Threshold: threshold}
+		if s.opts.onLimitWarning != nil {
+			s.opts.onLimitWarning(warning)
+		} else {
+			fmt.Fprintf(os.Stderr, "mkvstore: soft limit %s reached for table %q: %d >= %d\n", limit, s.table, value, threshold)
+		}
+	}
+	return nil
+}
+
+// scheduleSoftLimits schedules the limits maintenance task, if enabled.
+func (s *Store) scheduleSoftLimits(root bool) error {
+	if s.opts.softLimits == nil {
+		return nil
+	}
+	c := &limitChecker{exceeded: make(map[string]bool)}
+	return s.schedule(MaintenanceTask{Name: "limits", Interval: s.opts.softLimitInterval, Run: func(context.Context) error {
+		return s.checkSoftLimits(c, root)
+	}})
+}
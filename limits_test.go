@@ -0,0 +1,49 @@
+package mkvstore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSoftLimits tests that warnings fire once per crossing and re-arm once
+// the value drops below the threshold.
+func TestSoftLimits(t *testing.T) {
+	var warnings []LimitWarning
+	limits := SoftLimits{Keys: 2, DBSize: 1}
+	store, err := Open(filepath.Join(t.TempDir(), "limits.db"), "kv",
+		WithSoftLimits(limits, time.Hour, func(w LimitWarning) { warnings = append(warnings, w) }))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	status := store.MaintenanceStatus()
+	if len(status) != 1 || status[0].Name != "limits" {
+		t.Fatalf("Expected the limits task to be scheduled, got %+v", status)
+	}
+
+	c := &limitChecker{exceeded: make(map[string]bool)}
+	store.Set("a", "1", 0)
+	if err := store.checkSoftLimits(c, true); err != nil {
+		t.Fatalf("checkSoftLimits failed: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].Limit != "db_size" {
+		t.Fatalf("Expected only a db_size warning, got %+v", warnings)
+	}
+
+	store.Set("b", "2", 0)
+	store.checkSoftLimits(c, true)
+	store.checkSoftLimits(c, true)
+	if len(warnings) != 2 || warnings[1] != (LimitWarning{Table: "kv", Limit: "keys", Value: 2, Threshold: 2}) {
+		t.Fatalf("Expected one keys warning, got %+v", warnings)
+	}
+
+	store.Del("b")
+	store.checkSoftLimits(c, true)
+	store.Set("b", "2", 0)
+	store.checkSoftLimits(c, true)
+	if len(warnings) != 3 || warnings[2].Limit != "keys" {
+		t.Errorf("Expected the keys warning to re-arm, got %+v", warnings)
+	}
+}
@@ -0,0 +1,398 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Lists are stored as a row of type 'list' in the store's table, carrying the
+// key's expiry and version, plus one row per element in <table>_list ordered
+// by seq.
+
+// blockingPollInterval bounds how long a blocking operation sleeps before
+// re-checking the table, so it also notices writes made by other processes
+// sharing the database file. Writes through the same Store wake it at once.
+const blockingPollInterval = time.Second
+
+// listTableName returns the name of the table holding the elements of lists in table.
+func listTableName(table string) string {
+	return table + "_list"
+}
+
+// quoteListTable returns the list element table name safely quoted for SQL.
+func (s *Store) quoteListTable() string {
+	return quoteIdent(listTableName(s.table))
+}
+
+// push inserts values at the head (left) or tail of the list stored at key
+// and returns the new length of the list.
+func (s *Store) push(key string, left bool, values []string) (int, error) {
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+
+	var n int
+	err := s.update(func(tx *sql.Tx) error {
+		if err := s.touchKey(tx, key, "list", s.now().Unix()); err != nil {
+			return err
+		}
+
+		var seq int64
+		seqSQL := fmt.Sprintf(`SELECT COALESCE(MAX(seq), 0) FROM %s WHERE key = ?;`, s.quoteListTable())
+		step := int64(1)
+		if left {
+			seqSQL = fmt.Sprintf(`SELECT COALESCE(MIN(seq), 0) FROM %s WHERE key = ?;`, s.quoteListTable())
+			step = -1
+		}
+		if err := tx.QueryRowContext(s.ctx, seqSQL, key).Scan(&seq); err != nil {
+			return fmt.Errorf("failed to read list %q in table %q: %w", key, s.table, err)
+		}
+
+		pushSQL := fmt.Sprintf(`INSERT INTO %s (key, seq, value, codec, transforms) VALUES (?, ?, ?, ?, ?);`, s.quoteListTable())
+		for _, value := range values {
+			enc, err := s.encodeValue(key, value)
+			if err != nil {
+				return fmt.Errorf("failed to push to list %q in table %q: %w", key, s.table, err)
+			}
+			seq += step
+			if _, err := tx.ExecContext(s.ctx, pushSQL, key, seq, enc.data, enc.codec, enc.transforms); err != nil {
+				return fmt.Errorf("failed to push to list %q in table %q: %w", key, s.table, err)
+			}
+		}
+
+		lenSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE key = ?;`, s.quoteListTable())
+		if err := tx.QueryRowContext(s.ctx, lenSQL, key).Scan(&n); err != nil {
+			return fmt.Errorf("failed to count list %q in table %q: %w", key, s.table, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	op := "rpush"
+	if left {
+		op = "lpush"
+	}
+	s.notify.publish(key, op)
+	return n, nil
+}
+
+// LPush inserts values at the head of the list stored at key, one after the
+// other, so the last value ends up first. The list is created if needed.
+// It returns the new length of the list, or ErrWrongType if key holds
+// another type.
+func (s *Store) LPush(key string, values ...string) (int, error) {
+	defer s.observe("lpush", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return 0, err
+	}
+	return s.push(key, true, values)
+}
+
+// RPush appends values to the tail of the list stored at key, creating the
+// list if needed. It returns the new length of the list, or ErrWrongType if
+// key holds another type.
+func (s *Store) RPush(key string, values ...string) (int, error) {
+	defer s.observe("rpush", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return 0, err
+	}
+	return s.push(key, false, values)
+}
+
+// LPop removes and returns the first element of the list stored at key. The
+// list is deleted once its last element is removed.
+// Returns ErrKeyNotFound if the list is empty or does not exist, and
+// ErrWrongType if key holds another type.
+func (s *Store) LPop(key string) (string, error) {
+	defer s.observe("lpop", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return "", err
+	}
+	return s.pop(key, true)
+}
+
+// RPop removes and returns the last element of the list stored at key, like
+// LPop at the other end.
+func (s *Store) RPop(key string) (string, error) {
+	defer s.observe("rpop", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return "", err
+	}
+	return s.pop(key, false)
+}
+
+// pop removes and returns the element at the head (left) or tail of the list
+// stored at key, deleting the list with its last element.
+func (s *Store) pop(key string, left bool) (string, error) {
+	if err := s.Sync(); err != nil {
+		return "", err
+	}
+	now := s.now().Unix()
+	end := "MAX"
+	if left {
+		end = "MIN"
+	}
+
+	var value string
+	err := s.update(func(tx *sql.Tx) error {
+		if ok, err := s.liveKey(tx, key, "list", now); !ok {
+			if err == nil {
+				err = ErrKeyNotFound
+			}
+			return err
+		}
+
+		var stored []byte
+		var codec byte
+		var transforms sql.NullString
+		popSQL := fmt.Sprintf(`
+		DELETE FROM %s WHERE key = ?1 AND seq = (SELECT %s(seq) FROM %s WHERE key = ?1)
+		RETURNING value, codec, transforms;`, s.quoteListTable(), end, s.quoteListTable())
+		err := tx.QueryRowContext(s.ctx, popSQL, key).Scan(&stored, &codec, &transforms)
+		if err == sql.ErrNoRows {
+			return ErrKeyNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to pop from list %q in table %q: %w", key, s.table, err)
+		}
+		if value, err = s.decodeValue(stored, codec, transforms); err != nil {
+			return fmt.Errorf("failed to pop from list %q in table %q: %w", key, s.table, err)
+		}
+
+		return s.listChanged(tx, key, now)
+	})
+	if err != nil {
+		return "", err
+	}
+	op := "rpop"
+	if left {
+		op = "lpop"
+	}
+	s.notify.publish(key, op)
+	return value, nil
+}
+
+// listChanged records a removal from the list stored at key within tx,
+// dropping the list once it is empty and otherwise bumping its version.
+func (s *Store) listChanged(tx *sql.Tx, key string, now int64) error {
+	var n int
+	lenSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE key = ?;`, s.quoteListTable())
+	if err := tx.QueryRowContext(s.ctx, lenSQL, key).Scan(&n); err != nil {
+		return fmt.Errorf("failed to count list %q in table %q: %w", key, s.table, err)
+	}
+	parentSQL := fmt.Sprintf(`UPDATE %s SET version = version + 1, updated_at = ?2 WHERE key = ?1;`, s.quoteTable())
+	if n == 0 {
+		parentSQL = fmt.Sprintf(`DELETE FROM %s WHERE key = ?1;`, s.quoteTable())
+	}
+	if _, err := tx.ExecContext(s.ctx, parentSQL, key, now); err != nil {
+		return fmt.Errorf("failed to update list %q in table %q: %w", key, s.table, err)
+	}
+	return nil
+}
+
+// listRange resolves the inclusive indexes start and stop of a list of n
+// elements, negative ones counting from the tail as in Redis, to the offset
+// and number of elements they cover.
+func listRange(n, start, stop int) (offset, count int) {
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	stop = min(stop, n-1)
+	if start > stop {
+		return 0, 0
+	}
+	return start, stop - start + 1
+}
+
+// LRange returns the elements of the list stored at key from index start to
+// stop inclusive, 0 being the head and -1 the tail, like Redis LRANGE. Out of
+// range indexes are clamped, and a missing key is an empty list.
+// Returns ErrWrongType if key holds another type.
+func (s *Store) LRange(key string, start, stop int) ([]string, error) {
+	defer s.observe("lrange", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+
+	// The length and the range are read in one snapshot, so a concurrent
+	// push or pop cannot shift negative indexes in between
+	var values []string
+	err := s.snapshot(s.ctx, func(tx *sql.Tx) error {
+		if ok, err := s.liveKey(tx, key, "list", s.now().Unix()); !ok {
+			return err
+		}
+		var n int
+		lenSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE key = ?;`, s.quoteListTable())
+		if err := tx.QueryRowContext(s.ctx, lenSQL, key).Scan(&n); err != nil {
+			return fmt.Errorf("failed to count list %q in table %q: %w", key, s.table, err)
+		}
+		offset, count := listRange(n, start, stop)
+		if count == 0 {
+			return nil
+		}
+
+		rangeSQL := fmt.Sprintf(`SELECT value, codec, transforms FROM %s WHERE key = ? ORDER BY seq LIMIT ? OFFSET ?;`, s.quoteListTable())
+		rows, err := tx.QueryContext(s.ctx, rangeSQL, key, count, offset)
+		if err != nil {
+			return fmt.Errorf("failed to read list %q in table %q: %w", key, s.table, err)
+		}
+		defer rows.Close()
+
+		values = make([]string, 0, count)
+		for rows.Next() {
+			var stored []byte
+			var codec byte
+			var transforms sql.NullString
+			if err := rows.Scan(&stored, &codec, &transforms); err != nil {
+				return fmt.Errorf("failed to scan list %q in table %q: %w", key, s.table, err)
+			}
+			value, err := s.decodeValue(stored, codec, transforms)
+			if err != nil {
+				return fmt.Errorf("failed to read list %q in table %q: %w", key, s.table, err)
+			}
+			values = append(values, value)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating through list %q in table %q: %w", key, s.table, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// LTrim keeps only the elements of the list stored at key from index start
+// to stop inclusive, with the indexes of LRange, e.g. LTrim(key, 0, 99) after
+// LPush to cap a log at 100 entries. The list is deleted if nothing is left,
+// and a missing key is left alone.
+// Returns ErrWrongType if key holds another type.
+func (s *Store) LTrim(key string, start, stop int) error {
+	defer s.observe("ltrim", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return err
+	}
+	if err := s.Sync(); err != nil {
+		return err
+	}
+	now := s.now().Unix()
+
+	trimmed := false
+	err := s.update(func(tx *sql.Tx) error {
+		if ok, err := s.liveKey(tx, key, "list", now); !ok {
+			return err
+		}
+		var n int
+		lenSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE key = ?;`, s.quoteListTable())
+		if err := tx.QueryRowContext(s.ctx, lenSQL, key).Scan(&n); err != nil {
+			return fmt.Errorf("failed to count list %q in table %q: %w", key, s.table, err)
+		}
+		offset, count := listRange(n, start, stop)
+		if count == n {
+			return nil
+		}
+
+		trimSQL := fmt.Sprintf(`
+		DELETE FROM %s WHERE key = ?1 AND seq NOT IN (SELECT seq FROM %s WHERE key = ?1 ORDER BY seq LIMIT ?2 OFFSET ?3);`,
+			s.quoteListTable(), s.quoteListTable())
+		if _, err := tx.ExecContext(s.ctx, trimSQL, key, count, offset); err != nil {
+			return fmt.Errorf("failed to trim list %q in table %q: %w", key, s.table, err)
+		}
+		trimmed = true
+		return s.listChanged(tx, key, now)
+	})
+	if err != nil || !trimmed {
+		return err
+	}
+	s.notify.publish(key, "ltrim")
+	return nil
+}
+
+// LLen returns the length of the list stored at key, or 0 if the key does not
+// exist. Returns ErrWrongType if key holds another type.
+func (s *Store) LLen(key string) (int, error) {
+	defer s.observe("llen", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+	if ok, err := s.liveKey(s.q(), key, "list", s.now().Unix()); !ok {
+		return 0, err
+	}
+
+	var n int
+	lenSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE key = ?;`, s.quoteListTable())
+	if err := s.queryRow(lenSQL, key).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count list %q in table %q: %w", key, s.table, err)
+	}
+	return n, nil
+}
+
+// BLPop removes and returns the first element of the list queue, waiting for
+// one to be pushed if the list is empty, so worker loops need not poll the
+// store. Waiters are woken as soon as LPush or RPush on this Store adds to
+// the list; pushes from other processes sharing the file are picked up within
+// about a second. A timeout of 0 waits until ctx is done.
+// Returns ErrKeyNotFound if the timeout elapses, ctx.Err() if ctx is done
+// first, and ErrWrongType if queue holds another type.
+func (s *Store) BLPop(ctx context.Context, queue string, timeout time.Duration) (string, error) {
+	defer s.observe("blpop", time.Now())
+
+	queue = s.canonicalKey(queue)
+	if err := checkReserved(queue); err != nil {
+		return "", err
+	}
+	wait := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		wait, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Subscribe before the first attempt so a push in between is not missed
+	wake, unsubscribe := s.notify.subscribe(queue)
+	defer unsubscribe()
+
+	poll := time.NewTicker(blockingPollInterval)
+	defer poll.Stop()
+
+	for {
+		value, err := s.pop(queue, true)
+		if err != ErrKeyNotFound {
+			return value, err
+		}
+
+		select {
+		case <-wake:
+		case <-poll.C:
+		case <-s.ctx.Done():
+			return "", errStoreClosed
+		case <-wait.Done():
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			return "", ErrKeyNotFound // Timed out
+		}
+	}
+}
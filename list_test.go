@@ -0,0 +1,142 @@
+package mkvstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestListPushPop tests list ordering and deletion of empty lists.
+func TestListPushPop(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	store.RPush("q", "b", "c")
+	if n, err := store.LPush("q", "a"); err != nil || n != 3 {
+		t.Fatalf("LPush = %d, %v; expected 3", n, err)
+	}
+	for _, expected := range []string{"a", "b", "c"} {
+		if v, err := store.LPop("q"); err != nil || v != expected {
+			t.Errorf("LPop = %q, %v; expected %q", v, err, expected)
+		}
+	}
+	if _, err := store.LPop("q"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound from an empty list, got %v", err)
+	}
+	if exists, _ := store.Exists("q"); exists {
+		t.Error("Expected list to be deleted with its last element")
+	}
+
+	store.Set("s", "v", 0)
+	if _, err := store.RPush("s", "x"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from RPush on a string, got %v", err)
+	}
+}
+
+// TestListRangeTrim tests RPop, LRange and LTrim with Redis indexes.
+func TestListRangeTrim(t *testing.T) {
+	store, _ := setupFileStore(t)
+	store.RPush("log", "a", "b", "c", "d", "e")
+
+	for _, tc := range []struct {
+		start, stop int
+		expected    string
+	}{
+		{0, -1, "a,b,c,d,e"},
+		{1, 2, "b,c"},
+		{-2, -1, "d,e"},
+		{3, 100, "d,e"},
+		{-100, 0, "a"},
+		{4, 1, ""},
+		{5, 10, ""},
+	} {
+		values, err := store.LRange("log", tc.start, tc.stop)
+		if got := strings.Join(values, ","); err != nil || got != tc.expected {
+			t.Errorf("LRange(%d, %d) = %q, %v; expected %q", tc.start, tc.stop, got, err, tc.expected)
+		}
+	}
+
+	if v, err := store.RPop("log"); err != nil || v != "e" {
+		t.Errorf("RPop = %q, %v; expected e", v, err)
+	}
+	if err := store.LTrim("log", 1, -1); err != nil {
+		t.Fatalf("LTrim failed: %v", err)
+	}
+	if values, _ := store.LRange("log", 0, -1); strings.Join(values, ",") != "b,c,d" {
+		t.Errorf("Expected b,c,d after LTrim, got %v", values)
+	}
+	if err := store.LTrim("log", 5, 10); err != nil {
+		t.Fatalf("LTrim failed: %v", err)
+	}
+	if exists, _ := store.Exists("log"); exists {
+		t.Error("Expected the list to be deleted once trimmed to nothing")
+	}
+	if values, err := store.LRange("missing", 0, -1); err != nil || len(values) != 0 {
+		t.Errorf("LRange of a missing list = %v, %v", values, err)
+	}
+}
+
+// TestListTTL tests that a TTL applies to the whole list and survives pushes.
+func TestListTTL(t *testing.T) {
+	now := time.Now()
+	store := setupWALStore(t, WithClock(func() time.Time { return now }))
+	store.RPush("q", "a")
+	if ok, err := store.Expire("q", time.Minute); err != nil || !ok {
+		t.Fatalf("Expire = %v, %v", ok, err)
+	}
+	store.RPush("q", "b")
+	if ttl, _ := store.TTL("q"); ttl <= 0 {
+		t.Errorf("Expected the TTL to survive a push, got %v", ttl)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if n, _ := store.LLen("q"); n != 0 {
+		t.Errorf("Expected the expired list to be empty, got %d elements", n)
+	}
+	if _, err := store.RPop("q"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound from an expired list, got %v", err)
+	}
+	if n, _ := store.RPush("q", "c"); n != 1 {
+		t.Errorf("Expected a push to start a new list, got length %d", n)
+	}
+}
+
+// TestBLPop tests that BLPop is woken by a push and honors its timeout.
+func TestBLPop(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	if _, err := store.BLPop(context.Background(), "jobs", 50*time.Millisecond); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound on timeout, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := store.BLPop(ctx, "jobs", 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	result := make(chan string, 1)
+	go func() {
+		v, err := store.BLPop(context.Background(), "jobs", 5*time.Second)
+		if err != nil {
+			t.Errorf("BLPop failed: %v", err)
+		}
+		result <- v
+	}()
+
+	time.Sleep(20 * time.Millisecond) // Let the waiter block
+	start := time.Now()
+	store.RPush("jobs", "job-1")
+	select {
+	case v := <-result:
+		if v != "job-1" {
+			t.Errorf("BLPop = %q, expected job-1", v)
+		}
+		if elapsed := time.Since(start); elapsed > blockingPollInterval/2 {
+			t.Errorf("BLPop took %s to wake, expected a notification rather than a poll", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("BLPop was not woken by RPush")
+	}
+}
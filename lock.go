@@ -0,0 +1,59 @@
+package mkvstore
+
+import (
+	"fmt"
+	"os"
+)
+
+// lockMode selects whether Open takes an exclusive lock on the database file.
+type lockMode int
+
+const (
+	lockNone lockMode = iota
+	lockWait          // Block until the lock is free (WithExclusiveLock)
+	lockTry           // Fail with ErrDatabaseLocked if it is held (TryOpenExclusive)
+)
+
+// WithExclusiveLock makes Open take an advisory exclusive lock (flock) on
+// <database>.lock, a file next to the database file, blocking until any other
+// holder releases it, so that a process can be sure it is the sole writer of
+// the file, e.g. a standby daemon that takes over once the active one exits.
+// The lock is held until Close. It only excludes other processes and Stores
+// that also take the lock, and has no effect on in-memory databases. The lock
+// file is left in place. Use TryOpenExclusive to fail instead of waiting.
+func WithExclusiveLock() Option {
+	return func(o *options) {
+		if o.lock == lockNone {
+			o.lock = lockWait
+		}
+	}
+}
+
+// TryOpenExclusive opens the store like Open with WithExclusiveLock, but
+// returns an error wrapping ErrDatabaseLocked right away if another process
+// or Store holds the lock.
+func TryOpenExclusive(dbPath string, table string, opts ...Option) (*Store, error) {
+	return Open(dbPath, table, append(opts, func(o *options) { o.lock = lockTry })...)
+}
+
+// acquireLock opens the lock file of the database, creating it if needed,
+// and takes an exclusive lock on it. It returns nil for in-memory databases.
+// The database file itself is never opened: closing any descriptor of it
+// would drop the POSIX locks SQLite holds on it in this process.
+func acquireLock(dbPath string, mode lockMode) (*os.File, error) {
+	path := databaseFile(dbPath)
+	if mode == lockNone || path == "" {
+		return nil, nil
+	}
+	path += ".lock"
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %q: %w", path, err)
+	}
+	if err := lockFile(f, mode == lockWait); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %q: %w", path, err)
+	}
+	return f, nil
+}
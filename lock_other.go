@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package mkvstore
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile reports that exclusive locking is not available on this platform.
+func lockFile(f *os.File, wait bool) error {
+	return errors.New("exclusive file locking is not supported on this platform")
+}
@@ -0,0 +1,67 @@
+package mkvstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestExclusiveLock tests that only one Store at a time can hold the lock.
+func TestExclusiveLock(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "locked.db")
+
+	first, err := TryOpenExclusive(dbPath, "kv")
+	if err != nil {
+		t.Fatalf("TryOpenExclusive failed: %v", err)
+	}
+	if err := first.Set("k", "v", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if _, err := os.Stat(dbPath + ".lock"); err != nil {
+		t.Errorf("Expected the lock on a sidecar file, got %v", err)
+	}
+	if _, err := TryOpenExclusive(dbPath, "kv"); !errors.Is(err, ErrDatabaseLocked) {
+		t.Fatalf("Expected ErrDatabaseLocked while the lock is held, got %v", err)
+	}
+	// The failed attempt must not have dropped SQLite's locks of the holder
+	if err := first.Set("k2", "v2", 0); err != nil {
+		t.Errorf("Set after a failed TryOpenExclusive failed: %v", err)
+	}
+
+	// WithExclusiveLock waits for the holder to close
+	opened := make(chan *Store)
+	go func() {
+		second, err := Open(dbPath, "kv", WithExclusiveLock())
+		if err != nil {
+			t.Errorf("Open with WithExclusiveLock failed: %v", err)
+		}
+		opened <- second
+	}()
+	select {
+	case <-opened:
+		t.Fatal("Expected Open to wait for the lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	first.Close()
+	second := <-opened
+	if second == nil {
+		return
+	}
+	defer second.Close()
+	if v, err := second.Get("k"); err != nil || v != "v" {
+		t.Errorf("Get = %q, %v; expected %q", v, err, "v")
+	}
+}
+
+// TestExclusiveLockInMemory tests that in-memory databases are not locked.
+func TestExclusiveLockInMemory(t *testing.T) {
+	store, err := TryOpenExclusive(":memory:", "kv")
+	if err != nil {
+		t.Fatalf("TryOpenExclusive failed: %v", err)
+	}
+	store.Close()
+}
@@ -0,0 +1,90 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Meta holds per-key attributes stored alongside the value in the meta JSON
+// column, so new attributes do not require schema migrations.
+type Meta struct {
+	ContentType string            `json:"content_type,omitempty"` // MIME type of the value, e.g. "application/json"
+	Flags       uint32            `json:"flags,omitempty"`        // Application-defined bit flags
+	Tags        map[string]string `json:"tags,omitempty"`         // Free-form labels
+
+	// Version is incremented every time the value is overwritten, and a
+	// key created again starts above every version the table's deleted keys
+	// had. It is maintained by the store and ignored by SetMeta.
+	Version int64 `json:"-"`
+}
+
+// GetMeta returns the attributes of key.
+// Returns ErrKeyNotFound if the key does not exist or is expired.
+func (s *Store) GetMeta(key string) (Meta, error) {
+	defer s.observe("getmeta", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := s.Sync(); err != nil {
+		return Meta{}, err
+	}
+
+	var meta Meta
+	var raw sql.NullString
+	var expiresAt sql.NullInt64
+
+	getMetaSQL := fmt.Sprintf(`SELECT meta, version, expires_at FROM %s WHERE key = ?;`, s.quoteTable())
+	err := s.queryRow(getMetaSQL, key).Scan(&raw, &meta.Version, &expiresAt)
+	if err == sql.ErrNoRows {
+		return Meta{}, ErrKeyNotFound
+	}
+	if err != nil {
+		return Meta{}, fmt.Errorf("failed to get meta of key %q from table %q: %w", key, s.table, err)
+	}
+
+	if expiresAt.Valid && s.now().Unix() > expiresAt.Int64 {
+		go s.purgeExpired(key) // Delete asynchronously, ignore error here
+		return Meta{}, ErrKeyNotFound
+	}
+
+	if raw.Valid {
+		if err := json.Unmarshal([]byte(raw.String), &meta); err != nil {
+			return Meta{}, fmt.Errorf("failed to decode meta of key %q in table %q: %w", key, s.table, err)
+		}
+	}
+	return meta, nil
+}
+
+// SetMeta replaces the attributes of an existing key without touching its
+// value, TTL or version. Set preserves the attributes of keys it overwrites.
+// Returns ErrKeyNotFound if the key does not exist or is expired.
+func (s *Store) SetMeta(key string, meta Meta) error {
+	defer s.observe("setmeta", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return err
+	}
+	if err := s.Sync(); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode meta of key %q: %w", key, err)
+	}
+
+	setMetaSQL := fmt.Sprintf(`
+	UPDATE %s SET meta = ?
+	WHERE key = ? AND (expires_at IS NULL OR expires_at >= ?);`, s.quoteTable())
+	result, err := s.exec(context.Background(), setMetaSQL, string(raw), key, s.now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to set meta of key %q in table %q: %w", key, s.table, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package mkvstore
+
+import "testing"
+
+// TestMeta tests reading and writing per-key attributes.
+func TestMeta(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	if err := store.SetMeta("missing", Meta{}); err != ErrKeyNotFound {
+		t.Errorf("SetMeta on a missing key should return ErrKeyNotFound, got %v", err)
+	}
+
+	store.Set("doc", `{"a":1}`, 0)
+	meta, err := store.GetMeta("doc")
+	if err != nil {
+		t.Fatalf("GetMeta failed: %v", err)
+	}
+	if meta.ContentType != "" || meta.Version != 1 {
+		t.Errorf("Expected empty meta at version 1, got %+v", meta)
+	}
+
+	err = store.SetMeta("doc", Meta{ContentType: "application/json", Flags: 3, Tags: map[string]string{"owner": "ops"}})
+	if err != nil {
+		t.Fatalf("SetMeta failed: %v", err)
+	}
+
+	// Overwriting the value keeps the attributes and bumps the version
+	store.Set("doc", `{"a":2}`, 0)
+	meta, err = store.GetMeta("doc")
+	if err != nil {
+		t.Fatalf("GetMeta failed: %v", err)
+	}
+	if meta.ContentType != "application/json" || meta.Flags != 3 || meta.Tags["owner"] != "ops" || meta.Version != 2 {
+		t.Errorf("Unexpected meta after overwrite: %+v", meta)
+	}
+}
@@ -0,0 +1,203 @@
+package mkvstore
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Latency histograms use exponential buckets: bucket i counts operations
+// taking at most 2^i microseconds, the layout of a Prometheus native
+// histogram with schema 0. Buckets are only allocated once hit, and
+// everything beyond the last bucket (about 1.2 minutes) lands in it.
+const (
+	histogramBase    = time.Microsecond
+	histogramBuckets = 27
+)
+
+// WithLatencyHistograms records the latency of every operation in
+// histograms per operation type, exposed by LatencyHistograms and
+// WriteLatencyMetrics. Unlike averages, they show tail latencies such as
+// writes stalled behind a checkpoint.
+func WithLatencyHistograms() Option {
+	return func(o *options) {
+		o.latencyHistograms = true
+	}
+}
+
+// WithLatencyExemplars enables latency histograms and attaches exemplars to
+// them: fn is called after each operation and, if it returns a non-empty
+// trace ID, the observation is kept as the latest exemplar of its bucket so
+// slow operations can be linked to their traces. fn is typically backed by
+// goroutine-local tracing state and must be cheap and safe for concurrent use.
+func WithLatencyExemplars(fn func() string) Option {
+	return func(o *options) {
+		o.latencyHistograms = true
+		o.traceID = fn
+	}
+}
+
+// Exemplar is a sample observation linked to a trace.
+type Exemplar struct {
+	TraceID string
+	Latency time.Duration
+	Time    time.Time
+}
+
+// HistogramBucket counts operations taking at most UpperBound (and more than
+// the previous bucket's bound). Exemplar is nil if none was recorded.
+type HistogramBucket struct {
+	UpperBound time.Duration
+	Count      uint64
+	Exemplar   *Exemplar
+}
+
+// LatencyHistogram is the latency distribution of one operation type on one table.
+type LatencyHistogram struct {
+	Op      string // Operation name, e.g. "get" or "checkpoint"
+	Table   string
+	Count   uint64
+	Sum     time.Duration
+	Buckets []HistogramBucket // Non-empty buckets in increasing order
+}
+
+// opHistogram accumulates the latencies of one operation type.
+type opHistogram struct {
+	count     uint64
+	sum       time.Duration
+	buckets   [histogramBuckets]uint64
+	exemplars [histogramBuckets]*Exemplar
+}
+
+// latencyMetrics holds the histograms of a store.
+type latencyMetrics struct {
+	mu      sync.Mutex
+	ops     map[string]*opHistogram
+	traceID func() string
+}
+
+// bucketIndex returns the histogram bucket for latency d.
+func bucketIndex(d time.Duration) int {
+	if d <= histogramBase {
+		return 0
+	}
+	i := int(math.Ceil(math.Log2(float64(d) / float64(histogramBase))))
+	if i >= histogramBuckets {
+		return histogramBuckets - 1
+	}
+	return i
+}
+
+// bucketBound returns the upper bound of bucket i.
+func bucketBound(i int) time.Duration {
+	return histogramBase << i
+}
+
+// observe records an operation started at start. It is meant to be deferred
+// at the top of the operation and does nothing unless histograms or the slow
+// operation log are enabled.
+func (s *Store) observe(op string, start time.Time) {
+	m := s.metrics
+	if m == nil && s.slowOps == nil {
+		return
+	}
+	d := time.Since(start)
+	if s.slowOps != nil {
+		s.slowOps.record(op, d)
+	}
+	if m == nil {
+		return
+	}
+	i := bucketIndex(d)
+
+	var exemplar *Exemplar
+	if m.traceID != nil {
+		if id := m.traceID(); id != "" {
+			exemplar = &Exemplar{TraceID: id, Latency: d, Time: time.Now()}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.ops[op]
+	if h == nil {
+		h = &opHistogram{}
+		m.ops[op] = h
+	}
+	h.count++
+	h.sum += d
+	h.buckets[i]++
+	if exemplar != nil {
+		h.exemplars[i] = exemplar
+	}
+}
+
+// LatencyHistograms returns a snapshot of the latency histograms, sorted by
+// operation name. It returns nil unless the store was opened with
+// WithLatencyHistograms or WithLatencyExemplars.
+func (s *Store) LatencyHistograms() []LatencyHistogram {
+	m := s.metrics
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	histograms := make([]LatencyHistogram, 0, len(m.ops))
+	for op, h := range m.ops {
+		lh := LatencyHistogram{Op: op, Table: s.table, Count: h.count, Sum: h.sum}
+		for i, n := range h.buckets {
+			if n == 0 {
+				continue
+			}
+			b := HistogramBucket{UpperBound: bucketBound(i), Count: n}
+			if e := h.exemplars[i]; e != nil {
+				copied := *e
+				b.Exemplar = &copied
+			}
+			lh.Buckets = append(lh.Buckets, b)
+		}
+		histograms = append(histograms, lh)
+	}
+	sort.Slice(histograms, func(i, j int) bool { return histograms[i].Op < histograms[j].Op })
+	return histograms
+}
+
+// WriteLatencyMetrics writes the latency histograms to w in the OpenMetrics
+// text format as mkvstore_op_duration_seconds, labelled by op and table, with
+// exemplars carrying a trace_id label. Serve it from a /metrics handler or
+// merge it into an existing exposition.
+func (s *Store) WriteLatencyMetrics(w io.Writer) error {
+	histograms := s.LatencyHistograms()
+	if _, err := fmt.Fprintln(w, "# TYPE mkvstore_op_duration_seconds histogram"); err != nil {
+		return err
+	}
+	for _, h := range histograms {
+		labels := fmt.Sprintf(`op=%q,table=%q`, h.Op, h.Table)
+		var cumulative uint64
+		for _, b := range h.Buckets {
+			cumulative += b.Count
+			line := fmt.Sprintf(`mkvstore_op_duration_seconds_bucket{%s,le="%g"} %d`, labels, b.UpperBound.Seconds(), cumulative)
+			if e := b.Exemplar; e != nil {
+				line += fmt.Sprintf(` # {trace_id=%q} %g %.3f`, e.TraceID, e.Latency.Seconds(), float64(e.Time.UnixMilli())/1000)
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "mkvstore_op_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.Count); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "mkvstore_op_duration_seconds_sum{%s} %g\n", labels, h.Sum.Seconds()); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "mkvstore_op_duration_seconds_count{%s} %d\n", labels, h.Count); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "# EOF")
+	return err
+}
@@ -0,0 +1,80 @@
+package mkvstore
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBucketIndex tests the exponential bucket layout.
+func TestBucketIndex(t *testing.T) {
+	tests := []struct {
+		d        time.Duration
+		expected int
+	}{
+		{0, 0},
+		{time.Microsecond, 0},
+		{1500 * time.Nanosecond, 1},
+		{2 * time.Microsecond, 1},
+		{time.Millisecond, 10},
+		{time.Hour, histogramBuckets - 1},
+	}
+	for _, tt := range tests {
+		if got := bucketIndex(tt.d); got != tt.expected {
+			t.Errorf("bucketIndex(%s) = %d, expected %d", tt.d, got, tt.expected)
+		}
+		if tt.d <= bucketBound(histogramBuckets-1) && tt.d > bucketBound(bucketIndex(tt.d)) {
+			t.Errorf("%s exceeds the bound of its bucket", tt.d)
+		}
+	}
+}
+
+// TestLatencyHistograms tests that operations are recorded with exemplars.
+func TestLatencyHistograms(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "metrics.db"), "test_kv_metrics",
+		WithLatencyExemplars(func() string { return "trace-1" }))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	store.Set("a", "1", 0)
+	store.Set("b", "2", 0)
+	store.Get("a")
+
+	histograms := store.LatencyHistograms()
+	if len(histograms) != 2 || histograms[0].Op != "get" || histograms[1].Op != "set" {
+		t.Fatalf("Expected get and set histograms, got %+v", histograms)
+	}
+	set := histograms[1]
+	if set.Count != 2 || set.Table != "test_kv_metrics" || len(set.Buckets) == 0 {
+		t.Errorf("Unexpected set histogram %+v", set)
+	}
+	if e := set.Buckets[0].Exemplar; e == nil || e.TraceID != "trace-1" {
+		t.Errorf("Expected exemplar with trace-1, got %+v", e)
+	}
+
+	var out strings.Builder
+	if err := store.WriteLatencyMetrics(&out); err != nil {
+		t.Fatalf("WriteLatencyMetrics failed: %v", err)
+	}
+	for _, want := range []string{
+		`mkvstore_op_duration_seconds_count{op="set",table="test_kv_metrics"} 2`,
+		`# {trace_id="trace-1"}`,
+		"# EOF",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+// TestLatencyHistogramsDisabled tests that nothing is recorded by default.
+func TestLatencyHistogramsDisabled(t *testing.T) {
+	store, _ := setupFileStore(t)
+	store.Set("a", "1", 0)
+	if h := store.LatencyHistograms(); h != nil {
+		t.Errorf("Expected no histograms, got %+v", h)
+	}
+}
@@ -0,0 +1,453 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// schemaTable records the schema version of every store table in a database file.
+const schemaTable = "mkvstore_schema"
+
+// MigrationStep describes one schema migration.
+type MigrationStep struct {
+	Version     int    // Schema version the step upgrades to
+	Description string // Human-readable summary of the change
+}
+
+// migration is a schema upgrade step applied inside the migration transaction.
+type migration struct {
+	MigrationStep
+	apply func(tx *sql.Tx, table string) error
+}
+
+// migrations lists every schema upgrade in version order. Steps are never
+// edited or removed once released; schema changes are appended as new steps.
+var migrations = []migration{
+	{
+		MigrationStep: MigrationStep{Version: 1, Description: "create key-value table"},
+		apply: func(tx *sql.Tx, table string) error {
+			// Tables created before schema versioning have exactly this layout;
+			// refuse to adopt a same-named table that is not ours
+			if err := checkLegacyLayout(tx, table); err != nil {
+				return err
+			}
+			_, err := tx.Exec(fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s (
+				key TEXT PRIMARY KEY,
+				value TEXT,
+				type TEXT NOT NULL DEFAULT 'string', -- 'string', 'list', 'hash', etc.
+				expires_at INTEGER NULL -- Unix timestamp, NULL for no expiration
+			);`, quoteIdent(table)))
+			return err
+		},
+	},
+	{
+		MigrationStep: MigrationStep{Version: 2, Description: "add version, created_at and updated_at columns"},
+		apply: func(tx *sql.Tx, table string) error {
+			now := time.Now().Unix()
+			statements := []string{
+				fmt.Sprintf(`ALTER TABLE %s ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`, quoteIdent(table)),
+				fmt.Sprintf(`ALTER TABLE %s ADD COLUMN created_at INTEGER NULL;`, quoteIdent(table)),
+				fmt.Sprintf(`ALTER TABLE %s ADD COLUMN updated_at INTEGER NULL;`, quoteIdent(table)),
+				// Existing rows have no history; treat them as written now
+				fmt.Sprintf(`UPDATE %s SET created_at = %d, updated_at = %d;`, quoteIdent(table), now, now),
+			}
+			for _, stmt := range statements {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		MigrationStep: MigrationStep{Version: 3, Description: "store values as BLOB and add meta JSON column"},
+		apply: func(tx *sql.Tx, table string) error {
+			// SQLite cannot change a column type in place, so rebuild the table
+			rebuild := quoteIdent(table + "_rebuild")
+			statements := []string{
+				fmt.Sprintf(`
+				CREATE TABLE %s (
+					key TEXT PRIMARY KEY,
+					value BLOB,
+					type TEXT NOT NULL DEFAULT 'string',
+					expires_at INTEGER NULL, -- Unix timestamp, NULL for no expiration
+					version INTEGER NOT NULL DEFAULT 1,
+					created_at INTEGER NULL,
+					updated_at INTEGER NULL,
+					meta TEXT NULL CHECK (meta IS NULL OR json_valid(meta)) -- Per-key attributes as a JSON object
+				);`, rebuild),
+				fmt.Sprintf(`
+				INSERT INTO %s (key, value, type, expires_at, version, created_at, updated_at)
+				SELECT key, value, type, expires_at, version, created_at, updated_at FROM %s;`, rebuild, quoteIdent(table)),
+				fmt.Sprintf(`DROP TABLE %s;`, quoteIdent(table)),
+				fmt.Sprintf(`ALTER TABLE %s RENAME TO %s;`, rebuild, quoteIdent(table)),
+			}
+			for _, stmt := range statements {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		MigrationStep: MigrationStep{Version: 4, Description: "add codec column recording value compression"},
+		apply: func(tx *sql.Tx, table string) error {
+			_, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN codec INTEGER NOT NULL DEFAULT 0;`, quoteIdent(table)))
+			return err
+		},
+	},
+	{
+		MigrationStep: MigrationStep{Version: 5, Description: "add transforms column recording the value pipeline"},
+		apply: func(tx *sql.Tx, table string) error {
+			_, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN transforms TEXT NULL;`, quoteIdent(table)))
+			return err
+		},
+	},
+	{
+		MigrationStep: MigrationStep{Version: 6, Description: "add hash field table"},
+		apply: func(tx *sql.Tx, table string) error {
+			hash := quoteIdent(hashTableName(table))
+			statements := []string{
+				fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s (
+					key TEXT NOT NULL,
+					field TEXT NOT NULL,
+					value BLOB,
+					codec INTEGER NOT NULL DEFAULT 0,
+					transforms TEXT NULL,
+					expires_at INTEGER NULL, -- Unix timestamp, NULL for no expiration
+					PRIMARY KEY (key, field)
+				);`, hash),
+				// Fields go away with their hash, whether it is deleted or overwritten by another type
+				fmt.Sprintf(`
+				CREATE TRIGGER IF NOT EXISTS %s AFTER DELETE ON %s WHEN OLD.type = 'hash' BEGIN
+					DELETE FROM %s WHERE key = OLD.key;
+				END;`, quoteIdent(table+"_hash_delete"), quoteIdent(table), hash),
+				fmt.Sprintf(`
+				CREATE TRIGGER IF NOT EXISTS %s AFTER UPDATE OF type ON %s WHEN OLD.type = 'hash' AND NEW.type IS NOT 'hash' BEGIN
+					DELETE FROM %s WHERE key = OLD.key;
+				END;`, quoteIdent(table+"_hash_retype"), quoteIdent(table), hash),
+			}
+			for _, stmt := range statements {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		MigrationStep: MigrationStep{Version: 7, Description: "add list element table"},
+		apply: func(tx *sql.Tx, table string) error {
+			list := quoteIdent(listTableName(table))
+			statements := []string{
+				fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s (
+					key TEXT NOT NULL,
+					seq INTEGER NOT NULL, -- Element position; LPush goes below the minimum, RPush above the maximum
+					value BLOB,
+					codec INTEGER NOT NULL DEFAULT 0,
+					transforms TEXT NULL,
+					PRIMARY KEY (key, seq)
+				);`, list),
+				fmt.Sprintf(`
+				CREATE TRIGGER IF NOT EXISTS %s AFTER DELETE ON %s WHEN OLD.type = 'list' BEGIN
+					DELETE FROM %s WHERE key = OLD.key;
+				END;`, quoteIdent(table+"_list_delete"), quoteIdent(table), list),
+				fmt.Sprintf(`
+				CREATE TRIGGER IF NOT EXISTS %s AFTER UPDATE OF type ON %s WHEN OLD.type = 'list' AND NEW.type IS NOT 'list' BEGIN
+					DELETE FROM %s WHERE key = OLD.key;
+				END;`, quoteIdent(table+"_list_retype"), quoteIdent(table), list),
+			}
+			for _, stmt := range statements {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		MigrationStep: MigrationStep{Version: 8, Description: "add accessed_at column recording the last read"},
+		apply: func(tx *sql.Tx, table string) error {
+			_, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN accessed_at INTEGER NULL;`, quoteIdent(table)))
+			return err
+		},
+	},
+	{
+		MigrationStep: MigrationStep{Version: 9, Description: "add set member table"},
+		apply: func(tx *sql.Tx, table string) error {
+			set := quoteIdent(setTableName(table))
+			statements := []string{
+				fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s (
+					key TEXT NOT NULL,
+					member TEXT NOT NULL,
+					PRIMARY KEY (key, member)
+				);`, set),
+				fmt.Sprintf(`
+				CREATE TRIGGER IF NOT EXISTS %s AFTER DELETE ON %s WHEN OLD.type = 'set' BEGIN
+					DELETE FROM %s WHERE key = OLD.key;
+				END;`, quoteIdent(table+"_set_delete"), quoteIdent(table), set),
+				fmt.Sprintf(`
+				CREATE TRIGGER IF NOT EXISTS %s AFTER UPDATE OF type ON %s WHEN OLD.type = 'set' AND NEW.type IS NOT 'set' BEGIN
+					DELETE FROM %s WHERE key = OLD.key;
+				END;`, quoteIdent(table+"_set_retype"), quoteIdent(table), set),
+			}
+			for _, stmt := range statements {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		MigrationStep: MigrationStep{Version: 10, Description: "add sorted set member table"},
+		apply: func(tx *sql.Tx, table string) error {
+			zset := quoteIdent(zsetTableName(table))
+			statements := []string{
+				fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s (
+					key TEXT NOT NULL,
+					member TEXT NOT NULL,
+					score REAL NOT NULL,
+					PRIMARY KEY (key, member)
+				);`, zset),
+				// Ranges by rank and score scan this index in order
+				fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (key, score, member);`, quoteIdent(table+"_zset_score"), zset),
+				fmt.Sprintf(`
+				CREATE TRIGGER IF NOT EXISTS %s AFTER DELETE ON %s WHEN OLD.type = 'zset' BEGIN
+					DELETE FROM %s WHERE key = OLD.key;
+				END;`, quoteIdent(table+"_zset_delete"), quoteIdent(table), zset),
+				fmt.Sprintf(`
+				CREATE TRIGGER IF NOT EXISTS %s AFTER UPDATE OF type ON %s WHEN OLD.type = 'zset' AND NEW.type IS NOT 'zset' BEGIN
+					DELETE FROM %s WHERE key = OLD.key;
+				END;`, quoteIdent(table+"_zset_retype"), quoteIdent(table), zset),
+			}
+			for _, stmt := range statements {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		MigrationStep: MigrationStep{Version: 11, Description: "add stream entry table"},
+		apply: func(tx *sql.Tx, table string) error {
+			stream := quoteIdent(streamTableName(table))
+			statements := []string{
+				// A rowid table, so trimming can pick the rows to delete by rowid
+				fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s (
+					key TEXT NOT NULL,
+					ms INTEGER NOT NULL,
+					seq INTEGER NOT NULL,
+					fields TEXT NOT NULL,
+					PRIMARY KEY (key, ms, seq)
+				);`, stream),
+				fmt.Sprintf(`
+				CREATE TRIGGER IF NOT EXISTS %s AFTER DELETE ON %s WHEN OLD.type = 'stream' BEGIN
+					DELETE FROM %s WHERE key = OLD.key;
+				END;`, quoteIdent(table+"_stream_delete"), quoteIdent(table), stream),
+				fmt.Sprintf(`
+				CREATE TRIGGER IF NOT EXISTS %s AFTER UPDATE OF type ON %s WHEN OLD.type = 'stream' AND NEW.type IS NOT 'stream' BEGIN
+					DELETE FROM %s WHERE key = OLD.key;
+				END;`, quoteIdent(table+"_stream_retype"), quoteIdent(table), stream),
+			}
+			for _, stmt := range statements {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		MigrationStep: MigrationStep{Version: 12, Description: "forget fencing tokens of deleted keys"},
+		apply: func(tx *sql.Tx, table string) error {
+			userKey := fmt.Sprintf(`OLD.key NOT LIKE '%s' ESCAPE '\'`, prefixToSQLLike(ReservedPrefix))
+			statements := []string{
+				// The newest token written by SetWithFence goes with its key,
+				// whether it is deleted or renamed away
+				fmt.Sprintf(`
+				CREATE TRIGGER IF NOT EXISTS %s AFTER DELETE ON %s WHEN %s BEGIN
+					DELETE FROM %s WHERE key = '%s' || OLD.key;
+				END;`, quoteIdent(table+"_fence_delete"), quoteIdent(table), userKey, quoteIdent(table), fencedKeyPrefix),
+				fmt.Sprintf(`
+				CREATE TRIGGER IF NOT EXISTS %s AFTER UPDATE OF key ON %s WHEN %s AND NEW.key IS NOT OLD.key BEGIN
+					DELETE FROM %s WHERE key = '%s' || OLD.key;
+				END;`, quoteIdent(table+"_fence_rekey"), quoteIdent(table), userKey, quoteIdent(table), fencedKeyPrefix),
+			}
+			for _, stmt := range statements {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		MigrationStep: MigrationStep{Version: 13, Description: "remember versions of deleted keys"},
+		apply: func(tx *sql.Tx, table string) error {
+			// The column is shared by all tables, so only the first adds it
+			var present int
+			columnSQL := fmt.Sprintf(`SELECT COUNT(*) FROM pragma_table_info(%s) WHERE name = 'version_floor';`, sqlLiteral(schemaTable))
+			if err := tx.QueryRow(columnSQL).Scan(&present); err != nil {
+				return err
+			}
+			var statements []string
+			if present == 0 {
+				statements = append(statements, fmt.Sprintf(`
+				ALTER TABLE %s ADD COLUMN version_floor INTEGER NOT NULL DEFAULT 0;`, quoteIdent(schemaTable)))
+			}
+
+			// A key created again starts above every version its name had
+			// (see firstVersionSQL), so a reader holding an old version
+			// sees the change
+			userKey := fmt.Sprintf(`OLD.key NOT LIKE '%s' ESCAPE '\'`, prefixToSQLLike(ReservedPrefix))
+			floorSQL := fmt.Sprintf(`
+					UPDATE %s SET version_floor = OLD.version WHERE table_name = %s AND version_floor < OLD.version;`,
+				quoteIdent(schemaTable), sqlLiteral(table))
+			statements = append(statements,
+				fmt.Sprintf(`
+				CREATE TRIGGER IF NOT EXISTS %s AFTER DELETE ON %s WHEN %s BEGIN%s
+				END;`, quoteIdent(table+"_version_delete"), quoteIdent(table), userKey, floorSQL),
+				fmt.Sprintf(`
+				CREATE TRIGGER IF NOT EXISTS %s AFTER UPDATE OF key ON %s WHEN %s AND NEW.key IS NOT OLD.key BEGIN%s
+				END;`, quoteIdent(table+"_version_rekey"), quoteIdent(table), userKey, floorSQL),
+			)
+			for _, stmt := range statements {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// checkLegacyLayout verifies that table, if it already exists, has the
+// original key/value/type/expires_at columns so it can be upgraded in place.
+func checkLegacyLayout(tx *sql.Tx, table string) error {
+	rows, err := tx.Query(fmt.Sprintf(`PRAGMA table_info(%s);`, quoteIdent(table)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		columns[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(columns) == 0 {
+		return nil // Table does not exist yet
+	}
+	for _, name := range []string{"key", "value", "type", "expires_at"} {
+		if !columns[name] {
+			return fmt.Errorf("existing table %q is not a mkvstore table: missing column %q", table, name)
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns the latest schema version known to this package.
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// migrate brings table up to the latest schema version. All pending steps run
+// in a single transaction, so a failing step leaves the schema untouched.
+// With dryRun the transaction is always rolled back. It returns the steps
+// that were (or, for a dry run, would be) applied.
+func migrate(db *sql.DB, table string, dryRun bool) ([]MigrationStep, error) {
+	createSchemaSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		table_name TEXT PRIMARY KEY,
+		version INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL -- Unix timestamp of the last migration
+	);`, quoteIdent(schemaTable))
+	if _, err := db.Exec(createSchemaSQL); err != nil {
+		return nil, fmt.Errorf("failed to create schema version table: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin migration transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op after a successful Commit
+
+	// Writing first takes the write lock, so concurrent Opens of the same
+	// file migrate one after the other instead of deadlocking
+	now := time.Now().Unix()
+	registerSQL := fmt.Sprintf(`INSERT OR IGNORE INTO %s (table_name, version, updated_at) VALUES (?, 0, ?);`, quoteIdent(schemaTable))
+	if _, err := tx.Exec(registerSQL, table, now); err != nil {
+		return nil, fmt.Errorf("failed to register table %q in schema version table: %w", table, err)
+	}
+
+	var current int
+	versionSQL := fmt.Sprintf(`SELECT version FROM %s WHERE table_name = ?;`, quoteIdent(schemaTable))
+	if err := tx.QueryRow(versionSQL, table).Scan(&current); err != nil {
+		return nil, fmt.Errorf("failed to read schema version of table %q: %w", table, err)
+	}
+	if current > SchemaVersion() {
+		return nil, fmt.Errorf("table %q has schema version %d, newer than the supported version %d", table, current, SchemaVersion())
+	}
+
+	var applied []MigrationStep
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err := m.apply(tx, table); err != nil {
+			return nil, fmt.Errorf("migration %d (%s) of table %q failed: %w", m.Version, m.Description, table, err)
+		}
+		applied = append(applied, m.MigrationStep)
+	}
+
+	if dryRun || len(applied) == 0 {
+		return applied, nil // Deferred Rollback discards the dry run
+	}
+
+	updateSQL := fmt.Sprintf(`UPDATE %s SET version = ?, updated_at = ? WHERE table_name = ?;`, quoteIdent(schemaTable))
+	if _, err := tx.Exec(updateSQL, SchemaVersion(), now, table); err != nil {
+		return nil, fmt.Errorf("failed to record schema version of table %q: %w", table, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit migration of table %q: %w", table, err)
+	}
+	return applied, nil
+}
+
+// DryRunMigrations reports the schema migrations Open would apply to table in
+// the database at dbPath. The steps are actually executed inside a transaction
+// that is then rolled back, so an error means Open would fail the same way.
+// The database is left unchanged apart from the schema version bookkeeping table.
+func DryRunMigrations(dbPath string, table string) ([]MigrationStep, error) {
+	if table == "" {
+		return nil, errors.New("table name cannot be empty")
+	}
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	return migrate(db, table, true)
+}
@@ -0,0 +1,131 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// TestMigrateRecordsVersion tests that Open records the latest schema version.
+func TestMigrateRecordsVersion(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	var version int
+	err := store.db.QueryRow(fmt.Sprintf(`SELECT version FROM %s WHERE table_name = ?;`, quoteIdent(schemaTable)), store.table).Scan(&version)
+	if err != nil {
+		t.Fatalf("Failed to read schema version: %v", err)
+	}
+	if version != SchemaVersion() {
+		t.Errorf("Expected schema version %d, got %d", SchemaVersion(), version)
+	}
+}
+
+// TestDryRunMigrations tests that a dry run reports pending steps without applying them.
+func TestDryRunMigrations(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "dryrun.db")
+
+	steps, err := DryRunMigrations(dbPath, "test_kv_dryrun")
+	if err != nil {
+		t.Fatalf("DryRunMigrations failed: %v", err)
+	}
+	if len(steps) != len(migrations) {
+		t.Errorf("Expected %d pending steps for a new table, got %v", len(migrations), steps)
+	}
+
+	store, err := Open(dbPath, "test_kv_dryrun")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	steps, err = DryRunMigrations(dbPath, "test_kv_dryrun")
+	if err != nil {
+		t.Fatalf("DryRunMigrations after Open failed: %v", err)
+	}
+	if len(steps) != 0 {
+		t.Errorf("Expected no pending steps after Open, got %v", steps)
+	}
+}
+
+// TestMigrateRollbackOnError tests that a failing step leaves the schema untouched.
+func TestMigrateRollbackOnError(t *testing.T) {
+	saved := migrations
+	defer func() { migrations = saved }()
+
+	migrations = append(append([]migration(nil), saved...), migration{
+		MigrationStep: MigrationStep{Version: SchemaVersion() + 1, Description: "broken step"},
+		apply: func(tx *sql.Tx, table string) error {
+			if _, err := tx.Exec(`CREATE TABLE rollback_marker (id INTEGER);`); err != nil {
+				return err
+			}
+			return errors.New("boom")
+		},
+	})
+
+	dbPath := filepath.Join(t.TempDir(), "rollback.db")
+	if _, err := Open(dbPath, "test_kv_rollback"); err == nil {
+		t.Fatalf("Open should fail when a migration step fails")
+	}
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name IN ('rollback_marker', 'test_kv_rollback');`).Scan(&n)
+	if n != 0 {
+		t.Errorf("Failed migration left %d objects behind", n)
+	}
+}
+
+// TestUpgradeV1Table tests that a table created before schema versioning is upgraded in place.
+func TestUpgradeV1Table(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "v1.db")
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, err = db.Exec(`
+	CREATE TABLE "test_kv_v1" (
+		key TEXT PRIMARY KEY,
+		value TEXT,
+		type TEXT NOT NULL DEFAULT 'string',
+		expires_at INTEGER NULL
+	);
+	INSERT INTO "test_kv_v1" (key, value, type, expires_at) VALUES ('legacy', 'value', 'string', NULL);
+	CREATE TABLE "not_ours" (id INTEGER PRIMARY KEY, payload TEXT);`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to create v1 table: %v", err)
+	}
+
+	store, err := Open(dbPath, "test_kv_v1")
+	if err != nil {
+		t.Fatalf("Open of v1 table failed: %v", err)
+	}
+	defer store.Close()
+
+	if value, err := store.Get("legacy"); err != nil || value != "value" {
+		t.Errorf("Legacy key lost during upgrade, got %q, %v", value, err)
+	}
+
+	store.Set("legacy", "updated", 0)
+	var version int64
+	var createdAt, updatedAt sql.NullInt64
+	err = store.db.QueryRow(`SELECT version, created_at, updated_at FROM "test_kv_v1" WHERE key = 'legacy';`).Scan(&version, &createdAt, &updatedAt)
+	if err != nil {
+		t.Fatalf("Failed to read upgraded columns: %v", err)
+	}
+	if version != 2 || !createdAt.Valid || !updatedAt.Valid {
+		t.Errorf("Expected version 2 with timestamps after overwrite, got version %d, created %v, updated %v", version, createdAt, updatedAt)
+	}
+
+	if _, err := Open(dbPath, "not_ours"); err == nil {
+		t.Errorf("Open should refuse to adopt a table with a foreign layout")
+	}
+}
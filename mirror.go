@@ -0,0 +1,516 @@
+package mkvstore
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MirrorFormat selects the output of MirrorTo.
+type MirrorFormat string
+
+const (
+	// MirrorJSONL writes one JSON object per key with its key, type,
+	// expires_at (Unix timestamp, omitted for no expiration) and value,
+	// fields (hashes), elements (lists), members (sets), scored members
+	// (sorted sets) or entries (streams).
+	MirrorJSONL MirrorFormat = "jsonl"
+
+	// MirrorRESP writes one RESTORE ... REPLACE command per key in the Redis
+	// protocol, with the value in the DUMP format of RDB version 9 (Redis 5
+	// and later), ready for redis-cli --pipe. Expiring keys carry an ABSTTL.
+	// Streams, whose DUMP format is not simple, are written as DEL and XADD
+	// commands with their entry IDs, followed by a PEXPIREAT if they expire.
+	// Hash field TTLs are not carried over.
+	MirrorRESP MirrorFormat = "resp"
+
+	// MirrorSQL writes an SQLite script recreating the store's tables,
+	// indexes and triggers with their live rows, for the sqlite3 shell or a
+	// fresh database file that Open can then use as is.
+	MirrorSQL MirrorFormat = "sql"
+)
+
+// mirrorKey is one live key of a mirror with its contents.
+type mirrorKey struct {
+	Key       string        `json:"key"`
+	Type      string        `json:"type"`
+	ExpiresAt int64         `json:"expires_at,omitempty"`
+	Value     *string       `json:"value,omitempty"`
+	Fields    []HashField   `json:"fields,omitempty"`
+	Elements  []string      `json:"elements,omitempty"`
+	Members   []string      `json:"members,omitempty"`
+	Scored    []ZMember     `json:"scored,omitempty"`
+	Entries   []StreamEntry `json:"entries,omitempty"`
+}
+
+// MirrorTo writes a point-in-time export of every live key to w in format,
+// for downstream tools that want the data in their own format. Like
+// IncrementalBackup it reads from a single read transaction, so the export is
+// consistent and, in WAL mode, does not block writers. Cancelling ctx aborts
+// the export, leaving w with a partial mirror. The JSONL and RESP mirrors
+// leave out reserved keys (see ReservedPrefix), which Import would refuse;
+// the SQL mirror copies them with the rest of the table.
+func (s *Store) MirrorTo(ctx context.Context, w io.Writer, format MirrorFormat) error {
+	switch format {
+	case MirrorJSONL, MirrorRESP, MirrorSQL:
+	default:
+		return fmt.Errorf("invalid mirror format %q", format)
+	}
+	if err := s.Sync(); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	err := s.snapshot(ctx, func(tx *sql.Tx) error {
+		if format == MirrorSQL {
+			return s.mirrorSQL(ctx, tx, bw)
+		}
+		enc := json.NewEncoder(bw)
+		return s.mirrorKeys(ctx, tx, func(k mirrorKey) error {
+			if format == MirrorJSONL {
+				return enc.Encode(k)
+			}
+			return writeRestore(bw, k)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write mirror of table %q: %w", s.table, err)
+	}
+	return nil
+}
+
+// mirrorKeys calls fn for every live key but reserved ones in key order, with
+// the fields of hashes, elements of lists, members of sets and sorted sets and
+// entries of streams loaded.
+func (s *Store) mirrorKeys(ctx context.Context, tx *sql.Tx, fn func(k mirrorKey) error) error {
+	now := s.now().Unix()
+	keysSQL := fmt.Sprintf(`
+	SELECT key, type, value, codec, transforms, expires_at FROM %s
+	WHERE (expires_at IS NULL OR expires_at >= ?) AND %s
+	ORDER BY key;`, s.quoteTable(), notReservedSQL)
+
+	rows, err := tx.QueryContext(ctx, keysSQL, now)
+	if err != nil {
+		return fmt.Errorf("failed to query table %q: %w", s.table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k mirrorKey
+		var stored []byte
+		var codec byte
+		var transforms sql.NullString
+		var expiresAt sql.NullInt64
+		if err := rows.Scan(&k.Key, &k.Type, &stored, &codec, &transforms, &expiresAt); err != nil {
+			return fmt.Errorf("failed to scan key row in table %q: %w", s.table, err)
+		}
+		k.ExpiresAt = expiresAt.Int64
+
+		switch k.Type {
+		case "hash", "list", "set", "zset", "stream":
+			err = s.mirrorContents(ctx, tx, &k, now)
+		default:
+			var value string
+			value, err = s.decodeValue(stored, codec, transforms)
+			k.Value = &value
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read key %q in table %q: %w", k.Key, s.table, err)
+		}
+		if err := fn(k); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating through key rows in table %q: %w", s.table, err)
+	}
+	return nil
+}
+
+// mirrorContents loads the fields, elements, members or entries of the
+// container k, and leaves keys of other types alone.
+func (s *Store) mirrorContents(ctx context.Context, tx *sql.Tx, k *mirrorKey, now int64) error {
+	switch k.Type {
+	case "hash":
+		return s.mirrorFields(ctx, tx, k, now)
+	case "list":
+		return s.mirrorElements(ctx, tx, k)
+	case "set":
+		return s.mirrorMembers(ctx, tx, k)
+	case "zset":
+		return s.mirrorScored(ctx, tx, k)
+	case "stream":
+		return s.mirrorEntries(ctx, tx, k)
+	}
+	return nil
+}
+
+// mirrorFields loads the live fields of the hash k.
+func (s *Store) mirrorFields(ctx context.Context, tx *sql.Tx, k *mirrorKey, now int64) error {
+	fieldsSQL := fmt.Sprintf(`
+	SELECT field, value, codec, transforms FROM %s
+	WHERE key = ? AND (expires_at IS NULL OR expires_at >= ?)
+	ORDER BY field;`, s.quoteHashTable())
+	rows, err := tx.QueryContext(ctx, fieldsSQL, k.Key, now)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var f HashField
+		var stored []byte
+		var codec byte
+		var transforms sql.NullString
+		if err := rows.Scan(&f.Field, &stored, &codec, &transforms); err != nil {
+			return err
+		}
+		if f.Value, err = s.decodeValue(stored, codec, transforms); err != nil {
+			return err
+		}
+		k.Fields = append(k.Fields, f)
+	}
+	return rows.Err()
+}
+
+// mirrorElements loads the elements of the list k, head first.
+func (s *Store) mirrorElements(ctx context.Context, tx *sql.Tx, k *mirrorKey) error {
+	elementsSQL := fmt.Sprintf(`SELECT value, codec, transforms FROM %s WHERE key = ? ORDER BY seq;`, s.quoteListTable())
+	rows, err := tx.QueryContext(ctx, elementsSQL, k.Key)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var stored []byte
+		var codec byte
+		var transforms sql.NullString
+		if err := rows.Scan(&stored, &codec, &transforms); err != nil {
+			return err
+		}
+		value, err := s.decodeValue(stored, codec, transforms)
+		if err != nil {
+			return err
+		}
+		k.Elements = append(k.Elements, value)
+	}
+	return rows.Err()
+}
+
+// mirrorMembers loads the members of the set k in ascending order.
+func (s *Store) mirrorMembers(ctx context.Context, tx *sql.Tx, k *mirrorKey) error {
+	membersSQL := fmt.Sprintf(`SELECT member FROM %s WHERE key = ? ORDER BY member;`, s.quoteSetTable())
+	rows, err := tx.QueryContext(ctx, membersSQL, k.Key)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var member string
+		if err := rows.Scan(&member); err != nil {
+			return err
+		}
+		k.Members = append(k.Members, member)
+	}
+	return rows.Err()
+}
+
+// mirrorScored loads the members of the sorted set k, lowest score first.
+func (s *Store) mirrorScored(ctx context.Context, tx *sql.Tx, k *mirrorKey) error {
+	scoredSQL := fmt.Sprintf(`SELECT member, score FROM %s WHERE key = ? ORDER BY score, member;`, s.quoteZSetTable())
+	rows, err := tx.QueryContext(ctx, scoredSQL, k.Key)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m ZMember
+		if err := rows.Scan(&m.Member, &m.Score); err != nil {
+			return err
+		}
+		k.Scored = append(k.Scored, m)
+	}
+	return rows.Err()
+}
+
+// mirrorEntries loads the entries of the stream k, oldest first.
+func (s *Store) mirrorEntries(ctx context.Context, tx *sql.Tx, k *mirrorKey) error {
+	entriesSQL := fmt.Sprintf(`SELECT ms, seq, fields FROM %s WHERE key = ? ORDER BY ms, seq;`, s.quoteStreamTable())
+	rows, err := tx.QueryContext(ctx, entriesSQL, k.Key)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id streamID
+		var fields string
+		if err := rows.Scan(&id.ms, &id.seq, &fields); err != nil {
+			return err
+		}
+		entry := StreamEntry{ID: id.String()}
+		if err := json.Unmarshal([]byte(fields), &entry.Fields); err != nil {
+			return err
+		}
+		k.Entries = append(k.Entries, entry)
+	}
+	return rows.Err()
+}
+
+// RDB object types and version used for DUMP payloads.
+const (
+	rdbTypeString = 0
+	rdbTypeList   = 1
+	rdbTypeSet    = 2
+	rdbTypeHash   = 4
+	rdbTypeZSet2  = 5 // Scores as binary doubles
+	rdbVersion    = 9
+)
+
+// writeRestore writes the RESTORE command recreating k in Redis, or for a
+// stream the commands of writeStream.
+func writeRestore(w *bufio.Writer, k mirrorKey) error {
+	if k.Type == "stream" {
+		writeStream(w, k)
+		return nil
+	}
+	var payload []byte
+	switch k.Type {
+	case "string":
+		payload = append(payload, rdbTypeString)
+		payload = rdbString(payload, *k.Value)
+	case "hash":
+		payload = append(payload, rdbTypeHash)
+		payload = rdbLength(payload, uint64(len(k.Fields)))
+		for _, f := range k.Fields {
+			payload = rdbString(rdbString(payload, f.Field), f.Value)
+		}
+	case "list":
+		payload = append(payload, rdbTypeList)
+		payload = rdbLength(payload, uint64(len(k.Elements)))
+		for _, e := range k.Elements {
+			payload = rdbString(payload, e)
+		}
+	case "set":
+		payload = append(payload, rdbTypeSet)
+		payload = rdbLength(payload, uint64(len(k.Members)))
+		for _, m := range k.Members {
+			payload = rdbString(payload, m)
+		}
+	case "zset":
+		payload = append(payload, rdbTypeZSet2)
+		payload = rdbLength(payload, uint64(len(k.Scored)))
+		for _, m := range k.Scored {
+			payload = binary.LittleEndian.AppendUint64(rdbString(payload, m.Member), math.Float64bits(m.Score))
+		}
+	default:
+		return fmt.Errorf("cannot mirror key %q of type %q to the Redis protocol", k.Key, k.Type)
+	}
+	payload = binary.LittleEndian.AppendUint16(payload, rdbVersion)
+	payload = binary.LittleEndian.AppendUint64(payload, crc64Jones(payload))
+
+	args := []string{"RESTORE", k.Key, "0", string(payload), "REPLACE"}
+	if k.ExpiresAt != 0 {
+		// The key lives through the whole second of expires_at
+		args[2] = strconv.FormatInt((k.ExpiresAt+1)*1000, 10)
+		args = append(args, "ABSTTL")
+	}
+	writeCommand(w, args)
+	return nil
+}
+
+// writeStream writes the commands recreating the stream k in Redis, entry by
+// entry with fields in sorted order.
+func writeStream(w *bufio.Writer, k mirrorKey) {
+	writeCommand(w, []string{"DEL", k.Key})
+	for _, entry := range k.Entries {
+		args := []string{"XADD", k.Key, entry.ID}
+		for _, field := range slices.Sorted(maps.Keys(entry.Fields)) {
+			args = append(args, field, entry.Fields[field])
+		}
+		writeCommand(w, args)
+	}
+	if k.ExpiresAt != 0 {
+		// The key lives through the whole second of expires_at
+		writeCommand(w, []string{"PEXPIREAT", k.Key, strconv.FormatInt((k.ExpiresAt+1)*1000, 10)})
+	}
+}
+
+// writeCommand writes args as a command in the Redis protocol.
+func writeCommand(w *bufio.Writer, args []string) {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// rdbLength appends n in the RDB length encoding.
+func rdbLength(b []byte, n uint64) []byte {
+	switch {
+	case n < 1<<6:
+		return append(b, byte(n))
+	case n < 1<<14:
+		return append(b, byte(n>>8)|0x40, byte(n))
+	case n <= 1<<32-1:
+		return binary.BigEndian.AppendUint32(append(b, 0x80), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0x81), n)
+}
+
+// rdbString appends v as a length-prefixed RDB string.
+func rdbString(b []byte, v string) []byte {
+	return append(rdbLength(b, uint64(len(v))), v...)
+}
+
+// crc64JonesTable is the lookup table of the reflected Jones polynomial used
+// by Redis to checksum DUMP payloads.
+var crc64JonesTable = func() (t [256]uint64) {
+	for i := range t {
+		crc := uint64(i)
+		for range 8 {
+			if crc&1 == 1 {
+				crc = crc>>1 ^ 0x95ac9329ac4bc9b5
+			} else {
+				crc >>= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}()
+
+// crc64Jones returns the Redis CRC-64 of b. Unlike hash/crc64, it neither
+// inverts the initial nor the final value.
+func crc64Jones(b []byte) uint64 {
+	var crc uint64
+	for _, c := range b {
+		crc = crc64JonesTable[byte(crc)^c] ^ crc>>8
+	}
+	return crc
+}
+
+// mirrorSQL writes an SQLite script recreating the schema version, tables,
+// indexes and triggers of the store with their live rows.
+func (s *Store) mirrorSQL(ctx context.Context, tx *sql.Tx, w *bufio.Writer) error {
+	now := s.now().Unix()
+	live := `(expires_at IS NULL OR expires_at >= ?)`
+	liveKey := fmt.Sprintf(`key IN (SELECT key FROM %s WHERE %s)`, s.quoteTable(), live)
+	tables := []struct {
+		name  string
+		where string
+		args  []interface{}
+	}{
+		{schemaTable, `table_name = ?`, []interface{}{s.table}},
+		{s.table, live, []interface{}{now}},
+		{hashTableName(s.table), live + ` AND ` + liveKey, []interface{}{now, now}},
+		{listTableName(s.table), liveKey, []interface{}{now}},
+		{setTableName(s.table), liveKey, []interface{}{now}},
+		{zsetTableName(s.table), liveKey, []interface{}{now}},
+		{streamTableName(s.table), liveKey, []interface{}{now}},
+	}
+
+	fmt.Fprintf(w, "-- mkvstore mirror of table %q at %s\n", s.table, s.now().UTC().Format(time.RFC3339))
+	fmt.Fprintln(w, "BEGIN TRANSACTION;")
+	for _, t := range tables {
+		var create string
+		schemaSQL := `SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?;`
+		if err := tx.QueryRowContext(ctx, schemaSQL, t.name).Scan(&create); err != nil {
+			return fmt.Errorf("failed to read schema of table %q: %w", t.name, err)
+		}
+		fmt.Fprintf(w, "%s;\n", strings.TrimSuffix(create, ";"))
+		if err := s.mirrorRows(ctx, tx, w, t.name, t.where, t.args); err != nil {
+			return err
+		}
+	}
+
+	// Indexes and triggers come last so they do not slow down the inserts
+	names := make([]interface{}, 0, len(tables))
+	for _, t := range tables {
+		names = append(names, t.name)
+	}
+	extrasSQL := fmt.Sprintf(`
+	SELECT sql FROM sqlite_master
+	WHERE type IN ('index', 'trigger') AND sql IS NOT NULL AND tbl_name IN (?%s)
+	ORDER BY type, name;`, strings.Repeat(", ?", len(names)-1))
+	rows, err := tx.QueryContext(ctx, extrasSQL, names...)
+	if err != nil {
+		return fmt.Errorf("failed to read indexes of table %q: %w", s.table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var create string
+		if err := rows.Scan(&create); err != nil {
+			return fmt.Errorf("failed to read indexes of table %q: %w", s.table, err)
+		}
+		fmt.Fprintf(w, "%s;\n", strings.TrimSuffix(create, ";"))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read indexes of table %q: %w", s.table, err)
+	}
+	fmt.Fprintln(w, "COMMIT;")
+	return nil
+}
+
+// mirrorRows writes an INSERT statement for every row of table matching where.
+func (s *Store) mirrorRows(ctx context.Context, tx *sql.Tx, w *bufio.Writer, table, where string, args []interface{}) error {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT * FROM %s WHERE %s;`, quoteIdent(table), where), args...)
+	if err != nil {
+		return fmt.Errorf("failed to query table %q: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to query table %q: %w", table, err)
+	}
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("failed to scan row in table %q: %w", table, err)
+		}
+		literals := make([]string, len(values))
+		for i, v := range values {
+			literals[i] = sqlLiteral(v)
+		}
+		fmt.Fprintf(w, "INSERT INTO %s VALUES(%s);\n", quoteIdent(table), strings.Join(literals, ","))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating through rows in table %q: %w", table, err)
+	}
+	return nil
+}
+
+// sqlLiteral formats a value scanned from SQLite as an SQL literal.
+func sqlLiteral(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case time.Time:
+		return "'" + v.Format(time.RFC3339Nano) + "'"
+	}
+	return "'" + strings.ReplaceAll(fmt.Sprint(v), "'", "''") + "'"
+}
@@ -0,0 +1,93 @@
+package mkvstore
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCRC64Jones tests the DUMP checksum against the Redis check value.
+func TestCRC64Jones(t *testing.T) {
+	if got := crc64Jones([]byte("123456789")); got != 0xe9c6d914c4b8d9ca {
+		t.Errorf("crc64Jones = %#x, expected 0xe9c6d914c4b8d9ca", got)
+	}
+}
+
+// TestMirrorTo tests the JSONL, RESP and SQL mirrors of the same data.
+func TestMirrorTo(t *testing.T) {
+	store, _ := setupFileStore(t)
+	store.Set("a", "it's", 0)
+	store.Set("b", "temp", time.Hour)
+	store.HSet("h", "f", "v")
+	store.RPush("l", "x", "y")
+
+	var jsonl bytes.Buffer
+	if err := store.MirrorTo(context.Background(), &jsonl, MirrorJSONL); err != nil {
+		t.Fatalf("MirrorTo(jsonl) failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(jsonl.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 JSONL lines, got %q", jsonl.String())
+	}
+	var h mirrorKey
+	json.Unmarshal([]byte(lines[2]), &h)
+	if h.Key != "h" || h.Type != "hash" || len(h.Fields) != 1 || h.Fields[0] != (HashField{"f", "v"}) {
+		t.Errorf("Unexpected hash line %q", lines[2])
+	}
+	if !strings.Contains(lines[3], `"elements":["x","y"]`) {
+		t.Errorf("Unexpected list line %q", lines[3])
+	}
+
+	var resp bytes.Buffer
+	if err := store.MirrorTo(context.Background(), &resp, MirrorRESP); err != nil {
+		t.Fatalf("MirrorTo(resp) failed: %v", err)
+	}
+	payload := []byte("\x00\x04it's\x09\x00")
+	payload = binary.LittleEndian.AppendUint64(payload, crc64Jones(payload))
+	first := "*5\r\n$7\r\nRESTORE\r\n$1\r\na\r\n$1\r\n0\r\n$16\r\n" + string(payload) + "\r\n$7\r\nREPLACE\r\n"
+	if !strings.HasPrefix(resp.String(), first) {
+		t.Errorf("Unexpected RESTORE command %q", resp.String()[:len(first)])
+	}
+	if strings.Count(resp.String(), "ABSTTL") != 1 {
+		t.Error("Expected the expiring key to be restored with ABSTTL")
+	}
+
+	var dump bytes.Buffer
+	if err := store.MirrorTo(context.Background(), &dump, MirrorSQL); err != nil {
+		t.Fatalf("MirrorTo(sql) failed: %v", err)
+	}
+	dbPath := filepath.Join(t.TempDir(), "mirror.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open mirror database: %v", err)
+	}
+	if _, err := db.Exec(dump.String()); err != nil {
+		t.Fatalf("Failed to load SQL mirror: %v\n%s", err, dump.String())
+	}
+	db.Close()
+
+	mirror, err := Open(dbPath, store.table)
+	if err != nil {
+		t.Fatalf("Open of SQL mirror failed: %v", err)
+	}
+	defer mirror.Close()
+	if v, _ := mirror.Get("a"); v != "it's" {
+		t.Errorf("Expected mirrored a = it's, got %q", v)
+	}
+	if v, _ := mirror.HGet("h", "f"); v != "v" {
+		t.Errorf("Expected mirrored hash field, got %q", v)
+	}
+	if ttl, _ := mirror.TTL("b"); ttl <= 0 {
+		t.Errorf("Expected mirrored TTL on b, got %s", ttl)
+	}
+
+	if err := store.MirrorTo(context.Background(), &dump, "xml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
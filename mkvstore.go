@@ -8,14 +8,29 @@ import (
 	"os"
 	"strings" // Import strings for quoting the table name
 	"time"
-
-	_ "github.com/mattn/go-sqlite3" // Import the SQLite driver
 )
 
 // Store represents the key-value store backed by SQLite.
 type Store struct {
-	db    *sql.DB
-	table string // Store the table name here
+	db      *sql.DB
+	conn    *sql.Conn // Pinned connection of a Session, nil for a Store
+	path    string    // Database file path as passed to Open
+	table   string    // Store the table name here
+	opts    options
+	wb      *writeBuffer    // Non-nil when writes are coalesced (see WithFlashWearReduction)
+	wq      *writeQueue     // Non-nil when writes are serialized (see WithSerializedWrites)
+	lock    *os.File        // Holds the exclusive lock on the database file (see WithExclusiveLock)
+	parent  *Store          // Store owning db, for stores opened with Table
+	expiry  *expiryHeap     // Non-nil when expirations are tracked in memory (see WithProactiveExpiry)
+	notify  *notifier       // Wakes blocking operations such as BLPop
+	metrics *latencyMetrics // Non-nil when latency histograms are enabled
+	slowOps *slowOpLog      // Non-nil when slow operations are logged (see WithSlowOpLog)
+	codecs  *codecStats     // Compression and transformer statistics (see CodecStats)
+	hot     *hotStatements  // Prepared statements of the read hot path
+	keys    *keysCache      // Translated patterns and memoized results of Keys
+	maint   *maintenance    // Background maintenance scheduler, nil for a Session
+	ready   *readiness      // Startup work left running by Open (see WaitReady)
+	cleanup cleanupState    // Status of the background cleanup
 	// Context and cancel function for background cleanup
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -25,154 +40,463 @@ type Store struct {
 // using the specified table name.
 // dbPath is the path to the SQLite database file. Use ":memory:" for an in-memory database.
 // table is the name of the table to use within the database.
-func Open(dbPath string, table string) (*Store, error) {
+// opts are optional settings such as WithAutoCheckpoint.
+func Open(dbPath string, table string, opts ...Option) (*Store, error) {
 	if table == "" {
 		return nil, errors.New("table name cannot be empty")
 	}
 
-	db, err := sql.Open("sqlite3", dbPath)
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.pinningRejected() && o.flashWear != nil {
+		return nil, fmt.Errorf("WithFlashWearReduction needs more than one connection: %w", ErrSingleConnection)
+	}
+
+	// Lock the file before any connection can touch it
+	lock, err := acquireLock(dbPath, o.lock)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
+	}
+
+	o.attached = &attachments{}
+	o.pacer = newDeletionPacer(o.deletionThrottle)
+	db := sql.OpenDB(newConnector(o.dsn(dbPath), o.connPragmas(), o.attached))
+
+	if o.maxOpenConns > 0 {
+		db.SetMaxOpenConns(o.maxOpenConns)
+	}
+	if o.maxIdleConns > 0 {
+		db.SetMaxIdleConns(o.maxIdleConns)
 	}
 
 	// Ping to ensure the connection is valid
-	if err = db.Ping(); err != nil {
+	if err := db.Ping(); err != nil {
 		db.Close()
+		lock.Close() // Harmless without a lock
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
+	var repair *RepairReport
+	if o.autoRepair {
+		// The lock file stays in place when a corrupt file is quarantined
+		if db, repair, err = repairIfCorrupt(db, dbPath, o); err != nil {
+			lock.Close()
+			return nil, err
+		}
+	}
+
+	store, err := openTable(db, dbPath, table, o, nil)
+	if err != nil {
+		db.Close()
+		lock.Close()
+		return nil, err
+	}
+	store.lock = lock
+	if repair != nil {
+		store.emit(CorruptionEvent{Path: dbPath, Table: table, Repair: repair})
+	}
+	return store, nil
+}
+
+// Table returns a Store for another table of the same database, sharing this
+// Store's connection pool and options, e.g. to serve several isolated
+// namespaces from one database handle. The table is created if needed.
+// Background routines such as cleanup run per table, while checkpointing,
+// the exclusive lock and the serialized writer stay with the Store returned
+// by Open. Close the returned Store before closing this one; its Close leaves
+// the connection pool open.
+func (s *Store) Table(table string) (*Store, error) {
+	if table == "" {
+		return nil, errors.New("table name cannot be empty")
+	}
+	if s.parent != nil {
+		return s.parent.Table(table)
+	}
+	return openTable(s.db, s.path, table, s.opts, s)
+}
+
+// openTable initializes the schema of table in db and starts the background
+// routines configured by o. parent is the Store owning db, or nil when the
+// new Store owns it.
+func openTable(db *sql.DB, dbPath string, table string, o options, parent *Store) (*Store, error) {
+	start := time.Now()
 	store := &Store{
-		db:    db,
-		table: table,
+		db:     db,
+		path:   dbPath,
+		table:  table,
+		opts:   o,
+		parent: parent,
+		notify: &notifier{},
+		maint:  &maintenance{wake: make(chan struct{}, 1)},
+		codecs: &codecStats{stats: make(map[string]*CodecStats)},
+		hot:    newHotStatements(table),
+		keys:   newKeysCache(o.keysCacheTTL),
+	}
+	if o.latencyHistograms {
+		store.metrics = &latencyMetrics{ops: make(map[string]*opHistogram), traceID: o.traceID}
+	}
+	if o.slowOpThreshold > 0 {
+		store.slowOps = &slowOpLog{threshold: o.slowOpThreshold}
 	}
 
-	// Create the table if it doesn't exist
-	// Use store.quoteTable to safely include the table name in SQL
-	createTableSQL := fmt.Sprintf(`
-	CREATE TABLE IF NOT EXISTS %s (
-		key TEXT PRIMARY KEY,
-		value TEXT,
-		type TEXT NOT NULL DEFAULT 'string', -- 'string', 'list', 'hash', etc. (currently only 'string' supported)
-		expires_at INTEGER NULL -- Unix timestamp, NULL for no expiration
-	);`, store.quoteTable())
+	// Create the table if it doesn't exist and upgrade its schema if needed
+	if _, err := migrate(db, table, false); err != nil {
+		return nil, err
+	}
 
-	if _, err = db.Exec(createTableSQL); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to create table %q: %w", table, err)
+	if store.opts.changeLog {
+		if err := store.createChangeLog(); err != nil {
+			return nil, err
+		}
+	}
+	if store.opts.statsView {
+		if err := store.createStatsView(); err != nil {
+			return nil, err
+		}
+	}
+	if store.bucketSeconds() > 0 {
+		if err := store.createExpiryBucketIndexes(); err != nil {
+			return nil, err
+		}
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	store.ctx = ctx
 	store.cancel = cancel
 
+	if parent != nil {
+		store.wq = parent.wq // One writer for the whole database
+	} else if store.opts.serializedWrites {
+		store.startWriteQueue()
+	}
+	if store.opts.flashWear != nil {
+		if err := store.startWriteBuffer(*store.opts.flashWear); err != nil {
+			cancel()
+			if store.wq != nil && parent == nil {
+				store.wq.close()
+			}
+			return nil, err
+		}
+	}
+
+	if store.opts.proactiveExpiry {
+		if err := store.startExpiryHeap(); err != nil {
+			cancel()
+			if store.wb != nil {
+				store.wb.close()
+			}
+			if store.wq != nil && parent == nil {
+				store.wq.close()
+			}
+			return nil, err
+		}
+	}
+	if err := store.scheduleMaintenance(parent == nil); err != nil {
+		cancel()
+		if store.wb != nil {
+			store.wb.close()
+		}
+		if store.wq != nil && parent == nil {
+			store.wq.close()
+		}
+		return nil, err
+	}
+	store.startReady()
+
+	store.emit(OpenEvent{Path: dbPath, Table: table, Duration: time.Since(start)})
 	return store, nil
 }
 
 // quoteTable returns the table name safely quoted for SQL.
 func (s *Store) quoteTable() string {
+	return quoteIdent(s.table)
+}
+
+// quoteIdent returns an SQL identifier (table, index or trigger name) safely quoted.
+func quoteIdent(name string) string {
 	// Simple quoting for SQLite. For more complex scenarios,
 	// you might need a more robust quoting function.
-	return "\"" + strings.ReplaceAll(s.table, "\"", "\"\"") + "\""
+	return "\"" + strings.ReplaceAll(name, "\"", "\"\"") + "\""
 }
 
 // Close closes the database connection and stops any background routines.
+// Stores opened with Table only stop their own routines.
 func (s *Store) Close() error {
+	// Commit any buffered writes before the connection goes away
+	if s.wb != nil {
+		s.wb.close()
+	}
+
 	// Signal background routines to stop
 	if s.cancel != nil {
 		s.cancel()
 	}
+	if s.hot != nil {
+		s.hot.close()
+	}
+	if s.parent != nil {
+		s.emit(CloseEvent{Path: s.path, Table: s.table})
+		return nil // The connection pool belongs to the parent
+	}
+	if s.wq != nil {
+		s.wq.close()
+	}
 
+	var err error
 	if s.db != nil {
-		return s.db.Close()
+		err = s.db.Close()
 	}
-	return nil
+	// Release the file only once every connection is closed
+	if s.lock != nil {
+		s.lock.Close()
+	}
+	s.emit(CloseEvent{Path: s.path, Table: s.table, Err: err})
+	return err
 }
 
 // Set sets the string value of a key. If the key already exists, it is overwritten.
 // ttl is the time duration for the key to live. Use 0 or negative for no expiration.
+// A ttl of 0 takes the default configured for the key's prefix, if any (see WithPrefixTTL).
 func (s *Store) Set(key string, value string, ttl time.Duration) error {
+	defer s.observe("set", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return err
+	}
+
+	ttl = s.effectiveTTL(key, ttl)
+
 	var expiresAt interface{} // Use interface{} to allow for NULL
 	if ttl > 0 {
-		expiresAt = time.Now().Add(ttl).Unix()
+		expiresAt = s.now().Add(ttl).Unix()
 	} else {
 		expiresAt = nil // Set to NULL in the database
 	}
 
-	// Use fmt.Sprintf to dynamically build the SQL with the table name
-	setSQL := fmt.Sprintf(`INSERT OR REPLACE INTO %s (key, value, type, expires_at) VALUES (?, ?, 'string', ?);`, s.quoteTable())
+	if s.wb != nil {
+		if err := s.wb.put(key, pendingWrite{value: value, expiresAt: expiresAt}); err != nil {
+			return err
+		}
+		s.trackExpiry(key, expiresAt)
+		s.notify.publish(key, "set")
+		return nil
+	}
 
-	_, err := s.db.Exec(setSQL, key, value, expiresAt)
+	enc, err := s.encodeValue(key, value)
 	if err != nil {
 		return fmt.Errorf("failed to set key %q in table %q: %w", key, s.table, err)
 	}
+
+	_, err = s.exec(context.Background(), s.setSQL(), key, enc.data, expiresAt, s.now().Unix(), enc.codec, enc.transforms)
+	if err != nil {
+		return fmt.Errorf("failed to set key %q in table %q: %w", key, s.table, err)
+	}
+	s.trackExpiry(key, expiresAt)
+	s.notify.publish(key, "set")
 	return nil
 }
 
+// setSQL returns the upsert statement used to write a string value. It takes
+// key, encoded value, expires_at, the current Unix time, the codec ID and the
+// transformer names as parameters (see encodeValue). Overwriting an existing key bumps its version
+// and keeps its creation time.
+func (s *Store) setSQL() string {
+	// Use fmt.Sprintf to dynamically build the SQL with the table name
+	return fmt.Sprintf(`
+	INSERT INTO %s (key, value, type, expires_at, version, created_at, updated_at, codec, transforms) VALUES (?1, ?2, 'string', ?3, %s, ?4, ?4, ?5, ?6)
+	ON CONFLICT(key) DO UPDATE SET
+		value = excluded.value, type = 'string', expires_at = excluded.expires_at,
+		version = version + 1, updated_at = excluded.updated_at, codec = excluded.codec, transforms = excluded.transforms;`, s.quoteTable(), firstVersionSQL(s.table))
+}
+
 // Get retrieves the string value of a key.
 // Returns ErrKeyNotFound if the key does not exist, is expired, or is not a string.
 func (s *Store) Get(key string) (string, error) {
-	var value string
-	var keyType string
-	var expiresAt sql.NullInt64 // Use sql.NullInt64 to handle NULL
+	defer s.observe("get", time.Now())
 
-	// Use fmt.Sprintf to dynamically build the SQL with the table name
-	getSQL := fmt.Sprintf(`SELECT value, type, expires_at FROM %s WHERE key = ?;`, s.quoteTable())
+	key = s.canonicalKey(key)
 
-	row := s.db.QueryRow(getSQL, key)
-	err := row.Scan(&value, &keyType, &expiresAt)
+	if w, found, err := s.bufferedValue(key); found {
+		return w.value, err
+	}
 
-	if err == sql.ErrNoRows {
-		return "", ErrKeyNotFound
+	value, err := s.getString(s.q(), key)
+	if err == ErrKeyNotFound {
+		return s.getArchived(key) // Fall through to attached databases
+	}
+	return value, err
+}
+
+// getString reads the string value of key using q, which may be a
+// transaction, following aliases (see Alias).
+func (s *Store) getString(q queryer, key string) (string, error) {
+	for range maxAliasDepth + 1 {
+		value, target, err := s.readString(q, key)
+		if err != nil || target == "" {
+			return value, err
+		}
+		key = target
+		if w, found, err := s.bufferedValue(key); found {
+			return w.value, err
+		}
+	}
+	return "", ErrAliasCycle
+}
+
+// readString reads the string value of key using q, or the target of key if
+// it is an alias.
+func (s *Store) readString(q queryer, key string) (value, target string, err error) {
+	var stored []byte
+	var codec byte
+	var transforms sql.NullString
+	var keyType string
+	var expiresAt sql.NullInt64 // Use sql.NullInt64 to handle NULL
+	var lastUsed int64          // Last read or write, for archive tiering
+
+	// The query is built once per table and prepared on the pool (see hotStatements)
+	rows, err := s.queryGet(context.Background(), q, key)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get key %q from table %q: %w", key, s.table, err)
+	}
+	if !rows.Next() {
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get key %q from table %q: %w", key, s.table, err)
+		}
+		return "", "", ErrKeyNotFound
 	}
+	err = rows.Scan(&stored, &codec, &transforms, &keyType, &expiresAt, &lastUsed)
+	rows.Close()
 	if err != nil {
-		return "", fmt.Errorf("failed to get key %q from table %q: %w", key, s.table, err)
+		return "", "", fmt.Errorf("failed to get key %q from table %q: %w", key, s.table, err)
 	}
 
 	// Check the key type (currently only 'string' is supported for Get)
-	if keyType != "string" {
+	if keyType != "string" && keyType != "alias" && keyType != "archived" {
 		// Optionally delete if wrong type? Redis doesn't delete on WRONGTYPE.
 		// Let's return ErrWrongType for now.
-		return "", ErrWrongType
+		return "", "", ErrWrongType
 	}
 
 	// Check for expiration
 	if expiresAt.Valid {
-		if time.Now().Unix() > expiresAt.Int64 {
+		if s.now().Unix() > expiresAt.Int64 {
 			// Key is expired, delete it and return not found
 			// Use a goroutine to avoid blocking the Get operation
-			go s.Del(key) // Delete asynchronously, ignore error here
-			return "", ErrKeyNotFound
+			go s.purgeExpired(key) // Delete asynchronously, ignore error here
+			return "", "", ErrKeyNotFound
 		}
 	}
+	if keyType == "alias" {
+		return "", string(stored), nil
+	}
+	if keyType == "archived" {
+		// Serve the archived value and bring it back for the next reads
+		if value, err = s.readArchived(q, string(stored), key); err == nil {
+			go s.restoreArchived(key) // Restore asynchronously, ignore error here
+		}
+		return value, "", err
+	}
+	if n := s.touchInterval(); n > 0 && s.now().Unix()-lastUsed >= n {
+		go s.touch(key) // Record asynchronously, ignore error here
+	}
 
-	return value, nil
+	value, err = s.decodeValue(stored, codec, transforms)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get key %q from table %q: %w", key, s.table, err)
+	}
+	return value, "", nil
 }
 
 // Del deletes a key. It returns nil if the key was deleted or did not exist.
 func (s *Store) Del(key string) error {
+	defer s.observe("del", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return err
+	}
+
+	if err := s.delArchived(key); err != nil {
+		return err
+	}
+
+	if s.wb != nil {
+		if err := s.wb.put(key, pendingWrite{deleted: true}); err != nil {
+			return err
+		}
+		s.notify.publish(key, "del")
+		return nil
+	}
+
 	// Use fmt.Sprintf to dynamically build the SQL with the table name
 	delSQL := fmt.Sprintf(`DELETE FROM %s WHERE key = ?;`, s.quoteTable())
-	_, err := s.db.Exec(delSQL, key)
+	result, err := s.exec(context.Background(), delSQL, key)
 	if err != nil {
 		return fmt.Errorf("failed to delete key %q from table %q: %w", key, s.table, err)
 	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		s.notify.publish(key, "del")
+	}
 	return nil // Deleting a non-existent key is not an error in Redis
 }
 
+// purgeExpired deletes key if it is still expired. Reads that find an expired
+// key call it asynchronously; the condition keeps it from deleting a value
+// written by a Set that ran in between, which would make the Set look lost.
+func (s *Store) purgeExpired(key string) error {
+	if p := s.opts.pacer; p != nil {
+		if err := p.wait(s.ctx, 1); err != nil {
+			return err
+		}
+		defer p.done(1, 1, 0)
+	}
+	purgeSQL := fmt.Sprintf(`DELETE FROM %s WHERE key = ? AND expires_at IS NOT NULL AND expires_at < ?;`, s.quoteTable())
+	result, err := s.exec(context.Background(), purgeSQL, key, s.now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to delete expired key %q from table %q: %w", key, s.table, err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		s.notify.publish(key, "del")
+		if s.opts.onExpired != nil {
+			s.opts.onExpired(key)
+		}
+		s.emit(EvictionEvent{Table: s.table, Key: key, Reason: "expired"})
+	}
+	return nil
+}
+
 // Exists checks if a key exists and is not expired.
 // Returns true if the key exists and is valid, false otherwise.
 func (s *Store) Exists(key string) (bool, error) {
+	defer s.observe("exists", time.Now())
+
+	key = s.canonicalKey(key)
+
+	if _, found, err := s.bufferedValue(key); found {
+		return err == nil, nil
+	}
+
 	var keyType string
 	var expiresAt sql.NullInt64
 
 	// Use fmt.Sprintf to dynamically build the SQL with the table name
 	existsSQL := fmt.Sprintf(`SELECT type, expires_at FROM %s WHERE key = ?;`, s.quoteTable())
 
-	row := s.db.QueryRow(existsSQL, key)
+	row := s.queryRow(existsSQL, key)
 	err := row.Scan(&keyType, &expiresAt)
 
 	if err == sql.ErrNoRows {
-		return false, nil // Key does not exist
+		// Key does not exist, unless in an attached database
+		_, err := s.getArchived(key)
+		if err == ErrKeyNotFound {
+			return false, nil
+		}
+		return err == nil, err
 	}
 	if err != nil {
 		return false, fmt.Errorf("failed to check existence of key %q in table %q: %w", key, s.table, err)
@@ -180,10 +504,10 @@ func (s *Store) Exists(key string) (bool, error) {
 
 	// Check for expiration
 	if expiresAt.Valid {
-		if time.Now().Unix() > expiresAt.Int64 {
+		if s.now().Unix() > expiresAt.Int64 {
 			// Key is expired, delete it and return false
 			// Use a goroutine to avoid blocking the Exists operation
-			go s.Del(key) // Delete asynchronously, ignore error here
+			go s.purgeExpired(key) // Delete asynchronously, ignore error here
 			return false, nil
 		}
 	}
@@ -197,19 +521,34 @@ func (s *Store) Exists(key string) (bool, error) {
 // - time.Duration remaining time if the key has a TTL and is not expired.
 // - -1 and nil error if the key exists but has no associated TTL.
 // - 0 and ErrKeyNotFound if the key does not exist or is expired.
-// - 0 and ErrWrongType if the key exists but is not a string.
+// - 0 and ErrWrongType if the key is an alias (see Alias).
 //
 // Note: Redis returns specific integer values (-1 for no TTL, -2 for not found/expired).
 // We map -1 to a non-zero Duration and nil error, 0+ Duration to remaining TTL,
 // and 0 Duration with ErrKeyNotFound for not found/expired.
 func (s *Store) TTL(key string) (time.Duration, error) {
+	defer s.observe("ttl", time.Now())
+
+	key = s.canonicalKey(key)
+
+	if w, found, err := s.bufferedValue(key); found {
+		if err != nil {
+			return 0, err
+		}
+		expiresAt, ok := w.expiresAt.(int64)
+		if !ok {
+			return -1, nil
+		}
+		return time.Unix(expiresAt, 0).Sub(s.now()), nil
+	}
+
 	var expiresAt sql.NullInt64
 	var keyType string
 
 	// Use fmt.Sprintf to dynamically build the SQL with the table name
 	ttlSQL := fmt.Sprintf(`SELECT expires_at, type FROM %s WHERE key = ?;`, s.quoteTable())
 
-	row := s.db.QueryRow(ttlSQL, key)
+	row := s.queryRow(ttlSQL, key)
 	err := row.Scan(&expiresAt, &keyType)
 
 	if err == sql.ErrNoRows {
@@ -219,10 +558,10 @@ func (s *Store) TTL(key string) (time.Duration, error) {
 		return 0, fmt.Errorf("failed to get TTL for key %q in table %q: %w", key, s.table, err)
 	}
 
-	// Check the key type (optional, but good practice if adding other types)
-	// Redis TTL works on any key type, but PTTL returns specific values.
-	// Let's return ErrWrongType if it's not 'string' for clarity in this K/V store.
-	if keyType != "string" {
+	// Like Redis, TTL works on any key type: a hash or list expires as a
+	// whole, and archived strings keep their expiration on the stub. Only
+	// aliases are refused, their TTL being easy to mistake for the target's.
+	if keyType == "alias" {
 		return 0, ErrWrongType
 	}
 
@@ -231,12 +570,12 @@ func (s *Store) TTL(key string) (time.Duration, error) {
 	}
 
 	expiryTime := time.Unix(expiresAt.Int64, 0)
-	now := time.Now()
+	now := s.now()
 
 	if expiryTime.Before(now) {
 		// Key is expired, delete it and return not found
 		// Use a goroutine to avoid blocking the TTL operation
-		go s.Del(key) // Delete asynchronously, ignore error here
+		go s.purgeExpired(key) // Delete asynchronously, ignore error here
 		return 0, ErrKeyNotFound
 	}
 
@@ -262,19 +601,39 @@ func globToSQLLike(glob string) string {
 	return result.String()
 }
 
+// keysSQL returns the query run by Keys, taking the SQL LIKE pattern as parameter.
+func (s *Store) keysSQL() string {
+	// Use fmt.Sprintf to dynamically build the SQL with the table name
+	// Add ESCAPE '\' to the LIKE clause to correctly handle escaped % and _
+	return fmt.Sprintf(`SELECT key, type, expires_at FROM %s WHERE key LIKE ? ESCAPE '\' AND %s;`, s.quoteTable(), notReservedSQL)
+}
+
 // Keys returns all keys matching the pattern.
 // Pattern supports Redis-style glob patterns: '*' (any sequence), '?' (any single character).
-// Expired keys are deleted and not included in the results.
+// Expired keys are deleted and not included in the results, nor are reserved
+// keys (see ReservedPrefix).
 // Only string keys are returned (adjust if other types are added).
 func (s *Store) Keys(pattern string) ([]string, error) {
-	// Convert Redis glob pattern to SQL LIKE pattern
-	sqlPattern := globToSQLLike(pattern)
+	defer s.observe("keys", time.Now())
 
-	// Use fmt.Sprintf to dynamically build the SQL with the table name
-	// Add ESCAPE '\' to the LIKE clause to correctly handle escaped % and _
-	keysSQL := fmt.Sprintf(`SELECT key, type, expires_at FROM %s WHERE key LIKE ? ESCAPE '\';`, s.quoteTable())
+	pattern = s.canonicalKey(pattern)
+
+	// Buffered writes must be visible to the pattern query
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+
+	return s.keys.do(pattern, s.notify.generation(), s.now(), func() ([]string, error) {
+		return s.queryKeys(pattern)
+	})
+}
+
+// queryKeys runs the query of Keys.
+func (s *Store) queryKeys(pattern string) ([]string, error) {
+	// Convert Redis glob pattern to SQL LIKE pattern
+	sqlPattern := s.keys.like(pattern)
 
-	rows, err := s.db.Query(keysSQL, sqlPattern)
+	rows, err := s.query(s.keysSQL(), sqlPattern)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query keys with pattern %q (SQL LIKE %q) from table %q: %w", pattern, sqlPattern, s.table, err)
 	}
@@ -294,13 +653,13 @@ func (s *Store) Keys(pattern string) ([]string, error) {
 			continue
 		}
 
-		// Check type (only return strings for now)
-		if keyType != "string" {
+		// Check type (only return strings for now, archived ones included)
+		if keyType != "string" && keyType != "archived" {
 			continue
 		}
 
 		// Check expiration
-		if expiresAt.Valid && time.Now().Unix() > expiresAt.Int64 {
+		if expiresAt.Valid && s.now().Unix() > expiresAt.Int64 {
 			keysToDelete = append(keysToDelete, key)
 			continue // Skip expired keys
 		}
@@ -315,7 +674,7 @@ func (s *Store) Keys(pattern string) ([]string, error) {
 	// Delete collected expired keys outside the scan loop
 	// Use goroutines for asynchronous deletion to not block the Keys operation
 	for _, key := range keysToDelete {
-		go s.Del(key) // Delete asynchronously, ignore error
+		go s.purgeExpired(key) // Delete asynchronously, ignore error
 	}
 
 	return keys, nil
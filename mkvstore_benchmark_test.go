@@ -105,6 +105,32 @@ func BenchmarkGet(b *testing.B) {
 	}
 }
 
+// BenchmarkGetInto benchmarks GetInto reusing one buffer, reporting allocations
+// to compare with BenchmarkGet.
+func BenchmarkGetInto(b *testing.B) {
+	store := setupBenchmarkStore(b)
+
+	// Pre-populate the store with keys
+	keysToGet := make([]string, b.N)
+	for i := 0; i < b.N; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		value := fmt.Sprintf("value-%d", i)
+		store.Set(key, value, 0) // Set without TTL
+		keysToGet[i] = key
+	}
+	buf := make([]byte, 64)
+
+	b.ReportAllocs()
+	b.ResetTimer() // Reset timer to exclude pre-population time
+
+	for i := 0; i < b.N; i++ {
+		key := keysToGet[i]
+		if _, err := store.GetInto(key, buf); err != nil {
+			b.Fatalf("GetInto failed for key %q: %v", key, err)
+		}
+	}
+}
+
 // BenchmarkGetExpired benchmarks the Get operation on expired keys.
 // This tests the performance impact of checking and deleting expired keys during Get.
 func BenchmarkGetExpired(b *testing.B) {
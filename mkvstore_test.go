@@ -1,6 +1,8 @@
 package mkvstore
 
 import (
+	"context"
+	"errors"
 	"fmt" // Import fmt for logging in tests
 	"os"
 	"sort"
@@ -578,3 +580,83 @@ func TestRunCleanup(t *testing.T) {
 	// Give cleanup routine a moment to finish logging if needed before test ends
 	time.Sleep(100 * time.Millisecond)
 }
+
+// TestCleanupSweepCancelled tests that a cleanup sweep stops when its context
+// is cancelled, as it is when the store is closed.
+func TestCleanupSweepCancelled(t *testing.T) {
+	store, _ := setupFileStore(t)
+	if err := store.Set("k", "v", time.Minute); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := store.sweepExpired(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("sweepExpired with cancelled context: expected context.Canceled, got %v", err)
+	}
+
+	// The store stays usable, and an uncancelled sweep succeeds
+	if _, err := store.sweepExpired(context.Background()); err != nil {
+		t.Fatalf("sweepExpired failed: %v", err)
+	}
+}
+
+// TestTable tests stores sharing a connection pool through Table.
+func TestTable(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	other, err := store.Table("other_table")
+	if err != nil {
+		t.Fatalf("Table failed: %v", err)
+	}
+	store.Set("k", "main", 0)
+	other.Set("k", "other", 0)
+	if v, _ := store.Get("k"); v != "main" {
+		t.Errorf("Expected main table value %q, got %q", "main", v)
+	}
+	if v, _ := other.Get("k"); v != "other" {
+		t.Errorf("Expected other table value %q, got %q", "other", v)
+	}
+
+	// Closing the derived store leaves the pool open
+	if err := other.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if v, err := store.Get("k"); err != nil || v != "main" {
+		t.Errorf("Get after closing derived store = %q, %v", v, err)
+	}
+}
+
+// TestPurgeExpiredKeepsNewWrites tests that the asynchronous deletion of an
+// expired key, triggered by a read, does not delete a value set afterwards.
+func TestPurgeExpiredKeepsNewWrites(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	store.Set("k", "old", time.Hour)
+	backdate := fmt.Sprintf(`UPDATE %s SET expires_at = ? WHERE key = ?;`, store.quoteTable())
+	if _, err := store.db.Exec(backdate, time.Now().Add(-time.Hour).Unix(), "k"); err != nil {
+		t.Fatalf("Failed to backdate key: %v", err)
+	}
+	if _, err := store.Get("k"); err != ErrKeyNotFound {
+		t.Fatalf("Expected expired key to be missing, got %v", err)
+	}
+
+	// A Set racing with the purge started by Get must win
+	store.Set("k", "new", 0)
+	if err := store.purgeExpired("k"); err != nil {
+		t.Fatalf("purgeExpired failed: %v", err)
+	}
+	if v, err := store.Get("k"); err != nil || v != "new" {
+		t.Errorf("Get after purge = %q, %v; expected %q", v, err, "new")
+	}
+
+	store.HSet("h", "f", "old")
+	store.HExpire("h", "f", time.Hour)
+	store.HSet("h", "f", "new") // Clears the field TTL
+	if err := store.purgeExpiredField("h", "f"); err != nil {
+		t.Fatalf("purgeExpiredField failed: %v", err)
+	}
+	if v, err := store.HGet("h", "f"); err != nil || v != "new" {
+		t.Errorf("HGet after purge = %q, %v; expected %q", v, err, "new")
+	}
+}
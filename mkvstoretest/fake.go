@@ -0,0 +1,450 @@
+// Package mkvstoretest provides test doubles for code using mkvstore: Fake,
+// an in-memory KVStore with the same TTL and type semantics as Store, and
+// Mock, which records calls and can be programmed per method.
+package mkvstoretest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+)
+
+// Kinds of entries held by Fake, named like the types of Store.
+const (
+	kindString = "string"
+	kindHash   = "hash"
+	kindList   = "list"
+)
+
+// entry is a value held by Fake.
+type entry struct {
+	kind      string
+	value     string            // Value of a string
+	fields    map[string]string // Fields of a hash
+	elements  []string          // Elements of a list, head first
+	expiresAt time.Time         // Zero for no expiration
+}
+
+// Fake is an in-memory KVStore. Like Store, expired keys are reported as
+// missing and removed lazily. It is safe for concurrent use.
+type Fake struct {
+	mu     sync.Mutex
+	data   map[string]entry
+	now    func() time.Time
+	closed bool
+}
+
+var _ mkvstore.KVStore = (*Fake)(nil)
+
+// NewFake returns an empty Fake using the wall clock.
+func NewFake() *Fake {
+	return &Fake{data: make(map[string]entry), now: time.Now}
+}
+
+// SetClock makes the fake read the current time from now, e.g. to expire keys
+// without sleeping in tests.
+func (f *Fake) SetClock(now func() time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+}
+
+// live returns the entry at key if it exists and has not expired. Must be
+// called with f.mu held.
+func (f *Fake) live(key string) (entry, bool) {
+	e, ok := f.data[key]
+	if !ok {
+		return entry{}, false
+	}
+	if !e.expiresAt.IsZero() && f.now().After(e.expiresAt) {
+		delete(f.data, key)
+		return entry{}, false
+	}
+	return e, true
+}
+
+// typed returns the live entry at key if it holds kind. ok is false if the
+// key does not exist, and the error ErrWrongType if it holds another kind.
+// Must be called with f.mu held.
+func (f *Fake) typed(key, kind string) (e entry, ok bool, err error) {
+	e, ok = f.live(key)
+	if ok && e.kind != kind {
+		return entry{}, false, mkvstore.ErrWrongType
+	}
+	return e, ok, nil
+}
+
+// checkOpen returns an error once the fake is closed. Must be called with f.mu held.
+func (f *Fake) checkOpen() error {
+	if f.closed {
+		return fmt.Errorf("mkvstoretest: fake store is closed")
+	}
+	return nil
+}
+
+// Set implements mkvstore.KVStore.
+func (f *Fake) Set(key string, value string, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return err
+	}
+	f.set(key, value, ttl)
+	return nil
+}
+
+// set writes the string value of key. Must be called with f.mu held.
+func (f *Fake) set(key string, value string, ttl time.Duration) {
+	e := entry{kind: kindString, value: value}
+	if ttl > 0 {
+		e.expiresAt = f.now().Add(ttl)
+	}
+	f.data[key] = e
+}
+
+// Get implements mkvstore.KVStore.
+func (f *Fake) Get(key string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return "", err
+	}
+	e, ok, err := f.typed(key, kindString)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", mkvstore.ErrKeyNotFound
+	}
+	return e.value, nil
+}
+
+// Del implements mkvstore.KVStore.
+func (f *Fake) Del(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return err
+	}
+	delete(f.data, key)
+	return nil
+}
+
+// Exists implements mkvstore.KVStore.
+func (f *Fake) Exists(key string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return false, err
+	}
+	_, ok := f.live(key)
+	return ok, nil
+}
+
+// TTL implements mkvstore.KVStore.
+func (f *Fake) TTL(key string) (time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return 0, err
+	}
+	e, ok := f.live(key)
+	if !ok {
+		return 0, mkvstore.ErrKeyNotFound
+	}
+	if e.expiresAt.IsZero() {
+		return -1, nil
+	}
+	return e.expiresAt.Sub(f.now()), nil
+}
+
+// sortedKeys returns the live keys matching pattern in key order. Must be
+// called with f.mu held.
+func (f *Fake) sortedKeys(pattern string) []string {
+	var keys []string
+	for key := range f.data {
+		if _, ok := f.live(key); ok && mkvstore.MatchPattern(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Keys implements mkvstore.KVStore.
+func (f *Fake) Keys(pattern string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return nil, err
+	}
+	return f.sortedKeys(pattern), nil
+}
+
+// Scan implements mkvstore.KVStore.
+func (f *Fake) Scan(cursor string, pattern string, count int) ([]string, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return nil, "", err
+	}
+	if count <= 0 {
+		count = 10
+	}
+	all := f.sortedKeys(pattern)
+	start := sort.SearchStrings(all, cursor)
+	if start < len(all) && all[start] == cursor {
+		start++
+	}
+	page := all[start:min(start+count, len(all))]
+	if len(page) < count {
+		return page, "", nil
+	}
+	return page, page[len(page)-1], nil
+}
+
+// GetAll implements mkvstore.KVStore.
+func (f *Fake) GetAll(pattern string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+	for _, key := range f.sortedKeys(pattern) {
+		if e := f.data[key]; e.kind == kindString {
+			result[key] = e.value
+		}
+	}
+	return result, nil
+}
+
+// Rename implements mkvstore.KVStore.
+func (f *Fake) Rename(from, to string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return err
+	}
+	e, ok := f.live(from)
+	if !ok {
+		return fmt.Errorf("failed to rename key %q: %w", from, mkvstore.ErrKeyNotFound)
+	}
+	delete(f.data, from)
+	f.data[to] = e
+	return nil
+}
+
+// SetNX implements mkvstore.Strings.
+func (f *Fake) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return false, err
+	}
+	if _, ok := f.live(key); ok {
+		return false, nil
+	}
+	f.set(key, value, ttl)
+	return true, nil
+}
+
+// SetXX implements mkvstore.Strings.
+func (f *Fake) SetXX(key, value string, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return false, err
+	}
+	if e, ok := f.live(key); !ok || e.kind != kindString {
+		return false, nil
+	}
+	f.set(key, value, ttl)
+	return true, nil
+}
+
+// MSet implements mkvstore.Strings.
+func (f *Fake) MSet(pairs map[string]string, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return err
+	}
+	for key, value := range pairs {
+		f.set(key, value, ttl)
+	}
+	return nil
+}
+
+// GetDel implements mkvstore.Strings.
+func (f *Fake) GetDel(key string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return "", err
+	}
+	e, ok, err := f.typed(key, kindString)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", mkvstore.ErrKeyNotFound
+	}
+	delete(f.data, key)
+	return e.value, nil
+}
+
+// Append implements mkvstore.Strings.
+func (f *Fake) Append(key, suffix string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return 0, err
+	}
+	e, ok, err := f.typed(key, kindString)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		e = entry{kind: kindString}
+	}
+	e.value += suffix
+	f.data[key] = e
+	return len(e.value), nil
+}
+
+// Incr implements mkvstore.Counters.
+func (f *Fake) Incr(key string) (int64, error) {
+	return f.IncrBy(key, 1)
+}
+
+// Decr implements mkvstore.Counters.
+func (f *Fake) Decr(key string) (int64, error) {
+	return f.IncrBy(key, -1)
+}
+
+// IncrBy implements mkvstore.Counters.
+func (f *Fake) IncrBy(key string, delta int64) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return 0, err
+	}
+	e, ok, err := f.typed(key, kindString)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	if ok {
+		if n, err = strconv.ParseInt(e.value, 10, 64); err != nil {
+			return 0, mkvstore.ErrWrongType
+		}
+	} else {
+		e = entry{kind: kindString}
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, mkvstore.ErrOverflow
+	}
+	n += delta
+	e.value = strconv.FormatInt(n, 10)
+	f.data[key] = e
+	return n, nil
+}
+
+// Expire implements mkvstore.Expirer.
+func (f *Fake) Expire(key string, ttl time.Duration) (bool, error) {
+	return f.expireIf(key, ttl, func(time.Time, time.Time) bool { return true })
+}
+
+// ExpireAt implements mkvstore.Expirer.
+func (f *Fake) ExpireAt(key string, t time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.expireAtIf(key, t, func(time.Time, time.Time) bool { return true })
+}
+
+// ExpireNX implements mkvstore.Expirer.
+func (f *Fake) ExpireNX(key string, ttl time.Duration) (bool, error) {
+	return f.expireIf(key, ttl, func(current, _ time.Time) bool { return current.IsZero() })
+}
+
+// ExpireGT implements mkvstore.Expirer.
+func (f *Fake) ExpireGT(key string, ttl time.Duration) (bool, error) {
+	return f.expireIf(key, ttl, func(current, at time.Time) bool { return !current.IsZero() && at.After(current) })
+}
+
+// ExpireLT implements mkvstore.Expirer.
+func (f *Fake) ExpireLT(key string, ttl time.Duration) (bool, error) {
+	return f.expireIf(key, ttl, func(current, at time.Time) bool { return current.IsZero() || at.Before(current) })
+}
+
+// expireIf sets the expiry of key to now + ttl if the key exists and cond
+// holds for its current expiry, zero for none, and the new one.
+func (f *Fake) expireIf(key string, ttl time.Duration, cond func(current, at time.Time) bool) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.expireAtIf(key, f.now().Add(ttl), cond)
+}
+
+// expireAtIf sets the expiry of key to at if the key exists and cond holds,
+// deleting the key if at is not in the future, like Store. Must be called
+// with f.mu held.
+func (f *Fake) expireAtIf(key string, at time.Time, cond func(current, at time.Time) bool) (bool, error) {
+	if err := f.checkOpen(); err != nil {
+		return false, err
+	}
+	e, ok := f.live(key)
+	if !ok || !cond(e.expiresAt, at) {
+		return false, nil
+	}
+	if !at.After(f.now()) {
+		delete(f.data, key)
+		return true, nil
+	}
+	e.expiresAt = at
+	f.data[key] = e
+	return true, nil
+}
+
+// ExpireTime implements mkvstore.Expirer.
+func (f *Fake) ExpireTime(key string) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return time.Time{}, err
+	}
+	e, ok := f.live(key)
+	if !ok {
+		return time.Time{}, mkvstore.ErrKeyNotFound
+	}
+	return e.expiresAt, nil
+}
+
+// Persist implements mkvstore.Expirer.
+func (f *Fake) Persist(key string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return false, err
+	}
+	e, ok := f.live(key)
+	if !ok || e.expiresAt.IsZero() {
+		return false, nil
+	}
+	e.expiresAt = time.Time{}
+	f.data[key] = e
+	return true, nil
+}
+
+// Close implements mkvstore.KVStore. Later calls fail.
+func (f *Fake) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
@@ -0,0 +1,131 @@
+package mkvstoretest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+)
+
+// TestFakeTTL tests that the fake expires keys like Store.
+func TestFakeTTL(t *testing.T) {
+	now := time.Unix(1000, 0)
+	f := NewFake()
+	f.SetClock(func() time.Time { return now })
+
+	f.Set("a", "1", time.Minute)
+	f.Set("b", "2", 0)
+	if ttl, _ := f.TTL("a"); ttl != time.Minute {
+		t.Errorf("TTL(a) = %s, expected 1m", ttl)
+	}
+	if ttl, _ := f.TTL("b"); ttl != -1 {
+		t.Errorf("TTL(b) = %s, expected -1", ttl)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := f.Get("a"); !errors.Is(err, mkvstore.ErrKeyNotFound) {
+		t.Errorf("Expected expired key to be gone, got %v", err)
+	}
+	if keys, _ := f.Keys("*"); !reflect.DeepEqual(keys, []string{"b"}) {
+		t.Errorf("Keys = %v, expected [b]", keys)
+	}
+}
+
+// TestFakeScan tests cursor iteration over the fake.
+func TestFakeScan(t *testing.T) {
+	f := NewFake()
+	for _, k := range []string{"k:1", "k:2", "k:3", "x"} {
+		f.Set(k, k, 0)
+	}
+	page, next, _ := f.Scan("", "k:*", 2)
+	if !reflect.DeepEqual(page, []string{"k:1", "k:2"}) || next != "k:2" {
+		t.Fatalf("First page = %v, %q", page, next)
+	}
+	page, next, _ = f.Scan(next, "k:*", 2)
+	if !reflect.DeepEqual(page, []string{"k:3"}) || next != "" {
+		t.Errorf("Second page = %v, %q", page, next)
+	}
+}
+
+// TestMock tests call recording and programmed behavior.
+func TestMock(t *testing.T) {
+	m := NewMock()
+	boom := errors.New("boom")
+	m.GetFunc = func(key string) (string, error) { return "", boom }
+
+	m.Set("a", "1", time.Second)
+	if _, err := m.Get("a"); !errors.Is(err, boom) {
+		t.Errorf("Expected programmed error, got %v", err)
+	}
+	if ok, _ := m.Exists("a"); !ok {
+		t.Error("Expected unprogrammed call to reach the fake")
+	}
+
+	sets := m.CallsTo("Set")
+	if len(sets) != 1 || !reflect.DeepEqual(sets[0].Args, []interface{}{"a", "1", time.Second}) {
+		t.Errorf("Unexpected Set calls %+v", sets)
+	}
+	if len(m.Calls()) != 3 {
+		t.Errorf("Expected 3 calls, got %+v", m.Calls())
+	}
+	m.Reset()
+	if len(m.Calls()) != 0 {
+		t.Error("Expected Reset to clear calls")
+	}
+}
+
+// TestFakeTypes tests counters, expiry, hashes and lists on the fake,
+// including type errors like Store.
+func TestFakeTypes(t *testing.T) {
+	now := time.Unix(1000, 0)
+	f := NewFake()
+	f.SetClock(func() time.Time { return now })
+
+	if n, err := f.IncrBy("c", 5); err != nil || n != 5 {
+		t.Errorf("IncrBy of a missing key = %d, %v, expected 5", n, err)
+	}
+	if ok, _ := f.SetNX("c", "x", 0); ok {
+		t.Error("Expected SetNX of an existing key to report false")
+	}
+	if ok, _ := f.Expire("c", time.Minute); !ok {
+		t.Error("Expected Expire of an existing key to report true")
+	}
+	if at, _ := f.ExpireTime("c"); !at.Equal(now.Add(time.Minute)) {
+		t.Errorf("ExpireTime = %v, expected a minute from now", at)
+	}
+	if ok, _ := f.ExpireGT("c", time.Second); ok {
+		t.Error("Expected ExpireGT not to shorten the TTL")
+	}
+
+	f.HSet("h", "f", "v")
+	if _, err := f.Incr("h"); !errors.Is(err, mkvstore.ErrWrongType) {
+		t.Errorf("Incr of a hash = %v, expected ErrWrongType", err)
+	}
+	if _, err := f.Get("h"); !errors.Is(err, mkvstore.ErrWrongType) {
+		t.Errorf("Get of a hash = %v, expected ErrWrongType", err)
+	}
+	if fields, _ := f.HGetAll("h"); !reflect.DeepEqual(fields, map[string]string{"f": "v"}) {
+		t.Errorf("HGetAll = %v", fields)
+	}
+	if ok, _ := f.HDel("h", "f"); !ok {
+		t.Error("Expected HDel of an existing field to report true")
+	}
+	if exists, _ := f.Exists("h"); exists {
+		t.Error("Expected the hash to go with its last field")
+	}
+
+	f.RPush("l", "b", "c")
+	f.LPush("l", "a")
+	if values, _ := f.LRange("l", 0, -1); !reflect.DeepEqual(values, []string{"a", "b", "c"}) {
+		t.Errorf("LRange = %v, expected [a b c]", values)
+	}
+	f.LTrim("l", -2, -1)
+	if value, _ := f.RPop("l"); value != "c" {
+		t.Errorf("RPop = %q, expected c", value)
+	}
+	if n, _ := f.LLen("l"); n != 1 {
+		t.Errorf("LLen = %d, expected 1", n)
+	}
+}
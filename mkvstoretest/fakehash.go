@@ -0,0 +1,93 @@
+package mkvstoretest
+
+import (
+	"maps"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+)
+
+// HSet implements mkvstore.Hashes.
+func (f *Fake) HSet(key, field, value string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return err
+	}
+	e, ok, err := f.typed(key, kindHash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		e = entry{kind: kindHash, fields: make(map[string]string)}
+	}
+	e.fields[field] = value
+	f.data[key] = e
+	return nil
+}
+
+// HGet implements mkvstore.Hashes.
+func (f *Fake) HGet(key, field string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return "", err
+	}
+	e, _, err := f.typed(key, kindHash)
+	if err != nil {
+		return "", err
+	}
+	value, ok := e.fields[field]
+	if !ok {
+		return "", mkvstore.ErrKeyNotFound
+	}
+	return value, nil
+}
+
+// HGetAll implements mkvstore.Hashes.
+func (f *Fake) HGetAll(key string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return nil, err
+	}
+	e, _, err := f.typed(key, kindHash)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(e.fields))
+	maps.Copy(fields, e.fields)
+	return fields, nil
+}
+
+// HLen implements mkvstore.Hashes.
+func (f *Fake) HLen(key string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return 0, err
+	}
+	e, _, err := f.typed(key, kindHash)
+	return len(e.fields), err
+}
+
+// HDel implements mkvstore.Hashes. Like Store, the hash is deleted with its
+// last field.
+func (f *Fake) HDel(key, field string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return false, err
+	}
+	e, _, err := f.typed(key, kindHash)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := e.fields[field]; !ok {
+		return false, nil
+	}
+	delete(e.fields, field)
+	if len(e.fields) == 0 {
+		delete(f.data, key)
+	}
+	return true, nil
+}
@@ -0,0 +1,160 @@
+package mkvstoretest
+
+import (
+	"slices"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+)
+
+// push adds values at the head, one after the other, or at the tail of the
+// list stored at key and returns its new length. Must be called with f.mu
+// held.
+func (f *Fake) push(key string, head bool, values []string) (int, error) {
+	if err := f.checkOpen(); err != nil {
+		return 0, err
+	}
+	e, ok, err := f.typed(key, kindList)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		e = entry{kind: kindList}
+	}
+	for _, value := range values {
+		if head {
+			e.elements = slices.Insert(e.elements, 0, value)
+		} else {
+			e.elements = append(e.elements, value)
+		}
+	}
+	if len(e.elements) > 0 {
+		f.data[key] = e
+	}
+	return len(e.elements), nil
+}
+
+// LPush implements mkvstore.Lists.
+func (f *Fake) LPush(key string, values ...string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.push(key, true, values)
+}
+
+// RPush implements mkvstore.Lists.
+func (f *Fake) RPush(key string, values ...string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.push(key, false, values)
+}
+
+// pop removes and returns the element at the head or tail of the list stored
+// at key, deleting the list with its last element. Must be called with f.mu
+// held.
+func (f *Fake) pop(key string, head bool) (string, error) {
+	if err := f.checkOpen(); err != nil {
+		return "", err
+	}
+	e, ok, err := f.typed(key, kindList)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", mkvstore.ErrKeyNotFound
+	}
+	var value string
+	if head {
+		value, e.elements = e.elements[0], e.elements[1:]
+	} else {
+		last := len(e.elements) - 1
+		value, e.elements = e.elements[last], e.elements[:last]
+	}
+	f.putList(key, e)
+	return value, nil
+}
+
+// putList writes back the list e at key, or deletes the key once the list is
+// empty, like Store. Must be called with f.mu held.
+func (f *Fake) putList(key string, e entry) {
+	if len(e.elements) == 0 {
+		delete(f.data, key)
+		return
+	}
+	f.data[key] = e
+}
+
+// LPop implements mkvstore.Lists.
+func (f *Fake) LPop(key string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pop(key, true)
+}
+
+// RPop implements mkvstore.Lists.
+func (f *Fake) RPop(key string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pop(key, false)
+}
+
+// listRange resolves the inclusive indexes start and stop of a list of n
+// elements, negative ones counting from the tail, to the half-open range of
+// elements they cover, as Store does.
+func listRange(n, start, stop int) (from, to int) {
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	stop = min(stop, n-1)
+	if start > stop {
+		return 0, 0
+	}
+	return start, stop + 1
+}
+
+// LRange implements mkvstore.Lists.
+func (f *Fake) LRange(key string, start, stop int) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return nil, err
+	}
+	e, _, err := f.typed(key, kindList)
+	if err != nil {
+		return nil, err
+	}
+	from, to := listRange(len(e.elements), start, stop)
+	if from == to {
+		return nil, nil
+	}
+	return slices.Clone(e.elements[from:to]), nil
+}
+
+// LTrim implements mkvstore.Lists.
+func (f *Fake) LTrim(key string, start, stop int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return err
+	}
+	e, ok, err := f.typed(key, kindList)
+	if err != nil || !ok {
+		return err
+	}
+	from, to := listRange(len(e.elements), start, stop)
+	e.elements = slices.Clone(e.elements[from:to])
+	f.putList(key, e)
+	return nil
+}
+
+// LLen implements mkvstore.Lists.
+func (f *Fake) LLen(key string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return 0, err
+	}
+	e, _, err := f.typed(key, kindList)
+	return len(e.elements), err
+}
@@ -0,0 +1,444 @@
+package mkvstoretest
+
+import (
+	"sync"
+	"time"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+)
+
+// Call is a method call recorded by Mock.
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Mock is a KVStore that records every call and can be programmed per
+// method: when the matching ...Func field is set it is called, otherwise the
+// call is forwarded to Fake, so only the behavior under test needs to be
+// programmed. Set the Func fields before use; Mock is safe for concurrent
+// calls afterwards.
+type Mock struct {
+	// Fake backs every method without a Func. NewMock sets it to NewFake().
+	Fake *Fake
+
+	SetFunc    func(key string, value string, ttl time.Duration) error
+	GetFunc    func(key string) (string, error)
+	DelFunc    func(key string) error
+	ExistsFunc func(key string) (bool, error)
+	TTLFunc    func(key string) (time.Duration, error)
+	KeysFunc   func(pattern string) ([]string, error)
+	ScanFunc   func(cursor string, pattern string, count int) ([]string, string, error)
+	GetAllFunc func(pattern string) (map[string]string, error)
+	RenameFunc func(from, to string) error
+	CloseFunc  func() error
+
+	SetNXFunc  func(key, value string, ttl time.Duration) (bool, error)
+	SetXXFunc  func(key, value string, ttl time.Duration) (bool, error)
+	MSetFunc   func(pairs map[string]string, ttl time.Duration) error
+	GetDelFunc func(key string) (string, error)
+	AppendFunc func(key, suffix string) (int, error)
+
+	IncrFunc   func(key string) (int64, error)
+	DecrFunc   func(key string) (int64, error)
+	IncrByFunc func(key string, delta int64) (int64, error)
+
+	ExpireFunc     func(key string, ttl time.Duration) (bool, error)
+	ExpireAtFunc   func(key string, t time.Time) (bool, error)
+	ExpireNXFunc   func(key string, ttl time.Duration) (bool, error)
+	ExpireGTFunc   func(key string, ttl time.Duration) (bool, error)
+	ExpireLTFunc   func(key string, ttl time.Duration) (bool, error)
+	ExpireTimeFunc func(key string) (time.Time, error)
+	PersistFunc    func(key string) (bool, error)
+
+	HSetFunc    func(key, field, value string) error
+	HGetFunc    func(key, field string) (string, error)
+	HGetAllFunc func(key string) (map[string]string, error)
+	HLenFunc    func(key string) (int, error)
+	HDelFunc    func(key, field string) (bool, error)
+
+	LPushFunc  func(key string, values ...string) (int, error)
+	RPushFunc  func(key string, values ...string) (int, error)
+	LPopFunc   func(key string) (string, error)
+	RPopFunc   func(key string) (string, error)
+	LRangeFunc func(key string, start, stop int) ([]string, error)
+	LTrimFunc  func(key string, start, stop int) error
+	LLenFunc   func(key string) (int, error)
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ mkvstore.KVStore = (*Mock)(nil)
+
+// NewMock returns a Mock backed by an empty Fake.
+func NewMock() *Mock {
+	return &Mock{Fake: NewFake()}
+}
+
+// record appends a call to the history.
+func (m *Mock) record(method string, args ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, Call{Method: method, Args: args})
+}
+
+// Calls returns every recorded call in order.
+func (m *Mock) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// CallsTo returns the recorded calls to method, e.g. "Set", in order.
+func (m *Mock) CallsTo(method string) []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var calls []Call
+	for _, c := range m.calls {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset clears the recorded calls.
+func (m *Mock) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = nil
+}
+
+// Set implements mkvstore.KVStore.
+func (m *Mock) Set(key string, value string, ttl time.Duration) error {
+	m.record("Set", key, value, ttl)
+	if m.SetFunc != nil {
+		return m.SetFunc(key, value, ttl)
+	}
+	return m.Fake.Set(key, value, ttl)
+}
+
+// Get implements mkvstore.KVStore.
+func (m *Mock) Get(key string) (string, error) {
+	m.record("Get", key)
+	if m.GetFunc != nil {
+		return m.GetFunc(key)
+	}
+	return m.Fake.Get(key)
+}
+
+// Del implements mkvstore.KVStore.
+func (m *Mock) Del(key string) error {
+	m.record("Del", key)
+	if m.DelFunc != nil {
+		return m.DelFunc(key)
+	}
+	return m.Fake.Del(key)
+}
+
+// Exists implements mkvstore.KVStore.
+func (m *Mock) Exists(key string) (bool, error) {
+	m.record("Exists", key)
+	if m.ExistsFunc != nil {
+		return m.ExistsFunc(key)
+	}
+	return m.Fake.Exists(key)
+}
+
+// TTL implements mkvstore.KVStore.
+func (m *Mock) TTL(key string) (time.Duration, error) {
+	m.record("TTL", key)
+	if m.TTLFunc != nil {
+		return m.TTLFunc(key)
+	}
+	return m.Fake.TTL(key)
+}
+
+// Keys implements mkvstore.KVStore.
+func (m *Mock) Keys(pattern string) ([]string, error) {
+	m.record("Keys", pattern)
+	if m.KeysFunc != nil {
+		return m.KeysFunc(pattern)
+	}
+	return m.Fake.Keys(pattern)
+}
+
+// Scan implements mkvstore.KVStore.
+func (m *Mock) Scan(cursor string, pattern string, count int) ([]string, string, error) {
+	m.record("Scan", cursor, pattern, count)
+	if m.ScanFunc != nil {
+		return m.ScanFunc(cursor, pattern, count)
+	}
+	return m.Fake.Scan(cursor, pattern, count)
+}
+
+// GetAll implements mkvstore.KVStore.
+func (m *Mock) GetAll(pattern string) (map[string]string, error) {
+	m.record("GetAll", pattern)
+	if m.GetAllFunc != nil {
+		return m.GetAllFunc(pattern)
+	}
+	return m.Fake.GetAll(pattern)
+}
+
+// Rename implements mkvstore.KVStore.
+func (m *Mock) Rename(from, to string) error {
+	m.record("Rename", from, to)
+	if m.RenameFunc != nil {
+		return m.RenameFunc(from, to)
+	}
+	return m.Fake.Rename(from, to)
+}
+
+// Close implements mkvstore.KVStore.
+func (m *Mock) Close() error {
+	m.record("Close")
+	if m.CloseFunc != nil {
+		return m.CloseFunc()
+	}
+	return m.Fake.Close()
+}
+
+// SetNX implements mkvstore.Strings.
+func (m *Mock) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	m.record("SetNX", key, value, ttl)
+	if m.SetNXFunc != nil {
+		return m.SetNXFunc(key, value, ttl)
+	}
+	return m.Fake.SetNX(key, value, ttl)
+}
+
+// SetXX implements mkvstore.Strings.
+func (m *Mock) SetXX(key, value string, ttl time.Duration) (bool, error) {
+	m.record("SetXX", key, value, ttl)
+	if m.SetXXFunc != nil {
+		return m.SetXXFunc(key, value, ttl)
+	}
+	return m.Fake.SetXX(key, value, ttl)
+}
+
+// MSet implements mkvstore.Strings.
+func (m *Mock) MSet(pairs map[string]string, ttl time.Duration) error {
+	m.record("MSet", pairs, ttl)
+	if m.MSetFunc != nil {
+		return m.MSetFunc(pairs, ttl)
+	}
+	return m.Fake.MSet(pairs, ttl)
+}
+
+// GetDel implements mkvstore.Strings.
+func (m *Mock) GetDel(key string) (string, error) {
+	m.record("GetDel", key)
+	if m.GetDelFunc != nil {
+		return m.GetDelFunc(key)
+	}
+	return m.Fake.GetDel(key)
+}
+
+// Append implements mkvstore.Strings.
+func (m *Mock) Append(key, suffix string) (int, error) {
+	m.record("Append", key, suffix)
+	if m.AppendFunc != nil {
+		return m.AppendFunc(key, suffix)
+	}
+	return m.Fake.Append(key, suffix)
+}
+
+// Incr implements mkvstore.Counters.
+func (m *Mock) Incr(key string) (int64, error) {
+	m.record("Incr", key)
+	if m.IncrFunc != nil {
+		return m.IncrFunc(key)
+	}
+	return m.Fake.Incr(key)
+}
+
+// Decr implements mkvstore.Counters.
+func (m *Mock) Decr(key string) (int64, error) {
+	m.record("Decr", key)
+	if m.DecrFunc != nil {
+		return m.DecrFunc(key)
+	}
+	return m.Fake.Decr(key)
+}
+
+// IncrBy implements mkvstore.Counters.
+func (m *Mock) IncrBy(key string, delta int64) (int64, error) {
+	m.record("IncrBy", key, delta)
+	if m.IncrByFunc != nil {
+		return m.IncrByFunc(key, delta)
+	}
+	return m.Fake.IncrBy(key, delta)
+}
+
+// Expire implements mkvstore.Expirer.
+func (m *Mock) Expire(key string, ttl time.Duration) (bool, error) {
+	m.record("Expire", key, ttl)
+	if m.ExpireFunc != nil {
+		return m.ExpireFunc(key, ttl)
+	}
+	return m.Fake.Expire(key, ttl)
+}
+
+// ExpireAt implements mkvstore.Expirer.
+func (m *Mock) ExpireAt(key string, t time.Time) (bool, error) {
+	m.record("ExpireAt", key, t)
+	if m.ExpireAtFunc != nil {
+		return m.ExpireAtFunc(key, t)
+	}
+	return m.Fake.ExpireAt(key, t)
+}
+
+// ExpireNX implements mkvstore.Expirer.
+func (m *Mock) ExpireNX(key string, ttl time.Duration) (bool, error) {
+	m.record("ExpireNX", key, ttl)
+	if m.ExpireNXFunc != nil {
+		return m.ExpireNXFunc(key, ttl)
+	}
+	return m.Fake.ExpireNX(key, ttl)
+}
+
+// ExpireGT implements mkvstore.Expirer.
+func (m *Mock) ExpireGT(key string, ttl time.Duration) (bool, error) {
+	m.record("ExpireGT", key, ttl)
+	if m.ExpireGTFunc != nil {
+		return m.ExpireGTFunc(key, ttl)
+	}
+	return m.Fake.ExpireGT(key, ttl)
+}
+
+// ExpireLT implements mkvstore.Expirer.
+func (m *Mock) ExpireLT(key string, ttl time.Duration) (bool, error) {
+	m.record("ExpireLT", key, ttl)
+	if m.ExpireLTFunc != nil {
+		return m.ExpireLTFunc(key, ttl)
+	}
+	return m.Fake.ExpireLT(key, ttl)
+}
+
+// ExpireTime implements mkvstore.Expirer.
+func (m *Mock) ExpireTime(key string) (time.Time, error) {
+	m.record("ExpireTime", key)
+	if m.ExpireTimeFunc != nil {
+		return m.ExpireTimeFunc(key)
+	}
+	return m.Fake.ExpireTime(key)
+}
+
+// Persist implements mkvstore.Expirer.
+func (m *Mock) Persist(key string) (bool, error) {
+	m.record("Persist", key)
+	if m.PersistFunc != nil {
+		return m.PersistFunc(key)
+	}
+	return m.Fake.Persist(key)
+}
+
+// HSet implements mkvstore.Hashes.
+func (m *Mock) HSet(key, field, value string) error {
+	m.record("HSet", key, field, value)
+	if m.HSetFunc != nil {
+		return m.HSetFunc(key, field, value)
+	}
+	return m.Fake.HSet(key, field, value)
+}
+
+// HGet implements mkvstore.Hashes.
+func (m *Mock) HGet(key, field string) (string, error) {
+	m.record("HGet", key, field)
+	if m.HGetFunc != nil {
+		return m.HGetFunc(key, field)
+	}
+	return m.Fake.HGet(key, field)
+}
+
+// HGetAll implements mkvstore.Hashes.
+func (m *Mock) HGetAll(key string) (map[string]string, error) {
+	m.record("HGetAll", key)
+	if m.HGetAllFunc != nil {
+		return m.HGetAllFunc(key)
+	}
+	return m.Fake.HGetAll(key)
+}
+
+// HLen implements mkvstore.Hashes.
+func (m *Mock) HLen(key string) (int, error) {
+	m.record("HLen", key)
+	if m.HLenFunc != nil {
+		return m.HLenFunc(key)
+	}
+	return m.Fake.HLen(key)
+}
+
+// HDel implements mkvstore.Hashes.
+func (m *Mock) HDel(key, field string) (bool, error) {
+	m.record("HDel", key, field)
+	if m.HDelFunc != nil {
+		return m.HDelFunc(key, field)
+	}
+	return m.Fake.HDel(key, field)
+}
+
+// LPush implements mkvstore.Lists.
+func (m *Mock) LPush(key string, values ...string) (int, error) {
+	m.record("LPush", key, values)
+	if m.LPushFunc != nil {
+		return m.LPushFunc(key, values...)
+	}
+	return m.Fake.LPush(key, values...)
+}
+
+// RPush implements mkvstore.Lists.
+func (m *Mock) RPush(key string, values ...string) (int, error) {
+	m.record("RPush", key, values)
+	if m.RPushFunc != nil {
+		return m.RPushFunc(key, values...)
+	}
+	return m.Fake.RPush(key, values...)
+}
+
+// LPop implements mkvstore.Lists.
+func (m *Mock) LPop(key string) (string, error) {
+	m.record("LPop", key)
+	if m.LPopFunc != nil {
+		return m.LPopFunc(key)
+	}
+	return m.Fake.LPop(key)
+}
+
+// RPop implements mkvstore.Lists.
+func (m *Mock) RPop(key string) (string, error) {
+	m.record("RPop", key)
+	if m.RPopFunc != nil {
+		return m.RPopFunc(key)
+	}
+	return m.Fake.RPop(key)
+}
+
+// LRange implements mkvstore.Lists.
+func (m *Mock) LRange(key string, start, stop int) ([]string, error) {
+	m.record("LRange", key, start, stop)
+	if m.LRangeFunc != nil {
+		return m.LRangeFunc(key, start, stop)
+	}
+	return m.Fake.LRange(key, start, stop)
+}
+
+// LTrim implements mkvstore.Lists.
+func (m *Mock) LTrim(key string, start, stop int) error {
+	m.record("LTrim", key, start, stop)
+	if m.LTrimFunc != nil {
+		return m.LTrimFunc(key, start, stop)
+	}
+	return m.Fake.LTrim(key, start, stop)
+}
+
+// LLen implements mkvstore.Lists.
+func (m *Mock) LLen(key string) (int, error) {
+	m.record("LLen", key)
+	if m.LLenFunc != nil {
+		return m.LLenFunc(key)
+	}
+	return m.Fake.LLen(key)
+}
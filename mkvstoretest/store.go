@@ -0,0 +1,77 @@
+package mkvstoretest
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+)
+
+// Table is the table name used by stores created with New and NewInMemory.
+const Table = "kv"
+
+// memoryDBs makes in-memory database names unique within the process.
+var memoryDBs atomic.Uint64
+
+// New opens a Store backed by a database file in a temporary directory
+// private to t, and closes it when the test finishes. Pass
+// mkvstore.WithClock(clock.Now) with a Clock to control expiry.
+func New(t testing.TB, opts ...mkvstore.Option) *mkvstore.Store {
+	t.Helper()
+	return open(t, filepath.Join(t.TempDir(), "mkvstore.db"), opts)
+}
+
+// NewInMemory is like New but uses a named shared-cache in-memory database,
+// so every connection of the pool sees the same data without touching disk.
+// Durability options that need a file, such as WAL mode, have no effect.
+func NewInMemory(t testing.TB, opts ...mkvstore.Option) *mkvstore.Store {
+	t.Helper()
+	name := fmt.Sprintf("%s-%d", url.PathEscape(t.Name()), memoryDBs.Add(1))
+	return open(t, "file:"+name+"?mode=memory&cache=shared", opts)
+}
+
+// open opens the store at dbPath and registers its cleanup with t.
+func open(t testing.TB, dbPath string, opts []mkvstore.Option) *mkvstore.Store {
+	t.Helper()
+	store, err := mkvstore.Open(dbPath, Table, opts...)
+	if err != nil {
+		t.Fatalf("mkvstoretest: failed to open store at %q: %v", dbPath, err)
+	}
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			t.Errorf("mkvstoretest: failed to close store: %v", err)
+		}
+	})
+	return store
+}
+
+// Clock is a manually advanced clock for mkvstore.WithClock and Fake.SetClock.
+// It is safe for concurrent use.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a clock stopped at start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the clock's current time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,40 @@
+package mkvstoretest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+)
+
+// TestNewWithClock tests that a fake clock drives expiry of a real store.
+func TestNewWithClock(t *testing.T) {
+	clock := NewClock(time.Now())
+	store := New(t, mkvstore.WithClock(clock.Now))
+
+	store.Set("session", "abc", time.Hour)
+	if _, err := store.Get("session"); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	clock.Advance(2 * time.Hour)
+	if _, err := store.Get("session"); !errors.Is(err, mkvstore.ErrKeyNotFound) {
+		t.Errorf("Expected key to expire with the clock, got %v", err)
+	}
+}
+
+// TestNewInMemory tests that the in-memory store is shared across the pool
+// and isolated between stores.
+func TestNewInMemory(t *testing.T) {
+	a := NewInMemory(t)
+	b := NewInMemory(t)
+
+	a.Set("k", "v", 0)
+	keys, err := a.Keys("*") // Runs on any pooled connection
+	if err != nil || len(keys) != 1 {
+		t.Errorf("Keys = %v, %v; expected [k]", keys, err)
+	}
+	if ok, _ := b.Exists("k"); ok {
+		t.Error("Expected stores to be isolated")
+	}
+}
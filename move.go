@@ -0,0 +1,105 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Move moves key, with its type, TTL, version and any hash fields, list
+// elements, set and sorted set members or stream entries, to table targetTable of the same database in one transaction,
+// like Redis MOVE between databases, e.g. to quarantine or archive a key in a
+// table that other code scans separately. The target table is created if
+// needed. If the key already exists in targetTable it is left alone and Move
+// returns false. Keys archived by ArchiveColdKeys cannot be moved. Only
+// subscribers of this Store see the move, as a "move_from" event.
+// Returns ErrKeyNotFound if key does not exist or is expired.
+func (s *Store) Move(key, targetTable string) (bool, error) {
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return false, err
+	}
+	if targetTable == "" {
+		return false, errors.New("table name cannot be empty")
+	}
+	if targetTable == s.table {
+		return false, fmt.Errorf("failed to move key %q: table %q is the source table", key, targetTable)
+	}
+	if err := s.Sync(); err != nil {
+		return false, err
+	}
+	defer s.observe("move", time.Now())
+
+	// Schema changes take their own transaction, so create the target first
+	if _, err := migrate(s.db, targetTable, false); err != nil {
+		return false, err
+	}
+
+	now := s.now().Unix()
+	moved := false
+	err := s.update(func(tx *sql.Tx) error {
+		var keyType string
+		var expiresAt sql.NullInt64
+		checkSQL := fmt.Sprintf(`SELECT type, expires_at FROM %s WHERE key = ?;`, s.quoteTable())
+		err := tx.QueryRowContext(s.ctx, checkSQL, key).Scan(&keyType, &expiresAt)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to move key %q from table %q: %w", key, s.table, err)
+		}
+		if err == sql.ErrNoRows || (expiresAt.Valid && now > expiresAt.Int64) {
+			return fmt.Errorf("failed to move key %q from table %q: %w", key, s.table, ErrKeyNotFound)
+		}
+		if keyType == "archived" {
+			return fmt.Errorf("failed to move key %q from table %q: key is archived", key, s.table)
+		}
+
+		target := quoteIdent(targetTable)
+		var exists int
+		existsSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE key = ? AND (expires_at IS NULL OR expires_at >= ?);`, target)
+		if err := tx.QueryRowContext(s.ctx, existsSQL, key, now).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to move key %q to table %q: %w", key, targetTable, err)
+		}
+		if exists > 0 {
+			return nil
+		}
+
+		statements := []string{
+			// Clears an expired key, whose fields or elements go with it
+			fmt.Sprintf(`DELETE FROM %s WHERE key = ?;`, target),
+			fmt.Sprintf(`
+			INSERT INTO %s (key, value, type, expires_at, version, created_at, updated_at, codec, transforms, meta, accessed_at)
+			SELECT key, value, type, expires_at, MAX(version, %s), created_at, updated_at, codec, transforms, meta, accessed_at
+			FROM %s WHERE key = ?;`, target, firstVersionSQL(targetTable), s.quoteTable()),
+			fmt.Sprintf(`
+			INSERT INTO %s (key, field, value, codec, transforms, expires_at)
+			SELECT key, field, value, codec, transforms, expires_at FROM %s WHERE key = ?;`,
+				quoteIdent(hashTableName(targetTable)), s.quoteHashTable()),
+			fmt.Sprintf(`
+			INSERT INTO %s (key, seq, value, codec, transforms)
+			SELECT key, seq, value, codec, transforms FROM %s WHERE key = ?;`,
+				quoteIdent(listTableName(targetTable)), s.quoteListTable()),
+			fmt.Sprintf(`
+			INSERT INTO %s (key, member) SELECT key, member FROM %s WHERE key = ?;`,
+				quoteIdent(setTableName(targetTable)), s.quoteSetTable()),
+			fmt.Sprintf(`
+			INSERT INTO %s (key, member, score) SELECT key, member, score FROM %s WHERE key = ?;`,
+				quoteIdent(zsetTableName(targetTable)), s.quoteZSetTable()),
+			fmt.Sprintf(`
+			INSERT INTO %s (key, ms, seq, fields) SELECT key, ms, seq, fields FROM %s WHERE key = ?;`,
+				quoteIdent(streamTableName(targetTable)), s.quoteStreamTable()),
+			fmt.Sprintf(`DELETE FROM %s WHERE key = ?;`, s.quoteTable()),
+		}
+		for _, stmt := range statements {
+			if _, err := tx.ExecContext(s.ctx, stmt, key); err != nil {
+				return fmt.Errorf("failed to move key %q from table %q to table %q: %w", key, s.table, targetTable, err)
+			}
+		}
+		moved = true
+		return nil
+	})
+	if err != nil || !moved {
+		return false, err
+	}
+	s.notify.publish(key, "move_from")
+	return true, nil
+}
@@ -0,0 +1,58 @@
+package mkvstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestMove tests moving strings and hashes to another table of the same
+// database, keeping keys already in the target table.
+func TestMove(t *testing.T) {
+	store := setupStore(t)
+
+	store.Set("job", "payload", time.Minute)
+	store.HSet("h", "f", "1")
+	for _, key := range []string{"job", "h"} {
+		if ok, err := store.Move(key, "quarantine"); err != nil || !ok {
+			t.Fatalf("Move(%q) = %v, %v", key, ok, err)
+		}
+	}
+	if _, err := store.Get("job"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected job to leave the source table, got %v", err)
+	}
+	if all, _ := store.HGetAll("h"); len(all) != 0 {
+		t.Errorf("Expected the fields of h to leave the source table, got %v", all)
+	}
+
+	quarantine, err := store.Table("quarantine")
+	if err != nil {
+		t.Fatalf("Table failed: %v", err)
+	}
+	defer quarantine.Close()
+	if v, _ := quarantine.Get("job"); v != "payload" {
+		t.Errorf("Expected job in the target table, got %q", v)
+	}
+	if ttl, _ := quarantine.TTL("job"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("Expected job to keep its TTL, got %v", ttl)
+	}
+	if v, _ := quarantine.HGet("h", "f"); v != "1" {
+		t.Errorf("Expected the fields of h in the target table, got %q", v)
+	}
+
+	// A key already in the target stays, and so does the source
+	store.Set("job", "second", 0)
+	if ok, err := store.Move("job", "quarantine"); err != nil || ok {
+		t.Errorf("Move onto an existing key = %v, %v", ok, err)
+	}
+	if v, _ := store.Get("job"); v != "second" {
+		t.Errorf("Expected job to stay in the source table, got %q", v)
+	}
+
+	if _, err := store.Move("missing", "quarantine"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if _, err := store.Move("job", store.table); err == nil {
+		t.Error("Expected moving a key to its own table to fail")
+	}
+}
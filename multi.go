@@ -0,0 +1,251 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MSet sets every key of pairs to its value in a single transaction, like
+// Set with the same ttl for each, so a batch of thousands of keys costs one
+// commit, and one fsync, instead of one per key. Either all pairs are written
+// or, on error, none is. With WithFlashWearReduction the pairs are buffered
+// together and, unless running write-behind, MSet waits for their commit.
+func (s *Store) MSet(pairs map[string]string, ttl time.Duration) error {
+	defer s.observe("mset", time.Now())
+
+	pairs = s.canonicalPairs(pairs)
+
+	if len(pairs) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(pairs))
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+	if err := checkReserved(keys...); err != nil {
+		return err
+	}
+	sort.Strings(keys) // Deterministic statement and event order
+
+	writes := make(map[string]pendingWrite, len(pairs))
+	for _, key := range keys {
+		var expiresAt interface{} // NULL for no expiration
+		if ttl := s.effectiveTTL(key, ttl); ttl > 0 {
+			expiresAt = s.now().Add(ttl).Unix()
+		}
+		writes[key] = pendingWrite{value: pairs[key], expiresAt: expiresAt}
+	}
+
+	if s.wb != nil {
+		if err := s.wb.putAll(writes); err != nil {
+			return err
+		}
+	} else {
+		now := s.now().Unix()
+		err := s.update(func(tx *sql.Tx) error {
+			stmt, err := tx.PrepareContext(context.Background(), s.setSQL())
+			if err != nil {
+				return fmt.Errorf("failed to prepare batch set in table %q: %w", s.table, err)
+			}
+			defer stmt.Close()
+			for _, key := range keys {
+				w := writes[key]
+				enc, err := s.encodeValue(key, w.value)
+				if err != nil {
+					return fmt.Errorf("failed to set key %q in table %q: %w", key, s.table, err)
+				}
+				if _, err := stmt.Exec(key, enc.data, w.expiresAt, now, enc.codec, enc.transforms); err != nil {
+					return fmt.Errorf("failed to set key %q in table %q: %w", key, s.table, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, key := range keys {
+		s.trackExpiry(key, writes[key].expiresAt)
+		s.notify.publish(key, "set")
+	}
+	return nil
+}
+
+// Swap sets every key of pairs to its value like MSet and returns the values
+// the keys held before, read and replaced in a single transaction, so a
+// reconciliation loop learns exactly what it overwrote. Keys that did not hold
+// a live string are missing from the result; keys of other types are
+// overwritten like with Set. Aliases are followed for the previous value and
+// replaced themselves. Either all pairs are written or, on error, none is.
+func (s *Store) Swap(pairs map[string]string, ttl time.Duration) (map[string]string, error) {
+	defer s.observe("swap", time.Now())
+
+	pairs = s.canonicalPairs(pairs)
+
+	previous := make(map[string]string, len(pairs))
+	if len(pairs) == 0 {
+		return previous, nil
+	}
+	keys := make([]string, 0, len(pairs))
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+	if err := checkReserved(keys...); err != nil {
+		return nil, err
+	}
+	sort.Strings(keys) // Deterministic statement and event order
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+
+	expiries := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		var expiresAt interface{} // NULL for no expiration
+		if ttl := s.effectiveTTL(key, ttl); ttl > 0 {
+			expiresAt = s.now().Add(ttl).Unix()
+		}
+		expiries[key] = expiresAt
+	}
+
+	now := s.now().Unix()
+	err := s.update(func(tx *sql.Tx) error {
+		for _, key := range keys {
+			value, err := s.getString(tx, key)
+			switch {
+			case err == nil:
+				previous[key] = value
+			case err != ErrKeyNotFound && err != ErrWrongType:
+				return err
+			}
+
+			enc, err := s.encodeValue(key, pairs[key])
+			if err != nil {
+				return fmt.Errorf("failed to set key %q in table %q: %w", key, s.table, err)
+			}
+			if _, err := tx.ExecContext(s.ctx, s.setSQL(), key, enc.data, expiries[key], now, enc.codec, enc.transforms); err != nil {
+				return fmt.Errorf("failed to set key %q in table %q: %w", key, s.table, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		s.trackExpiry(key, expiries[key])
+		s.notify.publish(key, "set")
+	}
+	return previous, nil
+}
+
+// mgetChunk is the number of keys MGet looks up per query, well below the
+// SQLite limit on bound parameters.
+const mgetChunk = 500
+
+// MGet returns the string values of keys in a single query per 500 keys
+// instead of one round trip per key. Keys that do not exist, are expired or
+// are not strings are missing from the result, like nil replies to Redis MGET.
+// Aliases are followed and archived keys restored, as with Get.
+func (s *Store) MGet(keys ...string) (map[string]string, error) {
+	defer s.observe("mget", time.Now())
+
+	keys = s.canonicalKeys(keys)
+
+	values := make(map[string]string, len(keys))
+	var stored []string // Keys to look up in the table
+	for _, key := range keys {
+		if w, found, err := s.bufferedValue(key); found {
+			if err == nil {
+				values[key] = w.value
+			}
+			continue
+		}
+		stored = append(stored, key)
+	}
+
+	var indirect []string // Aliases and archived keys, resolved like Get
+	archives := len(s.opts.attached.aliases()) > 0
+	for start := 0; start < len(stored); start += mgetChunk {
+		chunk := stored[start:min(start+mgetChunk, len(stored))]
+		present, err := s.mget(chunk, values)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range chunk {
+			if _, ok := present[key]; !ok && archives {
+				indirect = append(indirect, key) // Maybe in an attached database
+			} else if present[key] {
+				indirect = append(indirect, key)
+			}
+		}
+	}
+	for _, key := range indirect {
+		value, err := s.Get(key)
+		if err == ErrKeyNotFound || err == ErrWrongType {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// mget reads the plain string values of keys into values. It returns the keys
+// present in the table, mapped to true for aliases and archived keys, which
+// it leaves to the caller.
+func (s *Store) mget(keys []string, values map[string]string) (map[string]bool, error) {
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	mgetSQL := fmt.Sprintf(`
+	SELECT key, value, codec, transforms, type, expires_at, max(COALESCE(accessed_at, 0), COALESCE(updated_at, 0))
+	FROM %s WHERE key IN (?%s);`, s.quoteTable(), strings.Repeat(", ?", len(keys)-1))
+	rows, err := s.query(mgetSQL, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %d keys from table %q: %w", len(keys), s.table, err)
+	}
+	defer rows.Close()
+
+	present := make(map[string]bool, len(keys))
+	now := s.now().Unix()
+	for rows.Next() {
+		var key, keyType string
+		var stored []byte
+		var codec byte
+		var transforms sql.NullString
+		var expiresAt sql.NullInt64
+		var lastUsed int64
+		if err := rows.Scan(&key, &stored, &codec, &transforms, &keyType, &expiresAt, &lastUsed); err != nil {
+			return nil, fmt.Errorf("failed to get %d keys from table %q: %w", len(keys), s.table, err)
+		}
+		present[key] = keyType == "alias" || keyType == "archived"
+		if keyType != "string" {
+			continue
+		}
+		if expiresAt.Valid && now > expiresAt.Int64 {
+			go s.purgeExpired(key) // Delete asynchronously, ignore error here
+			continue
+		}
+		value, err := s.decodeValue(stored, codec, transforms)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get key %q from table %q: %w", key, s.table, err)
+		}
+		values[key] = value
+		if n := s.touchInterval(); n > 0 && now-lastUsed >= n {
+			go s.touch(key) // Record asynchronously, ignore error here
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get %d keys from table %q: %w", len(keys), s.table, err)
+	}
+	return present, nil
+}
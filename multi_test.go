@@ -0,0 +1,110 @@
+package mkvstore
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestMSet tests that a batch is written in one transaction with the same TTL.
+func TestMSet(t *testing.T) {
+	store := setupWALStore(t)
+	pairs := make(map[string]string)
+	for i := range 100 {
+		pairs[fmt.Sprintf("key:%03d", i)] = fmt.Sprintf("value:%d", i)
+	}
+	if err := store.MSet(pairs, time.Hour); err != nil {
+		t.Fatalf("MSet failed: %v", err)
+	}
+	if n := countRows(t, store); n != 100 {
+		t.Errorf("Expected 100 rows, got %d", n)
+	}
+	if v, err := store.Get("key:042"); err != nil || v != "value:42" {
+		t.Errorf("Expected key:042 = value:42, got %q, %v", v, err)
+	}
+	if ttl, err := store.TTL("key:099"); err != nil || ttl <= 0 {
+		t.Errorf("Expected a TTL on key:099, got %s, %v", ttl, err)
+	}
+
+	// A failing pair rolls back the whole batch
+	store.db.Exec(fmt.Sprintf(`CREATE TRIGGER fail BEFORE INSERT ON %s WHEN NEW.key = 'bad' BEGIN SELECT RAISE(ABORT, 'rejected'); END;`, store.quoteTable()))
+	if err := store.MSet(map[string]string{"good": "1", "bad": "2"}, 0); err == nil {
+		t.Fatal("Expected MSet to fail")
+	}
+	if _, err := store.Get("good"); err != ErrKeyNotFound {
+		t.Errorf("Expected no pair of a failed batch to be written, got %v", err)
+	}
+}
+
+// TestMSetFlashWear tests that a buffered batch is committed before MSet returns.
+func TestMSetFlashWear(t *testing.T) {
+	store := setupWALStore(t, WithFlashWearReduction(FlashWearConfig{}))
+	if err := store.MSet(map[string]string{"a": "1", "b": "2"}, 0); err != nil {
+		t.Fatalf("MSet failed: %v", err)
+	}
+	if n := countRows(t, store); n != 2 {
+		t.Errorf("Expected 2 committed rows after MSet returned, got %d", n)
+	}
+}
+
+// TestMGet tests batch reads of present, missing, expired, aliased and
+// non-string keys.
+func TestMGet(t *testing.T) {
+	now := time.Now()
+	store := setupWALStore(t, WithClock(func() time.Time { return now }))
+	store.MSet(map[string]string{"a": "1", "b": "2"}, 0)
+	store.Set("old", "x", time.Second)
+	store.Alias("link", "a")
+	store.HSet("h", "f", "v")
+	now = now.Add(2 * time.Second)
+
+	keys := []string{"a", "b", "missing", "old", "link", "h"}
+	for i := range 1000 {
+		keys = append(keys, fmt.Sprintf("none:%d", i)) // Spans several queries
+	}
+	values, err := store.MGet(keys...)
+	if err != nil {
+		t.Fatalf("MGet failed: %v", err)
+	}
+	expected := map[string]string{"a": "1", "b": "2", "link": "1"}
+	if fmt.Sprint(values) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+}
+
+// TestSwap tests that Swap returns the previous strings of the keys it
+// writes, and writes nothing if a pair fails.
+func TestSwap(t *testing.T) {
+	now := time.Now()
+	store := setupWALStore(t, WithClock(func() time.Time { return now }))
+	store.MSet(map[string]string{"a": "1", "b": "2"}, 0)
+	store.Set("old", "x", time.Second)
+	store.HSet("h", "f", "v")
+	now = now.Add(2 * time.Second)
+
+	previous, err := store.Swap(map[string]string{"a": "10", "old": "y", "h": "z", "new": "n"}, time.Hour)
+	if err != nil {
+		t.Fatalf("Swap failed: %v", err)
+	}
+	if len(previous) != 1 || previous["a"] != "1" {
+		t.Errorf("Expected only a = 1 as previous value, got %v", previous)
+	}
+	values, err := store.MGet("a", "b", "old", "h", "new")
+	if err != nil {
+		t.Fatalf("MGet failed: %v", err)
+	}
+	if fmt.Sprint(values) != "map[a:10 b:2 h:z new:n old:y]" {
+		t.Errorf("Unexpected values after Swap: %v", values)
+	}
+	if ttl, err := store.TTL("new"); err != nil || ttl <= 0 {
+		t.Errorf("Expected a TTL on new, got %s, %v", ttl, err)
+	}
+
+	store.db.Exec(fmt.Sprintf(`CREATE TRIGGER fail BEFORE UPDATE ON %s WHEN NEW.key = 'b' BEGIN SELECT RAISE(ABORT, 'rejected'); END;`, store.quoteTable()))
+	if _, err := store.Swap(map[string]string{"a": "20", "b": "3"}, 0); err == nil {
+		t.Fatal("Expected Swap to fail")
+	}
+	if v, err := store.Get("a"); err != nil || v != "10" {
+		t.Errorf("Expected a failed Swap to write nothing, got a = %q, %v", v, err)
+	}
+}
@@ -0,0 +1,174 @@
+package mkvstore
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// subscriptionBuffer is the number of events a Subscription buffers before
+// further events are dropped.
+const subscriptionBuffer = 256
+
+// Event describes a change to a key, delivered to subscribers.
+type Event struct {
+	Key  string
+	Op   string // Command that changed the key, e.g. "set", "del", "hset" or "lpush"
+	Time time.Time
+}
+
+// Subscription receives the events for keys matching its pattern.
+type Subscription struct {
+	// C delivers the events. It is closed by Close.
+	C <-chan Event
+
+	c       chan Event
+	pattern string
+	prefix  string // Literal prefix of pattern, checked before the full match
+	dropped atomic.Uint64
+	n       *notifier
+	once    sync.Once
+}
+
+// Dropped returns the number of events dropped because C was full.
+func (sub *Subscription) Dropped() uint64 {
+	return sub.dropped.Load()
+}
+
+// Close stops delivery and closes C.
+func (sub *Subscription) Close() {
+	sub.once.Do(func() {
+		sub.n.mu.Lock()
+		defer sub.n.mu.Unlock()
+		for i, other := range sub.n.subs {
+			if other == sub {
+				sub.n.subs = append(sub.n.subs[:i], sub.n.subs[i+1:]...)
+				break
+			}
+		}
+		close(sub.c)
+	})
+}
+
+// Subscribe returns a subscription to changes of keys matching pattern, with
+// the same glob syntax as Keys, like Redis PSUBSCRIBE on keyspace events.
+// Patterns are filtered in the store, so consumers only see their namespace,
+// e.g. Subscribe("config:*"). Only changes made through this Store are
+// delivered. Events are dropped rather than blocking writers when the
+// subscriber falls behind (see Subscription.Dropped). Call Close when done.
+func (s *Store) Subscribe(pattern string) *Subscription {
+	pattern = s.canonicalKey(pattern)
+	c := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{C: c, c: c, pattern: pattern, prefix: globPrefix(pattern), n: s.notify}
+
+	s.notify.mu.Lock()
+	defer s.notify.mu.Unlock()
+	s.notify.subs = append(s.notify.subs, sub)
+	return sub
+}
+
+// notifier wakes goroutines waiting for a key to change, so blocking
+// operations such as BLPop do not have to poll the table, and delivers events
+// to subscriptions. It only sees writes made through this Store; the zero
+// value is ready to use.
+type notifier struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+	subs    []*Subscription
+	gen     atomic.Uint64 // Counts the changes published
+}
+
+// generation returns a number that changes whenever a change is published.
+func (n *notifier) generation() uint64 {
+	return n.gen.Load()
+}
+
+// subscribe registers interest in key. The returned channel receives a value
+// after the key changes; call cancel once done waiting.
+func (n *notifier) subscribe(key string) (ch <-chan struct{}, cancel func()) {
+	c := make(chan struct{}, 1)
+
+	n.mu.Lock()
+	if n.waiters == nil {
+		n.waiters = make(map[string]map[chan struct{}]struct{})
+	}
+	if n.waiters[key] == nil {
+		n.waiters[key] = make(map[chan struct{}]struct{})
+	}
+	n.waiters[key][c] = struct{}{}
+	n.mu.Unlock()
+
+	return c, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		delete(n.waiters[key], c)
+		if len(n.waiters[key]) == 0 {
+			delete(n.waiters, key)
+		}
+	}
+}
+
+// publish wakes every goroutine waiting on key and sends an event for op to
+// the matching subscriptions. It never blocks.
+func (n *notifier) publish(key, op string) {
+	n.gen.Add(1)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for c := range n.waiters[key] {
+		select {
+		case c <- struct{}{}:
+		default: // Already has a pending wakeup
+		}
+	}
+
+	if len(n.subs) == 0 {
+		return
+	}
+	ev := Event{Key: key, Op: op, Time: time.Now()}
+	for _, sub := range n.subs {
+		if !strings.HasPrefix(key, sub.prefix) || !globMatch(sub.pattern, key) {
+			continue
+		}
+		select {
+		case sub.c <- ev:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// globPrefix returns the literal part of a glob pattern before its first wildcard.
+func globPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, "*?"); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// globMatch reports whether key matches the glob pattern, where '*' matches any
+// sequence and '?' any single character, like Keys.
+func globMatch(globPattern, key string) bool {
+	pattern, s := []rune(globPattern), []rune(key)
+	p, i := 0, 0
+	star, mark := -1, 0 // Position after the last '*' and where it started matching
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p+1, i
+			p++
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case star >= 0:
+			mark++
+			p, i = star, mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
@@ -0,0 +1,68 @@
+package mkvstore
+
+import (
+	"testing"
+	"time"
+)
+
+// TestGlobMatch tests the glob matcher used for subscriptions.
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, key string
+		expected     bool
+	}{
+		{"config:*", "config:a", true},
+		{"config:*", "config:", true},
+		{"config:*", "conf", false},
+		{"*:temp", "dev:1:temp", true},
+		{"dev:?:temp", "dev:1:temp", true},
+		{"dev:?:temp", "dev:12:temp", false},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"k?y", "kéy", true},
+		{"exact", "exact", true},
+		{"*", "", true},
+	}
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.key); got != tt.expected {
+			t.Errorf("globMatch(%q, %q) = %v, expected %v", tt.pattern, tt.key, got, tt.expected)
+		}
+	}
+}
+
+// TestSubscribe tests that subscribers only receive events for matching keys.
+func TestSubscribe(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	sub := store.Subscribe("config:*")
+	defer sub.Close()
+
+	store.Set("telemetry:cpu", "1", 0)
+	store.Set("config:a", "1", 0)
+	store.HSet("config:h", "f", "v")
+	store.Del("config:a")
+	store.Del("config:missing") // Nothing deleted, no event
+
+	expected := []Event{{Key: "config:a", Op: "set"}, {Key: "config:h", Op: "hset"}, {Key: "config:a", Op: "del"}}
+	for _, want := range expected {
+		select {
+		case ev := <-sub.C:
+			if ev.Key != want.Key || ev.Op != want.Op {
+				t.Errorf("Got event %s %s, expected %s %s", ev.Op, ev.Key, want.Op, want.Key)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Missing event %s %s", want.Op, want.Key)
+		}
+	}
+	select {
+	case ev := <-sub.C:
+		t.Errorf("Unexpected event %+v", ev)
+	default:
+	}
+
+	sub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Error("Expected channel to be closed")
+	}
+	store.Set("config:b", "1", 0) // Must not panic after Close
+}
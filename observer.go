@@ -0,0 +1,96 @@
+package mkvstore
+
+import (
+	"time"
+)
+
+// LifecycleEvent is an event passed to an Observer: one of OpenEvent,
+// CloseEvent, CleanupRunEvent, EvictionEvent or CorruptionEvent.
+type LifecycleEvent interface {
+	event()
+}
+
+// OpenEvent reports a Store opened by Open or Table.
+type OpenEvent struct {
+	Path     string        // Database path as passed to Open
+	Table    string        // Table of the Store
+	Duration time.Duration // Time taken to open the table
+}
+
+// CloseEvent reports a Store closed by Close.
+type CloseEvent struct {
+	Path  string
+	Table string
+	Err   error // Error returned by Close, if any
+}
+
+// CleanupRunEvent reports a run of the cleanup maintenance task (see RunCleanup).
+type CleanupRunEvent struct {
+	Table    string
+	Deleted  int64 // Expired keys deleted
+	Duration time.Duration
+	Err      error // Why the run failed, if it did
+}
+
+// EvictionEvent reports a key the store deleted on its own, because it was
+// found expired by a read or by the proactive expiry heap (see
+// WithProactiveExpiry). Keys deleted in bulk by a cleanup run are only counted
+// by its CleanupRunEvent.
+type EvictionEvent struct {
+	Table  string
+	Key    string
+	Reason string // "expired"
+}
+
+// CorruptionEvent reports a malformed database file, detected by a write or
+// by the integrity check of WithAutoRepair.
+type CorruptionEvent struct {
+	Path   string
+	Table  string
+	Err    error         // SQLite error reporting the corruption, nil after a repair at Open
+	Repair *RepairReport // Set when the file was repaired at Open
+}
+
+func (OpenEvent) event()       {}
+func (CloseEvent) event()      {}
+func (CleanupRunEvent) event() {}
+func (EvictionEvent) event()   {}
+func (CorruptionEvent) event() {}
+
+// Observer receives the lifecycle events of a Store, e.g. to surface its
+// health in the UI of an embedding application. Events are delivered
+// synchronously from the goroutine that caused them, so Observe must not
+// block for long nor call back into the Store.
+type Observer interface {
+	Observe(LifecycleEvent)
+}
+
+// ObserverFunc adapts a function to the Observer interface.
+type ObserverFunc func(LifecycleEvent)
+
+// Observe calls f(e).
+func (f ObserverFunc) Observe(e LifecycleEvent) { f(e) }
+
+// WithObserver registers an Observer for the lifecycle events of the store
+// and of the tables opened from it with Table. It may be given several times.
+func WithObserver(observer Observer) Option {
+	return func(o *options) {
+		o.observers = append(o.observers, observer)
+	}
+}
+
+// emit passes e to every registered Observer.
+func (s *Store) emit(e LifecycleEvent) {
+	for _, observer := range s.opts.observers {
+		observer.Observe(e)
+	}
+}
+
+// checkCorrupt emits a CorruptionEvent if err reports a malformed database,
+// and returns err unchanged.
+func (s *Store) checkCorrupt(err error) error {
+	if err != nil && len(s.opts.observers) > 0 && isCorrupt(err) {
+		s.emit(CorruptionEvent{Path: s.path, Table: s.table, Err: err})
+	}
+	return err
+}
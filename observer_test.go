@@ -0,0 +1,61 @@
+package mkvstore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestObserver tests the Open, Eviction, CleanupRun and Close events.
+func TestObserver(t *testing.T) {
+	events := make(chan LifecycleEvent, 16)
+	now := time.Now()
+	clock := func() time.Time { return now }
+	dbPath := filepath.Join(t.TempDir(), "observer.db")
+	store, err := Open(dbPath, "kv", WithClock(clock), WithObserver(ObserverFunc(func(e LifecycleEvent) { events <- e })))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	next := func() LifecycleEvent {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for an event")
+			return nil
+		}
+	}
+
+	if e, ok := next().(OpenEvent); !ok || e.Path != dbPath || e.Table != "kv" {
+		t.Errorf("Expected an OpenEvent for kv, got %#v", e)
+	}
+
+	store.Set("a", "1", time.Second)
+	store.Set("b", "2", time.Second)
+	now = now.Add(2 * time.Second)
+	if _, err := store.Get("a"); err != ErrKeyNotFound {
+		t.Fatalf("Expected a to be expired, got %v", err)
+	}
+	if e, ok := next().(EvictionEvent); !ok || e.Key != "a" || e.Reason != "expired" {
+		t.Errorf("Expected an EvictionEvent for a, got %#v", e)
+	}
+
+	store.RunCleanup(10 * time.Millisecond)
+	if e, ok := next().(CleanupRunEvent); !ok || e.Deleted != 1 || e.Err != nil {
+		t.Errorf("Expected a CleanupRunEvent deleting b, got %#v", e)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	for {
+		e := next()
+		if _, ok := e.(CleanupRunEvent); ok {
+			continue // Runs that raced with Close
+		}
+		if c, ok := e.(CloseEvent); !ok || c.Table != "kv" || c.Err != nil {
+			t.Errorf("Expected a CloseEvent for kv, got %#v", e)
+		}
+		break
+	}
+}
@@ -0,0 +1,52 @@
+package mkvstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// analysisLimit caps the rows ANALYZE samples per index, keeping Optimize
+// fast on large tables. See https://www.sqlite.org/lang_analyze.html#approx.
+const analysisLimit = 1000
+
+// WithOptimize schedules Optimize every interval as the "optimize"
+// maintenance task, e.g. alongside WithCleanup, so query plans keep up with
+// large churn. The task stops when the store is closed.
+func WithOptimize(interval time.Duration) Option {
+	return func(o *options) {
+		o.optimizeInterval = interval
+	}
+}
+
+// Optimize refreshes the query planner statistics of the store's tables with
+// ANALYZE, sampling at most 1000 rows per index, then runs PRAGMA optimize.
+// Run it after bulk loads or deletes; statistics are otherwise never updated.
+func (s *Store) Optimize() error {
+	defer s.observe("optimize", time.Now())
+
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx) // analysis_limit is per connection
+	if err != nil {
+		return fmt.Errorf("failed to get connection to optimize table %q: %w", s.table, err)
+	}
+	defer conn.Close()
+
+	statements := []string{
+		fmt.Sprintf(`PRAGMA analysis_limit = %d;`, analysisLimit),
+		fmt.Sprintf(`ANALYZE %s;`, s.quoteTable()),
+		fmt.Sprintf(`ANALYZE %s;`, s.quoteHashTable()),
+		fmt.Sprintf(`ANALYZE %s;`, s.quoteListTable()),
+		fmt.Sprintf(`ANALYZE %s;`, s.quoteSetTable()),
+		fmt.Sprintf(`ANALYZE %s;`, s.quoteZSetTable()),
+		fmt.Sprintf(`ANALYZE %s;`, s.quoteStreamTable()),
+		`PRAGMA optimize;`,
+		`PRAGMA analysis_limit = 0;`, // Restore the default before the connection returns to the pool
+	}
+	for _, stmt := range statements {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to optimize table %q: %w", s.table, err)
+		}
+	}
+	return nil
+}
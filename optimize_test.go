@@ -0,0 +1,25 @@
+package mkvstore
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestOptimize tests that Optimize gathers planner statistics.
+func TestOptimize(t *testing.T) {
+	store, _ := setupFileStore(t)
+	for i := 0; i < 50; i++ {
+		store.Set(fmt.Sprintf("key:%d", i), "v", 0)
+	}
+
+	if err := store.Optimize(); err != nil {
+		t.Fatalf("Optimize failed: %v", err)
+	}
+	var n int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM sqlite_stat1 WHERE tbl = ?;`, store.table).Scan(&n); err != nil {
+		t.Fatalf("Failed to read sqlite_stat1: %v", err)
+	}
+	if n == 0 {
+		t.Error("Expected statistics for the store table")
+	}
+}
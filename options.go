@@ -0,0 +1,201 @@
+package mkvstore
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Option configures optional Store behaviour at Open.
+type Option func(*options)
+
+// options holds the settings collected from the Options passed to Open.
+type options struct {
+	// Connection pragmas applied through the DSN (see WithDurability)
+	durability  Durability
+	cacheSize   int           // Page cache size in KiB, 0 for the SQLite default
+	busyTimeout time.Duration // How long to wait on a locked database, 0 for the driver default
+
+	// Connection pool limits, 0 for the database/sql defaults
+	maxOpenConns int
+	maxIdleConns int
+
+	// Background cleanup started at Open (see WithCleanup)
+	cleanupInterval time.Duration
+
+	// Automatic WAL checkpointing (see WithAutoCheckpoint)
+	checkpointInterval  time.Duration
+	checkpointThreshold int64
+
+	// Periodic planner statistics refresh (see WithOptimize)
+	optimizeInterval time.Duration
+
+	// Write coalescing (see WithFlashWearReduction)
+	flashWear *FlashWearConfig
+
+	// Change data capture (see WithChangeLog)
+	changeLog bool
+
+	// Serialization for SetAny/GetAny (see WithCodec)
+	codec Codec
+
+	// Value compression (see WithCompression)
+	compression        byte
+	compressionMinSize int
+
+	// Value transformation pipelines (see WithTransformers)
+	pipelines []prefixPipeline
+
+	// Default TTLs by key prefix (see WithPrefixTTL)
+	prefixTTLs []prefixTTL
+
+	// Latency histograms (see WithLatencyHistograms and WithLatencyExemplars)
+	latencyHistograms bool
+	traceID           func() string
+
+	// Slow operation log threshold (see WithSlowOpLog)
+	slowOpThreshold time.Duration
+
+	// Time source for expirations and timestamps (see WithClock)
+	clock func() time.Time
+
+	// Single writer goroutine for all mutations (see WithSerializedWrites)
+	serializedWrites bool
+	rejectPinning    bool // Set by ProfileTest, see pinningRejected
+
+	// Exclusive lock on the database file (see WithExclusiveLock)
+	lock lockMode
+
+	// Expiry bucket size for cleanup (see WithExpiryBuckets)
+	expiryBucket time.Duration
+
+	// In-memory expiration heap (see WithProactiveExpiry)
+	proactiveExpiry bool
+	onExpired       func(key string)
+
+	// Maintenance scheduling (see WithMaintenanceTask and WithMaintenanceJitter)
+	maintenanceTasks  []MaintenanceTask
+	maintenanceJitter time.Duration
+
+	// Soft limit warnings (see WithSoftLimits)
+	softLimits        *SoftLimits
+	softLimitInterval time.Duration
+	onLimitWarning    func(LimitWarning)
+
+	// Integrity check and salvage at Open (see WithAutoRepair)
+	autoRepair bool
+	onRepair   func(RepairReport)
+
+	// Lifecycle event observers (see WithObserver)
+	observers []Observer
+
+	// Databases attached to every connection (see AttachDatabase)
+	attached *attachments
+
+	// Cold key archiving (see WithArchiveTiering)
+	archive *ArchivePolicy
+
+	// Key normalization (see WithKeyCanonicalization)
+	canon *KeyCanonicalization
+
+	// SQL statistics view (see WithStatsView)
+	statsView bool
+
+	// Scheduled prefix snapshots (see WithPrefixSnapshots)
+	snapshots []SnapshotPolicy
+
+	// Memoized Keys results (see WithKeysCache)
+	keysCacheTTL time.Duration
+
+	// Paced deletions (see WithDeletionThrottle)
+	deletionThrottle *DeletionThrottle
+	pacer            *deletionPacer
+}
+
+// WithAutoCheckpoint schedules the "checkpoint" maintenance task, which checks
+// the WAL file size every interval and runs a TRUNCATE checkpoint once it
+// reaches threshold bytes. A threshold of 0 checkpoints on every run. The task
+// stops when the store is closed. It has no effect for databases not in WAL journal mode.
+func WithAutoCheckpoint(interval time.Duration, threshold int64) Option {
+	return func(o *options) {
+		o.checkpointInterval = interval
+		o.checkpointThreshold = threshold
+	}
+}
+
+// WithCacheSize sets the SQLite page cache size of every connection in KiB.
+func WithCacheSize(kib int) Option {
+	return func(o *options) {
+		o.cacheSize = kib
+	}
+}
+
+// WithBusyTimeout sets how long a connection waits for a lock held by another
+// connection or process before failing with SQLITE_BUSY.
+func WithBusyTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.busyTimeout = d
+	}
+}
+
+// WithMaxOpenConns limits the number of open connections in the pool. Use 1
+// for ":memory:" databases, where every connection otherwise sees its own
+// private database.
+func WithMaxOpenConns(n int) Option {
+	return func(o *options) {
+		o.maxOpenConns = n
+	}
+}
+
+// WithMaxIdleConns sets the maximum number of idle connections kept in the pool.
+func WithMaxIdleConns(n int) Option {
+	return func(o *options) {
+		o.maxIdleConns = n
+	}
+}
+
+// WithCleanup starts the background cleanup routine at Open, as if RunCleanup
+// had been called with interval.
+func WithCleanup(interval time.Duration) Option {
+	return func(o *options) {
+		o.cleanupInterval = interval
+	}
+}
+
+// dsn returns dbPath with the connection parameters implied by the options
+// appended, so that they apply to every connection in the pool rather than
+// only to the one that happens to run a PRAGMA statement.
+func (o *options) dsn(dbPath string) string {
+	params := url.Values{}
+	o.durability.apply(params)
+	if o.busyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(o.busyTimeout.Milliseconds(), 10))
+	}
+	if len(params) == 0 {
+		return dbPath
+	}
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+	return dbPath + sep + params.Encode()
+}
+
+// connPragmas returns the PRAGMA statements to run on every new connection
+// for settings the driver does not accept as DSN parameters.
+func (o *options) connPragmas() []string {
+	var pragmas []string
+	if o.cacheSize > 0 {
+		// Negative values are interpreted as KiB rather than pages
+		pragmas = append(pragmas, "PRAGMA cache_size = -"+strconv.Itoa(o.cacheSize)+";")
+	}
+	return pragmas
+}
+
+// pinningRejected reports whether operations that pin a connection for their
+// duration must fail, as under ProfileTest, whose pool has a single
+// connection that the Store would then wait for forever.
+func (o *options) pinningRejected() bool {
+	return o.rejectPinning && o.maxOpenConns == 1
+}
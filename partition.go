@@ -0,0 +1,296 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// partitionDayFormat is the layout of the day stamp in partition table names.
+const partitionDayFormat = "20060102"
+
+// Partitioned writes keys into one table per UTC day, named
+// <prefix>_<YYYYMMDD> (e.g. telemetry_20240101), and reads across the days of
+// a retention window, newest first. Days older than the window are dropped
+// table by table, which is far cheaper than deleting millions of expired
+// rows. It suits append-mostly data such as telemetry, where a key is
+// written once and ages out with its day.
+type Partitioned struct {
+	s         *Store
+	prefix    string
+	retention int // Days, today included
+
+	mu     sync.Mutex
+	tables map[string]*Store // Open partitions by table name
+}
+
+// Partitioned returns a day-partitioned view of the tables named
+// <prefix>_<YYYYMMDD> in the database of s, keeping retentionDays days,
+// today included. Partitions older than that are ignored by reads and dropped
+// by the "partitions:<prefix>" maintenance task, hourly, or by DropExpired.
+// Days are cut in UTC by the store's clock (see WithClock).
+func (s *Store) Partitioned(prefix string, retentionDays int) (*Partitioned, error) {
+	if prefix == "" {
+		return nil, errors.New("partition prefix cannot be empty")
+	}
+	if retentionDays <= 0 {
+		return nil, errors.New("partition retention must be at least one day")
+	}
+	root := s
+	if s.parent != nil {
+		root = s.parent
+	}
+	p := &Partitioned{s: root, prefix: prefix, retention: retentionDays, tables: make(map[string]*Store)}
+	err := root.schedule(MaintenanceTask{
+		Name:     "partitions:" + prefix,
+		Interval: time.Hour,
+		Run: func(context.Context) error {
+			_, err := p.DropExpired()
+			return err
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// partitionName returns the table holding the keys written on the day of t.
+func (p *Partitioned) partitionName(t time.Time) string {
+	return p.prefix + "_" + t.UTC().Format(partitionDayFormat)
+}
+
+// oldest returns the name of the oldest partition within the retention window.
+// Day stamps sort like the days they name, so names compare chronologically.
+func (p *Partitioned) oldest() string {
+	return p.partitionName(p.s.now().AddDate(0, 0, -(p.retention - 1)))
+}
+
+// Partitions returns the names of the existing partition tables, newest first,
+// including those past the retention window not dropped yet.
+func (p *Partitioned) Partitions() ([]string, error) {
+	listSQL := fmt.Sprintf(`SELECT table_name FROM %s WHERE table_name LIKE ? ESCAPE '\';`, quoteIdent(schemaTable))
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(p.prefix)
+	rows, err := p.s.query(listSQL, escaped+`\_%`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions of %q: %w", p.prefix, err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to list partitions of %q: %w", p.prefix, err)
+		}
+		day := strings.TrimPrefix(name, p.prefix+"_")
+		if _, err := time.Parse(partitionDayFormat, day); err == nil && len(day) == len(partitionDayFormat) {
+			names = append(names, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list partitions of %q: %w", p.prefix, err)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names, nil
+}
+
+// live returns the open partitions within the retention window, newest first.
+func (p *Partitioned) live() ([]*Store, error) {
+	names, err := p.Partitions()
+	if err != nil {
+		return nil, err
+	}
+	oldest := p.oldest()
+	var stores []*Store
+	for _, name := range names {
+		if name < oldest {
+			break
+		}
+		store, err := p.table(name)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	return stores, nil
+}
+
+// table returns the Store of partition name, creating the table if needed.
+func (p *Partitioned) table(name string) (*Store, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if store, ok := p.tables[name]; ok {
+		return store, nil
+	}
+	store, err := p.s.Table(name)
+	if err != nil {
+		return nil, err
+	}
+	p.tables[name] = store
+	return store, nil
+}
+
+// Set sets key to value in today's partition, like Store.Set.
+func (p *Partitioned) Set(key, value string, ttl time.Duration) error {
+	store, err := p.table(p.partitionName(p.s.now()))
+	if err != nil {
+		return err
+	}
+	return store.Set(key, value, ttl)
+}
+
+// Get returns the value of key from the newest partition within the retention
+// window holding it.
+// Returns ErrKeyNotFound if no partition holds the key.
+func (p *Partitioned) Get(key string) (string, error) {
+	stores, err := p.live()
+	if err != nil {
+		return "", err
+	}
+	for _, store := range stores {
+		value, err := store.Get(key)
+		if !errors.Is(err, ErrKeyNotFound) {
+			return value, err
+		}
+	}
+	return "", ErrKeyNotFound
+}
+
+// Del deletes key from every partition within the retention window.
+func (p *Partitioned) Del(key string) error {
+	stores, err := p.live()
+	if err != nil {
+		return err
+	}
+	for _, store := range stores {
+		if err := store.Del(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Keys returns the keys matching pattern across the partitions within the
+// retention window, sorted and without duplicates.
+func (p *Partitioned) Keys(pattern string) ([]string, error) {
+	stores, err := p.live()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var keys []string
+	for _, store := range stores {
+		matched, err := store.Keys(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range matched {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// DropExpired drops the partitions older than the retention window, with
+// their hash, list and change log tables, and returns their names. With
+// DryRun it only returns the names of the partitions it would drop, and
+// AffectedKeys receives the same names.
+func (p *Partitioned) DropExpired(opts ...BulkOption) ([]string, error) {
+	o := bulkOpts(opts)
+	names, err := p.Partitions()
+	if err != nil {
+		return nil, err
+	}
+	oldest := p.oldest()
+	var dropped []string
+	if o.keys != nil {
+		defer func() { *o.keys = dropped }()
+	}
+	for _, name := range names {
+		if name >= oldest {
+			continue
+		}
+		if o.dryRun {
+			dropped = append(dropped, name)
+			continue
+		}
+		if err := p.drop(name); err != nil {
+			return dropped, err
+		}
+		dropped = append(dropped, name)
+	}
+	return dropped, nil
+}
+
+// drop closes and drops the partition name, at the pace of the deletion
+// throttle if one is set, with its rows and value bytes as the cost.
+func (p *Partitioned) drop(name string) error {
+	p.mu.Lock()
+	if store, ok := p.tables[name]; ok {
+		store.Close()
+		delete(p.tables, name)
+	}
+	p.mu.Unlock()
+
+	pacer := p.s.opts.pacer
+	var rows int
+	var bytes int64
+	if pacer != nil {
+		sizeSQL := fmt.Sprintf(`SELECT COUNT(*), COALESCE(SUM(%s), 0) FROM %s;`, valueSizeSQL, quoteIdent(name))
+		if err := p.s.queryRow(sizeSQL).Scan(&rows, &bytes); err != nil {
+			return fmt.Errorf("failed to size partition %q: %w", name, err)
+		}
+		if err := pacer.wait(p.s.ctx, rows); err != nil {
+			return err
+		}
+	}
+	err := p.s.update(func(tx *sql.Tx) error { return dropTable(tx, name) })
+	if pacer != nil {
+		if err != nil {
+			rows, bytes = 0, 0 // Rolled back
+		}
+		pacer.done(rows, rows, bytes)
+	}
+	return err
+}
+
+// Close closes the open partitions. The drop task keeps running until the
+// Store is closed.
+func (p *Partitioned) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, store := range p.tables {
+		store.Close()
+		delete(p.tables, name)
+	}
+	return nil
+}
+
+// dropTable drops a store table together with its auxiliary tables, whose
+// triggers and indexes go with them, and its statistics view, and forgets its
+// schema version.
+func dropTable(tx *sql.Tx, table string) error {
+	if _, err := tx.Exec(fmt.Sprintf(`DROP VIEW IF EXISTS %s;`, quoteIdent(statsViewName(table)))); err != nil {
+		return fmt.Errorf("failed to drop view of table %q: %w", table, err)
+	}
+	for _, name := range []string{table, hashTableName(table), listTableName(table), setTableName(table), zsetTableName(table), streamTableName(table), changesTableName(table)} {
+		if _, err := tx.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s;`, quoteIdent(name))); err != nil {
+			return fmt.Errorf("failed to drop table %q: %w", name, err)
+		}
+	}
+	forgetSQL := fmt.Sprintf(`DELETE FROM %s WHERE table_name = ?;`, quoteIdent(schemaTable))
+	if _, err := tx.Exec(forgetSQL, table); err != nil {
+		return fmt.Errorf("failed to drop table %q: %w", table, err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package mkvstore
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestPartitioned tests writes to day tables, reads across the retention
+// window and the dropping of old days.
+func TestPartitioned(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := setupWALStore(t, WithClock(func() time.Time { return now }))
+	p, err := store.Partitioned("telemetry", 2)
+	if err != nil {
+		t.Fatalf("Partitioned failed: %v", err)
+	}
+	defer p.Close()
+
+	p.Set("a", "day1", 0)
+	p.Set("b", "day1", 0)
+	now = now.AddDate(0, 0, 1)
+	p.Set("a", "day2", 0)
+
+	names, err := p.Partitions()
+	if err != nil || !slices.Equal(names, []string{"telemetry_20240102", "telemetry_20240101"}) {
+		t.Errorf("Unexpected partitions %v, %v", names, err)
+	}
+	if v, err := p.Get("a"); err != nil || v != "day2" {
+		t.Errorf("Expected the newest value of a, got %q, %v", v, err)
+	}
+	if v, err := p.Get("b"); err != nil || v != "day1" {
+		t.Errorf("Expected b from the previous day, got %q, %v", v, err)
+	}
+	if keys, err := p.Keys("*"); err != nil || !slices.Equal(keys, []string{"a", "b"}) {
+		t.Errorf("Expected keys [a b], got %v, %v", keys, err)
+	}
+
+	now = now.AddDate(0, 0, 1)
+	if _, err := p.Get("b"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected b to be past the retention window, got %v", err)
+	}
+	var affected []string
+	wouldDrop, err := p.DropExpired(DryRun(), AffectedKeys(&affected))
+	if err != nil || !slices.Equal(wouldDrop, []string{"telemetry_20240101"}) || !slices.Equal(affected, wouldDrop) {
+		t.Errorf("Expected the dry run to report the first day, got %v (affected %v), %v", wouldDrop, affected, err)
+	}
+	if names, _ := p.Partitions(); len(names) != 2 {
+		t.Errorf("Expected the dry run to keep both partitions, got %v", names)
+	}
+	dropped, err := p.DropExpired()
+	if err != nil || !slices.Equal(dropped, []string{"telemetry_20240101"}) {
+		t.Errorf("Expected the first day to be dropped, got %v, %v", dropped, err)
+	}
+	var n int
+	store.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name LIKE 'telemetry_20240101%';`).Scan(&n)
+	if n != 0 {
+		t.Errorf("Expected no tables left for the dropped day, got %d", n)
+	}
+	if v, err := p.Get("a"); err != nil || v != "day2" {
+		t.Errorf("Expected a from the kept day, got %q, %v", v, err)
+	}
+
+	if _, err := store.Partitioned("", 1); err == nil {
+		t.Error("Expected an error for an empty prefix")
+	}
+}
@@ -0,0 +1,54 @@
+package mkvstore
+
+import (
+	"strings"
+	"time"
+)
+
+// prefixTTL is a default TTL for keys under prefix.
+type prefixTTL struct {
+	prefix string
+	ttl    time.Duration
+}
+
+// WithPrefixTTL sets the TTL applied when Set is called with a ttl of 0 for
+// keys starting with prefix, e.g. 24h for "telemetry:". Writers without a TTL
+// of their own apply it to the keys they create: counters of IncrBy, hashes,
+// lists, sets, sorted sets, streams and HyperLogLogs, and the values of
+// Append. The longest matching prefix wins. A ttl of 0 makes keys under prefix
+// never expire by default, which can be used to exempt a namespace from a
+// shorter prefix's policy. Callers can still opt out of the default by
+// passing a negative ttl to Set.
+func WithPrefixTTL(prefix string, ttl time.Duration) Option {
+	return func(o *options) {
+		o.prefixTTLs = append(o.prefixTTLs, prefixTTL{prefix: prefix, ttl: ttl})
+	}
+}
+
+// effectiveTTL returns the TTL to apply to key for a ttl passed to Set:
+// the prefix default when ttl is 0, ttl itself otherwise.
+func (s *Store) effectiveTTL(key string, ttl time.Duration) time.Duration {
+	if ttl != 0 {
+		return ttl
+	}
+	best := -1
+	for i, p := range s.opts.prefixTTLs {
+		if strings.HasPrefix(key, p.prefix) && (best < 0 || len(p.prefix) >= len(s.opts.prefixTTLs[best].prefix)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0
+	}
+	return s.opts.prefixTTLs[best].ttl
+}
+
+// defaultExpiresAt returns the expiration of key created at the Unix time now
+// by a writer without a TTL of its own: the Unix timestamp the prefix default
+// gives, or nil for no expiration.
+func (s *Store) defaultExpiresAt(key string, now int64) interface{} {
+	if ttl := s.effectiveTTL(key, 0); ttl > 0 {
+		return time.Unix(now, 0).Add(ttl).Unix()
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package mkvstore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestWithPrefixTTL tests that prefix defaults apply only when Set gets a zero TTL.
+func TestWithPrefixTTL(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "prefixttl.db"), "test_kv_prefixttl",
+		WithPrefixTTL("telemetry:", 24*time.Hour),
+		WithPrefixTTL("telemetry:pinned:", 0),
+	)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	store.Set("telemetry:cpu", "1", 0)
+	store.Set("telemetry:mem", "2", time.Minute)
+	store.Set("telemetry:pinned:boot", "3", 0)
+	store.Set("telemetry:opt-out", "4", -1)
+	store.Set("config:a", "5", 0)
+
+	tests := []struct {
+		key      string
+		min, max time.Duration
+	}{
+		{"telemetry:cpu", 23 * time.Hour, 24 * time.Hour},
+		{"telemetry:mem", 0, time.Minute},
+		{"telemetry:pinned:boot", -1, -1},
+		{"telemetry:opt-out", -1, -1},
+		{"config:a", -1, -1},
+	}
+	for _, tt := range tests {
+		ttl, err := store.TTL(tt.key)
+		if err != nil {
+			t.Fatalf("TTL(%q) failed: %v", tt.key, err)
+		}
+		if ttl < tt.min || ttl > tt.max {
+			t.Errorf("TTL(%q) = %s, expected between %s and %s", tt.key, ttl, tt.min, tt.max)
+		}
+	}
+}
+
+// TestPrefixTTLOnCreate tests that keys created by writers without a TTL of
+// their own get the prefix default, and keep their TTL once created.
+func TestPrefixTTLOnCreate(t *testing.T) {
+	store, err := Open(":memory:", "test_kv_prefixttl", WithPrefixTTL("telemetry:", 24*time.Hour))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	store.IncrBy("telemetry:count", 1)
+	store.HSet("telemetry:hash", "f", "v")
+	store.RPush("telemetry:list", "x")
+	store.SAdd("telemetry:set", "m")
+	store.ZAdd("telemetry:zset", ZMember{Member: "m", Score: 1})
+	store.XAdd("telemetry:stream", map[string]string{"f": "v"}, 0)
+	store.IncrBy("config:count", 1)
+
+	for _, key := range []string{"telemetry:count", "telemetry:hash", "telemetry:list", "telemetry:set", "telemetry:zset", "telemetry:stream"} {
+		if ttl, err := store.TTL(key); err != nil || ttl < 23*time.Hour || ttl > 24*time.Hour {
+			t.Errorf("TTL(%q) = %s, %v, expected the 24h prefix default", key, ttl, err)
+		}
+	}
+	if ttl, _ := store.TTL("config:count"); ttl != -1 {
+		t.Errorf("TTL(config:count) = %s, expected no expiration", ttl)
+	}
+
+	// Writes to existing keys keep the TTL they have
+	store.Expire("telemetry:count", time.Minute)
+	store.IncrBy("telemetry:count", 1)
+	store.Expire("telemetry:hash", time.Minute)
+	store.HSet("telemetry:hash", "g", "v")
+	for _, key := range []string{"telemetry:count", "telemetry:hash"} {
+		if ttl, _ := store.TTL(key); ttl > time.Minute {
+			t.Errorf("TTL(%q) = %s after a write, expected it kept at most 1m", key, ttl)
+		}
+	}
+}
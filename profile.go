@@ -0,0 +1,83 @@
+package mkvstore
+
+import (
+	"fmt"
+	"time"
+)
+
+// Profile is a bundle of pragma, cache, cleanup and pool settings tuned for
+// a deployment environment. See OpenWithProfile.
+type Profile int
+
+const (
+	// ProfileEdge targets gateways and other devices with little RAM and
+	// SD/eMMC storage: balanced durability, a small page cache, coalesced
+	// writes to reduce flash wear, a small pool and infrequent cleanup.
+	ProfileEdge Profile = iota
+	// ProfileServer targets hosts with plenty of RAM and SSD storage: strict
+	// durability, a large page cache, a larger pool and frequent cleanup.
+	ProfileServer
+	// ProfileTest targets unit tests: no fsync and a single connection, so
+	// ":memory:" databases behave like one shared database. Whatever would
+	// hold that connection while the Store waits for it is rejected instead
+	// of deadlocking: WithFlashWearReduction fails Open, and Session and
+	// ForEach with ScanOptions.Snapshot fail with ErrSingleConnection.
+	// Overriding WithMaxOpenConns with more connections lifts this, for file
+	// databases.
+	ProfileTest
+)
+
+// String returns the profile name.
+func (p Profile) String() string {
+	switch p {
+	case ProfileEdge:
+		return "edge"
+	case ProfileServer:
+		return "server"
+	case ProfileTest:
+		return "test"
+	}
+	return fmt.Sprintf("Profile(%d)", int(p))
+}
+
+// options returns the Options bundled by the profile.
+func (p Profile) options() ([]Option, error) {
+	switch p {
+	case ProfileEdge:
+		return []Option{
+			WithDurability(DurabilityBalanced),
+			WithCacheSize(2 * 1024), // 2 MiB
+			WithBusyTimeout(5 * time.Second),
+			WithMaxOpenConns(4),
+			WithFlashWearReduction(FlashWearConfig{}),
+			WithAutoCheckpoint(time.Minute, 4<<20),
+			WithCleanup(5 * time.Minute),
+		}, nil
+	case ProfileServer:
+		return []Option{
+			WithDurability(DurabilityStrict),
+			WithCacheSize(64 * 1024), // 64 MiB
+			WithBusyTimeout(5 * time.Second),
+			WithMaxOpenConns(16),
+			WithMaxIdleConns(16),
+			WithCleanup(time.Minute),
+		}, nil
+	case ProfileTest:
+		return []Option{
+			WithDurability(DurabilityFast),
+			WithMaxOpenConns(1),
+			func(o *options) { o.rejectPinning = true },
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown profile %v", p)
+}
+
+// OpenWithProfile opens a store like Open, using the settings bundled by
+// profile. Any opts are applied after the profile and override its settings.
+func OpenWithProfile(dbPath string, table string, profile Profile, opts ...Option) (*Store, error) {
+	profileOpts, err := profile.options()
+	if err != nil {
+		return nil, err
+	}
+	return Open(dbPath, table, append(profileOpts, opts...)...)
+}
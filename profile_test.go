@@ -0,0 +1,84 @@
+package mkvstore
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestOpenWithProfile tests that each profile opens a working store with its settings applied.
+func TestOpenWithProfile(t *testing.T) {
+	for _, profile := range []Profile{ProfileEdge, ProfileServer, ProfileTest} {
+		t.Run(profile.String(), func(t *testing.T) {
+			dbPath := filepath.Join(t.TempDir(), "profile.db")
+			if profile == ProfileTest {
+				dbPath = ":memory:"
+			}
+			store, err := OpenWithProfile(dbPath, "test_kv_profile", profile)
+			if err != nil {
+				t.Fatalf("OpenWithProfile failed: %v", err)
+			}
+			defer store.Close()
+
+			if err := store.Set("key", "value", 0); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			if value, err := store.Get("key"); err != nil || value != "value" {
+				t.Errorf("Get returned %q, %v", value, err)
+			}
+
+			var cacheSize int
+			if err := store.db.QueryRow("PRAGMA cache_size;").Scan(&cacheSize); err != nil {
+				t.Fatalf("Failed to read cache_size: %v", err)
+			}
+			if profile == ProfileServer && cacheSize != -64*1024 {
+				t.Errorf("Expected cache_size -65536 for server profile, got %d", cacheSize)
+			}
+		})
+	}
+
+	if _, err := OpenWithProfile(":memory:", "test_kv_profile", Profile(42)); err == nil {
+		t.Errorf("OpenWithProfile with an unknown profile should fail")
+	}
+}
+
+// TestProfileTestRejectsPinning tests that operations pinning the only
+// connection of ProfileTest fail instead of deadlocking.
+func TestProfileTestRejectsPinning(t *testing.T) {
+	store, err := OpenWithProfile(":memory:", "test_kv_profile", ProfileTest)
+	if err != nil {
+		t.Fatalf("OpenWithProfile failed: %v", err)
+	}
+	defer store.Close()
+	store.Set("key:1", "value", 0)
+
+	if _, err := store.Session(context.Background()); !errors.Is(err, ErrSingleConnection) {
+		t.Errorf("Expected ErrSingleConnection from Session, got %v", err)
+	}
+	err = store.ForEach(ScanOptions{Snapshot: true}, func(key, value string) error { return nil })
+	if !errors.Is(err, ErrSingleConnection) {
+		t.Errorf("Expected ErrSingleConnection from ForEach with Snapshot, got %v", err)
+	}
+	n := 0
+	if err := store.ForEach(ScanOptions{}, func(key, value string) error { n++; return nil }); err != nil || n != 1 {
+		t.Errorf("ForEach without Snapshot = %d keys, %v", n, err)
+	}
+
+	_, err = OpenWithProfile(":memory:", "test_kv_profile", ProfileTest, WithFlashWearReduction(FlashWearConfig{}))
+	if !errors.Is(err, ErrSingleConnection) {
+		t.Errorf("Expected ErrSingleConnection opening with WithFlashWearReduction, got %v", err)
+	}
+
+	// More connections lift the restriction
+	wide, err := OpenWithProfile(filepath.Join(t.TempDir(), "profile.db"), "test_kv_profile", ProfileTest, WithMaxOpenConns(4))
+	if err != nil {
+		t.Fatalf("OpenWithProfile with more connections failed: %v", err)
+	}
+	defer wide.Close()
+	sess, err := wide.Session(context.Background())
+	if err != nil {
+		t.Fatalf("Session with more connections failed: %v", err)
+	}
+	sess.Close()
+}
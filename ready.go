@@ -0,0 +1,50 @@
+package mkvstore
+
+import (
+	"context"
+	"fmt"
+)
+
+// readiness tracks the startup work that Open leaves running in the
+// background. A nil *readiness is always ready.
+type readiness struct {
+	done chan struct{} // Closed once the startup work has finished
+	err  error         // Failure of the startup work, set before done is closed
+}
+
+// startReady runs the background part of the startup of the store: with
+// WithCleanup, a first sweep of the keys that expired while the store was
+// closed, instead of leaving them for a whole interval. The schema
+// migration, integrity check and index builds already ran in Open.
+func (s *Store) startReady() {
+	r := &readiness{done: make(chan struct{})}
+	s.ready = r
+	if s.opts.cleanupInterval <= 0 {
+		close(r.done)
+		return
+	}
+	go func() {
+		defer close(r.done)
+		if err := s.runCleanup(s.ctx); err != nil {
+			r.err = fmt.Errorf("failed startup cleanup of table %q: %w", s.table, err)
+		}
+	}()
+}
+
+// WaitReady blocks until the store is fully usable: Open has migrated the
+// schema, checked integrity (see WithAutoRepair) and built its indexes, and
+// the startup cleanup of WithCleanup has swept the keys that expired while
+// the store was closed. Gate readiness probes on it rather than on Open
+// returning. It returns the error of the startup work, if any, or ctx.Err()
+// if ctx is done first.
+func (s *Store) WaitReady(ctx context.Context) error {
+	if s.ready == nil {
+		return nil
+	}
+	select {
+	case <-s.ready.done:
+		return s.ready.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,45 @@
+package mkvstore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestWaitReady tests that WaitReady returns once the startup cleanup swept
+// the keys that expired while the store was closed.
+func TestWaitReady(t *testing.T) {
+	store, dbPath := setupFileStore(t)
+	if err := store.WaitReady(context.Background()); err != nil {
+		t.Fatalf("WaitReady without startup work failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		store.Set(fmt.Sprintf("key%d", i), "value", time.Minute)
+	}
+	store.Set("kept", "value", 0)
+	store.Close()
+
+	later := time.Now().Add(time.Hour)
+	store, err := Open(dbPath, "test_kv_data_file", WithCleanup(time.Hour), WithClock(func() time.Time { return later }))
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := store.WaitReady(ctx); err != nil {
+		t.Fatalf("WaitReady failed: %v", err)
+	}
+	var rows int
+	if err := store.db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %s;`, store.quoteTable())).Scan(&rows); err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if rows != 1 {
+		t.Errorf("Expected the expired keys to be swept at startup, got %d rows", rows)
+	}
+	if status := store.CleanupStatus(); status.LastDeleted != 3 {
+		t.Errorf("Expected the startup cleanup to be reported, got %+v", status)
+	}
+}
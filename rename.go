@@ -0,0 +1,119 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// renameKey moves key from to key to using q, normally a transaction,
+// together with any hash fields or list elements, replacing whatever to held.
+// Returns ErrKeyNotFound if from does not exist or is expired.
+func (s *Store) renameKey(q queryer, from, to string, now int64) error {
+	var expiresAt sql.NullInt64
+	checkSQL := fmt.Sprintf(`SELECT expires_at FROM %s WHERE key = ?;`, s.quoteTable())
+	err := q.QueryRowContext(s.ctx, checkSQL, from).Scan(&expiresAt)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to rename key %q in table %q: %w", from, s.table, err)
+	}
+	if err == sql.ErrNoRows || (expiresAt.Valid && now > expiresAt.Int64) {
+		return fmt.Errorf("failed to rename key %q in table %q: %w", from, s.table, ErrKeyNotFound)
+	}
+	if from == to {
+		return nil
+	}
+	if expiresAt.Valid {
+		s.trackExpiry(to, expiresAt.Int64) // Harmless if the rename is rolled back
+	}
+
+	statements := []string{
+		// Deleting the destination also drops its fields or elements
+		fmt.Sprintf(`DELETE FROM %s WHERE key = ?2;`, s.quoteTable()),
+		// The renamed key goes on above the versions of the destination
+		fmt.Sprintf(`UPDATE %s SET key = ?2, version = MAX(version + 1, %s), updated_at = ?3 WHERE key = ?1;`, s.quoteTable(), firstVersionSQL(s.table)),
+		fmt.Sprintf(`UPDATE %s SET key = ?2 WHERE key = ?1;`, s.quoteHashTable()),
+		fmt.Sprintf(`UPDATE %s SET key = ?2 WHERE key = ?1;`, s.quoteListTable()),
+		fmt.Sprintf(`UPDATE %s SET key = ?2 WHERE key = ?1;`, s.quoteSetTable()),
+		fmt.Sprintf(`UPDATE %s SET key = ?2 WHERE key = ?1;`, s.quoteZSetTable()),
+		fmt.Sprintf(`UPDATE %s SET key = ?2 WHERE key = ?1;`, s.quoteStreamTable()),
+	}
+	for _, stmt := range statements {
+		if _, err := q.ExecContext(s.ctx, stmt, from, to, now); err != nil {
+			return fmt.Errorf("failed to rename key %q to %q in table %q: %w", from, to, s.table, err)
+		}
+	}
+	return nil
+}
+
+// Rename renames key from to to, overwriting to if it exists. Like Redis
+// RENAME, the value, type and TTL move with the key.
+// Returns ErrKeyNotFound if from does not exist or is expired.
+func (s *Store) Rename(from, to string) error {
+	return s.RenameBatch(map[string]string{from: to})
+}
+
+// RenameBatch renames every key of renames to its mapped name in a single
+// transaction, e.g. to promote a staged set of config:staged:* keys to
+// config:live:* so readers and crash recovery never observe a partial
+// rollout. Either all keys are renamed or, on error, none is. Destinations
+// are overwritten. A key may not be both a source and a destination, and two
+// sources may not share a destination.
+// Returns an error wrapping ErrKeyNotFound if any source does not exist.
+func (s *Store) RenameBatch(renames map[string]string) error {
+	defer s.observe("renamebatch", time.Now())
+
+	if len(renames) == 0 {
+		return nil
+	}
+	if s.opts.canon != nil {
+		canonical := make(map[string]string, len(renames))
+		for from, to := range renames {
+			canonical[s.canonicalKey(from)] = s.canonicalKey(to)
+		}
+		renames = canonical
+	}
+
+	// Chained renames would depend on map order, so reject them up front
+	sources := make([]string, 0, len(renames))
+	targets := make(map[string]string, len(renames))
+	for from, to := range renames {
+		if err := checkReserved(from, to); err != nil {
+			return err
+		}
+		if _, ok := renames[to]; ok && to != from {
+			return fmt.Errorf("key %q is both a rename source and destination", to)
+		}
+		if other, ok := targets[to]; ok {
+			return fmt.Errorf("keys %q and %q are both renamed to %q", other, from, to)
+		}
+		targets[to] = from
+		sources = append(sources, from)
+	}
+	sort.Strings(sources) // Deterministic statement order
+
+	if err := s.Sync(); err != nil {
+		return err
+	}
+
+	now := s.now().Unix()
+	err := s.update(func(tx *sql.Tx) error {
+		for _, from := range sources {
+			if err := s.renameKey(tx, from, renames[from], now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, from := range sources {
+		if to := renames[from]; to != from {
+			s.notify.publish(from, "rename_from")
+			s.notify.publish(to, "rename_to")
+		}
+	}
+	return nil
+}
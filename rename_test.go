@@ -0,0 +1,51 @@
+package mkvstore
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestRenameBatch tests that a batch of renames applies atomically.
+func TestRenameBatch(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	store.Set("config:staged:a", "new-a", 0)
+	store.Set("config:staged:b", "new-b", 0)
+	store.Set("config:live:a", "old-a", 0)
+	store.HSet("config:staged:h", "f", "v")
+
+	err := store.RenameBatch(map[string]string{
+		"config:staged:a": "config:live:a",
+		"config:staged:b": "config:live:b",
+		"config:staged:h": "config:live:h",
+	})
+	if err != nil {
+		t.Fatalf("RenameBatch failed: %v", err)
+	}
+	if v, _ := store.Get("config:live:a"); v != "new-a" {
+		t.Errorf("Expected config:live:a to be overwritten, got %q", v)
+	}
+	if v, _ := store.HGet("config:live:h", "f"); v != "v" {
+		t.Errorf("Expected hash fields to move with the key, got %q", v)
+	}
+	if exists, _ := store.Exists("config:staged:b"); exists {
+		t.Error("Expected source key to be gone")
+	}
+
+	// A missing source rolls back the whole batch
+	store.Set("config:staged:c", "new-c", 0)
+	err = store.RenameBatch(map[string]string{
+		"config:staged:c":       "config:live:c",
+		"config:staged:missing": "config:live:missing",
+	})
+	if !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if _, err := store.Get("config:staged:c"); err != nil {
+		t.Errorf("Expected failed batch to leave config:staged:c in place, got %v", err)
+	}
+
+	if err := store.RenameBatch(map[string]string{"a": "b", "b": "c"}); err == nil {
+		t.Error("Expected chained renames to be rejected")
+	}
+}
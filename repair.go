@@ -0,0 +1,334 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// RepairReport describes a database file repaired at Open (see WithAutoRepair).
+type RepairReport struct {
+	Path           string              // Database file that failed the integrity check
+	QuarantinePath string              // Where the damaged file was moved
+	Problems       []string            // What the integrity check found
+	SalvagedRows   int64               // Rows copied into the fresh file, over all tables
+	LostKeys       map[string][]string // Keys known to be lost, by table
+}
+
+// WithAutoRepair runs PRAGMA quick_check at Open. If the database file is
+// corrupt, it is moved aside to <path>.corrupt-<unix time> together with its
+// WAL, the rows that can still be read are salvaged into a fresh file at the
+// original path, and Open carries on with it instead of failing, so one bad
+// page does not brick the store. Rows on damaged pages are lost; those whose
+// keys can still be read from the primary key index are listed in the report
+// passed to onRepair, which may be nil to only log a summary to stderr.
+//
+// The check reads the whole database, so it slows Open down on large files.
+// In-memory databases are never checked.
+func WithAutoRepair(onRepair func(RepairReport)) Option {
+	return func(o *options) {
+		o.autoRepair = true
+		o.onRepair = onRepair
+	}
+}
+
+// isCorrupt reports whether err is SQLite reporting a malformed database.
+func isCorrupt(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrCorrupt || sqliteErr.Code == sqlite3.ErrNotADB)
+}
+
+// integrityProblems runs PRAGMA quick_check and returns the problems found,
+// none if the database is intact.
+func integrityProblems(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`PRAGMA quick_check;`)
+	if isCorrupt(err) {
+		return []string{err.Error()}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check database integrity: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var problem string
+		if err := rows.Scan(&problem); err != nil {
+			return nil, fmt.Errorf("failed to check database integrity: %w", err)
+		}
+		if problem != "ok" {
+			problems = append(problems, problem)
+		}
+	}
+	if err := rows.Err(); isCorrupt(err) {
+		problems = append(problems, err.Error())
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to check database integrity: %w", err)
+	}
+	return problems, nil
+}
+
+// repairIfCorrupt checks the database opened as db and, if it is corrupt,
+// closes it, salvages it into a fresh file at dbPath and returns the fresh
+// database instead, with the report of the repair. db is closed if an error
+// is returned.
+func repairIfCorrupt(db *sql.DB, dbPath string, o options) (*sql.DB, *RepairReport, error) {
+	path := databaseFile(dbPath)
+	if path == "" {
+		return db, nil, nil
+	}
+	problems, err := integrityProblems(db)
+	if err != nil || len(problems) > 0 {
+		db.Close()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(problems) == 0 {
+		return db, nil, nil
+	}
+
+	report := RepairReport{
+		Path:           path,
+		QuarantinePath: fmt.Sprintf("%s.corrupt-%d", path, time.Now().Unix()),
+		Problems:       problems,
+		LostKeys:       make(map[string][]string),
+	}
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		err := os.Rename(path+suffix, report.QuarantinePath+suffix)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("failed to quarantine corrupt database %q: %w", path, err)
+		}
+	}
+
+	damaged, err := sql.Open("sqlite3", report.QuarantinePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open quarantined database %q: %w", report.QuarantinePath, err)
+	}
+	defer damaged.Close()
+	damaged.SetMaxOpenConns(1)
+
+	fresh := sql.OpenDB(newConnector(o.dsn(dbPath), o.connPragmas(), o.attached))
+	if o.maxOpenConns > 0 {
+		fresh.SetMaxOpenConns(o.maxOpenConns)
+	}
+	if o.maxIdleConns > 0 {
+		fresh.SetMaxIdleConns(o.maxIdleConns)
+	}
+	if err := salvage(damaged, fresh, &report); err != nil {
+		fresh.Close()
+		return nil, nil, fmt.Errorf("failed to salvage corrupt database %q: %w", path, err)
+	}
+
+	if o.onRepair != nil {
+		o.onRepair(report)
+	} else {
+		lost := 0
+		for _, keys := range report.LostKeys {
+			lost += len(keys)
+		}
+		fmt.Fprintf(os.Stderr, "mkvstore: repaired corrupt database %q: salvaged %d rows, lost %d keys, damaged file kept at %q\n",
+			path, report.SalvagedRows, lost, report.QuarantinePath)
+	}
+	return fresh, &report, nil
+}
+
+// salvage recreates the tables of damaged in fresh with every row that can
+// still be read, then their indexes and triggers.
+func salvage(damaged, fresh *sql.DB, report *RepairReport) error {
+	// Without a readable schema there is nothing to salvage
+	schema, _ := readSchema(damaged)
+
+	for _, obj := range schema {
+		if obj.kind != "table" {
+			continue
+		}
+		if _, err := fresh.Exec(obj.sql); err != nil {
+			return fmt.Errorf("failed to recreate table %q: %w", obj.name, err)
+		}
+		copied, lost, err := salvageRows(damaged, fresh, obj.name)
+		if err != nil {
+			return err
+		}
+		report.SalvagedRows += copied
+		if len(lost) > 0 {
+			report.LostKeys[obj.name] = lost
+		}
+	}
+
+	// Indexes and triggers come last so they do not slow down the inserts;
+	// unique indexes hold since the rows come from the same table
+	for _, obj := range schema {
+		if obj.kind == "table" {
+			continue
+		}
+		if _, err := fresh.Exec(obj.sql); err != nil {
+			return fmt.Errorf("failed to recreate %s %q: %w", obj.kind, obj.name, err)
+		}
+	}
+	return nil
+}
+
+// schemaObject is a table, index or trigger of a database.
+type schemaObject struct {
+	kind, name, sql string
+}
+
+// readSchema returns the tables, indexes and triggers of db, skipping SQLite's
+// internal objects and those it creates implicitly.
+func readSchema(db *sql.DB) ([]schemaObject, error) {
+	rows, err := db.Query(`
+	SELECT type, name, sql FROM sqlite_master
+	WHERE type IN ('table', 'index', 'trigger') AND sql IS NOT NULL AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+	ORDER BY rowid;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schema []schemaObject
+	for rows.Next() {
+		var obj schemaObject
+		if err := rows.Scan(&obj.kind, &obj.name, &obj.sql); err != nil {
+			return schema, err
+		}
+		schema = append(schema, obj)
+	}
+	return schema, rows.Err()
+}
+
+// salvageRows copies the readable rows of table from damaged to fresh: a
+// sequential scan up to the first unreadable page, then a lookup by rowid of
+// every row known from the primary key index that the scan missed. It returns
+// the number of rows copied and the keys of the rows that could not be read.
+// Read errors on damaged are expected and only end the salvage attempt at hand.
+func salvageRows(damaged, fresh *sql.DB, table string) (int64, []string, error) {
+	columns, err := tableColumns(damaged, table)
+	if err != nil || len(columns) == 0 {
+		return 0, nil, nil // Unreadable table definition, nothing to salvage
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdent(column)
+	}
+	columnList := strings.Join(quoted, ", ")
+	insertSQL := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s);`, quoteIdent(table), columnList,
+		strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+
+	tx, err := fresh.Begin()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to begin salvage transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op after a successful Commit
+
+	seen := make(map[int64]bool)
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns)+1)
+	var rowid int64
+	ptrs[0] = &rowid
+	for i := range values {
+		ptrs[i+1] = &values[i]
+	}
+	copyRow := func() error {
+		if _, err := tx.Exec(insertSQL, values...); err != nil {
+			return fmt.Errorf("failed to salvage row %d of table %q: %w", rowid, table, err)
+		}
+		seen[rowid] = true
+		return nil
+	}
+
+	scanSQL := fmt.Sprintf(`SELECT rowid, %s FROM %s ORDER BY rowid;`, columnList, quoteIdent(table))
+	if rows, err := damaged.Query(scanSQL); err == nil {
+		for rows.Next() {
+			if rows.Scan(ptrs...) != nil {
+				break
+			}
+			if err := copyRow(); err != nil {
+				rows.Close()
+				return 0, nil, err
+			}
+		}
+		rows.Close()
+	}
+
+	var lost []string
+	lookupSQL := fmt.Sprintf(`SELECT rowid, %s FROM %s WHERE rowid = ?;`, columnList, quoteIdent(table))
+	for _, entry := range indexedRows(damaged, table) {
+		if seen[entry.rowid] {
+			continue
+		}
+		if damaged.QueryRow(lookupSQL, entry.rowid).Scan(ptrs...) != nil {
+			if len(lost) == 0 || lost[len(lost)-1] != entry.key {
+				lost = append(lost, entry.key)
+			}
+			continue
+		}
+		if err := copyRow(); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, fmt.Errorf("failed to commit salvaged rows of table %q: %w", table, err)
+	}
+	return int64(len(seen)), lost, nil
+}
+
+// tableColumns returns the column names of table.
+func tableColumns(db *sql.DB, table string) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s);`, quoteIdent(table)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+// indexedRow is a key and rowid read from a primary key index.
+type indexedRow struct {
+	key   string
+	rowid int64
+}
+
+// indexedRows returns the keys and rowids of table that can be read from its
+// primary key index, in key order, for tables keyed by a key column. The
+// index lives on other pages than the rows, so it usually survives damage to
+// them.
+func indexedRows(db *sql.DB, table string) []indexedRow {
+	var index string
+	indexSQL := `SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND name LIKE 'sqlite\_autoindex\_%' ESCAPE '\' LIMIT 1;`
+	if db.QueryRow(indexSQL, table).Scan(&index) != nil {
+		return nil
+	}
+	rows, err := db.Query(fmt.Sprintf(`SELECT key, rowid FROM %s INDEXED BY %s ORDER BY key;`, quoteIdent(table), quoteIdent(index)))
+	if err != nil {
+		return nil // No key column or unreadable index
+	}
+	defer rows.Close()
+
+	var entries []indexedRow
+	for rows.Next() {
+		var entry indexedRow
+		if rows.Scan(&entry.key, &entry.rowid) != nil {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
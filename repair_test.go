@@ -0,0 +1,86 @@
+package mkvstore
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestAutoRepair tests that a store with a damaged page opens with the
+// readable rows salvaged, the damaged file quarantined and the lost keys
+// reported.
+func TestAutoRepair(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "repair.db")
+	store, err := Open(dbPath, "kv")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	for i := range 2000 {
+		store.Set(fmt.Sprintf("key-%05d", i), fmt.Sprintf("value-%05d-%s", i, strings.Repeat("x", 40)), 0)
+	}
+	var pageSize int64
+	store.db.QueryRow(`PRAGMA page_size;`).Scan(&pageSize)
+	store.Close()
+
+	// Wipe the table page holding one of the values
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to read database file: %v", err)
+	}
+	offset := int64(bytes.Index(data, []byte("value-01000-")))
+	if offset < pageSize {
+		t.Fatalf("Value not found past the first page (offset %d)", offset)
+	}
+	page := offset / pageSize * pageSize
+	copy(data[page:page+pageSize], bytes.Repeat([]byte{0xff}, int(pageSize)))
+	if err := os.WriteFile(dbPath, data, 0o644); err != nil {
+		t.Fatalf("Failed to corrupt database file: %v", err)
+	}
+
+	var report RepairReport
+	var corruption []CorruptionEvent
+	observer := ObserverFunc(func(e LifecycleEvent) {
+		if c, ok := e.(CorruptionEvent); ok {
+			corruption = append(corruption, c)
+		}
+	})
+	store, err = Open(dbPath, "kv", WithAutoRepair(func(r RepairReport) { report = r }), WithObserver(observer))
+	if err != nil {
+		t.Fatalf("Open with auto repair failed: %v", err)
+	}
+	defer store.Close()
+
+	if len(report.Problems) == 0 {
+		t.Fatal("Expected the integrity check to report problems")
+	}
+	if _, err := os.Stat(report.QuarantinePath); err != nil {
+		t.Errorf("Expected the damaged file at %q: %v", report.QuarantinePath, err)
+	}
+	if len(corruption) != 1 || corruption[0].Repair == nil || corruption[0].Repair.QuarantinePath != report.QuarantinePath {
+		t.Errorf("Expected one CorruptionEvent with the repair report, got %+v", corruption)
+	}
+	lost := report.LostKeys["kv"]
+	if !slices.Contains(lost, "key-01000") {
+		t.Errorf("Expected key-01000 among the lost keys, got %v", lost)
+	}
+	if report.SalvagedRows < 1900 || report.SalvagedRows+int64(len(lost)) < 2000 {
+		t.Errorf("Expected every row to be salvaged or reported lost, got %d salvaged and %d lost", report.SalvagedRows, len(lost))
+	}
+
+	if v, err := store.Get("key-01999"); err != nil || !strings.HasPrefix(v, "value-01999-") {
+		t.Errorf("Expected salvaged key to be readable, got %q, %v", v, err)
+	}
+	if _, err := store.Get("key-01000"); err != ErrKeyNotFound {
+		t.Errorf("Expected lost key to be missing, got %v", err)
+	}
+	if err := store.Set("after", "repair", 0); err != nil {
+		t.Errorf("Expected the repaired store to accept writes: %v", err)
+	}
+	if problems, err := integrityProblems(store.db); err != nil || len(problems) != 0 {
+		t.Errorf("Expected the repaired file to pass the check, got %v, %v", problems, err)
+	}
+}
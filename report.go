@@ -0,0 +1,109 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// KeyStatus is the state of one key reported by Report.
+type KeyStatus struct {
+	Key    string
+	Exists bool          // False if the key does not exist or is expired
+	Type   string        // "string", "hash", "list", "set", "zset" or "stream"; empty if the key does not exist
+	TTL    time.Duration // Remaining time to live, -1 without TTL, 0 if the key does not exist
+	Size   int64         // Size in bytes of the stored value (see SizeOf), 0 for hashes, lists, sets, sorted sets and streams
+
+	// LastUsed is when the key was last written, or read if access times are
+	// tracked (see WithArchiveTiering). Zero if the key does not exist.
+	LastUsed time.Time
+}
+
+// Report returns the existence, type, TTL and size of every key in keys, in
+// the same order, from a single query. It is meant for monitoring agents
+// checking hundreds of sentinel keys every cycle, where one Exists and one
+// TTL call per key would dominate the cost.
+func (s *Store) Report(keys []string) ([]KeyStatus, error) {
+	keys = s.canonicalKeys(keys)
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	requested, err := json.Marshal(keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode keys for report: %w", err)
+	}
+
+	// json_each numbers the requested keys, so duplicates and order survive the join
+	reportSQL := fmt.Sprintf(`
+	SELECT r.key, t.type, t.expires_at, length(CAST(t.value AS BLOB)),
+		max(COALESCE(t.accessed_at, 0), COALESCE(t.updated_at, 0))
+	FROM json_each(?) r LEFT JOIN %s t ON t.key = r.value AND (t.expires_at IS NULL OR t.expires_at >= ?)
+	ORDER BY r.key;`, s.quoteTable())
+
+	now := s.now()
+	rows, err := s.query(reportSQL, string(requested), now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to report on keys in table %q: %w", s.table, err)
+	}
+	defer rows.Close()
+
+	report := make([]KeyStatus, 0, len(keys))
+	for rows.Next() {
+		var i int
+		var keyType sql.NullString
+		var expiresAt, size, lastUsed sql.NullInt64
+		if err := rows.Scan(&i, &keyType, &expiresAt, &size, &lastUsed); err != nil {
+			return nil, fmt.Errorf("failed to scan report row in table %q: %w", s.table, err)
+		}
+
+		status := KeyStatus{Key: keys[i], Exists: keyType.Valid, Type: keyType.String, Size: size.Int64}
+		if status.Exists {
+			status.TTL = -1
+			if expiresAt.Valid {
+				status.TTL = time.Unix(expiresAt.Int64, 0).Sub(now)
+			}
+			if lastUsed.Int64 > 0 {
+				status.LastUsed = time.Unix(lastUsed.Int64, 0)
+			}
+		}
+		report = append(report, status)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through report rows in table %q: %w", s.table, err)
+	}
+	return report, nil
+}
+
+// Type returns the type of the value stored at key: "string", "hash", "list",
+// "set", "zset", "stream" or "alias" (see Alias). Keys moved to an archive by ArchiveColdKeys still
+// hold strings, so they report "string".
+// Returns ErrKeyNotFound if the key does not exist or is expired.
+func (s *Store) Type(key string) (string, error) {
+	defer s.observe("type", time.Now())
+
+	key = s.canonicalKey(key)
+	if _, found, err := s.bufferedValue(key); found {
+		if err != nil {
+			return "", err
+		}
+		return "string", nil // Only strings are buffered
+	}
+
+	var keyType string
+	typeSQL := fmt.Sprintf(`SELECT type FROM %s WHERE key = ? AND (expires_at IS NULL OR expires_at >= ?);`, s.quoteTable())
+	err := s.queryRow(typeSQL, key, s.now().Unix()).Scan(&keyType)
+	if err == sql.ErrNoRows {
+		return "", ErrKeyNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get type of key %q from table %q: %w", key, s.table, err)
+	}
+	if keyType == "archived" {
+		return "string", nil
+	}
+	return keyType, nil
+}
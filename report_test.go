@@ -0,0 +1,62 @@
+package mkvstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestReport tests per-key status reporting in request order.
+func TestReport(t *testing.T) {
+	store, _ := setupFileStore(t)
+	store.Set("a", "hello", 0)
+	store.Set("b", "x", time.Hour)
+	store.HSet("h", "f", "v")
+
+	report, err := store.Report([]string{"b", "missing", "a", "h", "a"})
+	if err != nil {
+		t.Fatalf("Report failed: %v", err)
+	}
+	if len(report) != 5 {
+		t.Fatalf("Expected 5 statuses, got %d: %+v", len(report), report)
+	}
+
+	if st := report[0]; st.Key != "b" || !st.Exists || st.Type != "string" || st.Size != 1 || st.TTL < 59*time.Minute {
+		t.Errorf("Unexpected status for b: %+v", st)
+	}
+	if st := report[1]; st.Key != "missing" || st.Exists || st.Type != "" || st.TTL != 0 {
+		t.Errorf("Unexpected status for missing key: %+v", st)
+	}
+	if st := report[2]; st.Key != "a" || !st.Exists || st.TTL != -1 || st.Size != 5 {
+		t.Errorf("Unexpected status for a: %+v", st)
+	}
+	if st := report[3]; st.Key != "h" || st.Type != "hash" {
+		t.Errorf("Unexpected status for h: %+v", st)
+	}
+	if report[4] != report[2] {
+		t.Errorf("Expected duplicate key to be reported twice, got %+v", report[4])
+	}
+}
+
+// TestType tests the type reported for each kind of key.
+func TestType(t *testing.T) {
+	now := time.Now()
+	store := setupWALStore(t, WithClock(func() time.Time { return now }))
+	store.Set("s", "v", 0)
+	store.HSet("h", "f", "v")
+	store.RPush("l", "a")
+	store.Alias("a", "s")
+	store.Set("gone", "v", time.Second)
+	now = now.Add(time.Minute)
+
+	for key, want := range map[string]string{"s": "string", "h": "hash", "l": "list", "a": "alias"} {
+		if got, err := store.Type(key); err != nil || got != want {
+			t.Errorf("Type(%q) = %q, %v, expected %q", key, got, err, want)
+		}
+	}
+	for _, key := range []string{"missing", "gone"} {
+		if _, err := store.Type(key); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("Type(%q): expected ErrKeyNotFound, got %v", key, err)
+		}
+	}
+}
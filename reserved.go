@@ -0,0 +1,32 @@
+package mkvstore
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ReservedPrefix starts the keys the store keeps for its own bookkeeping,
+// such as counters and quotas. User operations may read them but not write
+// or delete them: single-key writes fail with ErrReservedKey, and pattern
+// operations such as DelPattern and Flush skip them.
+const ReservedPrefix = "__mkv:"
+
+// notReservedSQL is the condition excluding reserved keys from pattern
+// operations.
+var notReservedSQL = fmt.Sprintf(`key NOT LIKE '%s' ESCAPE '\'`, prefixToSQLLike(ReservedPrefix))
+
+// isReserved reports whether key is in the reserved namespace.
+func isReserved(key string) bool {
+	return strings.HasPrefix(key, ReservedPrefix)
+}
+
+// checkReserved returns an error wrapping ErrReservedKey if any of keys is in
+// the reserved namespace.
+func checkReserved(keys ...string) error {
+	for _, key := range keys {
+		if isReserved(key) {
+			return fmt.Errorf("%w: %q", ErrReservedKey, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package mkvstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestReservedNamespace tests that user operations cannot write or delete
+// reserved keys, while reads still see them.
+func TestReservedNamespace(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	internal := ReservedPrefix + "counter"
+	if _, err := store.db.Exec(store.setSQL(), internal, "1", nil, time.Now().Unix(), 0, nil); err != nil {
+		t.Fatalf("Failed to write internal key: %v", err)
+	}
+	store.Set("user", "v", 0)
+
+	if err := store.Set(internal, "2", 0); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Set = %v, expected ErrReservedKey", err)
+	}
+	if err := store.Del(internal); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Del = %v, expected ErrReservedKey", err)
+	}
+	if err := store.MSet(map[string]string{"ok": "1", internal: "2"}, 0); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("MSet = %v, expected ErrReservedKey", err)
+	}
+	if err := store.Rename("user", internal); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Rename = %v, expected ErrReservedKey", err)
+	}
+
+	if n, err := store.DelPattern("*"); err != nil || n != 1 {
+		t.Errorf("DelPattern = %d, %v, expected only the user key deleted", n, err)
+	}
+	store.Set("user", "v", 0)
+	if n, err := store.Flush(); err != nil || n != 1 {
+		t.Errorf("Flush = %d, %v, expected only the user key deleted", n, err)
+	}
+	if value, err := store.Get(internal); err != nil || value != "1" {
+		t.Errorf("Get of the internal key = %q, %v, expected it untouched", value, err)
+	}
+}
@@ -0,0 +1,233 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultRewriteBatch is the number of keys RewriteTable copies between
+// progress reports without RewriteBatchSize.
+const defaultRewriteBatch = 10000
+
+// RewriteOption configures RewriteTable.
+type RewriteOption func(*rewriteOptions)
+
+// rewriteOptions holds the settings collected from RewriteOptions.
+type rewriteOptions struct {
+	batch    int
+	progress func(RewriteProgress)
+}
+
+// RewriteProgress reports how far RewriteTable got.
+type RewriteProgress struct {
+	Copied int64 // Live keys copied so far
+	Total  int64 // Keys in the table before the rewrite, expired ones included
+}
+
+// RewriteBatchSize makes RewriteTable copy n keys between progress reports
+// and cancellation checks, 10000 by default.
+func RewriteBatchSize(n int) RewriteOption {
+	return func(o *rewriteOptions) {
+		o.batch = n
+	}
+}
+
+// OnRewriteProgress makes RewriteTable call fn after each batch of keys.
+func OnRewriteProgress(fn func(RewriteProgress)) RewriteOption {
+	return func(o *rewriteOptions) {
+		o.progress = fn
+	}
+}
+
+// RewriteTable copies the live keys of the table, with their hash fields,
+// list elements, set and sorted set members and stream entries, into fresh tables that replace the old ones, whose indexes
+// and triggers are recreated. For tables where most rows are expired keys
+// waiting for cleanup this is much faster than deleting them and running
+// VACUUM, and leaves the table densely packed; the pages of the old tables
+// return to the free list of the database for reuse.
+//
+// The rewrite runs in a single transaction, so a crash or a cancelled ctx
+// leaves the old tables untouched. Other writers wait for it, up to the busy
+// timeout. The returned progress has the final counts.
+func (s *Store) RewriteTable(ctx context.Context, opts ...RewriteOption) (RewriteProgress, error) {
+	o := rewriteOptions{batch: defaultRewriteBatch}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.batch <= 0 {
+		return RewriteProgress{}, fmt.Errorf("failed to rewrite table %q: batch size must be positive", s.table)
+	}
+	if err := s.Sync(); err != nil {
+		return RewriteProgress{}, err
+	}
+	defer s.observe("rewritetable", time.Now())
+
+	conn, err := s.db.Conn(ctx) // legacy_alter_table is per connection
+	if err != nil {
+		return RewriteProgress{}, fmt.Errorf("failed to get connection to rewrite table %q: %w", s.table, err)
+	}
+	defer conn.Close()
+
+	// Views such as the statistics view refer to the tables by name, and
+	// modern ALTER TABLE refuses to rename while they dangle
+	if _, err := conn.ExecContext(ctx, `PRAGMA legacy_alter_table = ON;`); err != nil {
+		return RewriteProgress{}, fmt.Errorf("failed to rewrite table %q: %w", s.table, err)
+	}
+	defer conn.ExecContext(context.Background(), `PRAGMA legacy_alter_table = OFF;`)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return RewriteProgress{}, fmt.Errorf("failed to begin transaction on table %q: %w", s.table, err)
+	}
+	defer tx.Rollback() // No-op after a successful Commit
+
+	progress, err := s.rewriteTables(ctx, tx, o)
+	if err != nil {
+		return progress, s.checkCorrupt(fmt.Errorf("failed to rewrite table %q: %w", s.table, err))
+	}
+	if err := tx.Commit(); err != nil {
+		return progress, s.checkCorrupt(fmt.Errorf("failed to commit rewrite of table %q: %w", s.table, err))
+	}
+	return progress, nil
+}
+
+// rewriteTables does the work of RewriteTable in tx.
+func (s *Store) rewriteTables(ctx context.Context, tx *sql.Tx, o rewriteOptions) (RewriteProgress, error) {
+	var progress RewriteProgress
+	tables := []string{s.table, hashTableName(s.table), listTableName(s.table), setTableName(s.table), zsetTableName(s.table), streamTableName(s.table)}
+
+	// Indexes and triggers go with the dropped tables, so keep their SQL.
+	// Implicit indexes such as those of primary keys have none.
+	objectsSQL := `
+	SELECT sql FROM sqlite_master
+	WHERE type IN ('index', 'trigger') AND tbl_name IN (?, ?, ?, ?, ?, ?) AND sql IS NOT NULL
+	ORDER BY type = 'trigger';`
+	rows, err := tx.QueryContext(ctx, objectsSQL, tables[0], tables[1], tables[2], tables[3], tables[4], tables[5])
+	if err != nil {
+		return progress, err
+	}
+	var objects []string
+	for rows.Next() {
+		var stmt string
+		if err := rows.Scan(&stmt); err != nil {
+			rows.Close()
+			return progress, err
+		}
+		objects = append(objects, stmt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return progress, err
+	}
+
+	// Create the fresh tables from the definitions of the old ones
+	for _, table := range tables {
+		var def string
+		defSQL := `SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?;`
+		if err := tx.QueryRowContext(ctx, defSQL, table).Scan(&def); err != nil {
+			return progress, fmt.Errorf("failed to read definition of table %q: %w", table, err)
+		}
+		columns := strings.Index(def, "(")
+		if columns < 0 {
+			return progress, fmt.Errorf("unexpected definition of table %q: %s", table, def)
+		}
+		createSQL := fmt.Sprintf(`CREATE TABLE %s %s`, quoteIdent(table+"_rewrite"), def[columns:])
+		if _, err := tx.ExecContext(ctx, createSQL); err != nil {
+			return progress, err
+		}
+	}
+
+	countSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s;`, s.quoteTable())
+	if err := tx.QueryRowContext(ctx, countSQL).Scan(&progress.Total); err != nil {
+		return progress, err
+	}
+
+	// Copy the live keys in key order, batch by batch, resuming after the
+	// greatest key copied so far
+	now := s.now().Unix()
+	fresh := quoteIdent(s.table + "_rewrite")
+	copySQL := fmt.Sprintf(`
+	INSERT INTO %s SELECT * FROM %s
+	WHERE key > ? AND (expires_at IS NULL OR expires_at >= ?)
+	ORDER BY key LIMIT ?;`, fresh, s.quoteTable())
+	lastSQL := fmt.Sprintf(`SELECT COALESCE(MAX(key), '') FROM %s;`, fresh)
+	after := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+		result, err := tx.ExecContext(ctx, copySQL, after, now, o.batch)
+		if err != nil {
+			return progress, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return progress, err
+		}
+		if n == 0 {
+			break
+		}
+		progress.Copied += n
+		if o.progress != nil {
+			o.progress(progress)
+		}
+		if err := tx.QueryRowContext(ctx, lastSQL).Scan(&after); err != nil {
+			return progress, err
+		}
+	}
+
+	// Hash fields, list elements, set and sorted set members and stream entries
+	// of the copied keys, without expired fields
+	childSQL := []string{
+		fmt.Sprintf(`
+		INSERT INTO %s SELECT h.* FROM %s h
+		WHERE h.key IN (SELECT key FROM %s WHERE type = 'hash') AND (h.expires_at IS NULL OR h.expires_at >= ?);`,
+			quoteIdent(hashTableName(s.table)+"_rewrite"), s.quoteHashTable(), fresh),
+		fmt.Sprintf(`
+		INSERT INTO %s SELECT l.* FROM %s l
+		WHERE l.key IN (SELECT key FROM %s WHERE type = 'list');`,
+			quoteIdent(listTableName(s.table)+"_rewrite"), s.quoteListTable(), fresh),
+		fmt.Sprintf(`
+		INSERT INTO %s SELECT c.* FROM %s c
+		WHERE c.key IN (SELECT key FROM %s WHERE type = 'set');`,
+			quoteIdent(setTableName(s.table)+"_rewrite"), s.quoteSetTable(), fresh),
+		fmt.Sprintf(`
+		INSERT INTO %s SELECT z.* FROM %s z
+		WHERE z.key IN (SELECT key FROM %s WHERE type = 'zset');`,
+			quoteIdent(zsetTableName(s.table)+"_rewrite"), s.quoteZSetTable(), fresh),
+		fmt.Sprintf(`
+		INSERT INTO %s SELECT e.* FROM %s e
+		WHERE e.key IN (SELECT key FROM %s WHERE type = 'stream');`,
+			quoteIdent(streamTableName(s.table)+"_rewrite"), s.quoteStreamTable(), fresh),
+	}
+	if _, err := tx.ExecContext(ctx, childSQL[0], now); err != nil {
+		return progress, err
+	}
+	for _, stmt := range childSQL[1:] {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return progress, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return progress, err
+	}
+
+	// Swap the fresh tables in
+	var statements []string
+	for _, table := range tables {
+		statements = append(statements, fmt.Sprintf(`DROP TABLE %s;`, quoteIdent(table)))
+	}
+	for _, table := range tables {
+		statements = append(statements, fmt.Sprintf(`ALTER TABLE %s RENAME TO %s;`, quoteIdent(table+"_rewrite"), quoteIdent(table)))
+	}
+	statements = append(statements, objects...)
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return progress, err
+		}
+	}
+	return progress, nil
+}
@@ -0,0 +1,116 @@
+package mkvstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestRewriteTable tests that RewriteTable keeps the live keys, fields and
+// elements, drops expired ones, reports progress and keeps the triggers.
+func TestRewriteTable(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	store := setupWALStore(t, WithClock(func() time.Time { return now }), WithChangeLog(), WithStatsView())
+
+	for i := 0; i < 10; i++ {
+		ttl := time.Duration(0)
+		if i%2 == 1 {
+			ttl = time.Minute
+		}
+		if err := store.Set(fmt.Sprintf("key%d", i), "value", ttl); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if err := store.HSet("hash", "field", "value"); err != nil {
+		t.Fatalf("HSet failed: %v", err)
+	}
+	if _, err := store.RPush("list", "a", "b", "c"); err != nil {
+		t.Fatalf("RPush failed: %v", err)
+	}
+	now = now.Add(time.Hour)
+
+	var reports []RewriteProgress
+	progress, err := store.RewriteTable(context.Background(), RewriteBatchSize(3),
+		OnRewriteProgress(func(p RewriteProgress) { reports = append(reports, p) }))
+	if err != nil {
+		t.Fatalf("RewriteTable failed: %v", err)
+	}
+	if progress != (RewriteProgress{Copied: 7, Total: 12}) {
+		t.Errorf("Expected 7 of 12 keys copied, got %+v", progress)
+	}
+	if len(reports) != 3 || reports[len(reports)-1] != progress {
+		t.Errorf("Unexpected progress reports %+v", reports)
+	}
+
+	var rows int
+	if err := store.db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %s;`, store.quoteTable())).Scan(&rows); err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if rows != 7 {
+		t.Errorf("Expected 7 rows left, got %d", rows)
+	}
+	if got, err := store.HGetAll("hash"); err != nil || !reflect.DeepEqual(got, map[string]string{"field": "value"}) {
+		t.Errorf("HGetAll = %v, %v", got, err)
+	}
+	if got, err := store.LRange("list", 0, -1); err != nil || !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("LRange = %v, %v", got, err)
+	}
+
+	// The delete triggers of hashes and the change log survive the rewrite
+	before, err := store.ChangesSince(0, "*", 100)
+	if err != nil {
+		t.Fatalf("ChangesSince failed: %v", err)
+	}
+	if err := store.Del("hash"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	after, err := store.ChangesSince(0, "*", 100)
+	if err != nil {
+		t.Fatalf("ChangesSince failed: %v", err)
+	}
+	if len(after) != len(before)+1 {
+		t.Errorf("Expected the delete to be logged, got %d changes after %d", len(after), len(before))
+	}
+	if err := store.db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %s;`, store.quoteHashTable())).Scan(&rows); err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if rows != 0 {
+		t.Errorf("Expected the fields to be deleted with the hash, got %d", rows)
+	}
+	if _, err := store.db.Exec(fmt.Sprintf(`SELECT * FROM %s;`, quoteIdent(statsViewName(store.table)))); err != nil {
+		t.Errorf("Statistics view broken by the rewrite: %v", err)
+	}
+}
+
+// TestRewriteTableCancel tests that a cancelled rewrite leaves the table
+// untouched.
+func TestRewriteTableCancel(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	store := setupWALStore(t, WithClock(func() time.Time { return now }))
+	for i := 0; i < 5; i++ {
+		if err := store.Set(fmt.Sprintf("key%d", i), "value", time.Minute); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if err := store.Set("live", "value", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	now = now.Add(time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := store.RewriteTable(ctx, RewriteBatchSize(1), OnRewriteProgress(func(RewriteProgress) { cancel() }))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	var rows int
+	if err := store.db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %s;`, store.quoteTable())).Scan(&rows); err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if rows != 6 {
+		t.Errorf("Expected the 5 expired rows to be kept, got %d rows", rows)
+	}
+}
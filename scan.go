@@ -0,0 +1,157 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// defaultScanBatchSize is the number of rows fetched per query by ForEach
+// when ScanOptions.BatchSize is not set.
+const defaultScanBatchSize = 500
+
+// queryer is the subset of *sql.DB, *sql.Tx and *sql.Conn used to run
+// statements, so the same code can run inside or outside a transaction.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// ScanOptions controls iteration with ForEach.
+type ScanOptions struct {
+	// Pattern filters keys with the same glob syntax as Keys. Empty matches all keys.
+	Pattern string
+
+	// BatchSize is the number of rows fetched per query. Defaults to 500.
+	BatchSize int
+
+	// Snapshot runs every batch inside a single read transaction so the
+	// iteration sees a consistent point-in-time view of the table, even while
+	// writers proceed. In WAL mode writers are not blocked; in rollback-journal
+	// mode they wait until the iteration finishes.
+	Snapshot bool
+}
+
+// scanPage returns up to count live string keys and values matching
+// sqlPattern that sort after cursor, in key order, reserved keys excluded.
+func (s *Store) scanPage(ctx context.Context, q queryer, cursor, sqlPattern string, count int) (keys, values []string, err error) {
+	scanSQL := fmt.Sprintf(`
+	SELECT key, value, codec, transforms FROM %s
+	WHERE key > ? AND key LIKE ? ESCAPE '\' AND type = 'string' AND (expires_at IS NULL OR expires_at >= ?) AND %s
+	ORDER BY key LIMIT ?;`, s.quoteTable(), notReservedSQL)
+
+	rows, err := q.QueryContext(ctx, scanSQL, cursor, sqlPattern, s.now().Unix(), count)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to scan table %q: %w", s.table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var stored []byte
+		var codec byte
+		var transforms sql.NullString
+		if err := rows.Scan(&key, &stored, &codec, &transforms); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan key row in table %q: %w", s.table, err)
+		}
+		value, err := s.decodeValue(stored, codec, transforms)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode key %q in table %q: %w", key, s.table, err)
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating through scan rows in table %q: %w", s.table, err)
+	}
+	return keys, values, nil
+}
+
+// Scan incrementally iterates over live keys matching pattern (same glob syntax
+// as Keys), returning at most count keys per call in key order.
+// Pass an empty cursor to start; the returned cursor is passed to the next
+// call and is empty once the iteration is complete. Like Redis SCAN, keys
+// added or removed between calls may or may not be returned; use ForEach with
+// ScanOptions.Snapshot for a consistent view.
+func (s *Store) Scan(cursor string, pattern string, count int) ([]string, string, error) {
+	defer s.observe("scan", time.Now())
+
+	pattern = s.canonicalKey(pattern)
+	if count <= 0 {
+		count = 10 // Redis SCAN default COUNT
+	}
+	if err := s.Sync(); err != nil {
+		return nil, "", err
+	}
+
+	keys, _, err := s.scanPage(context.Background(), s.q(), cursor, globToSQLLike(pattern), count)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(keys) < count {
+		return keys, "", nil
+	}
+	return keys, keys[len(keys)-1], nil
+}
+
+// ForEach calls fn for every live string key matching opts.Pattern, in key
+// order, fetching rows in batches. Iteration stops at the first error
+// returned by fn, which ForEach returns. With ScanOptions.Snapshot, fn must
+// not use the Store if the pool is limited to a single connection, since the
+// snapshot transaction holds it for the whole iteration; under ProfileTest
+// ForEach then fails with ErrSingleConnection instead.
+func (s *Store) ForEach(opts ScanOptions, fn func(key, value string) error) error {
+	defer s.observe("foreach", time.Now())
+
+	opts.Pattern = s.canonicalKey(opts.Pattern)
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultScanBatchSize
+	}
+	if opts.Pattern == "" {
+		opts.Pattern = "*"
+	}
+	if err := s.Sync(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	sqlPattern := globToSQLLike(opts.Pattern)
+	iterate := func(q queryer) error {
+		cursor := ""
+		for {
+			keys, values, err := s.scanPage(ctx, q, cursor, sqlPattern, opts.BatchSize)
+			if err != nil {
+				return err
+			}
+			for i := range keys {
+				if err := fn(keys[i], values[i]); err != nil {
+					return err
+				}
+			}
+			if len(keys) < opts.BatchSize {
+				return nil
+			}
+			cursor = keys[len(keys)-1]
+		}
+	}
+	if opts.Snapshot {
+		if s.opts.pinningRejected() {
+			return fmt.Errorf("failed to scan table %q in a snapshot: %w", s.table, ErrSingleConnection)
+		}
+		return s.snapshot(ctx, func(tx *sql.Tx) error { return iterate(tx) })
+	}
+	return iterate(s.q())
+}
+
+// snapshot runs fn in a read-only transaction, giving it a consistent view of
+// the database.
+func (s *Store) snapshot(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.beginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to begin snapshot transaction: %w", err)
+	}
+	defer tx.Rollback() // Read-only, nothing to commit
+	return fn(tx)
+}
@@ -0,0 +1,79 @@
+package mkvstore
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestScan tests cursor-based iteration over keys matching a pattern.
+func TestScan(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	for i := 0; i < 25; i++ {
+		store.Set(fmt.Sprintf("item:%02d", i), "value", 0)
+	}
+	store.Set("other", "value", 0)
+
+	var all []string
+	cursor := ""
+	for calls := 0; ; calls++ {
+		if calls > 10 {
+			t.Fatalf("Scan did not terminate")
+		}
+		keys, next, err := store.Scan(cursor, "item:*", 10)
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		all = append(all, keys...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if len(all) != 25 || all[0] != "item:00" || all[24] != "item:24" {
+		t.Errorf("Scan returned unexpected keys: %v", all)
+	}
+}
+
+// TestForEachSnapshot tests that a snapshot iteration ignores concurrent writes.
+func TestForEachSnapshot(t *testing.T) {
+	for _, snapshot := range []bool{false, true} {
+		t.Run(fmt.Sprintf("snapshot=%t", snapshot), func(t *testing.T) {
+			store := setupWALStore(t)
+			for i := 0; i < 10; i++ {
+				store.Set(fmt.Sprintf("key:%d", i), "value", 0)
+			}
+
+			var seen []string
+			err := store.ForEach(ScanOptions{Pattern: "key:*", BatchSize: 3, Snapshot: snapshot}, func(key, value string) error {
+				if key == "key:0" {
+					// Modify the table behind the iterator's back
+					if err := store.Set("key:99", "new", 0); err != nil {
+						return err
+					}
+					if err := store.Del("key:9"); err != nil {
+						return err
+					}
+				}
+				seen = append(seen, key)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ForEach failed: %v", err)
+			}
+
+			sawNew, sawDeleted := false, false
+			for _, key := range seen {
+				sawNew = sawNew || key == "key:99"
+				sawDeleted = sawDeleted || key == "key:9"
+			}
+			if snapshot && (sawNew || !sawDeleted) {
+				t.Errorf("Snapshot iteration observed concurrent writes: %v", seen)
+			}
+			if !snapshot && (!sawNew || sawDeleted) {
+				t.Errorf("Non-snapshot iteration should observe concurrent writes: %v", seen)
+			}
+		})
+	}
+}
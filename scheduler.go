@@ -0,0 +1,318 @@
+package mkvstore
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaintenanceTask is a periodic background job run by the maintenance
+// scheduler of a Store, such as vacuuming, enforcing a retention policy or
+// taking backups. Built-in tasks (cleanup, checkpoint and optimize) run on the
+// same scheduler.
+type MaintenanceTask struct {
+	Name     string        // Unique per store; a task added under an existing name replaces it
+	Interval time.Duration // Time between the end of one run and the start of the next
+	Jitter   time.Duration // Random extra delay of up to Jitter per run, 0 for the WithMaintenanceJitter default
+
+	// Run performs the task. ctx is cancelled when the store is closed or
+	// when the run takes longer than Interval.
+	Run func(ctx context.Context) error
+}
+
+// MaintenanceTaskStatus describes a scheduled maintenance task.
+type MaintenanceTaskStatus struct {
+	Name         string        `json:"name"`
+	Interval     time.Duration `json:"interval"`
+	Jitter       time.Duration `json:"jitter"`
+	Paused       bool          `json:"paused"`
+	Running      bool          `json:"running"` // A run is in progress
+	Runs         int64         `json:"runs"`
+	LastRun      time.Time     `json:"last_run"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastError    string        `json:"last_error,omitempty"`
+	NextRun      time.Time     `json:"next_run"`
+}
+
+// WithMaintenanceTask schedules task on the maintenance scheduler at Open. It
+// runs on the Store returned by Open only, not on those opened with Table.
+func WithMaintenanceTask(task MaintenanceTask) Option {
+	return func(o *options) {
+		o.maintenanceTasks = append(o.maintenanceTasks, task)
+	}
+}
+
+// WithMaintenanceJitter delays every maintenance run by a random duration of
+// up to jitter, for tasks that do not set their own, so that stores opened
+// together (or processes sharing a file) do not run maintenance in lockstep.
+func WithMaintenanceJitter(jitter time.Duration) Option {
+	return func(o *options) {
+		o.maintenanceJitter = jitter
+	}
+}
+
+// scheduledTask is a MaintenanceTask with its scheduling state.
+type scheduledTask struct {
+	task   MaintenanceTask
+	status MaintenanceTaskStatus
+}
+
+// maintenance runs the maintenance tasks of a store one at a time on a
+// single goroutine, started with the first task.
+type maintenance struct {
+	mu      sync.Mutex
+	tasks   []*scheduledTask
+	started bool
+	paused  bool          // No task starts while set (see PauseMaintenance)
+	wake    chan struct{} // Signals a change to the schedule
+
+	// running is held for the duration of every run, taken under mu, so
+	// PauseMaintenance can wait for the run in progress.
+	running sync.Mutex
+}
+
+// schedule adds task to the maintenance scheduler of the store, replacing any
+// task of the same name, and starts the scheduler if needed.
+func (s *Store) schedule(task MaintenanceTask) error {
+	if task.Name == "" || task.Run == nil {
+		return fmt.Errorf("maintenance task for table %q needs a name and a run function", s.table)
+	}
+	if task.Interval <= 0 {
+		return fmt.Errorf("maintenance task %q for table %q needs a positive interval", task.Name, s.table)
+	}
+	if task.Jitter <= 0 {
+		task.Jitter = s.opts.maintenanceJitter
+	}
+
+	m := s.maint
+	if m == nil {
+		return fmt.Errorf("maintenance task %q cannot run on a session", task.Name)
+	}
+	m.mu.Lock()
+	st := &scheduledTask{task: task, status: MaintenanceTaskStatus{
+		Name:     task.Name,
+		Interval: task.Interval,
+		Jitter:   task.Jitter,
+		NextRun:  nextMaintenanceRun(time.Now(), task),
+	}}
+	if i := slices.IndexFunc(m.tasks, func(t *scheduledTask) bool { return t.task.Name == task.Name }); i >= 0 {
+		old := m.tasks[i].status
+		st.status.Paused, st.status.Runs = old.Paused, old.Runs
+		st.status.LastRun, st.status.LastDuration, st.status.LastError = old.LastRun, old.LastDuration, old.LastError
+		m.tasks[i] = st
+	} else {
+		m.tasks = append(m.tasks, st)
+	}
+	start := !m.started
+	m.started = true
+	m.mu.Unlock()
+
+	if start {
+		go s.runMaintenance()
+	}
+	m.signal()
+	return nil
+}
+
+// nextMaintenanceRun returns when task runs next if its last run ended at now.
+func nextMaintenanceRun(now time.Time, task MaintenanceTask) time.Time {
+	next := now.Add(task.Interval)
+	if task.Jitter > 0 {
+		next = next.Add(rand.N(task.Jitter))
+	}
+	return next
+}
+
+// signal wakes the scheduler to recompute its next deadline.
+func (m *maintenance) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default: // Already signalled
+	}
+}
+
+// runMaintenance runs the most overdue task whenever one is due, until the
+// store is closed.
+func (s *Store) runMaintenance() {
+	m := s.maint
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		var due *scheduledTask
+		wait := time.Hour
+		m.mu.Lock()
+		now := time.Now()
+		for _, t := range m.tasks {
+			if t.status.Paused || m.paused {
+				continue
+			}
+			if d := t.status.NextRun.Sub(now); d < wait {
+				due, wait = t, d
+			}
+		}
+		if due != nil && wait <= 0 {
+			due.status.Running = true
+			m.running.Lock()
+		} else {
+			due = nil
+		}
+		m.mu.Unlock()
+
+		if due == nil {
+			timer.Reset(wait)
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-m.wake: // Recompute the deadline
+			case <-timer.C:
+			}
+			continue
+		}
+
+		// A run may not outlast its interval, and Close interrupts it
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(s.ctx, due.task.Interval)
+		err := due.task.Run(ctx)
+		cancel()
+		m.running.Unlock()
+		if s.ctx.Err() != nil {
+			return // Closed mid-run
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mkvstore: maintenance task %q for table %q failed: %v\n", due.task.Name, s.table, err)
+		}
+
+		m.mu.Lock()
+		due.status.Running = false
+		due.status.Runs++
+		due.status.LastRun, due.status.LastDuration = start, time.Since(start)
+		due.status.LastError = ""
+		if err != nil {
+			due.status.LastError = err.Error()
+		}
+		due.status.NextRun = nextMaintenanceRun(time.Now(), due.task)
+		m.mu.Unlock()
+	}
+}
+
+// MaintenanceStatus reports the maintenance tasks scheduled on the store,
+// ordered by name.
+func (s *Store) MaintenanceStatus() []MaintenanceTaskStatus {
+	if s.maint == nil {
+		return nil
+	}
+	m := s.maint
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	statuses := make([]MaintenanceTaskStatus, 0, len(m.tasks))
+	for _, t := range m.tasks {
+		statuses = append(statuses, t.status)
+	}
+	slices.SortFunc(statuses, func(a, b MaintenanceTaskStatus) int { return strings.Compare(a.Name, b.Name) })
+	return statuses
+}
+
+// PauseMaintenanceTask stops scheduling the named task until it is resumed. A
+// run in progress is not interrupted.
+func (s *Store) PauseMaintenanceTask(name string) error {
+	return s.setTaskPaused(name, true)
+}
+
+// ResumeMaintenanceTask resumes a task paused by PauseMaintenanceTask. If it
+// became due while paused, it runs right away.
+func (s *Store) ResumeMaintenanceTask(name string) error {
+	return s.setTaskPaused(name, false)
+}
+
+// PauseMaintenance stops all maintenance tasks of the store from starting,
+// e.g. to keep background database activity out of a latency-critical window,
+// and waits for a run in progress to finish. Tasks that become due meanwhile
+// run once each, most overdue first, after ResumeMaintenance. Proactive
+// expiry and buffered writes are not maintenance tasks and carry on.
+func (s *Store) PauseMaintenance() {
+	if s.maint == nil {
+		return
+	}
+	m := s.maint
+	m.mu.Lock()
+	m.paused = true
+	m.mu.Unlock()
+
+	m.running.Lock()
+	m.running.Unlock()
+}
+
+// ResumeMaintenance resumes the maintenance tasks paused by PauseMaintenance,
+// running right away those that became due while paused. Tasks paused by
+// PauseMaintenanceTask stay paused.
+func (s *Store) ResumeMaintenance() {
+	if s.maint == nil {
+		return
+	}
+	m := s.maint
+	m.mu.Lock()
+	m.paused = false
+	m.mu.Unlock()
+	m.signal()
+}
+
+// setTaskPaused pauses or resumes the named task.
+func (s *Store) setTaskPaused(name string, paused bool) error {
+	if s.maint == nil {
+		return fmt.Errorf("no maintenance task %q for table %q", name, s.table)
+	}
+	m := s.maint
+	m.mu.Lock()
+	i := slices.IndexFunc(m.tasks, func(t *scheduledTask) bool { return t.task.Name == name })
+	if i < 0 {
+		m.mu.Unlock()
+		return fmt.Errorf("no maintenance task %q for table %q", name, s.table)
+	}
+	m.tasks[i].status.Paused = paused
+	m.mu.Unlock()
+	m.signal()
+	return nil
+}
+
+// scheduleMaintenance schedules the built-in tasks enabled by the options, and
+// on the store owning the database those added with WithMaintenanceTask.
+func (s *Store) scheduleMaintenance(root bool) error {
+	if s.opts.checkpointInterval > 0 && root {
+		threshold := s.opts.checkpointThreshold
+		s.schedule(MaintenanceTask{Name: "checkpoint", Interval: s.opts.checkpointInterval, Run: func(context.Context) error {
+			return s.autoCheckpoint(threshold)
+		}})
+	}
+	if s.opts.cleanupInterval > 0 {
+		s.RunCleanup(s.opts.cleanupInterval)
+	}
+	if s.opts.optimizeInterval > 0 {
+		s.schedule(MaintenanceTask{Name: "optimize", Interval: s.opts.optimizeInterval, Run: func(context.Context) error {
+			return s.Optimize()
+		}})
+	}
+	if err := s.scheduleSoftLimits(root); err != nil {
+		return err
+	}
+	if err := s.scheduleArchive(); err != nil {
+		return err
+	}
+	if err := s.scheduleSnapshots(); err != nil {
+		return err
+	}
+	if !root {
+		return nil
+	}
+	for _, task := range s.opts.maintenanceTasks {
+		if err := s.schedule(task); err != nil {
+			return err
+		}
+	}
+	return nil
+}
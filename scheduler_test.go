@@ -0,0 +1,122 @@
+package mkvstore
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestMaintenanceScheduler tests that built-in and custom tasks share one
+// scheduler, report their status and can be paused and resumed.
+func TestMaintenanceScheduler(t *testing.T) {
+	var runs atomic.Int64
+	task := MaintenanceTask{
+		Name:     "retention",
+		Interval: 20 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			runs.Add(1)
+			return errors.New("boom")
+		},
+	}
+	store, err := Open(filepath.Join(t.TempDir(), "maint.db"), "kv",
+		WithCleanup(time.Hour), WithOptimize(time.Hour), WithMaintenanceTask(task), WithMaintenanceJitter(time.Millisecond))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	status := store.MaintenanceStatus()
+	if len(status) != 3 || status[0].Name != "cleanup" || status[1].Name != "optimize" || status[2].Name != "retention" {
+		t.Fatalf("Expected cleanup, optimize and retention tasks, got %+v", status)
+	}
+	if status[0].Runs != 0 || status[0].NextRun.Before(time.Now().Add(50*time.Minute)) {
+		t.Errorf("Expected cleanup not to run yet, got %+v", status[0])
+	}
+	if st := status[2]; st.Runs < 2 || st.LastError != "boom" || st.Jitter != time.Millisecond {
+		t.Errorf("Expected retention to run repeatedly and record its error, got %+v", st)
+	}
+
+	if err := store.PauseMaintenanceTask("retention"); err != nil {
+		t.Fatalf("PauseMaintenanceTask failed: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond) // Let a run in progress finish
+	paused := runs.Load()
+	time.Sleep(100 * time.Millisecond)
+	if n := runs.Load(); n != paused {
+		t.Errorf("Expected no runs while paused, got %d more", n-paused)
+	}
+	if !store.MaintenanceStatus()[2].Paused {
+		t.Error("Expected status to report the task as paused")
+	}
+
+	if err := store.ResumeMaintenanceTask("retention"); err != nil {
+		t.Fatalf("ResumeMaintenanceTask failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if runs.Load() == paused {
+		t.Error("Expected runs to continue after resume")
+	}
+	if err := store.PauseMaintenanceTask("missing"); err == nil {
+		t.Error("Expected an error pausing an unknown task")
+	}
+}
+
+// TestMaintenanceTaskInvalid tests that Open rejects malformed tasks.
+func TestMaintenanceTaskInvalid(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "maint.db"), "kv", WithMaintenanceTask(MaintenanceTask{Name: "vacuum", Run: func(context.Context) error { return nil }}))
+	if err == nil {
+		t.Error("Expected Open to fail for a task without an interval")
+	}
+}
+
+// TestPauseMaintenance tests that pausing waits for the run in progress,
+// holds back every task and catches up on resume.
+func TestPauseMaintenance(t *testing.T) {
+	var runs atomic.Int64
+	release := make(chan struct{})
+	task := MaintenanceTask{
+		Name:     "backup",
+		Interval: 20 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			if runs.Add(1) == 1 {
+				<-release
+			}
+			return nil
+		},
+	}
+	store, err := Open(filepath.Join(t.TempDir(), "pause.db"), "kv", WithMaintenanceTask(task))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	for runs.Load() == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	paused := make(chan struct{})
+	go func() {
+		store.PauseMaintenance()
+		close(paused)
+	}()
+	select {
+	case <-paused:
+		t.Fatal("Expected PauseMaintenance to wait for the run in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-paused
+
+	time.Sleep(100 * time.Millisecond)
+	if n := runs.Load(); n != 1 {
+		t.Errorf("Expected no runs while paused, got %d", n-1)
+	}
+	store.ResumeMaintenance()
+	time.Sleep(10 * time.Millisecond)
+	if n := runs.Load(); n != 2 {
+		t.Errorf("Expected one catch-up run right after resume, got %d", n-1)
+	}
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+)
+
+// DebugHandler returns store.DebugHandler, serving /debug/store, and with
+// withPprof the net/http/pprof profiles under /debug/pprof/. The profiles
+// are built from the exported pprof handlers on a private mux. Like the
+// store's handler it exposes internals, so never mount it on a publicly
+// reachable listener.
+func DebugHandler(store *mkvstore.Store, withPprof bool) http.Handler {
+	if !withPprof {
+		return store.DebugHandler()
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/debug/store", store.DebugHandler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+	"github.com/hootrhino/microkvstore/server/watchpb"
+)
+
+// GRPC serves the Watch service of watchpb over gRPC, streaming key changes
+// with the semantics of the /v1/watch WebSocket of HTTP: from the change log
+// when the store has one, so a client resumes with since, or else from
+// Store.Subscribe, ending the stream with codes.Aborted if events are
+// dropped, so the client knows to reload.
+//
+// The password of the server and the credentials of Tenants, see
+// Config.Tenants, are sent as "authorization: Bearer <token>" metadata. A
+// tenant credential watches the keys of that tenant.
+type GRPC struct {
+	watchpb.UnimplementedWatchServer
+
+	store   *mkvstore.Store
+	srv     *grpc.Server
+	token   string   // Required bearer token unless empty, set by New
+	tenants *Tenants // Tenants reachable by bearer token, or nil, set by New
+	metrics *metrics // Shared with the other endpoints of a Server
+}
+
+// NewGRPC returns a gRPC server for store. Serve starts it.
+func NewGRPC(store *mkvstore.Store) *GRPC {
+	g := &GRPC{store: store}
+	g.srv = grpc.NewServer(grpc.StreamInterceptor(g.authorize))
+	watchpb.RegisterWatchServer(g.srv, g)
+	return g
+}
+
+// Serve accepts connections on l until l fails or Close is called, in which
+// case it returns nil.
+func (g *GRPC) Serve(l net.Listener) error {
+	if err := g.srv.Serve(l); !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
+}
+
+// Close stops the listeners and ends the streams in flight. The Store stays
+// open.
+func (g *GRPC) Close() error {
+	g.srv.Stop()
+	return nil
+}
+
+// grpcStream carries the store selected by authorize to the handlers.
+type grpcStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *grpcStream) Context() context.Context {
+	return s.ctx
+}
+
+// authorize checks the bearer token of a call, as HTTP does, and selects the
+// store of the tenant it is the credential of.
+func (g *GRPC) authorize(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	g.metrics.request()
+	var token string
+	hasToken := false
+	md, _ := metadata.FromIncomingContext(ss.Context())
+	if values := md.Get("authorization"); len(values) > 0 {
+		token, hasToken = strings.CutPrefix(values[0], "Bearer ")
+	}
+	bound, _ := g.tenants.ByCredential(token)
+	admin := g.token != "" && hasToken && subtle.ConstantTimeCompare([]byte(token), []byte(g.token)) == 1
+	if g.token != "" && !admin && bound == nil {
+		g.metrics.authFailed()
+		return status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+	}
+	if bound == nil {
+		return handler(srv, ss)
+	}
+	err := handler(srv, &grpcStream{ServerStream: ss, ctx: context.WithValue(ss.Context(), tenantKey{}, bound)})
+	if err != nil {
+		bound.Observe(errCommandFailed)
+	} else {
+		bound.Observe(nil)
+	}
+	return err
+}
+
+// storeOf returns the store serving ctx: that of its tenant, or the server's.
+func (g *GRPC) storeOf(ctx context.Context) *mkvstore.Store {
+	if t, ok := ctx.Value(tenantKey{}).(*Tenant); ok {
+		return t.Store
+	}
+	return g.store
+}
+
+// Watch implements watchpb.WatchServer.
+func (g *GRPC) Watch(req *watchpb.WatchRequest, stream watchpb.Watch_WatchServer) error {
+	pattern := req.GetPattern()
+	if pattern == "" {
+		pattern = "*"
+	}
+	store := g.storeOf(stream.Context())
+	seq, err := store.ChangeSeq()
+	changeLog := err == nil
+	if err != nil && !errors.Is(err, mkvstore.ErrChangeLogDisabled) {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if req.Since != nil {
+		switch {
+		case req.GetSince() < 0:
+			return status.Error(codes.InvalidArgument, "since must be a change sequence")
+		case !changeLog:
+			return status.Error(codes.FailedPrecondition, "resuming needs the change log")
+		}
+		seq = req.GetSince()
+	}
+
+	// Headers go out once subscribed, so a client waiting for them misses
+	// no change made after
+	sub := store.Subscribe(pattern)
+	defer sub.Close()
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+	send := func(ev watchEvent) error {
+		return stream.Send(&watchpb.WatchEvent{Seq: ev.Seq, Key: ev.Key, Op: ev.Op, TimeUnixNano: ev.Time.UnixNano()})
+	}
+	done := stream.Context().Done()
+	if changeLog {
+		err = watchChangeLog(store, sub, pattern, seq, send, done)
+	} else {
+		err = watchEvents(sub, send, done)
+	}
+	switch {
+	case errors.Is(err, errChangeLogRead):
+		return status.Error(codes.Internal, err.Error())
+	case errors.Is(err, errEventsDropped):
+		return status.Error(codes.Aborted, "events dropped")
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+	"github.com/hootrhino/microkvstore/mkvstoretest"
+	"github.com/hootrhino/microkvstore/server/watchpb"
+)
+
+// dialGRPC serves g on an in-memory listener and returns a Watch client.
+func dialGRPC(t *testing.T, g *GRPC) watchpb.WatchClient {
+	t.Helper()
+	l := bufconn.Listen(1 << 20)
+	go g.Serve(l)
+	t.Cleanup(func() { g.Close() })
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return watchpb.NewWatchClient(conn)
+}
+
+// openWatch starts a Watch call and waits until the server subscribed.
+func openWatch(t *testing.T, ctx context.Context, client watchpb.WatchClient, req *watchpb.WatchRequest) watchpb.Watch_WatchClient {
+	t.Helper()
+	stream, err := client.Watch(ctx, req)
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	return stream
+}
+
+// TestGRPCWatchResume tests streaming the change log and resuming after the
+// last event seen.
+func TestGRPCWatchResume(t *testing.T) {
+	store := mkvstoretest.New(t, mkvstore.WithChangeLog())
+	client := dialGRPC(t, NewGRPC(store))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store.Set("cfg:a", "1", 0)
+	store.Set("other", "x", 0)
+	since := int64(0)
+	stream := openWatch(t, ctx, client, &watchpb.WatchRequest{Pattern: "cfg:*", Since: &since})
+	first, err := stream.Recv()
+	if err != nil || first.Key != "cfg:a" || first.Op != "set" || first.Seq == 0 || first.TimeUnixNano == 0 {
+		t.Fatalf("Unexpected first event %v, %v", first, err)
+	}
+
+	store.Del("cfg:a")
+	if ev, err := stream.Recv(); err != nil || ev.Key != "cfg:a" || ev.Op != "del" || ev.Seq <= first.Seq {
+		t.Fatalf("Unexpected live event %v, %v", ev, err)
+	}
+
+	// A reconnecting client gets what followed the last event it saw
+	stream = openWatch(t, ctx, client, &watchpb.WatchRequest{Pattern: "cfg:*", Since: &first.Seq})
+	if ev, err := stream.Recv(); err != nil || ev.Op != "del" {
+		t.Errorf("Expected the del after resuming, got %v, %v", ev, err)
+	}
+}
+
+// TestGRPCWatchLive tests streaming events from a store without a change log.
+func TestGRPCWatchLive(t *testing.T) {
+	store := mkvstoretest.New(t)
+	client := dialGRPC(t, NewGRPC(store))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	since := int64(1)
+	stream, err := client.Watch(ctx, &watchpb.WatchRequest{Since: &since})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected resuming without a change log to fail, got %v", err)
+	}
+
+	stream = openWatch(t, ctx, client, &watchpb.WatchRequest{Pattern: "cfg:*"})
+	store.Set("other", "x", 0)
+	store.Set("cfg:a", "1", 0)
+	if ev, err := stream.Recv(); err != nil || ev.Key != "cfg:a" || ev.Op != "set" || ev.Seq != 0 {
+		t.Errorf("Unexpected event %v, %v", ev, err)
+	}
+}
+
+// TestGRPCWatchAuth tests the bearer token and tenant credentials of calls.
+func TestGRPCWatchAuth(t *testing.T) {
+	store := mkvstoretest.New(t)
+	tenants := NewTenants(store)
+	sensors, err := tenants.Add("sensors", 1, "sensors-secret")
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	g := NewGRPC(store)
+	g.token = "secret"
+	g.tenants = tenants
+	client := dialGRPC(t, g)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &watchpb.WatchRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected a call without a token to fail, got %v", err)
+	}
+
+	tctx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer sensors-secret")
+	stream = openWatch(t, tctx, client, &watchpb.WatchRequest{})
+	store.Set("base", "1", 0)
+	sensors.Store.Set("temp", "21", 0)
+	if ev, err := stream.Recv(); err != nil || ev.Key != "temp" {
+		t.Errorf("Expected the event of the tenant, got %v, %v", ev, err)
+	}
+
+	actx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+	stream = openWatch(t, actx, client, &watchpb.WatchRequest{})
+	store.Set("base", "2", 0)
+	if ev, err := stream.Recv(); err != nil || ev.Key != "base" {
+		t.Errorf("Expected the event of the store, got %v, %v", ev, err)
+	}
+}
@@ -0,0 +1,431 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+)
+
+const (
+	defaultPageSize = 100      // Keys per page of /v1/keys without limit
+	maxPageSize     = 1000     // Largest limit accepted by /v1/keys
+	maxBodySize     = 32 << 20 // Largest request body accepted
+)
+
+// HTTP serves a Store over a JSON API under /v1/, meant for dashboards and
+// tools that do not speak RESP:
+//
+//	GET  /v1/keys/{key}  value of a string key, with its version as ETag
+//	GET  /v1/keys        page of keys, see below
+//	GET  /v1/stats       key count, value bytes and disk usage
+//	POST /v1/mget        values of a JSON array of keys, as Store.MGet
+//	POST /v1/mset        {"pairs": {key: value}, "ttl_seconds": n}, as Store.MSet
+//	POST /v1/pipeline    JSON array of operations run in one transaction
+//	GET  /v1/watch       WebSocket streaming key changes, see watch
+//
+// /v1/keys takes the query parameters pattern (glob syntax as Store.Keys,
+// default "*"), limit (default 100, at most 1000), cursor (the next_cursor of
+// the previous page) and withValues=true. Pages come from Store.Scan, in key
+// order, so cursors stay valid while keys change, and only string keys are
+// listed. /v1/keys/{key} answers 304 Not Modified when If-None-Match holds
+// the ETag of the current version, as Store.GetIfChanged. Errors are reported
+// as {"error": "..."}.
+//
+// With Tenants, see Config.Tenants, a path starting with the name of a tenant,
+// e.g. /sensors/v1/keys, is served from its table, and so is a request whose
+// bearer token is the credential of a tenant. A tenant with a credential is
+// only served with that credential or the password of the server.
+type HTTP struct {
+	store   *mkvstore.Store
+	mux     *http.ServeMux
+	token   string   // Required bearer token unless empty, set by New
+	tenants *Tenants // Tenants reachable by path and bearer token, or nil, set by New
+	metrics *metrics // Shared with the other endpoints of a Server
+
+	mu      sync.Mutex
+	watches map[*wsConn]struct{} // Open /v1/watch connections
+}
+
+// NewHTTP returns an HTTP API handler for store.
+func NewHTTP(store *mkvstore.Store) *HTTP {
+	h := &HTTP{store: store, mux: http.NewServeMux(), watches: make(map[*wsConn]struct{})}
+	h.mux.HandleFunc("GET /v1/keys", h.listKeys)
+	h.mux.HandleFunc("GET /v1/keys/{key...}", h.getKey)
+	h.mux.HandleFunc("GET /v1/stats", h.stats)
+	h.mux.HandleFunc("POST /v1/mget", h.mget)
+	h.mux.HandleFunc("POST /v1/mset", h.mset)
+	h.mux.HandleFunc("POST /v1/pipeline", h.pipeline)
+	h.mux.HandleFunc("GET /v1/watch", h.watch)
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *HTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.metrics.request()
+	token, hasToken := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	bound, _ := h.tenants.ByCredential(token)
+	admin := h.token != "" && hasToken && subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+	t, rest, byPath := h.tenants.ByPath(r.URL.Path)
+	if !byPath {
+		t = bound
+	}
+	switch {
+	case h.token != "" && !admin && bound == nil, t != nil && t.Credential != "" && t != bound && !admin:
+		h.metrics.authFailed()
+		w.Header().Set("WWW-Authenticate", `Bearer realm="mkvstore"`)
+		writeJSONError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+		return
+	case bound != nil && t != bound:
+		writeJSONError(w, http.StatusForbidden, "bearer token does not grant access to this tenant")
+		return
+	case t == nil:
+		h.mux.ServeHTTP(w, r)
+		return
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), tenantKey{}, t))
+	if byPath {
+		u := *r.URL
+		u.Path = rest
+		u.RawPath = strings.TrimPrefix(u.RawPath, "/"+t.Name)
+		r.URL = &u
+	}
+	sw := &statusWriter{ResponseWriter: w}
+	h.mux.ServeHTTP(sw, r)
+	var err error
+	if sw.status >= http.StatusBadRequest {
+		err = errCommandFailed
+	}
+	t.Observe(err)
+}
+
+// tenantKey is the context key of the tenant serving a request.
+type tenantKey struct{}
+
+// storeOf returns the store serving r: that of its tenant, or the server's.
+func (h *HTTP) storeOf(r *http.Request) *mkvstore.Store {
+	if t, ok := r.Context().Value(tenantKey{}).(*Tenant); ok {
+		return t.Store
+	}
+	return h.store
+}
+
+// statusWriter records the status of a response for the statistics of a
+// tenant.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to upgrade
+// /v1/watch to a WebSocket.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// closeWatches closes the open /v1/watch connections, which http.Server no
+// longer tracks once upgraded.
+func (h *HTTP) closeWatches() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ws := range h.watches {
+		ws.close(wsCloseGoingAway, "server shutting down")
+		ws.nc.Close()
+	}
+}
+
+// keyItem is an entry of a /v1/keys page.
+type keyItem struct {
+	Key   string  `json:"key"`
+	Value *string `json:"value,omitempty"`
+}
+
+// keysPage is the document served at /v1/keys.
+type keysPage struct {
+	Keys       []keyItem `json:"keys"`
+	NextCursor string    `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+func (h *HTTP) listKeys(w http.ResponseWriter, r *http.Request) {
+	store := h.storeOf(r)
+	q := r.URL.Query()
+	pattern := q.Get("pattern")
+	if pattern == "" {
+		pattern = "*"
+	}
+	limit := defaultPageSize
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageSize {
+			writeJSONError(w, http.StatusBadRequest, "limit must be between 1 and 1000")
+			return
+		}
+		limit = n
+	}
+	withValues, _ := strconv.ParseBool(q.Get("withValues"))
+
+	// Cursors are the last key of the previous page, opaque to clients
+	cursor, err := base64.RawURLEncoding.DecodeString(q.Get("cursor"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+	keys, next, err := store.Scan(string(cursor), pattern, limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	page := keysPage{Keys: make([]keyItem, 0, len(keys))}
+	if next != "" {
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(next))
+	}
+	var values map[string]string
+	if withValues && len(keys) > 0 {
+		if values, err = store.MGet(keys...); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	for _, key := range keys {
+		item := keyItem{Key: key}
+		if value, ok := values[key]; ok {
+			item.Value = &value
+		}
+		page.Keys = append(page.Keys, item)
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// getKey serves a string key with its version as ETag, and answers 304 Not
+// Modified without reading the value if If-None-Match carries that version.
+func (h *HTTP) getKey(w http.ResponseWriter, r *http.Request) {
+	store := h.storeOf(r)
+	key := r.PathValue("key")
+	value, version, changed, err := store.GetIfChanged(key, etagVersion(r.Header.Get("If-None-Match")))
+	switch {
+	case errors.Is(err, mkvstore.ErrKeyNotFound):
+		writeJSONError(w, http.StatusNotFound, "key not found")
+	case errors.Is(err, mkvstore.ErrWrongType):
+		writeJSONError(w, http.StatusConflict, "key does not hold a string")
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	case !changed:
+		w.Header().Set("ETag", etag(version))
+		w.WriteHeader(http.StatusNotModified)
+	default:
+		w.Header().Set("ETag", etag(version))
+		writeJSON(w, http.StatusOK, keyItem{Key: key, Value: &value})
+	}
+}
+
+// etag returns the entity tag of a key at version.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// etagVersion returns the version of the entity tag in an If-None-Match
+// header, weak or not, or 0, which never matches, if there is none.
+func etagVersion(header string) int64 {
+	tag := strings.TrimPrefix(strings.TrimSpace(header), "W/")
+	unquoted, ok := strings.CutPrefix(tag, `"`)
+	if !ok {
+		return 0
+	}
+	unquoted, ok = strings.CutSuffix(unquoted, `"`)
+	if !ok {
+		return 0
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version < 0 {
+		return 0
+	}
+	return version
+}
+
+// statsDoc is the document served at /v1/stats.
+type statsDoc struct {
+	Keys  int64               `json:"keys"`  // Live keys
+	Bytes int64               `json:"bytes"` // Total size of their values
+	Disk  *mkvstore.DiskStats `json:"disk,omitempty"`
+}
+
+func (h *HTTP) stats(w http.ResponseWriter, r *http.Request) {
+	store := h.storeOf(r)
+	var doc statsDoc
+	var err error
+	if doc.Keys, doc.Bytes, err = store.Usage(""); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if disk, err := store.DiskStats(); err == nil {
+		doc.Disk = &disk
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// readJSON decodes the JSON body of r into v, replying with an error and
+// returning false if it is not valid.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// mget replies with an object of the values of the string keys of the
+// request array, leaving out missing keys.
+func (h *HTTP) mget(w http.ResponseWriter, r *http.Request) {
+	store := h.storeOf(r)
+	var keys []string
+	if !readJSON(w, r, &keys) {
+		return
+	}
+	values, err := store.MGet(keys...)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, values)
+}
+
+// msetRequest is the body of /v1/mset.
+type msetRequest struct {
+	Pairs      map[string]string `json:"pairs"`
+	TTLSeconds int64             `json:"ttl_seconds,omitempty"`
+}
+
+func (h *HTTP) mset(w http.ResponseWriter, r *http.Request) {
+	store := h.storeOf(r)
+	var req msetRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := store.MSet(req.Pairs, time.Duration(req.TTLSeconds)*time.Second); err != nil {
+		writeStoreJSONError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"count": len(req.Pairs)})
+}
+
+// pipelineOp is an operation of /v1/pipeline: {"op": "get", "key": k},
+// {"op": "set", "key": k, "value": v, "ttl_seconds": n} or
+// {"op": "del", "key": k}.
+type pipelineOp struct {
+	Op         string `json:"op"`
+	Key        string `json:"key"`
+	Value      string `json:"value,omitempty"`
+	TTLSeconds int64  `json:"ttl_seconds,omitempty"`
+}
+
+// pipelineResult is the result of an operation: the value read by get, or
+// null for a missing key and for set and del.
+type pipelineResult struct {
+	Value *string `json:"value"`
+}
+
+// pipelineError fails a pipeline at operation Index.
+type pipelineError struct {
+	Index int
+	Err   error
+}
+
+func (e *pipelineError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+// pipeline runs the operations of the request array in one transaction and
+// replies with an array of their results. If one fails, none is applied and
+// the reply is {"error": ..., "index": i}.
+func (h *HTTP) pipeline(w http.ResponseWriter, r *http.Request) {
+	store := h.storeOf(r)
+	var ops []pipelineOp
+	if !readJSON(w, r, &ops) {
+		return
+	}
+	for i, op := range ops {
+		if op.Op != "get" && op.Op != "set" && op.Op != "del" {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": fmt.Sprintf("unknown op %q", op.Op), "index": i})
+			return
+		}
+	}
+
+	results := make([]pipelineResult, len(ops))
+	err := store.WithTx(func(tx *mkvstore.Tx) error {
+		for i, op := range ops {
+			var err error
+			switch op.Op {
+			case "get":
+				var value string
+				value, err = tx.Get(op.Key)
+				if err == nil {
+					results[i].Value = &value
+				} else if errors.Is(err, mkvstore.ErrKeyNotFound) {
+					err = nil
+				}
+			case "set":
+				err = tx.Set(op.Key, op.Value, time.Duration(op.TTLSeconds)*time.Second)
+			case "del":
+				err = tx.Del(op.Key)
+			}
+			if err != nil {
+				return &pipelineError{Index: i, Err: err}
+			}
+		}
+		return nil
+	})
+	var perr *pipelineError
+	if errors.As(err, &perr) {
+		writeJSON(w, storeErrorStatus(perr.Err), map[string]any{"error": perr.Err.Error(), "index": perr.Index})
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// storeErrorStatus returns the status code reporting a store error: a
+// client error if the request asked for something the store refuses.
+func storeErrorStatus(err error) int {
+	if errors.Is(err, mkvstore.ErrReservedKey) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// writeStoreJSONError replies with a store error.
+func writeStoreJSONError(w http.ResponseWriter, err error) {
+	writeJSONError(w, storeErrorStatus(err), err.Error())
+}
+
+// writeJSON replies with v encoded as JSON.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError replies with {"error": msg}.
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hootrhino/microkvstore/mkvstoretest"
+)
+
+// getJSON requests path from h and decodes the JSON reply into v, returning
+// the status code.
+func getJSON(t *testing.T, h http.Handler, path string, v any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("Failed to decode reply to %s: %v", path, err)
+	}
+	return rec.Code
+}
+
+// TestHTTPListKeys tests paging through keys with cursors and values.
+func TestHTTPListKeys(t *testing.T) {
+	store := mkvstoretest.New(t)
+	for i := range 5 {
+		store.Set(fmt.Sprintf("sensor:%d", i), fmt.Sprint(i), 0)
+	}
+	store.Set("config", "x", 0)
+	h := NewHTTP(store)
+
+	var seen []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		var page keysPage
+		path := "/v1/keys?pattern=sensor:*&limit=2&withValues=true&cursor=" + url.QueryEscape(cursor)
+		if code := getJSON(t, h, path, &page); code != http.StatusOK {
+			t.Fatalf("GET %s = %d", path, code)
+		}
+		for _, item := range page.Keys {
+			if item.Value == nil || "sensor:"+*item.Value != item.Key {
+				t.Errorf("Unexpected item %+v", item)
+			}
+			seen = append(seen, item.Key)
+		}
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+		if pages > 5 {
+			t.Fatal("Too many pages")
+		}
+	}
+	if len(seen) != 5 {
+		t.Errorf("Expected 5 keys, got %v", seen)
+	}
+
+	var page keysPage
+	getJSON(t, h, "/v1/keys", &page)
+	if len(page.Keys) != 6 || page.Keys[0].Value != nil {
+		t.Errorf("Expected all 6 keys without values, got %+v", page.Keys)
+	}
+
+	var failure map[string]string
+	if code := getJSON(t, h, "/v1/keys?limit=5000", &failure); code != http.StatusBadRequest || failure["error"] == "" {
+		t.Errorf("Expected a limit too large to fail, got %d %v", code, failure)
+	}
+}
+
+// TestHTTPKeyAndStats tests reading a key and the stats document.
+func TestHTTPKeyAndStats(t *testing.T) {
+	store := mkvstoretest.New(t)
+	store.Set("a/b", "hello", 0)
+	h := NewHTTP(store)
+
+	var item keyItem
+	if code := getJSON(t, h, "/v1/keys/a/b", &item); code != http.StatusOK || item.Value == nil || *item.Value != "hello" {
+		t.Errorf("GET /v1/keys/a/b = %d %+v", code, item)
+	}
+	var failure map[string]string
+	if code := getJSON(t, h, "/v1/keys/missing", &failure); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing key, got %d", code)
+	}
+
+	var stats statsDoc
+	if code := getJSON(t, h, "/v1/stats", &stats); code != http.StatusOK || stats.Keys != 1 || stats.Bytes != 5 {
+		t.Errorf("GET /v1/stats = %d %+v", code, stats)
+	}
+}
+
+// TestHTTPConditionalGet tests the ETag of a key and 304 replies to
+// If-None-Match.
+func TestHTTPConditionalGet(t *testing.T) {
+	store := mkvstoretest.New(t)
+	store.Set("k", "v1", 0)
+	h := NewHTTP(store)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/keys/k", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get("")
+	tag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || tag == "" {
+		t.Fatalf("GET /v1/keys/k = %d with ETag %q", first.Code, tag)
+	}
+	if rec := get(tag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 || rec.Header().Get("ETag") != tag {
+		t.Errorf("Expected 304 with ETag %s and no body, got %d %q %q", tag, rec.Code, rec.Header().Get("ETag"), rec.Body.String())
+	}
+	if rec := get("W/" + tag); rec.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for the weak form of the ETag, got %d", rec.Code)
+	}
+
+	store.Set("k", "v2", 0)
+	rec := get(tag)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == tag || !strings.Contains(rec.Body.String(), "v2") {
+		t.Errorf("Expected 200 with a new ETag after a write, got %d %q %q", rec.Code, rec.Header().Get("ETag"), rec.Body.String())
+	}
+
+	tag = rec.Header().Get("ETag")
+	store.Del("k")
+	store.Set("k", "v3", 0)
+	if rec := get(tag); rec.Code != http.StatusOK || rec.Header().Get("ETag") == tag {
+		t.Errorf("Expected 200 with a new ETag after delete and re-create, got %d %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+// postJSON posts body to path on h and decodes the JSON reply into v,
+// returning the status code.
+func postJSON(t *testing.T, h http.Handler, path, body string, v any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("Failed to decode reply to %s: %v", path, err)
+	}
+	return rec.Code
+}
+
+// TestHTTPBulk tests the mget, mset and pipeline endpoints.
+func TestHTTPBulk(t *testing.T) {
+	store := mkvstoretest.New(t)
+	h := NewHTTP(store)
+
+	var count map[string]int
+	if code := postJSON(t, h, "/v1/mset", `{"pairs": {"a": "1", "b": "2"}, "ttl_seconds": 60}`, &count); code != http.StatusOK || count["count"] != 2 {
+		t.Fatalf("POST /v1/mset = %d %v", code, count)
+	}
+	if ttl, _ := store.TTL("a"); ttl <= 0 {
+		t.Errorf("Expected a TTL on a, got %s", ttl)
+	}
+
+	var values map[string]string
+	if code := postJSON(t, h, "/v1/mget", `["a", "b", "missing"]`, &values); code != http.StatusOK || len(values) != 2 || values["b"] != "2" {
+		t.Errorf("POST /v1/mget = %d %v", code, values)
+	}
+
+	var results []pipelineResult
+	ops := `[{"op": "set", "key": "c", "value": "3"}, {"op": "get", "key": "c"}, {"op": "del", "key": "a"}, {"op": "get", "key": "a"}]`
+	if code := postJSON(t, h, "/v1/pipeline", ops, &results); code != http.StatusOK || len(results) != 4 {
+		t.Fatalf("POST /v1/pipeline = %d %v", code, results)
+	}
+	if results[1].Value == nil || *results[1].Value != "3" || results[3].Value != nil {
+		t.Errorf("Unexpected pipeline results %+v", results)
+	}
+
+	// A failing operation rolls back the whole pipeline
+	var failure map[string]any
+	ops = `[{"op": "set", "key": "d", "value": "4"}, {"op": "set", "key": "__mkv:x", "value": "5"}]`
+	if code := postJSON(t, h, "/v1/pipeline", ops, &failure); code != http.StatusBadRequest || failure["index"] != 1.0 {
+		t.Errorf("Expected the reserved key to fail at index 1, got %d %v", code, failure)
+	}
+	if _, err := store.Get("d"); err == nil {
+		t.Error("Expected the pipeline to be rolled back")
+	}
+	if code := postJSON(t, h, "/v1/pipeline", `[{"op": "incr", "key": "a"}]`, &failure); code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown op to fail, got %d", code)
+	}
+}
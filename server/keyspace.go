@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+)
+
+// maxScanCursors bounds the SCAN cursors a connection remembers. Older
+// cursors are forgotten, and continuing them fails.
+const maxScanCursors = 1024
+
+// scanCursors maps the numeric cursors of the SCAN command, which clients
+// parse as integers, to the key cursors of Store.Scan.
+type scanCursors struct {
+	next uint64
+	keys map[uint64]string
+}
+
+// put returns a numeric cursor continuing after key.
+func (sc *scanCursors) put(key string) uint64 {
+	if sc.keys == nil || len(sc.keys) >= maxScanCursors {
+		sc.keys = make(map[uint64]string)
+	}
+	sc.next++
+	sc.keys[sc.next] = key
+	return sc.next
+}
+
+// take returns the key cursor of a numeric cursor, "" for 0.
+func (sc *scanCursors) take(cursor uint64) (string, bool) {
+	if cursor == 0 {
+		return "", true
+	}
+	key, ok := sc.keys[cursor]
+	delete(sc.keys, cursor)
+	return key, ok
+}
+
+// cmdScan runs SCAN cursor [MATCH pattern] [COUNT count] [TYPE type] over the
+// string keys, the only type Store.Scan iterates.
+func cmdScan(c *respConn, args []string) {
+	cursor, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		c.writeError("ERR invalid cursor")
+		return
+	}
+	pattern, count, keyType := "*", 10, ""
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			c.writeError("ERR syntax error")
+			return
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count < 1 {
+				c.writeError("ERR value is not an integer or out of range")
+				return
+			}
+		case "TYPE":
+			keyType = strings.ToLower(args[i+1])
+		default:
+			c.writeError("ERR syntax error")
+			return
+		}
+	}
+
+	from, ok := c.cursors.take(cursor)
+	if !ok {
+		c.writeError("ERR invalid cursor")
+		return
+	}
+	var keys []string
+	next := ""
+	if keyType == "" || keyType == "string" {
+		if keys, next, err = c.store.Scan(from, pattern, count); err != nil {
+			c.writeStoreError(err)
+			return
+		}
+	}
+
+	writeArrayHeader(c.w, 2)
+	if next == "" {
+		writeBulk(c.w, "0")
+	} else {
+		writeBulk(c.w, strconv.FormatUint(c.cursors.put(next), 10))
+	}
+	writeArrayHeader(c.w, len(keys))
+	for _, key := range keys {
+		writeBulk(c.w, key)
+	}
+}
+
+// status returns the status of key, with Exists false if it does not exist,
+// tracking the read.
+func (c *respConn) status(key string) (mkvstore.KeyStatus, error) {
+	c.trackRead(key)
+	report, err := c.store.Report([]string{key})
+	if err != nil || len(report) == 0 {
+		return mkvstore.KeyStatus{}, err
+	}
+	return report[0], nil
+}
+
+// respType returns the Redis type name of a stored type. Aliases and
+// archived keys hold strings.
+func respType(storeType string) string {
+	switch storeType {
+	case "alias", "archived":
+		return "string"
+	case "":
+		return "none"
+	}
+	return storeType
+}
+
+func cmdType(c *respConn, args []string) {
+	st, err := c.status(args[1])
+	if err != nil {
+		c.writeStoreError(err)
+		return
+	}
+	writeSimple(c.w, respType(st.Type))
+}
+
+// cmdObject runs OBJECT ENCODING and OBJECT IDLETIME. Encodings are the
+// names Redis gives to the representation of each type, and idle times are
+// measured from the last write unless access times are tracked.
+func cmdObject(c *respConn, args []string) {
+	sub := strings.ToUpper(args[1])
+	if sub != "ENCODING" && sub != "IDLETIME" {
+		c.writeError(fmt.Sprintf("ERR unknown subcommand '%s'", args[1]))
+		return
+	}
+	if len(args) != 3 {
+		c.writeError(fmt.Sprintf("ERR wrong number of arguments for 'object|%s' command", strings.ToLower(sub)))
+		return
+	}
+	st, err := c.status(args[2])
+	if err != nil {
+		c.writeStoreError(err)
+		return
+	}
+	if !st.Exists {
+		writeNull(c.w, c.proto)
+		return
+	}
+
+	if sub == "IDLETIME" {
+		writeInt(c.w, int64(max(time.Since(st.LastUsed), 0)/time.Second))
+		return
+	}
+	switch respType(st.Type) {
+	case "hash", "set":
+		writeBulk(c.w, "hashtable")
+	case "list":
+		writeBulk(c.w, "quicklist")
+	case "zset":
+		writeBulk(c.w, "skiplist")
+	case "stream":
+		writeBulk(c.w, "stream")
+	default:
+		writeBulk(c.w, "raw")
+	}
+}
+
+// cmdExpire runs EXPIRE and PEXPIRE with the NX, GT and LT options. The
+// store keeps expirations to the second, so PEXPIRE rounds down.
+func cmdExpire(c *respConn, args []string) {
+	n, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		c.writeError("ERR value is not an integer or out of range")
+		return
+	}
+	ttl := time.Duration(n) * time.Second
+	if strings.ToUpper(args[0]) == "PEXPIRE" {
+		ttl = time.Duration(n) * time.Millisecond
+	}
+
+	expire := c.store.Expire
+	if len(args) == 4 {
+		switch strings.ToUpper(args[3]) {
+		case "NX":
+			expire = c.store.ExpireNX
+		case "GT":
+			expire = c.store.ExpireGT
+		case "LT":
+			expire = c.store.ExpireLT
+		default:
+			c.writeError(fmt.Sprintf("ERR unsupported option %s", args[3]))
+			return
+		}
+	}
+	ok, err := expire(args[1], ttl)
+	if err != nil {
+		c.writeStoreError(err)
+		return
+	}
+	writeBool(c.w, ok)
+}
+
+func cmdPersist(c *respConn, args []string) {
+	ok, err := c.store.Persist(args[1])
+	if err != nil {
+		c.writeStoreError(err)
+		return
+	}
+	writeBool(c.w, ok)
+}
+
+// cmdTTL runs TTL and PTTL.
+func cmdTTL(c *respConn, args []string) {
+	st, err := c.status(args[1])
+	switch {
+	case err != nil:
+		c.writeStoreError(err)
+	case !st.Exists:
+		writeInt(c.w, -2)
+	case st.TTL < 0:
+		writeInt(c.w, -1)
+	case strings.ToUpper(args[0]) == "PTTL":
+		writeInt(c.w, st.TTL.Milliseconds())
+	default:
+		writeInt(c.w, int64((st.TTL+time.Second/2)/time.Second))
+	}
+}
+
+// writeBool replies 1 for true and 0 for false, as Redis does.
+func writeBool(w *bufio.Writer, ok bool) {
+	if ok {
+		writeInt(w, 1)
+	} else {
+		writeInt(w, 0)
+	}
+}
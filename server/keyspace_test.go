@@ -0,0 +1,96 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+	"github.com/hootrhino/microkvstore/mkvstoretest"
+)
+
+// TestRESPScan tests iterating with numeric cursors, as redis-cli --scan does.
+func TestRESPScan(t *testing.T) {
+	c := dialRESP(t, startRESP(t, mkvstoretest.New(t)))
+	for i := range 25 {
+		c.do("SET", fmt.Sprintf("k:%02d", i), "v")
+	}
+	c.do("SET", "other", "v")
+
+	seen := make(map[string]bool)
+	cursor := "0"
+	for {
+		// [cursor [key ...]]
+		reply := c.do("SCAN", cursor, "MATCH", "k:*", "COUNT", "10")
+		fields := strings.Fields(strings.NewReplacer("[", "", "]", "").Replace(reply))
+		if _, err := strconv.ParseUint(fields[0], 10, 64); err != nil {
+			t.Fatalf("Expected a numeric cursor, got %q", fields[0])
+		}
+		for _, key := range fields[1:] {
+			seen[key] = true
+		}
+		if cursor = fields[0]; cursor == "0" {
+			break
+		}
+	}
+	if len(seen) != 25 || seen["other"] {
+		t.Errorf("Expected the 25 matching keys, got %d: %v", len(seen), seen)
+	}
+	if got := c.do("SCAN", "12345"); !strings.HasPrefix(got, "ERR") {
+		t.Errorf("Expected an unknown cursor to fail, got %q", got)
+	}
+}
+
+// TestRESPKeyCommands tests TYPE, OBJECT and the expiry commands.
+func TestRESPKeyCommands(t *testing.T) {
+	// A stopped clock on a whole second keeps TTLs exact
+	clock := mkvstoretest.NewClock(time.Now().Truncate(time.Second))
+	store := mkvstoretest.New(t, mkvstore.WithClock(clock.Now))
+	c := dialRESP(t, startRESP(t, store))
+	c.do("SET", "s", "v")
+	if err := store.HSet("h", "f", "v"); err != nil {
+		t.Fatalf("HSet failed: %v", err)
+	}
+
+	for key, want := range map[string]string{"s": "string", "h": "hash", "missing": "none"} {
+		if got := c.do("TYPE", key); got != want {
+			t.Errorf("TYPE %s = %q, expected %q", key, got, want)
+		}
+	}
+	if got := c.do("OBJECT", "ENCODING", "h"); got != "hashtable" {
+		t.Errorf("OBJECT ENCODING = %q", got)
+	}
+	if got := c.do("OBJECT", "IDLETIME", "s"); got != "0" && got != "1" {
+		t.Errorf("OBJECT IDLETIME = %q, expected about 0", got)
+	}
+	if got := c.do("OBJECT", "IDLETIME", "missing"); got != "nil" {
+		t.Errorf("OBJECT IDLETIME of a missing key = %q", got)
+	}
+
+	if got := c.do("TTL", "s"); got != "-1" {
+		t.Errorf("TTL = %q, expected -1", got)
+	}
+	if got := c.do("PEXPIRE", "s", "60000"); got != "1" {
+		t.Errorf("PEXPIRE = %q", got)
+	}
+	if got := c.do("TTL", "s"); got != "60" {
+		t.Errorf("TTL = %q, expected 60", got)
+	}
+	if got := c.do("EXPIRE", "s", "10", "GT"); got != "0" {
+		t.Errorf("EXPIRE GT shortening the TTL = %q, expected 0", got)
+	}
+	if got := c.do("PERSIST", "s"); got != "1" {
+		t.Errorf("PERSIST = %q", got)
+	}
+	if got := c.do("TTL", "s"); got != "-1" {
+		t.Errorf("TTL after PERSIST = %q, expected -1", got)
+	}
+	if got := c.do("EXPIRE", "missing", "10"); got != "0" {
+		t.Errorf("EXPIRE of a missing key = %q, expected 0", got)
+	}
+	if got := c.do("TTL", "missing"); got != "-2" {
+		t.Errorf("TTL of a missing key = %q, expected -2", got)
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+)
+
+// keyspaceChannel prefixes the channels of keyspace notifications, as in
+// Redis for database 0. A change of key is published on keyspaceChannel+key
+// with the command that made it, e.g. "set" or "hset", as the message.
+const keyspaceChannel = "__keyspace@0__:"
+
+// pubsubCount returns the number of channels and patterns c is subscribed
+// to, reported by the (P)SUBSCRIBE and (P)UNSUBSCRIBE replies.
+func (c *respConn) pubsubCount() int64 {
+	n := int64(len(c.patterns))
+	if c.subscribed {
+		n++
+	}
+	return n
+}
+
+// cmdPSubscribe runs PSUBSCRIBE pattern [pattern ...] on keyspace
+// notifications: patterns must start with __keyspace@0__: and the rest, in
+// the glob syntax of Store.Keys, is matched against keys by Store.Subscribe,
+// so clients only receive the changes of their namespace. Each change is
+// delivered as a pmessage on the channel of its key, with the command that
+// made it as the message.
+func cmdPSubscribe(c *respConn, args []string) {
+	for _, pattern := range args[1:] {
+		if !strings.HasPrefix(pattern, keyspaceChannel) {
+			c.writeError(fmt.Sprintf("ERR only patterns of %s* channels can be subscribed to", keyspaceChannel))
+			return
+		}
+	}
+	for _, pattern := range args[1:] {
+		if _, ok := c.patterns[pattern]; !ok {
+			sub := c.store.Subscribe(strings.TrimPrefix(pattern, keyspaceChannel))
+			c.patterns[pattern] = sub
+			go c.deliver(pattern, sub)
+		}
+		writePushHeader(c.w, c.proto, 3)
+		writeBulk(c.w, "psubscribe")
+		writeBulk(c.w, pattern)
+		writeInt(c.w, c.pubsubCount())
+	}
+}
+
+// cmdPUnsubscribe runs PUNSUBSCRIBE [pattern ...], from every pattern if
+// none is given.
+func cmdPUnsubscribe(c *respConn, args []string) {
+	patterns := args[1:]
+	if len(patterns) == 0 {
+		for pattern := range c.patterns {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if len(patterns) == 0 {
+		writePushHeader(c.w, c.proto, 3)
+		writeBulk(c.w, "punsubscribe")
+		writeNull(c.w, c.proto)
+		writeInt(c.w, c.pubsubCount())
+		return
+	}
+	for _, pattern := range patterns {
+		if sub, ok := c.patterns[pattern]; ok {
+			sub.Close()
+			delete(c.patterns, pattern)
+		}
+		writePushHeader(c.w, c.proto, 3)
+		writeBulk(c.w, "punsubscribe")
+		writeBulk(c.w, pattern)
+		writeInt(c.w, c.pubsubCount())
+	}
+}
+
+// closePatterns closes the pattern subscriptions of c when it disconnects.
+func (c *respConn) closePatterns() {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	for pattern, sub := range c.patterns {
+		sub.Close()
+		delete(c.patterns, pattern)
+	}
+}
+
+// deliver writes the events of sub to c as pmessages of pattern until sub
+// is closed.
+func (c *respConn) deliver(pattern string, sub *mkvstore.Subscription) {
+	for e := range sub.C {
+		c.wmu.Lock()
+		writePushHeader(c.w, c.proto, 4)
+		writeBulk(c.w, "pmessage")
+		writeBulk(c.w, pattern)
+		writeBulk(c.w, keyspaceChannel+e.Key)
+		writeBulk(c.w, e.Op)
+		c.w.Flush()
+		c.wmu.Unlock()
+	}
+}
@@ -0,0 +1,695 @@
+package server
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+)
+
+// maxBulkLen bounds the length of a bulk string in a request, like Redis
+// proto-max-bulk-len, so a bad client cannot make the server allocate
+// arbitrarily.
+const maxBulkLen = 512 << 20
+
+// RESP serves a Store over the Redis serialization protocol, RESP2 or RESP3
+// after HELLO 3, so redis-cli and Redis client libraries can share the store
+// with other processes. It implements the subset of commands the store maps
+// onto, including client-side caching with CLIENT TRACKING. With Tenants,
+// see Config.Tenants, clients reach the tenants by SELECT or by their AUTH
+// credential.
+type RESP struct {
+	store *mkvstore.Store
+
+	tracking *tracking
+	password string   // Required by AUTH unless empty, set by New
+	tenants  *Tenants // Tenants reachable by SELECT and AUTH, or nil, set by New
+	metrics  *metrics // Shared with the other endpoints of a Server
+
+	nextID atomic.Int64
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[int64]*respConn
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewRESP returns a RESP server for store. Serve starts it.
+func NewRESP(store *mkvstore.Store) *RESP {
+	r := &RESP{
+		store:     store,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[int64]*respConn),
+	}
+	r.tracking = newTracking(r)
+	return r
+}
+
+// Serve accepts connections on l and serves each on its own goroutine until
+// l fails or Close is called, in which case it returns nil.
+func (r *RESP) Serve(l net.Listener) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return net.ErrClosed
+	}
+	r.listeners[l] = struct{}{}
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.listeners, l)
+		r.mu.Unlock()
+	}()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			r.mu.Lock()
+			closed := r.closed
+			r.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		c := &respConn{
+			id:       r.nextID.Add(1),
+			srv:      r,
+			store:    r.store,
+			nc:       nc,
+			r:        bufio.NewReader(nc),
+			w:        bufio.NewWriter(nc),
+			proto:    2,
+			patterns: make(map[string]*mkvstore.Subscription),
+		}
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			nc.Close()
+			return nil
+		}
+		r.conns[c.id] = c
+		r.wg.Add(1)
+		r.mu.Unlock()
+		r.metrics.connOpened()
+		go c.serve()
+	}
+}
+
+// Close stops the listeners, closes every connection and waits for their
+// goroutines to return. The Store stays open.
+func (r *RESP) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	var errs []error
+	for l := range r.listeners {
+		if err := l.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	for _, c := range r.conns {
+		c.nc.Close()
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	r.tracking.close()
+	return errors.Join(errs...)
+}
+
+// conn returns the open connection with client ID id.
+func (r *RESP) conn(id int64) (*respConn, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.conns[id]
+	return c, ok
+}
+
+// respConn is a client connection.
+type respConn struct {
+	id  int64
+	srv *RESP
+	nc  net.Conn
+	r   *bufio.Reader
+
+	wmu   sync.Mutex // Guards w against invalidation pushes
+	w     *bufio.Writer
+	proto int // 2 or 3, set by HELLO
+
+	authed     bool                              // Passed AUTH, if the server needs a password
+	store      *mkvstore.Store                   // Store of the selected tenant, or of the server
+	tenant     *Tenant                           // Selected tenant, nil for the server's store
+	bound      *Tenant                           // Tenant whose credential passed AUTH, which c cannot leave
+	failed     bool                              // The running command replied with an error
+	subscribed bool                              // Subscribed to the invalidation channel for REDIRECT
+	patterns   map[string]*mkvstore.Subscription // PSUBSCRIBE patterns, guarded by wmu
+	cursors    scanCursors                       // SCAN cursors handed out
+}
+
+// serve reads and runs commands until the client quits or the connection fails.
+func (c *respConn) serve() {
+	defer c.srv.wg.Done()
+	defer func() {
+		c.srv.metrics.connClosed()
+		c.srv.tracking.forget(c.id)
+		c.closePatterns()
+		c.srv.mu.Lock()
+		delete(c.srv.conns, c.id)
+		c.srv.mu.Unlock()
+		c.nc.Close()
+	}()
+
+	for {
+		args, err := readCommand(c.r)
+		if err != nil {
+			var perr protocolError
+			if errors.As(err, &perr) {
+				c.wmu.Lock()
+				c.writeError("ERR Protocol error: " + string(perr))
+				c.w.Flush()
+				c.wmu.Unlock()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		c.wmu.Lock()
+		quit := c.run(args)
+		// Pipelined commands are answered in one write
+		var ferr error
+		if quit || c.r.Buffered() == 0 {
+			ferr = c.w.Flush()
+		}
+		c.wmu.Unlock()
+		if quit || ferr != nil {
+			return
+		}
+	}
+}
+
+// run runs the command args with c.wmu held and reports whether the client
+// asked to quit.
+func (c *respConn) run(args []string) (quit bool) {
+	c.srv.metrics.command()
+	name := strings.ToUpper(args[0])
+	cmd, ok := respCommands[name]
+	if !ok {
+		c.writeError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return false
+	}
+	if len(args) < cmd.minArgs || (cmd.maxArgs >= 0 && len(args) > cmd.maxArgs) {
+		c.writeError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+		return false
+	}
+	if c.srv.password != "" && !c.authed && name != "AUTH" && name != "HELLO" && name != "QUIT" {
+		c.writeError("NOAUTH Authentication required.")
+		return false
+	}
+	if c.pubsubCount() > 0 && !cmd.pubsub {
+		c.writeError(fmt.Sprintf("ERR Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", strings.ToLower(name)))
+		return false
+	}
+	c.failed = false
+	cmd.run(c, args)
+	if c.tenant != nil {
+		var err error
+		if c.failed {
+			err = errCommandFailed
+		}
+		c.tenant.Observe(err)
+	}
+	return name == "QUIT"
+}
+
+// respCommand describes a command: its argument count, command name
+// included, with maxArgs -1 for no limit.
+type respCommand struct {
+	minArgs, maxArgs int
+	pubsub           bool // Allowed while subscribed
+	run              func(c *respConn, args []string)
+}
+
+// respCommands are the commands served, by upper-case name.
+var respCommands = map[string]respCommand{
+	"PING":         {1, 2, true, cmdPing},
+	"ECHO":         {2, 2, false, cmdEcho},
+	"QUIT":         {1, 1, true, cmdQuit},
+	"AUTH":         {2, 3, false, cmdAuth},
+	"HELLO":        {1, -1, false, cmdHello},
+	"SELECT":       {2, 2, false, cmdSelect},
+	"CLIENT":       {2, -1, false, cmdClient},
+	"SUBSCRIBE":    {2, -1, true, cmdSubscribe},
+	"UNSUBSCRIBE":  {1, -1, true, cmdUnsubscribe},
+	"PSUBSCRIBE":   {2, -1, true, cmdPSubscribe},
+	"PUNSUBSCRIBE": {1, -1, true, cmdPUnsubscribe},
+	"GET":          {2, 2, false, cmdGet},
+	"MGET":         {2, -1, false, cmdMGet},
+	"SET":          {3, -1, false, cmdSet},
+	"DEL":          {2, -1, false, cmdDel},
+	"EXISTS":       {2, -1, false, cmdExists},
+	"SCAN":         {2, -1, false, cmdScan},
+	"TYPE":         {2, 2, false, cmdType},
+	"OBJECT":       {2, -1, false, cmdObject},
+	"EXPIRE":       {3, 4, false, cmdExpire},
+	"PEXPIRE":      {3, 4, false, cmdExpire},
+	"PERSIST":      {2, 2, false, cmdPersist},
+	"TTL":          {2, 2, false, cmdTTL},
+	"PTTL":         {2, 2, false, cmdTTL},
+}
+
+func cmdPing(c *respConn, args []string) {
+	switch {
+	case c.pubsubCount() > 0 && c.proto == 2:
+		msg := ""
+		if len(args) == 2 {
+			msg = args[1]
+		}
+		writeArrayHeader(c.w, 2)
+		writeBulk(c.w, "pong")
+		writeBulk(c.w, msg)
+	case len(args) == 2:
+		writeBulk(c.w, args[1])
+	default:
+		writeSimple(c.w, "PONG")
+	}
+}
+
+func cmdEcho(c *respConn, args []string) {
+	writeBulk(c.w, args[1])
+}
+
+func cmdQuit(c *respConn, args []string) {
+	writeSimple(c.w, "OK")
+}
+
+// cmdAuth runs AUTH [username] password. The server has a single user, so
+// the username is ignored.
+func cmdAuth(c *respConn, args []string) {
+	if c.auth(args[len(args)-1]) {
+		writeSimple(c.w, "OK")
+	}
+}
+
+// auth checks password against the credentials of the tenants, switching
+// to the tenant it belongs to, and then against the password of the server,
+// replying with an error if neither matches.
+func (c *respConn) auth(password string) bool {
+	if t, ok := c.srv.tenants.ByCredential(password); ok {
+		if !c.use(t) {
+			return false
+		}
+		c.authed, c.bound = true, t
+		return true
+	}
+	if c.srv.password == "" && c.srv.tenants == nil {
+		c.writeError("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+		return false
+	}
+	if c.srv.password == "" || subtle.ConstantTimeCompare([]byte(password), []byte(c.srv.password)) != 1 {
+		c.srv.metrics.authFailed()
+		c.writeError("WRONGPASS invalid username-password pair or user is disabled.")
+		return false
+	}
+	c.authed, c.bound = true, nil
+	return true
+}
+
+// cmdSelect runs SELECT index. Index 0 is the server's store unless a tenant
+// has it, and other indexes are those of the tenants. A connection that
+// authenticated with the credential of a tenant cannot leave it, and a
+// tenant with a credential can only be selected with it or after AUTH with
+// the password of the server.
+func cmdSelect(c *respConn, args []string) {
+	index, err := strconv.Atoi(args[1])
+	if err != nil {
+		c.writeError("ERR value is not an integer or out of range")
+		return
+	}
+	t, ok := c.srv.tenants.ByIndex(index)
+	switch {
+	case !ok && index != 0:
+		c.writeError("ERR DB index is out of range")
+		return
+	case c.bound != nil && t != c.bound,
+		t != nil && t.Credential != "" && t != c.bound && (c.srv.password == "" || !c.authed):
+		c.writeError("NOPERM this user has no permissions to access the selected database")
+		return
+	}
+	if c.use(t) {
+		writeSimple(c.w, "OK")
+	}
+}
+
+// use switches c to tenant t, or to the server's store if t is nil, with
+// fresh SCAN cursors. Tracking only follows the server's store, so c cannot
+// switch to a tenant while it tracks keys.
+func (c *respConn) use(t *Tenant) bool {
+	if t != nil && c.srv.tracking.redirect(c.id) >= 0 {
+		c.writeError("ERR tenants do not support CLIENT TRACKING")
+		return false
+	}
+	c.tenant, c.store, c.cursors = t, c.srv.store, scanCursors{}
+	if t != nil {
+		c.store = t.Store
+	}
+	return true
+}
+
+// cmdHello switches the protocol version and replies with the server
+// properties, authenticating first with the AUTH option. The SETNAME option
+// is not supported.
+func cmdHello(c *respConn, args []string) {
+	proto := c.proto
+	if len(args) > 1 {
+		var err error
+		if proto, err = strconv.Atoi(args[1]); err != nil {
+			c.writeError("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if proto != 2 && proto != 3 {
+			c.writeError("NOPROTO unsupported protocol version")
+			return
+		}
+	}
+	for i := 2; i < len(args); i++ {
+		if !strings.EqualFold(args[i], "AUTH") {
+			c.writeError(fmt.Sprintf("ERR unsupported HELLO option '%s'", args[i]))
+			return
+		}
+		if i+2 >= len(args) {
+			c.writeError("ERR syntax error in HELLO option 'auth'")
+			return
+		}
+		if !c.auth(args[i+2]) {
+			return
+		}
+		i += 2
+	}
+	if c.srv.password != "" && !c.authed {
+		c.writeError("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+		return
+	}
+	c.proto = proto
+
+	writeMapHeader(c.w, c.proto, 6)
+	writeBulk(c.w, "server")
+	writeBulk(c.w, "mkvstore")
+	writeBulk(c.w, "version")
+	writeBulk(c.w, "7.0.0") // Redis version whose protocol is spoken, which clients check
+	writeBulk(c.w, "proto")
+	writeInt(c.w, int64(c.proto))
+	writeBulk(c.w, "id")
+	writeInt(c.w, c.id)
+	writeBulk(c.w, "mode")
+	writeBulk(c.w, "standalone")
+	writeBulk(c.w, "role")
+	writeBulk(c.w, "master")
+}
+
+func cmdClient(c *respConn, args []string) {
+	switch strings.ToUpper(args[1]) {
+	case "ID":
+		writeInt(c.w, c.id)
+	case "TRACKING":
+		c.clientTracking(args[2:])
+	case "GETREDIR":
+		writeInt(c.w, c.srv.tracking.redirect(c.id))
+	default:
+		c.writeError(fmt.Sprintf("ERR unknown subcommand '%s'", args[1]))
+	}
+}
+
+// cmdSubscribe only supports the invalidation channel, which REDIRECT
+// clients of the RESP2 protocol subscribe to.
+func cmdSubscribe(c *respConn, args []string) {
+	for _, channel := range args[1:] {
+		if channel != invalidateChannel {
+			c.writeError(fmt.Sprintf("ERR only the %s channel can be subscribed to", invalidateChannel))
+			return
+		}
+	}
+	for _, channel := range args[1:] {
+		c.subscribed = true
+		writePushHeader(c.w, c.proto, 3)
+		writeBulk(c.w, "subscribe")
+		writeBulk(c.w, channel)
+		writeInt(c.w, c.pubsubCount())
+	}
+}
+
+func cmdUnsubscribe(c *respConn, args []string) {
+	count := int64(0)
+	if !c.subscribed {
+		count = -1 // Nothing to unsubscribe from, reply with a nil channel
+	}
+	c.subscribed = false
+	writePushHeader(c.w, c.proto, 3)
+	writeBulk(c.w, "unsubscribe")
+	if count < 0 {
+		writeNull(c.w, c.proto)
+	} else {
+		writeBulk(c.w, invalidateChannel)
+	}
+	writeInt(c.w, c.pubsubCount())
+}
+
+func cmdGet(c *respConn, args []string) {
+	c.trackRead(args[1])
+	value, err := c.store.Get(args[1])
+	switch {
+	case errors.Is(err, mkvstore.ErrKeyNotFound):
+		writeNull(c.w, c.proto)
+	case errors.Is(err, mkvstore.ErrWrongType):
+		c.writeError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	case err != nil:
+		c.writeStoreError(err)
+	default:
+		writeBulk(c.w, value)
+	}
+}
+
+func cmdMGet(c *respConn, args []string) {
+	for _, key := range args[1:] {
+		c.trackRead(key)
+	}
+	values, err := c.store.MGet(args[1:]...)
+	if err != nil {
+		c.writeStoreError(err)
+		return
+	}
+	writeArrayHeader(c.w, len(args)-1)
+	for _, key := range args[1:] {
+		if value, ok := values[key]; ok {
+			writeBulk(c.w, value)
+		} else {
+			writeNull(c.w, c.proto)
+		}
+	}
+}
+
+// cmdSet supports the EX, PX and XX options.
+func cmdSet(c *respConn, args []string) {
+	key, value := args[1], args[2]
+	var ttl time.Duration
+	var xx bool
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 == len(args) || ttl != 0 {
+				c.writeError("ERR syntax error")
+				return
+			}
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil || n <= 0 {
+				c.writeError("ERR invalid expire time in 'set' command")
+				return
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			ttl = time.Duration(n) * unit
+		default:
+			c.writeError("ERR syntax error")
+			return
+		}
+	}
+	var err error
+	ok := true
+	if xx {
+		ok, err = c.store.SetXX(key, value, ttl)
+	} else {
+		err = c.store.Set(key, value, ttl)
+	}
+	switch {
+	case err != nil:
+		c.writeStoreError(err)
+	case !ok:
+		writeNull(c.w, c.proto)
+	default:
+		writeSimple(c.w, "OK")
+	}
+}
+
+func cmdDel(c *respConn, args []string) {
+	var n int64
+	for _, key := range args[1:] {
+		exists, err := c.store.Exists(key)
+		if err == nil && exists {
+			err = c.store.Del(key)
+			n++
+		}
+		if err != nil {
+			c.writeStoreError(err)
+			return
+		}
+	}
+	writeInt(c.w, n)
+}
+
+func cmdExists(c *respConn, args []string) {
+	var n int64
+	for _, key := range args[1:] {
+		c.trackRead(key)
+		exists, err := c.store.Exists(key)
+		if err != nil {
+			c.writeStoreError(err)
+			return
+		}
+		if exists {
+			n++
+		}
+	}
+	writeInt(c.w, n)
+}
+
+// protocolError is a malformed request, reported to the client before the
+// connection is closed.
+type protocolError string
+
+func (e protocolError) Error() string {
+	return string(e)
+}
+
+// readCommand reads a request, either an array of bulk strings as sent by
+// client libraries or an inline command typed into telnet.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > 1024*1024 {
+		return nil, protocolError("invalid multibulk length")
+	}
+	args := make([]string, 0, max(n, 0))
+	for range n {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" || line[0] != '$' {
+			return nil, protocolError(fmt.Sprintf("expected '$', got '%.1s'", line))
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, protocolError("invalid bulk length")
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if string(buf[size:]) != "\r\n" {
+			return nil, protocolError("bulk string not terminated by CRLF")
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// readLine reads a line terminated by CRLF, or LF for inline commands.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+func writeSimple(w *bufio.Writer, s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+// writeError replies with an error, counted as a failed command in the
+// statistics of the tenant.
+func (c *respConn) writeError(msg string) {
+	c.failed = true
+	c.w.WriteString("-" + msg + "\r\n")
+}
+
+// writeStoreError replies with a store error, which must not contain line breaks.
+func (c *respConn) writeStoreError(err error) {
+	msg := strings.NewReplacer("\r", " ", "\n", " ").Replace(err.Error())
+	c.writeError("ERR " + msg)
+}
+
+func writeInt(w *bufio.Writer, n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func writeBulk(w *bufio.Writer, s string) {
+	w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func writeArrayHeader(w *bufio.Writer, n int) {
+	w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+// writeNull writes the nil reply of the protocol version: a null bulk string
+// in RESP2, the null type in RESP3.
+func writeNull(w *bufio.Writer, proto int) {
+	if proto == 3 {
+		w.WriteString("_\r\n")
+		return
+	}
+	w.WriteString("$-1\r\n")
+}
+
+// writeMapHeader writes the header of a map of n pairs, sent as a flat array
+// in RESP2.
+func writeMapHeader(w *bufio.Writer, proto, n int) {
+	if proto == 3 {
+		w.WriteString("%" + strconv.Itoa(n) + "\r\n")
+		return
+	}
+	writeArrayHeader(w, 2*n)
+}
+
+// writePushHeader writes the header of an out-of-band push of n elements,
+// sent as an array in RESP2.
+func writePushHeader(w *bufio.Writer, proto, n int) {
+	if proto == 3 {
+		w.WriteString(">" + strconv.Itoa(n) + "\r\n")
+		return
+	}
+	writeArrayHeader(w, n)
+}
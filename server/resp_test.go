@@ -0,0 +1,256 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+	"github.com/hootrhino/microkvstore/mkvstoretest"
+)
+
+// startRESP serves store on a local port for the duration of the test.
+func startRESP(t *testing.T, store *mkvstore.Store) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	srv := NewRESP(store)
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return l.Addr().String()
+}
+
+// respClient is a minimal RESP client rendering replies as strings, e.g.
+// "OK", "nil" or "[a b]", and push messages with a leading ">".
+type respClient struct {
+	t  *testing.T
+	nc net.Conn
+	r  *bufio.Reader
+}
+
+func dialRESP(t *testing.T, addr string) *respClient {
+	t.Helper()
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	return &respClient{t: t, nc: nc, r: bufio.NewReader(nc)}
+}
+
+// do sends a command and returns its reply.
+func (c *respClient) do(args ...string) string {
+	c.t.Helper()
+	fmt.Fprintf(c.nc, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.nc, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return c.read()
+}
+
+// read returns the next reply or push message.
+func (c *respClient) read() string {
+	c.t.Helper()
+	c.nc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("Failed to read reply: %v", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '+', '-', ':':
+		return line[1:]
+	case '_':
+		return "nil"
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "nil"
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			c.t.Fatalf("Failed to read bulk string: %v", err)
+		}
+		return string(buf[:n])
+	case '*', '>', '%':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "nil"
+		}
+		if line[0] == '%' {
+			n *= 2
+		}
+		items := make([]string, n)
+		for i := range items {
+			items[i] = c.read()
+		}
+		s := "[" + strings.Join(items, " ") + "]"
+		if line[0] == '>' {
+			s = ">" + s
+		}
+		return s
+	}
+	c.t.Fatalf("Unexpected reply %q", line)
+	return ""
+}
+
+// TestRESPCommands tests the basic commands.
+func TestRESPCommands(t *testing.T) {
+	c := dialRESP(t, startRESP(t, mkvstoretest.New(t)))
+
+	if got := c.do("PING"); got != "PONG" {
+		t.Errorf("PING = %q", got)
+	}
+	if got := c.do("SET", "a", "1"); got != "OK" {
+		t.Errorf("SET = %q", got)
+	}
+	if got := c.do("SET", "missing", "1", "XX"); got != "nil" {
+		t.Errorf("SET XX of a missing key = %q, expected nil", got)
+	}
+	if got := c.do("GET", "a"); got != "1" {
+		t.Errorf("GET = %q", got)
+	}
+	if got := c.do("MGET", "a", "b"); got != "[1 nil]" {
+		t.Errorf("MGET = %q", got)
+	}
+	if got := c.do("EXISTS", "a", "b", "a"); got != "2" {
+		t.Errorf("EXISTS = %q", got)
+	}
+	if got := c.do("DEL", "a", "b"); got != "1" {
+		t.Errorf("DEL = %q", got)
+	}
+	if got := c.do("NOPE"); !strings.HasPrefix(got, "ERR unknown command") {
+		t.Errorf("Unknown command reply = %q", got)
+	}
+
+	// Inline commands, as typed into telnet
+	fmt.Fprintf(c.nc, "SET b 2\r\n")
+	if got := c.read(); got != "OK" {
+		t.Errorf("Inline SET = %q", got)
+	}
+}
+
+// TestRESPTracking tests invalidation pushes to RESP3 clients in the default
+// mode, for writes from other clients and from the embedding process.
+func TestRESPTracking(t *testing.T) {
+	store := mkvstoretest.New(t)
+	addr := startRESP(t, store)
+	cache, writer := dialRESP(t, addr), dialRESP(t, addr)
+
+	if got := cache.do("HELLO", "3"); !strings.Contains(got, "proto 3") {
+		t.Fatalf("HELLO 3 = %q", got)
+	}
+	if got := cache.do("CLIENT", "TRACKING", "ON"); got != "OK" {
+		t.Fatalf("CLIENT TRACKING = %q", got)
+	}
+	if got := cache.do("GET", "k"); got != "nil" {
+		t.Fatalf("GET = %q", got)
+	}
+
+	writer.do("SET", "other", "x") // Not read, so not tracked
+	writer.do("SET", "k", "v")
+	if got := cache.read(); got != ">[invalidate [k]]" {
+		t.Errorf("Expected invalidation of k, got %q", got)
+	}
+
+	// Keys are forgotten once invalidated, until read again
+	writer.do("SET", "k", "w")
+	if got := cache.do("GET", "k"); got != "w" {
+		t.Errorf("GET = %q, expected no invalidation before the reply", got)
+	}
+	if err := store.Set("k", "from the process", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got := cache.read(); got != ">[invalidate [k]]" {
+		t.Errorf("Expected invalidation of k, got %q", got)
+	}
+}
+
+// TestRESPTrackingCanonical tests that reads are tracked under the canonical
+// key that invalidations carry.
+func TestRESPTrackingCanonical(t *testing.T) {
+	addr := startRESP(t, mkvstoretest.New(t, mkvstore.WithKeyCanonicalization(mkvstore.KeyCanonicalization{Lowercase: true})))
+	cache, writer := dialRESP(t, addr), dialRESP(t, addr)
+
+	cache.do("HELLO", "3")
+	cache.do("CLIENT", "TRACKING", "ON")
+	if got := cache.do("GET", "Foo"); got != "nil" {
+		t.Fatalf("GET = %q", got)
+	}
+	writer.do("SET", "foo", "v")
+	if got := cache.read(); got != ">[invalidate [foo]]" {
+		t.Errorf("Expected invalidation of foo, got %q", got)
+	}
+}
+
+// TestRESPTrackingRedirect tests broadcasting mode with prefixes, delivered
+// to a RESP2 connection subscribed to the invalidation channel.
+func TestRESPTrackingRedirect(t *testing.T) {
+	addr := startRESP(t, mkvstoretest.New(t))
+	cache, inbox, writer := dialRESP(t, addr), dialRESP(t, addr), dialRESP(t, addr)
+
+	id := inbox.do("CLIENT", "ID")
+	if got := inbox.do("SUBSCRIBE", invalidateChannel); got != "[subscribe "+invalidateChannel+" 1]" {
+		t.Fatalf("SUBSCRIBE = %q", got)
+	}
+	if got := cache.do("CLIENT", "TRACKING", "ON", "PREFIX", "cfg:"); !strings.HasPrefix(got, "ERR") {
+		t.Errorf("Expected PREFIX without BCAST to fail, got %q", got)
+	}
+	if got := cache.do("CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "cfg:", "REDIRECT", id); got != "OK" {
+		t.Fatalf("CLIENT TRACKING = %q", got)
+	}
+	if got := cache.do("CLIENT", "GETREDIR"); got != id {
+		t.Errorf("CLIENT GETREDIR = %q, expected %s", got, id)
+	}
+
+	writer.do("SET", "other", "x")
+	writer.do("SET", "cfg:a", "1")
+	if got := inbox.read(); got != "[message "+invalidateChannel+" [cfg:a]]" {
+		t.Errorf("Expected invalidation of cfg:a, got %q", got)
+	}
+}
+
+// TestRESPPSubscribe tests keyspace notifications filtered by PSUBSCRIBE
+// patterns and PUNSUBSCRIBE.
+func TestRESPPSubscribe(t *testing.T) {
+	addr := startRESP(t, mkvstoretest.New(t))
+	sub, writer := dialRESP(t, addr), dialRESP(t, addr)
+
+	if got := sub.do("PSUBSCRIBE", "news.*"); !strings.HasPrefix(got, "ERR") {
+		t.Errorf("Expected a pattern outside the keyspace channels to fail, got %q", got)
+	}
+	if got := sub.do("PSUBSCRIBE", "__keyspace@0__:config:*"); got != "[psubscribe __keyspace@0__:config:* 1]" {
+		t.Fatalf("PSUBSCRIBE = %q", got)
+	}
+	if got := sub.do("GET", "k"); !strings.HasPrefix(got, "ERR Can't execute 'get'") {
+		t.Errorf("GET while subscribed = %q", got)
+	}
+
+	writer.do("SET", "other", "x")
+	writer.do("SET", "config:mode", "eco")
+	if got := sub.read(); got != "[pmessage __keyspace@0__:config:* __keyspace@0__:config:mode set]" {
+		t.Errorf("Expected a pmessage for config:mode, got %q", got)
+	}
+	writer.do("DEL", "config:mode")
+	if got := sub.read(); got != "[pmessage __keyspace@0__:config:* __keyspace@0__:config:mode del]" {
+		t.Errorf("Expected a pmessage for the deletion, got %q", got)
+	}
+
+	if got := sub.do("PUNSUBSCRIBE"); got != "[punsubscribe __keyspace@0__:config:* 0]" {
+		t.Errorf("PUNSUBSCRIBE = %q", got)
+	}
+	if got := sub.do("PUNSUBSCRIBE"); got != "[punsubscribe nil 0]" {
+		t.Errorf("PUNSUBSCRIBE without patterns = %q", got)
+	}
+	writer.do("SET", "config:mode", "boost")
+	if got := sub.do("PING"); got != "PONG" {
+		t.Errorf("PING after PUNSUBSCRIBE = %q, expected no pending pmessage", got)
+	}
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+)
+
+const (
+	defaultSocketPerm      = 0660            // Mode of Unix sockets without Config.SocketPerm
+	defaultShutdownTimeout = 5 * time.Second // Grace period without Config.ShutdownTimeout
+)
+
+// Config selects the endpoints of a Server. Addresses are "host:port" for
+// TCP or "unix:/path" for a Unix socket created by ListenUnix; an empty
+// address disables the endpoint.
+type Config struct {
+	RESPAddr string // RESP endpoint, see RESP
+	HTTPAddr string // HTTP endpoint, see HTTP
+	GRPCAddr string // gRPC endpoint, see GRPC
+
+	// Password is required from every client unless empty: with AUTH or
+	// HELLO AUTH over RESP, and as an "Authorization: Bearer" token over HTTP
+	// and gRPC.
+	Password string
+
+	// Tenants, if set, serves the tenants next to the store: over RESP by
+	// SELECT index or AUTH credential, over HTTP by path prefix or bearer
+	// token, over gRPC by bearer token. Their counters are reported in Stats.
+	Tenants *Tenants
+
+	// Debug mounts DebugHandler on the HTTP endpoint, behind Password, with
+	// the pprof profiles if Pprof is also set. Only enable it on a private
+	// address.
+	Debug bool
+	Pprof bool
+
+	SocketPerm      fs.FileMode   // Mode of Unix sockets, 0660 if zero
+	ShutdownTimeout time.Duration // Grace period for HTTP requests on shutdown, 5s if zero
+}
+
+// Stats is a snapshot of the counters shared by the endpoints of a Server.
+type Stats struct {
+	Connections  int64  // Open RESP connections
+	Commands     uint64 // RESP commands received
+	Requests     uint64 // HTTP requests and gRPC calls received
+	AuthFailures uint64 // Rejected passwords and tokens
+
+	Tenants []TenantStats // Counters of Config.Tenants, ordered by name
+}
+
+// metrics counts the traffic of the endpoints of a Server. A nil *metrics
+// counts nothing, so RESP and HTTP also work on their own.
+type metrics struct {
+	connections  atomic.Int64
+	commands     atomic.Uint64
+	requests     atomic.Uint64
+	authFailures atomic.Uint64
+}
+
+func (m *metrics) connOpened() {
+	if m != nil {
+		m.connections.Add(1)
+	}
+}
+
+func (m *metrics) connClosed() {
+	if m != nil {
+		m.connections.Add(-1)
+	}
+}
+
+func (m *metrics) command() {
+	if m != nil {
+		m.commands.Add(1)
+	}
+}
+
+func (m *metrics) request() {
+	if m != nil {
+		m.requests.Add(1)
+	}
+}
+
+func (m *metrics) authFailed() {
+	if m != nil {
+		m.authFailures.Add(1)
+	}
+}
+
+// Server runs the RESP, HTTP and gRPC endpoints of a store as one unit, with a
+// shared password and shared counters, for applications embedding the store:
+//
+//	srv := server.New(store, server.Config{RESPAddr: ":6379", HTTPAddr: "unix:/run/kv.sock"})
+//	if err := srv.Start(ctx); err != nil { ... }
+//	err := srv.Wait() // Returns once ctx is cancelled and the endpoints stopped
+type Server struct {
+	cfg Config
+
+	metrics metrics
+	resp    *RESP
+	http    *HTTP
+	httpSrv *http.Server
+	grpc    *GRPC
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	started   bool
+	stopOnce  sync.Once
+	stopErr   error
+	wg        sync.WaitGroup
+	errs      chan error // First failure of an endpoint
+	done      chan struct{}
+}
+
+// New returns a Server for store with the endpoints enabled in cfg. Start
+// starts it. The Store stays owned by the caller.
+func New(store *mkvstore.Store, cfg Config) *Server {
+	if cfg.SocketPerm == 0 {
+		cfg.SocketPerm = defaultSocketPerm
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = defaultShutdownTimeout
+	}
+	srv := &Server{cfg: cfg, errs: make(chan error, 3), done: make(chan struct{})}
+	if cfg.RESPAddr != "" {
+		srv.resp = NewRESP(store)
+		srv.resp.password = cfg.Password
+		srv.resp.tenants = cfg.Tenants
+		srv.resp.metrics = &srv.metrics
+	}
+	if cfg.HTTPAddr != "" {
+		srv.http = NewHTTP(store)
+		srv.http.token = cfg.Password
+		srv.http.tenants = cfg.Tenants
+		srv.http.metrics = &srv.metrics
+		if cfg.Debug {
+			srv.http.mux.Handle("/debug/", DebugHandler(store, cfg.Pprof))
+		}
+		srv.httpSrv = &http.Server{Handler: srv.http, ReadHeaderTimeout: 10 * time.Second}
+		srv.httpSrv.RegisterOnShutdown(srv.http.closeWatches)
+	}
+	if cfg.GRPCAddr != "" {
+		srv.grpc = NewGRPC(store)
+		srv.grpc.token = cfg.Password
+		srv.grpc.tenants = cfg.Tenants
+		srv.grpc.metrics = &srv.metrics
+	}
+	return srv
+}
+
+// listen listens on a Config address.
+func (srv *Server) listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return ListenUnix(path, srv.cfg.SocketPerm)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %q: %w", addr, err)
+	}
+	return l, nil
+}
+
+// Start listens on every enabled endpoint and serves them in the background
+// until ctx is cancelled or Shutdown is called. If an endpoint cannot listen,
+// none is started and the error is returned.
+func (srv *Server) Start(ctx context.Context) error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.started {
+		return errors.New("server already started")
+	}
+	if srv.resp == nil && srv.http == nil && srv.grpc == nil {
+		return errors.New("no endpoint configured")
+	}
+
+	var respL, httpL, grpcL net.Listener
+	for _, ep := range []struct {
+		enabled bool
+		addr    string
+		l       *net.Listener
+	}{
+		{srv.resp != nil, srv.cfg.RESPAddr, &respL},
+		{srv.http != nil, srv.cfg.HTTPAddr, &httpL},
+		{srv.grpc != nil, srv.cfg.GRPCAddr, &grpcL},
+	} {
+		if !ep.enabled {
+			continue
+		}
+		l, err := srv.listen(ep.addr)
+		if err != nil {
+			for _, l := range srv.listeners {
+				l.Close()
+			}
+			srv.listeners = nil
+			return err
+		}
+		*ep.l = l
+		srv.listeners = append(srv.listeners, l)
+	}
+	srv.started = true
+
+	if respL != nil {
+		srv.serve(func() error {
+			err := srv.resp.Serve(respL)
+			if errors.Is(err, net.ErrClosed) {
+				respL.Close() // Shut down before Serve took the listener
+				return nil
+			}
+			return err
+		})
+	}
+	if httpL != nil {
+		srv.serve(func() error {
+			if err := srv.httpSrv.Serve(httpL); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		})
+	}
+	if grpcL != nil {
+		srv.serve(func() error { return srv.grpc.Serve(grpcL) })
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			srv.Shutdown(context.Background())
+		case <-srv.done:
+		}
+	}()
+	return nil
+}
+
+// serve runs an endpoint, recording its failure and stopping the others.
+func (srv *Server) serve(run func() error) {
+	srv.wg.Add(1)
+	go func() {
+		defer srv.wg.Done()
+		if err := run(); err != nil {
+			select {
+			case srv.errs <- err:
+			default:
+			}
+			go srv.Shutdown(context.Background())
+		}
+	}()
+}
+
+// Addrs returns the addresses the endpoints listen on, in the order RESP,
+// HTTP, gRPC, e.g. to find the ports chosen for ":0". It is empty before
+// Start.
+func (srv *Server) Addrs() []net.Addr {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	addrs := make([]net.Addr, len(srv.listeners))
+	for i, l := range srv.listeners {
+		addrs[i] = l.Addr()
+	}
+	return addrs
+}
+
+// Stats returns a snapshot of the counters of all endpoints.
+func (srv *Server) Stats() Stats {
+	return Stats{
+		Connections:  srv.metrics.connections.Load(),
+		Commands:     srv.metrics.commands.Load(),
+		Requests:     srv.metrics.requests.Load(),
+		AuthFailures: srv.metrics.authFailures.Load(),
+		Tenants:      srv.cfg.Tenants.Stats(),
+	}
+}
+
+// Shutdown stops the endpoints: listeners close first, then HTTP requests
+// in flight get until ctx is done or Config.ShutdownTimeout to complete,
+// while RESP connections, watch WebSockets and gRPC streams are closed. It waits for the
+// endpoints to return and can be called more than once.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.stopOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(ctx, srv.cfg.ShutdownTimeout)
+		defer cancel()
+		var errs []error
+		if srv.httpSrv != nil {
+			if err := srv.httpSrv.Shutdown(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("failed to shut down HTTP endpoint: %w", err))
+				srv.httpSrv.Close()
+			}
+		}
+		if srv.resp != nil {
+			if err := srv.resp.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to close RESP endpoint: %w", err))
+			}
+		}
+		if srv.grpc != nil {
+			srv.grpc.Close()
+		}
+		srv.wg.Wait()
+		srv.stopErr = errors.Join(errs...)
+		close(srv.done)
+	})
+	<-srv.done
+	return srv.stopErr
+}
+
+// Wait blocks until the started server has stopped, returning the error
+// that made an endpoint fail, if any, or else that of the shutdown.
+func (srv *Server) Wait() error {
+	<-srv.done
+	select {
+	case err := <-srv.errs:
+		return err
+	default:
+		return srv.stopErr
+	}
+}
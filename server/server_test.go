@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/hootrhino/microkvstore/mkvstoretest"
+	"github.com/hootrhino/microkvstore/server/watchpb"
+)
+
+// TestServer tests running RESP on TCP and HTTP on a Unix socket behind a
+// shared password, and shutting both down by cancelling the context.
+func TestServer(t *testing.T) {
+	store := mkvstoretest.New(t)
+	sock := filepath.Join(t.TempDir(), "http.sock")
+	srv := New(store, Config{RESPAddr: "127.0.0.1:0", HTTPAddr: "unix:" + sock, Password: "secret"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := srv.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := srv.Start(ctx); err == nil {
+		t.Error("Expected a second Start to fail")
+	}
+	addrs := srv.Addrs()
+	if len(addrs) != 2 {
+		t.Fatalf("Expected 2 addresses, got %v", addrs)
+	}
+
+	c := dialRESP(t, addrs[0].String())
+	if got := c.do("GET", "k"); !strings.HasPrefix(got, "NOAUTH") {
+		t.Errorf("GET before AUTH = %q", got)
+	}
+	if got := c.do("AUTH", "wrong"); !strings.HasPrefix(got, "WRONGPASS") {
+		t.Errorf("AUTH with a wrong password = %q", got)
+	}
+	if got := c.do("HELLO", "3", "AUTH", "default", "secret"); !strings.Contains(got, "proto 3") {
+		t.Errorf("HELLO AUTH = %q", got)
+	}
+	if got := c.do("SET", "k", "v"); got != "OK" {
+		t.Errorf("SET after AUTH = %q", got)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	get := func(token string) int {
+		req, _ := http.NewRequest(http.MethodGet, "http://kv/v1/keys/k", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := get(""); code != http.StatusUnauthorized {
+		t.Errorf("GET without a token = %d", code)
+	}
+	if code := get("secret"); code != http.StatusOK {
+		t.Errorf("GET with the token = %d", code)
+	}
+	client.CloseIdleConnections()
+
+	stats := srv.Stats()
+	if stats.Connections != 1 || stats.Commands != 4 || stats.Requests != 2 || stats.AuthFailures != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	cancel()
+	waited := make(chan error, 1)
+	go func() { waited <- srv.Wait() }()
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Errorf("Wait returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not stop after the context was cancelled")
+	}
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Errorf("Expected the socket to be removed, got %v", err)
+	}
+	c.nc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := bufio.NewReader(c.nc).ReadByte(); err == nil {
+		t.Error("Expected the RESP connection to be closed")
+	}
+}
+
+// TestServerDebug tests that Config.Debug and Config.Pprof mount the debug
+// pages on the HTTP endpoint behind the password.
+func TestServerDebug(t *testing.T) {
+	store := mkvstoretest.New(t)
+	get := func(cfg Config, path, token string) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		New(store, cfg).http.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := get(Config{HTTPAddr: ":0"}, "/debug/store", ""); code != http.StatusNotFound {
+		t.Errorf("/debug/store without Debug = %d", code)
+	}
+	debug := Config{HTTPAddr: ":0", Password: "secret", Debug: true}
+	if code := get(debug, "/debug/store", ""); code != http.StatusUnauthorized {
+		t.Errorf("/debug/store without the token = %d", code)
+	}
+	if code := get(debug, "/debug/store", "secret"); code != http.StatusOK {
+		t.Errorf("/debug/store = %d", code)
+	}
+	if code := get(debug, "/debug/pprof/", "secret"); code != http.StatusNotFound {
+		t.Errorf("/debug/pprof/ without Pprof = %d", code)
+	}
+	debug.Pprof = true
+	if code := get(debug, "/debug/pprof/", "secret"); code != http.StatusOK {
+		t.Errorf("/debug/pprof/ = %d", code)
+	}
+	if code := get(debug, "/debug/store", "secret"); code != http.StatusOK {
+		t.Errorf("/debug/store with Pprof = %d", code)
+	}
+}
+
+// TestServerGRPC tests serving watches on Config.GRPCAddr behind the
+// password, and ending their streams on shutdown.
+func TestServerGRPC(t *testing.T) {
+	store := mkvstoretest.New(t)
+	srv := New(store, Config{GRPCAddr: "127.0.0.1:0", Password: "secret"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := srv.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	addrs := srv.Addrs()
+	if len(addrs) != 1 {
+		t.Fatalf("Expected 1 address, got %v", addrs)
+	}
+	conn, err := grpc.NewClient(addrs[0].String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer conn.Close()
+	client := watchpb.NewWatchClient(conn)
+
+	stream, err := client.Watch(ctx, &watchpb.WatchRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected a watch without the token to fail, got %v", err)
+	}
+	authCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+	stream = openWatch(t, authCtx, client, &watchpb.WatchRequest{Pattern: "k"})
+	store.Set("k", "v", 0)
+	if ev, err := stream.Recv(); err != nil || ev.Key != "k" || ev.Op != "set" {
+		t.Errorf("Unexpected event %v, %v", ev, err)
+	}
+	if stats := srv.Stats(); stats.Requests != 2 || stats.AuthFailures != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+	if _, err := stream.Recv(); err == nil {
+		t.Error("Expected the stream to end on shutdown")
+	}
+}
@@ -0,0 +1,193 @@
+// Package server exposes mkvstore stores to other processes. RESP serves a
+// store over the Redis protocol, with client-side caching, and HTTP over a
+// JSON API, on TCP or, with ListenUnix, on a Unix socket. Server runs both
+// as one unit with a shared password. Tenants maps clients to isolated
+// namespaces, each stored in its own table of a shared database.
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+)
+
+// errCommandFailed is observed for the commands and requests of a tenant
+// that were answered with an error.
+var errCommandFailed = errors.New("command failed")
+
+// Tenant is an isolated namespace served from its own table.
+type Tenant struct {
+	Name       string          // Table name, also the URL path prefix
+	Index      int             // RESP SELECT index, or -1 if not selectable
+	Credential string          // AUTH password or bearer token, or empty
+	Store      *mkvstore.Store // Store for the tenant's table
+
+	commands   atomic.Uint64
+	errors     atomic.Uint64
+	lastAccess atomic.Int64 // Unix nanoseconds
+}
+
+// TenantStats is a snapshot of a tenant's request counters.
+type TenantStats struct {
+	Name       string
+	Commands   uint64    // Commands served
+	Errors     uint64    // Commands that failed
+	LastAccess time.Time // Zero if never accessed
+}
+
+// Observe records a command served for the tenant and whether it failed.
+// Protocol handlers call it once per command.
+func (t *Tenant) Observe(err error) {
+	t.commands.Add(1)
+	if err != nil {
+		t.errors.Add(1)
+	}
+	t.lastAccess.Store(time.Now().UnixNano())
+}
+
+// Stats returns a snapshot of the tenant's counters.
+func (t *Tenant) Stats() TenantStats {
+	stats := TenantStats{Name: t.Name, Commands: t.commands.Load(), Errors: t.errors.Load()}
+	if ns := t.lastAccess.Load(); ns != 0 {
+		stats.LastAccess = time.Unix(0, ns)
+	}
+	return stats
+}
+
+// Tenants routes clients to tenants by RESP SELECT index, URL path prefix or
+// credential. All tenants share the connection pool of the base Store. A nil
+// *Tenants has no tenants.
+type Tenants struct {
+	base *mkvstore.Store
+
+	mu           sync.RWMutex
+	byName       map[string]*Tenant
+	byIndex      map[int]*Tenant
+	byCredential map[string]*Tenant
+}
+
+// NewTenants returns an empty tenant registry whose tables live in the
+// database of base.
+func NewTenants(base *mkvstore.Store) *Tenants {
+	return &Tenants{
+		base:         base,
+		byName:       make(map[string]*Tenant),
+		byIndex:      make(map[int]*Tenant),
+		byCredential: make(map[string]*Tenant),
+	}
+}
+
+// Add registers a tenant stored in table name, creating the table if needed.
+// index is the RESP SELECT index of the tenant, or -1 to make it reachable
+// only by path or credential. An empty credential does not identify the
+// tenant. Names, indexes and credentials must be unique.
+func (ts *Tenants) Add(name string, index int, credential string) (*Tenant, error) {
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid tenant name %q", name)
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if _, ok := ts.byName[name]; ok {
+		return nil, fmt.Errorf("tenant %q already exists", name)
+	}
+	if other, ok := ts.byIndex[index]; ok && index >= 0 {
+		return nil, fmt.Errorf("index %d already belongs to tenant %q", index, other.Name)
+	}
+	if other, ok := ts.byCredential[credential]; ok && credential != "" {
+		return nil, fmt.Errorf("credential of tenant %q already belongs to tenant %q", name, other.Name)
+	}
+
+	store, err := ts.base.Table(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open table of tenant %q: %w", name, err)
+	}
+	t := &Tenant{Name: name, Index: index, Credential: credential, Store: store}
+	ts.byName[name] = t
+	if index >= 0 {
+		ts.byIndex[index] = t
+	}
+	if credential != "" {
+		ts.byCredential[credential] = t
+	}
+	return t, nil
+}
+
+// ByName returns the tenant stored in table name.
+func (ts *Tenants) ByName(name string) (*Tenant, bool) {
+	if ts == nil {
+		return nil, false
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	t, ok := ts.byName[name]
+	return t, ok
+}
+
+// ByIndex returns the tenant selected by a RESP SELECT index.
+func (ts *Tenants) ByIndex(index int) (*Tenant, bool) {
+	if ts == nil {
+		return nil, false
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	t, ok := ts.byIndex[index]
+	return t, ok
+}
+
+// ByCredential returns the tenant identified by an AUTH password or bearer token.
+func (ts *Tenants) ByCredential(credential string) (*Tenant, bool) {
+	if ts == nil || credential == "" {
+		return nil, false
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	t, ok := ts.byCredential[credential]
+	return t, ok
+}
+
+// ByPath returns the tenant named by the first segment of an HTTP request
+// path, together with the rest of the path, e.g. "/sensors/v1/keys/a"
+// routes to tenant "sensors" with rest "/v1/keys/a".
+func (ts *Tenants) ByPath(path string) (t *Tenant, rest string, ok bool) {
+	name, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if t, ok = ts.ByName(name); !ok {
+		return nil, "", false
+	}
+	return t, "/" + rest, true
+}
+
+// Stats returns a snapshot of every tenant's counters, ordered by name.
+func (ts *Tenants) Stats() []TenantStats {
+	if ts == nil {
+		return nil
+	}
+	ts.mu.RLock()
+	stats := make([]TenantStats, 0, len(ts.byName))
+	for _, t := range ts.byName {
+		stats = append(stats, t.Stats())
+	}
+	ts.mu.RUnlock()
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// Close closes the stores of all tenants. The base Store stays open.
+func (ts *Tenants) Close() error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	var errs []error
+	for _, t := range ts.byName {
+		if err := t.Store.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close tenant %q: %w", t.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+	"github.com/hootrhino/microkvstore/mkvstoretest"
+)
+
+// TestTenantsRouting tests routing by index, path and credential, and that
+// tenants are isolated from each other.
+func TestTenantsRouting(t *testing.T) {
+	tenants := NewTenants(mkvstoretest.New(t))
+	defer tenants.Close()
+
+	sensors, err := tenants.Add("sensors", 0, "s3cret")
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	config, err := tenants.Add("config", 1, "")
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if _, err := tenants.Add("other", 1, ""); err == nil {
+		t.Error("Expected an error adding a duplicate index")
+	}
+
+	if got, ok := tenants.ByIndex(1); !ok || got != config {
+		t.Errorf("ByIndex(1) = %v, %v; expected config", got, ok)
+	}
+	if got, ok := tenants.ByCredential("s3cret"); !ok || got != sensors {
+		t.Errorf("ByCredential = %v, %v; expected sensors", got, ok)
+	}
+	if _, ok := tenants.ByCredential(""); ok {
+		t.Error("Expected an empty credential not to match")
+	}
+	if got, rest, ok := tenants.ByPath("/sensors/v1/keys/a"); !ok || got != sensors || rest != "/v1/keys/a" {
+		t.Errorf("ByPath = %v, %q, %v; expected sensors and /v1/keys/a", got, rest, ok)
+	}
+	if _, _, ok := tenants.ByPath("/missing/v1/keys"); ok {
+		t.Error("Expected an unknown path not to match")
+	}
+
+	sensors.Store.Set("k", "sensor", 0)
+	if _, err := config.Store.Get("k"); !errors.Is(err, mkvstore.ErrKeyNotFound) {
+		t.Errorf("Expected tenants to be isolated, got %v", err)
+	}
+
+	sensors.Observe(nil)
+	sensors.Observe(errors.New("failed"))
+	stats := tenants.Stats()
+	if len(stats) != 2 || stats[1].Name != "sensors" || stats[1].Commands != 2 || stats[1].Errors != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if stats[0].Commands != 0 || !stats[0].LastAccess.IsZero() {
+		t.Errorf("Expected no activity for config, got %+v", stats[0])
+	}
+}
+
+// startTenants starts a Server for store with tenants "sensors", on index 1
+// with credential s3cret, and "config", on index 2 without credential.
+func startTenants(t *testing.T, store *mkvstore.Store, cfg Config) (*Server, *Tenants) {
+	t.Helper()
+	tenants := NewTenants(store)
+	t.Cleanup(func() { tenants.Close() })
+	if _, err := tenants.Add("sensors", 1, "s3cret"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if _, err := tenants.Add("config", 2, ""); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	cfg.Tenants = tenants
+	srv := New(store, cfg)
+	if cfg.RESPAddr != "" {
+		if err := srv.Start(context.Background()); err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	}
+	return srv, tenants
+}
+
+// TestRESPTenantSelect tests switching between the server's store and the
+// tenants with SELECT, and the per-tenant counters.
+func TestRESPTenantSelect(t *testing.T) {
+	store := mkvstoretest.New(t)
+	srv, _ := startTenants(t, store, Config{RESPAddr: "127.0.0.1:0"})
+	c := dialRESP(t, srv.Addrs()[0].String())
+
+	c.do("SET", "k", "base")
+	if got := c.do("SELECT", "2"); got != "OK" {
+		t.Fatalf("SELECT 2 = %q", got)
+	}
+	if got := c.do("GET", "k"); got != "nil" {
+		t.Errorf("GET in tenant config = %q, expected the tenants to be isolated", got)
+	}
+	c.do("SET", "k", "cfg")
+	if got := c.do("SELECT", "9"); !strings.HasPrefix(got, "ERR DB index is out of range") {
+		t.Errorf("SELECT of an unknown index = %q", got)
+	}
+	if got := c.do("SELECT", "1"); !strings.HasPrefix(got, "NOPERM") {
+		t.Errorf("SELECT of a tenant with a credential = %q", got)
+	}
+	if got := c.do("SELECT", "0"); got != "OK" {
+		t.Fatalf("SELECT 0 = %q", got)
+	}
+	if got := c.do("GET", "k"); got != "base" {
+		t.Errorf("GET after SELECT 0 = %q", got)
+	}
+	if got := c.do("SELECT", "one"); !strings.HasPrefix(got, "ERR") {
+		t.Errorf("SELECT of a non-integer = %q", got)
+	}
+
+	stats := srv.Stats().Tenants
+	if len(stats) != 2 || stats[0].Name != "config" || stats[0].Commands != 5 || stats[0].Errors != 2 {
+		t.Errorf("Unexpected tenant stats %+v", stats)
+	}
+	if stats[1].Commands != 0 {
+		t.Errorf("Expected no commands on sensors, got %+v", stats[1])
+	}
+}
+
+// TestRESPTenantCredentials tests that AUTH with the credential of a tenant
+// binds the connection to it, while the server's password reaches every
+// tenant.
+func TestRESPTenantCredentials(t *testing.T) {
+	store := mkvstoretest.New(t)
+	srv, tenants := startTenants(t, store, Config{RESPAddr: "127.0.0.1:0", Password: "admin"})
+	sensors, _ := tenants.ByName("sensors")
+	sensors.Store.Set("k", "sensor", 0)
+	addr := srv.Addrs()[0].String()
+
+	tenant := dialRESP(t, addr)
+	if got := tenant.do("GET", "k"); !strings.HasPrefix(got, "NOAUTH") {
+		t.Errorf("GET before AUTH = %q", got)
+	}
+	if got := tenant.do("AUTH", "s3cret"); got != "OK" {
+		t.Fatalf("AUTH with the tenant credential = %q", got)
+	}
+	if got := tenant.do("GET", "k"); got != "sensor" {
+		t.Errorf("GET after AUTH = %q, expected the tenant's value", got)
+	}
+	if got := tenant.do("SELECT", "0"); !strings.HasPrefix(got, "NOPERM") {
+		t.Errorf("SELECT out of the bound tenant = %q", got)
+	}
+	if got := tenant.do("SELECT", "1"); got != "OK" {
+		t.Errorf("SELECT of the bound tenant = %q", got)
+	}
+	if got := tenant.do("CLIENT", "TRACKING", "ON"); !strings.HasPrefix(got, "ERR tenants do not support") {
+		t.Errorf("CLIENT TRACKING in a tenant = %q", got)
+	}
+
+	admin := dialRESP(t, addr)
+	if got := admin.do("AUTH", "wrong"); !strings.HasPrefix(got, "WRONGPASS") {
+		t.Errorf("AUTH with a wrong password = %q", got)
+	}
+	admin.do("AUTH", "admin")
+	if got := admin.do("GET", "k"); got != "nil" {
+		t.Errorf("GET in the server's store = %q", got)
+	}
+	if got := admin.do("SELECT", "1"); got != "OK" {
+		t.Fatalf("SELECT with the server's password = %q", got)
+	}
+	if got := admin.do("GET", "k"); got != "sensor" {
+		t.Errorf("GET after SELECT 1 = %q", got)
+	}
+}
+
+// TestHTTPTenants tests routing HTTP requests to tenants by path prefix and
+// by bearer token, and the per-tenant counters.
+func TestHTTPTenants(t *testing.T) {
+	store := mkvstoretest.New(t)
+	srv, tenants := startTenants(t, store, Config{HTTPAddr: ":0", Password: "admin"})
+	sensors, _ := tenants.ByName("sensors")
+	config, _ := tenants.ByName("config")
+	store.Set("k", "base", 0)
+	sensors.Store.Set("k", "sensor", 0)
+	config.Store.Set("k", "cfg", 0)
+
+	get := func(path, token string) (int, string) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		srv.http.ServeHTTP(rec, req)
+		var item keyItem
+		if json.Unmarshal(rec.Body.Bytes(), &item) == nil && item.Value != nil {
+			return rec.Code, *item.Value
+		}
+		return rec.Code, ""
+	}
+
+	for _, tc := range []struct {
+		path, token string
+		code        int
+		value       string
+	}{
+		{"/v1/keys/k", "admin", http.StatusOK, "base"},
+		{"/config/v1/keys/k", "admin", http.StatusOK, "cfg"},
+		{"/sensors/v1/keys/k", "admin", http.StatusOK, "sensor"},
+		{"/v1/keys/k", "s3cret", http.StatusOK, "sensor"},
+		{"/sensors/v1/keys/k", "s3cret", http.StatusOK, "sensor"},
+		{"/sensors/v1/keys/missing", "s3cret", http.StatusNotFound, ""},
+		{"/config/v1/keys/k", "s3cret", http.StatusForbidden, ""},
+		{"/sensors/v1/keys/k", "", http.StatusUnauthorized, ""},
+		{"/sensors/v1/keys/k", "wrong", http.StatusUnauthorized, ""},
+	} {
+		if code, value := get(tc.path, tc.token); code != tc.code || value != tc.value {
+			t.Errorf("GET %s with %q = %d %q, expected %d %q", tc.path, tc.token, code, value, tc.code, tc.value)
+		}
+	}
+
+	stats := srv.Stats().Tenants
+	if len(stats) != 2 || stats[0].Commands != 1 || stats[1].Commands != 4 || stats[1].Errors != 1 {
+		t.Errorf("Unexpected tenant stats %+v", stats)
+	}
+}
@@ -0,0 +1,326 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+)
+
+// invalidateChannel is the channel RESP2 clients subscribe to on the
+// connection they REDIRECT invalidation messages to.
+const invalidateChannel = "__redis__:invalidate"
+
+// tracking implements client-side caching as Redis 6 does. In the default
+// mode the server remembers the keys each tracking client read and sends it
+// an invalidation message the first time one of them changes, after which
+// the key is forgotten until read again. In broadcasting mode (BCAST) clients
+// are told about every change of keys under their prefixes, without the
+// server remembering reads.
+//
+// Changes are learnt from a subscription to every key of the Store, so they
+// include writes made through the Store by the embedding process, not only by
+// RESP clients. Should the subscription drop events, every tracking client is
+// told to flush its whole cache. Only the keys of the server's store are
+// tracked, not those of tenants.
+type tracking struct {
+	srv *RESP
+
+	mu      sync.Mutex
+	clients map[int64]*tracker        // Tracking clients by ID
+	keys    map[string]map[int64]bool // Tracked keys and the clients who read them
+	sub     *mkvstore.Subscription    // Subscription to every key, while someone tracks
+	done    chan struct{}
+}
+
+// tracker holds the tracking settings of a client.
+type tracker struct {
+	redirect int64    // Client receiving the invalidations, or 0 for the client itself
+	bcast    bool     // Broadcasting mode
+	prefixes []string // Prefixes of keys broadcast, all keys if empty
+	keys     map[string]bool
+}
+
+// newTracking returns the tracking state of srv.
+func newTracking(srv *RESP) *tracking {
+	return &tracking{
+		srv:     srv,
+		clients: make(map[int64]*tracker),
+		keys:    make(map[string]map[int64]bool),
+	}
+}
+
+// clientTracking runs CLIENT TRACKING ON|OFF [REDIRECT id] [BCAST]
+// [PREFIX prefix ...] with c.wmu held. OPTIN, OPTOUT and NOLOOP are not
+// supported.
+func (c *respConn) clientTracking(args []string) {
+	if len(args) == 0 {
+		c.writeError("ERR wrong number of arguments for 'client|tracking' command")
+		return
+	}
+	var on bool
+	switch strings.ToUpper(args[0]) {
+	case "ON":
+		on = true
+	case "OFF":
+	default:
+		c.writeError("ERR syntax error")
+		return
+	}
+
+	t := &tracker{keys: make(map[string]bool)}
+	for i := 1; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "BCAST":
+			t.bcast = true
+		case "REDIRECT", "PREFIX":
+			if i+1 == len(args) {
+				c.writeError("ERR syntax error")
+				return
+			}
+			i++
+			if opt == "PREFIX" {
+				t.prefixes = append(t.prefixes, c.store.CanonicalKey(args[i]))
+				continue
+			}
+			id, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				c.writeError("ERR value is not an integer or out of range")
+				return
+			}
+			if _, ok := c.srv.conn(id); !ok || id == c.id {
+				c.writeError("ERR The client ID you want redirect to does not exist")
+				return
+			}
+			t.redirect = id
+		case "OPTIN", "OPTOUT", "NOLOOP":
+			c.writeError(fmt.Sprintf("ERR tracking option '%s' is not supported", args[i]))
+			return
+		default:
+			c.writeError("ERR syntax error")
+			return
+		}
+	}
+	if len(t.prefixes) > 0 && !t.bcast {
+		c.writeError("ERR PREFIX option requires BCAST mode to be enabled")
+		return
+	}
+
+	if on && c.tenant != nil {
+		c.writeError("ERR tenants do not support CLIENT TRACKING")
+		return
+	}
+	if on {
+		c.srv.tracking.start(c.id, t)
+	} else {
+		c.srv.tracking.forget(c.id)
+	}
+	writeSimple(c.w, "OK")
+}
+
+// start turns tracking on for client id with the settings of t, replacing
+// previous settings, and subscribes to the store's changes if needed.
+func (tr *tracking) start(id int64, t *tracker) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.forgetLocked(id)
+	tr.clients[id] = t
+	if tr.sub != nil {
+		return
+	}
+	tr.sub = tr.srv.store.Subscribe("*")
+	tr.done = make(chan struct{})
+	go tr.dispatch(tr.sub, tr.done)
+}
+
+// forget turns tracking off for client id, e.g. when it disconnects.
+func (tr *tracking) forget(id int64) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.forgetLocked(id)
+}
+
+func (tr *tracking) forgetLocked(id int64) {
+	t, ok := tr.clients[id]
+	if !ok {
+		return
+	}
+	for key := range t.keys {
+		delete(tr.keys[key], id)
+		if len(tr.keys[key]) == 0 {
+			delete(tr.keys, key)
+		}
+	}
+	delete(tr.clients, id)
+}
+
+// redirect returns the client receiving the invalidations of client id: 0
+// if it receives them itself and -1 if it is not tracking.
+func (tr *tracking) redirect(id int64) int64 {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	t, ok := tr.clients[id]
+	if !ok {
+		return -1
+	}
+	return t.redirect
+}
+
+// read records that client id read key, if it tracks in the default mode.
+// It is called before the read so a change in between is not missed.
+func (tr *tracking) read(id int64, key string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	t, ok := tr.clients[id]
+	if !ok || t.bcast {
+		return
+	}
+	t.keys[key] = true
+	if tr.keys[key] == nil {
+		tr.keys[key] = make(map[int64]bool)
+	}
+	tr.keys[key][id] = true
+}
+
+// trackRead records that c read key, unless it has selected a tenant, whose
+// keys are not tracked. The key is tracked in canonical form, as
+// invalidations name it.
+func (c *respConn) trackRead(key string) {
+	if c.tenant == nil {
+		c.srv.tracking.read(c.id, c.store.CanonicalKey(key))
+	}
+}
+
+// close stops delivering invalidations.
+func (tr *tracking) close() {
+	tr.mu.Lock()
+	sub, done := tr.sub, tr.done
+	tr.sub = nil
+	tr.mu.Unlock()
+	if sub != nil {
+		sub.Close()
+		<-done
+	}
+}
+
+// dispatch sends invalidation messages for the changes received on sub until
+// it is closed.
+func (tr *tracking) dispatch(sub *mkvstore.Subscription, done chan struct{}) {
+	defer close(done)
+	var seen uint64
+	for e := range sub.C {
+		if n := sub.Dropped(); n != seen {
+			seen = n
+			tr.flushAll()
+		}
+		tr.invalidate(e.Key)
+	}
+}
+
+// invalidate tells the clients tracking key that it changed.
+func (tr *tracking) invalidate(key string) {
+	tr.mu.Lock()
+	var targets []int64
+	for id, t := range tr.clients {
+		if t.bcast && matchesPrefix(key, t.prefixes) {
+			targets = append(targets, id)
+		}
+	}
+	for id := range tr.keys[key] {
+		targets = append(targets, id)
+		delete(tr.clients[id].keys, key)
+	}
+	delete(tr.keys, key)
+	tr.mu.Unlock()
+
+	for _, id := range targets {
+		tr.push(id, []string{key})
+	}
+}
+
+// flushAll tells every tracking client to drop its whole cache, with the
+// null invalidation message, after changes may have been missed.
+func (tr *tracking) flushAll() {
+	tr.mu.Lock()
+	targets := make([]int64, 0, len(tr.clients))
+	for id, t := range tr.clients {
+		targets = append(targets, id)
+		clear(t.keys)
+	}
+	clear(tr.keys)
+	tr.mu.Unlock()
+
+	for _, id := range targets {
+		tr.push(id, nil)
+	}
+}
+
+// push sends an invalidation message for keys, nil meaning all keys, to
+// client id or the client it redirects to. RESP3 clients get a push message,
+// RESP2 clients a message on the invalidation channel. Messages to clients
+// neither on RESP3 nor subscribed are dropped, as Redis does.
+func (tr *tracking) push(id int64, keys []string) {
+	tr.mu.Lock()
+	t, ok := tr.clients[id]
+	target := id
+	if ok && t.redirect != 0 {
+		target = t.redirect
+	}
+	tr.mu.Unlock()
+	if !ok {
+		return
+	}
+	c, ok := tr.srv.conn(target)
+	if !ok {
+		return
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	switch {
+	case c.proto == 3 && !c.subscribed:
+		writePushHeader(c.w, 3, 2)
+		writeBulk(c.w, "invalidate")
+	case c.subscribed:
+		writePushHeader(c.w, c.proto, 3)
+		writeBulk(c.w, "message")
+		writeBulk(c.w, invalidateChannel)
+	default:
+		return
+	}
+	writeKeys(c.w, c.proto, keys)
+	c.w.Flush()
+}
+
+// writeKeys writes keys as an array, or nil as a null.
+func writeKeys(w *bufio.Writer, proto int, keys []string) {
+	if keys == nil {
+		if proto == 3 {
+			writeNull(w, proto)
+		} else {
+			w.WriteString("*-1\r\n")
+		}
+		return
+	}
+	writeArrayHeader(w, len(keys))
+	for _, key := range keys {
+		writeBulk(w, key)
+	}
+}
+
+// matchesPrefix reports whether key starts with one of prefixes, or whether
+// there are none.
+func matchesPrefix(key string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"time"
+)
+
+// unixListener removes its socket file when closed.
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	if rerr := os.Remove(l.path); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) {
+		err = errors.Join(err, rerr)
+	}
+	return err
+}
+
+// ListenUnix listens on a Unix domain socket at path for RESP.Serve or
+// http.Serve, with file permissions perm (e.g. 0660 to admit the socket's
+// group) as the access control, so co-located processes can reach a store
+// without opening a TCP port. The socket only appears at path once perm is
+// applied, so it is never reachable with looser permissions. A stale socket
+// left at path by a crashed server is replaced, while one still accepting
+// connections is an error. Closing the listener removes the socket.
+func ListenUnix(path string, perm fs.FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	// Bind under a temporary name and rename once the mode is set, as the
+	// umask decides the mode of a new socket
+	tmp := fmt.Sprintf("%s.%d", path, os.Getpid())
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on unix socket %q: %w", path, err)
+	}
+	l.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, perm); err != nil {
+		l.Close()
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to set permissions of unix socket %q: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		l.Close()
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to create unix socket %q: %w", path, err)
+	}
+	return &unixListener{UnixListener: l, path: path}, nil
+}
+
+// removeStaleSocket removes the socket at path unless a server accepts
+// connections on it. Other files are left alone.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat unix socket %q: %w", path, err)
+	}
+	if fi.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("failed to listen on unix socket %q: file exists and is not a socket", path)
+	}
+	if nc, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		nc.Close()
+		return fmt.Errorf("failed to listen on unix socket %q: address in use", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale unix socket %q: %w", path, err)
+	}
+	return nil
+}
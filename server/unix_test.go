@@ -0,0 +1,102 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hootrhino/microkvstore/mkvstoretest"
+)
+
+// TestListenUnix tests serving RESP and HTTP on Unix sockets with the
+// requested permissions, and the cleanup of socket files.
+func TestListenUnix(t *testing.T) {
+	store := mkvstoretest.New(t)
+	dir := t.TempDir()
+	respPath, httpPath := filepath.Join(dir, "resp.sock"), filepath.Join(dir, "http.sock")
+
+	l, err := ListenUnix(respPath, 0600)
+	if err != nil {
+		t.Fatalf("ListenUnix failed: %v", err)
+	}
+	fi, err := os.Stat(respPath)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if fi.Mode().Type() != fs.ModeSocket || fi.Mode().Perm() != 0600 {
+		t.Errorf("Socket mode = %v, expected a socket with 0600", fi.Mode())
+	}
+	if _, err := ListenUnix(respPath, 0600); err == nil {
+		t.Error("Expected listening on a socket in use to fail")
+	}
+
+	srv := NewRESP(store)
+	go srv.Serve(l)
+	defer srv.Close()
+	nc, err := net.Dial("unix", respPath)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	c := &respClient{t: t, nc: nc, r: bufio.NewReader(nc)}
+	if got := c.do("SET", "k", "v"); got != "OK" {
+		t.Errorf("SET over the unix socket = %q", got)
+	}
+	nc.Close()
+
+	hl, err := ListenUnix(httpPath, 0660)
+	if err != nil {
+		t.Fatalf("ListenUnix failed: %v", err)
+	}
+	hs := &http.Server{Handler: NewHTTP(store)}
+	go hs.Serve(hl)
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", httpPath)
+		},
+	}}
+	resp, err := client.Get("http://kv/v1/keys/k")
+	if err != nil {
+		t.Fatalf("GET over the unix socket failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET over the unix socket = %d", resp.StatusCode)
+	}
+	client.CloseIdleConnections()
+	hs.Close()
+	if _, err := os.Stat(httpPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the socket to be removed on close, got %v", err)
+	}
+}
+
+// TestListenUnixStale tests replacing a socket left by a crashed server while
+// refusing to replace other files.
+func TestListenUnixStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.sock")
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close() // Leaves the socket file behind, as a crash would
+
+	l, err := ListenUnix(path, 0600)
+	if err != nil {
+		t.Fatalf("Expected the stale socket to be replaced, got %v", err)
+	}
+	l.Close()
+
+	file := filepath.Join(t.TempDir(), "data")
+	os.WriteFile(file, []byte("keep"), 0644)
+	if _, err := ListenUnix(file, 0600); err == nil {
+		t.Error("Expected listening over a regular file to fail")
+	}
+	if data, _ := os.ReadFile(file); string(data) != "keep" {
+		t.Error("Regular file was modified")
+	}
+}
@@ -0,0 +1,340 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+)
+
+const (
+	watchBatch        = 256              // Change log entries read per query
+	watchPollInterval = time.Second      // How often the change log is read without local events
+	wsWriteTimeout    = 10 * time.Second // Longest a client may stall a frame
+	wsMaxMessage      = 64 << 10         // Largest message accepted from clients
+)
+
+// wsGUID is appended to the client key to compute Sec-WebSocket-Accept.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes and close codes used by /v1/watch.
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xA
+
+	wsCloseNormal    = 1000
+	wsCloseGoingAway = 1001
+	wsCloseTooBig    = 1009
+	wsCloseInternal  = 1011
+)
+
+// watchEvent is a message of /v1/watch. Seq is the change log sequence, left
+// out when the store has no change log.
+type watchEvent struct {
+	Seq  int64     `json:"seq,omitempty"`
+	Key  string    `json:"key"`
+	Op   string    `json:"op"`
+	Time time.Time `json:"time"`
+}
+
+// watch streams the changes of keys matching the pattern query parameter
+// (default "*") over a WebSocket, one JSON watchEvent per text message.
+//
+// With a change log (mkvstore.WithChangeLog) events come from the log, so
+// they carry a sequence number and include changes made by other processes.
+// A client that reconnects passes the seq of the last event it saw as the
+// since query parameter to receive the changes it missed; entries already
+// trimmed from the log are lost. Without a change log, events come from
+// Store.Subscribe, since is rejected, and the connection is closed if the
+// client falls behind and events are dropped, so it knows to reload.
+func (h *HTTP) watch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pattern := q.Get("pattern")
+	if pattern == "" {
+		pattern = "*"
+	}
+	store := h.storeOf(r)
+	seq, err := store.ChangeSeq()
+	changeLog := err == nil
+	if err != nil && !errors.Is(err, mkvstore.ErrChangeLogDisabled) {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if s := q.Get("since"); s != "" {
+		since, err := strconv.ParseInt(s, 10, 64)
+		switch {
+		case err != nil || since < 0:
+			writeJSONError(w, http.StatusBadRequest, "since must be a change sequence")
+			return
+		case !changeLog:
+			writeJSONError(w, http.StatusBadRequest, "resuming needs the change log")
+			return
+		}
+		seq = since
+	}
+
+	// Subscribe before upgrading so no change is missed in between
+	sub := store.Subscribe(pattern)
+	defer sub.Close()
+	ws, ok := upgradeWebSocket(w, r)
+	if !ok {
+		return
+	}
+	defer ws.nc.Close()
+	h.mu.Lock()
+	h.watches[ws] = struct{}{}
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.watches, ws)
+		h.mu.Unlock()
+	}()
+	go ws.readLoop()
+
+	send := func(ev watchEvent) error { return ws.writeJSON(ev) }
+	if changeLog {
+		err = watchChangeLog(store, sub, pattern, seq, send, ws.done)
+	} else {
+		err = watchEvents(sub, send, ws.done)
+	}
+	switch {
+	case errors.Is(err, errChangeLogRead):
+		ws.close(wsCloseInternal, "failed to read change log")
+	case errors.Is(err, errEventsDropped):
+		ws.close(wsCloseInternal, "events dropped")
+	}
+}
+
+// Errors ending a watch, besides those of sending events.
+var (
+	errChangeLogRead = errors.New("failed to read change log")
+	errEventsDropped = errors.New("events dropped")
+)
+
+// watchChangeLog sends the change log after seq, reading it again after each
+// local event and every watchPollInterval, until send fails or done is
+// closed.
+func watchChangeLog(store *mkvstore.Store, sub *mkvstore.Subscription, pattern string, seq int64, send func(watchEvent) error, done <-chan struct{}) error {
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			changes, err := store.ChangesSince(seq, pattern, watchBatch)
+			if err != nil {
+				return fmt.Errorf("%w: %w", errChangeLogRead, err)
+			}
+			for _, c := range changes {
+				if err := send(watchEvent{Seq: c.Seq, Key: c.Key, Op: c.Op, Time: c.Time}); err != nil {
+					return err
+				}
+				seq = c.Seq
+			}
+			if len(changes) < watchBatch {
+				break
+			}
+		}
+
+		select {
+		case <-sub.C:
+			// One read covers every event already queued
+			for len(sub.C) > 0 {
+				<-sub.C
+			}
+		case <-ticker.C:
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// watchEvents sends the events of sub until send fails, events are dropped
+// or done is closed.
+func watchEvents(sub *mkvstore.Subscription, send func(watchEvent) error, done <-chan struct{}) error {
+	for {
+		select {
+		case ev := <-sub.C:
+			if sub.Dropped() > 0 {
+				return errEventsDropped
+			}
+			if err := send(watchEvent{Key: ev.Key, Op: ev.Op, Time: ev.Time}); err != nil {
+				return err
+			}
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// wsConn is the server side of a WebSocket connection (RFC 6455) that only
+// sends messages, answering the control frames of the client.
+type wsConn struct {
+	nc   net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex    // Serializes frames
+	done chan struct{} // Closed when the client is gone
+}
+
+// upgradeWebSocket completes the opening handshake of a WebSocket, replying
+// with an error and returning false if r is not one.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, bool) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") || key == "" {
+		writeJSONError(w, http.StatusBadRequest, "expected a WebSocket handshake")
+		return nil, false
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeJSONError(w, http.StatusUpgradeRequired, "unsupported WebSocket version")
+		return nil, false
+	}
+
+	nc, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "connection cannot be upgraded")
+		return nil, false
+	}
+	sum := sha1.Sum([]byte(key + wsGUID))
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := brw.Flush(); err != nil {
+		nc.Close()
+		return nil, false
+	}
+	return &wsConn{nc: nc, r: brw.Reader, done: make(chan struct{})}, true
+}
+
+// headerHasToken reports whether the comma-separated header name contains
+// token, ignoring case.
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, v := range header.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeFrame sends a final, unmasked frame.
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | op
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	c.nc.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := (&net.Buffers{header, payload}).WriteTo(c.nc)
+	return err
+}
+
+// writeJSON sends v as a text message.
+func (c *wsConn) writeJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(wsText, data)
+}
+
+// close sends a close frame with code and reason. The connection itself is
+// closed by the handler once it returns.
+func (c *wsConn) close(code uint16, reason string) {
+	c.writeFrame(wsClose, append(binary.BigEndian.AppendUint16(nil, code), reason...))
+}
+
+// readLoop reads the frames of the client until it closes the connection,
+// answering pings and discarding messages, then closes done.
+func (c *wsConn) readLoop() {
+	defer close(c.done)
+	for {
+		op, payload, err := c.readFrame()
+		if errors.Is(err, errMessageTooBig) {
+			c.close(wsCloseTooBig, "message too big")
+			return
+		}
+		if err != nil {
+			return
+		}
+		switch op {
+		case wsPing:
+			c.writeFrame(wsPong, payload)
+		case wsClose:
+			c.close(wsCloseNormal, "")
+			return
+		}
+	}
+}
+
+// errMessageTooBig is returned by readFrame for frames over wsMaxMessage.
+var errMessageTooBig = errors.New("websocket message too big")
+
+// readFrame reads a frame of the client, unmasking its payload.
+func (c *wsConn) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	op := head[0] & 0x0F
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxMessage {
+		return 0, nil, errMessageTooBig
+	}
+
+	var mask [4]byte
+	masked := head[1]&0x80 != 0
+	if masked {
+		if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return op, payload, nil
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mkvstore "github.com/hootrhino/microkvstore"
+	"github.com/hootrhino/microkvstore/mkvstoretest"
+)
+
+// dialWatch opens /v1/watch with query on srv and returns the reader of the
+// upgraded connection.
+func dialWatch(t *testing.T, srv *httptest.Server, query string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	nc, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	fmt.Fprintf(nc, "GET /v1/watch?%s HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n", query)
+
+	r := bufio.NewReader(nc)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("Failed to read handshake reply: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Handshake status = %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Sec-WebSocket-Accept = %q", got)
+	}
+	return nc, r
+}
+
+// readEvent reads the next message of a watch connection.
+func readEvent(t *testing.T, nc net.Conn, r *bufio.Reader) watchEvent {
+	t.Helper()
+	nc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	n := int(head[1] & 0x7F)
+	if n == 126 {
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("Failed to read payload: %v", err)
+	}
+	if op := head[0] & 0x0F; op != wsText {
+		t.Fatalf("Expected a text message, got opcode %d: %q", op, payload)
+	}
+	var ev watchEvent
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		t.Fatalf("Failed to decode event %q: %v", payload, err)
+	}
+	return ev
+}
+
+// TestHTTPWatchResume tests streaming the change log and resuming after the
+// last sequence seen.
+func TestHTTPWatchResume(t *testing.T) {
+	store := mkvstoretest.New(t, mkvstore.WithChangeLog())
+	srv := httptest.NewServer(NewHTTP(store))
+	defer srv.Close()
+
+	store.Set("cfg:a", "1", 0)
+	store.Set("other", "x", 0)
+	nc, r := dialWatch(t, srv, "pattern=cfg:*&since=0")
+	first := readEvent(t, nc, r)
+	if first.Key != "cfg:a" || first.Op != "set" || first.Seq == 0 {
+		t.Fatalf("Unexpected first event %+v", first)
+	}
+
+	store.Del("cfg:a")
+	if ev := readEvent(t, nc, r); ev.Key != "cfg:a" || ev.Op != "del" || ev.Seq <= first.Seq {
+		t.Fatalf("Unexpected live event %+v", ev)
+	}
+	nc.Close()
+
+	// A reconnecting client gets what followed the last event it saw
+	nc, r = dialWatch(t, srv, fmt.Sprintf("pattern=cfg:*&since=%d", first.Seq))
+	if ev := readEvent(t, nc, r); ev.Op != "del" {
+		t.Errorf("Expected the del after resuming, got %+v", ev)
+	}
+}
+
+// TestHTTPWatchLive tests streaming events from a store without a change log.
+func TestHTTPWatchLive(t *testing.T) {
+	store := mkvstoretest.New(t)
+	srv := httptest.NewServer(NewHTTP(store))
+	defer srv.Close()
+
+	var reply map[string]string
+	if code := getJSON(t, NewHTTP(store), "/v1/watch?since=1", &reply); code != http.StatusBadRequest {
+		t.Errorf("Expected resuming without a change log to fail, got %d", code)
+	}
+
+	nc, r := dialWatch(t, srv, "pattern=cfg:*")
+	store.Set("other", "x", 0)
+	store.Set("cfg:a", "1", 0)
+	if ev := readEvent(t, nc, r); ev.Key != "cfg:a" || ev.Op != "set" || ev.Seq != 0 {
+		t.Errorf("Unexpected event %+v", ev)
+	}
+}
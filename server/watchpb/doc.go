@@ -0,0 +1,5 @@
+// Package watchpb holds the gRPC Watch service served by server.GRPC,
+// generated from watch.proto.
+package watchpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative watch.proto
@@ -0,0 +1,109 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Session is a view of a Store that runs every operation on a single pinned
+// connection, with the same API as Store. Consecutive operations see each
+// other's effects and the connection's state, such as TEMP tables created
+// through Conn, which the pooled connections of a Store do not guarantee.
+//
+// Writes go straight to the connection, bypassing the write buffer of
+// WithFlashWearReduction and the writer of WithSerializedWrites. Background
+// routines, checkpointing and locking stay with the Store. Close the Session
+// to return its connection to the pool; use it from one goroutine at a time.
+type Session struct {
+	*Store
+}
+
+// Session pins a connection from the pool for a sequence of operations. ctx
+// bounds acquiring the connection and applies to the session's statements
+// until Close. Buffered writes are committed first, so the session sees them.
+func (s *Store) Session(ctx context.Context) (*Session, error) {
+	if s.opts.pinningRejected() {
+		return nil, fmt.Errorf("failed to reserve connection for table %q: %w", s.table, ErrSingleConnection)
+	}
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve connection for table %q: %w", s.table, err)
+	}
+
+	root := s
+	if s.parent != nil {
+		root = s.parent
+	}
+	sess := &Store{
+		db:      s.db,
+		conn:    conn,
+		path:    s.path,
+		table:   s.table,
+		opts:    s.opts,
+		notify:  s.notify, // Subscribers of the Store see the session's changes
+		metrics: s.metrics,
+		slowOps: s.slowOps,
+		codecs:  s.codecs,
+		hot:     s.hot,
+		keys:    s.keys,
+		expiry:  s.expiry,
+		ready:   s.ready,
+		parent:  root,
+	}
+	sess.ctx, sess.cancel = context.WithCancel(ctx)
+	return &Session{Store: sess}, nil
+}
+
+// Conn returns the pinned connection, e.g. to create TEMP tables or run
+// statements the Store API does not cover. Do not close it; call Close on
+// the Session instead.
+func (sess *Session) Conn() *sql.Conn {
+	return sess.conn
+}
+
+// Close returns the connection to the pool. The Store stays open.
+func (sess *Session) Close() error {
+	sess.cancel()
+	return sess.conn.Close()
+}
+
+// q returns the handle statements run on: the pinned connection of a
+// Session, otherwise the connection pool.
+func (s *Store) q() queryer {
+	if s.conn != nil {
+		return s.conn
+	}
+	return s.db
+}
+
+// queryCtx returns the context for reads: the session's context, so that
+// cancelling it interrupts them, or none for a Store.
+func (s *Store) queryCtx() context.Context {
+	if s.conn != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+// queryRow runs a query expected to return at most one row on q.
+func (s *Store) queryRow(query string, args ...interface{}) *sql.Row {
+	return s.q().QueryRowContext(s.queryCtx(), query, args...)
+}
+
+// query runs a query returning rows on q.
+func (s *Store) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.q().QueryContext(s.queryCtx(), query, args...)
+}
+
+// beginTx starts a transaction on the pinned connection of a Session,
+// otherwise on the connection pool.
+func (s *Store) beginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if s.conn != nil {
+		return s.conn.BeginTx(ctx, opts)
+	}
+	return s.db.BeginTx(ctx, opts)
+}
@@ -0,0 +1,51 @@
+package mkvstore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestSession tests operations on a pinned connection.
+func TestSession(t *testing.T) {
+	store, _ := setupFileStore(t)
+	sub := store.Subscribe("*")
+	defer sub.Close()
+
+	sess, err := store.Session(context.Background())
+	if err != nil {
+		t.Fatalf("Session failed: %v", err)
+	}
+	if err := sess.Set("k", "v", time.Minute); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if v, err := sess.Get("k"); err != nil || v != "v" {
+		t.Errorf("Get = %q, %v; expected %q", v, err, "v")
+	}
+	if _, err := sess.RPush("q", "a"); err != nil {
+		t.Fatalf("RPush failed: %v", err)
+	}
+
+	// TEMP tables live on the pinned connection for the whole session
+	ctx := context.Background()
+	if _, err := sess.Conn().ExecContext(ctx, `CREATE TEMP TABLE scratch (n INTEGER);`); err != nil {
+		t.Fatalf("Failed to create temp table: %v", err)
+	}
+	if _, err := sess.Conn().ExecContext(ctx, `INSERT INTO scratch VALUES (1);`); err != nil {
+		t.Errorf("Temp table not visible on the session connection: %v", err)
+	}
+
+	if ev := <-sub.C; ev.Key != "k" || ev.Op != "set" {
+		t.Errorf("Expected set event for k from the session, got %+v", ev)
+	}
+
+	if err := sess.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if v, err := store.Get("k"); err != nil || v != "v" {
+		t.Errorf("Store Get after session = %q, %v; expected %q", v, err, "v")
+	}
+	if _, err := sess.Get("k"); err == nil {
+		t.Error("Expected Get on a closed session to fail")
+	}
+}
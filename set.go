@@ -0,0 +1,270 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Sets are stored as a row of type 'set' in the store's table, carrying the
+// key's expiry and version, plus one row per member in <table>_set, whose
+// primary key keeps members unique. Members are stored as is, not through the
+// value codec, so that SQLite can compare them for SIsMember and the set
+// algebra.
+
+// setTableName returns the name of the table holding the members of sets in table.
+func setTableName(table string) string {
+	return table + "_set"
+}
+
+// quoteSetTable returns the set member table name safely quoted for SQL.
+func (s *Store) quoteSetTable() string {
+	return quoteIdent(setTableName(s.table))
+}
+
+// SAdd adds members to the set stored at key, creating the set if needed,
+// and returns the number of members that were not already in the set.
+// Returns ErrWrongType if key holds another type.
+func (s *Store) SAdd(key string, members ...string) (int, error) {
+	defer s.observe("sadd", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return 0, err
+	}
+	if len(members) == 0 {
+		return 0, fmt.Errorf("failed to add to set %q in table %q: no members", key, s.table)
+	}
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+
+	var added int
+	err := s.update(func(tx *sql.Tx) error {
+		if err := s.touchKey(tx, key, "set", s.now().Unix()); err != nil {
+			return err
+		}
+		saddSQL := fmt.Sprintf(`INSERT INTO %s (key, member) VALUES (?, ?) ON CONFLICT(key, member) DO NOTHING;`, s.quoteSetTable())
+		for _, member := range members {
+			result, err := tx.ExecContext(s.ctx, saddSQL, key, member)
+			if err != nil {
+				return fmt.Errorf("failed to add to set %q in table %q: %w", key, s.table, err)
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			added += int(n)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if added > 0 {
+		s.notify.publish(key, "sadd")
+	}
+	return added, nil
+}
+
+// SRem removes members from the set stored at key and returns the number of
+// members that were in the set. The set is deleted once its last member is
+// removed. Returns ErrWrongType if key holds another type.
+func (s *Store) SRem(key string, members ...string) (int, error) {
+	defer s.observe("srem", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return 0, err
+	}
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+	now := s.now().Unix()
+
+	var removed int
+	err := s.update(func(tx *sql.Tx) error {
+		if ok, err := s.liveKey(tx, key, "set", now); !ok {
+			return err
+		}
+		sremSQL := fmt.Sprintf(`DELETE FROM %s WHERE key = ? AND member = ?;`, s.quoteSetTable())
+		for _, member := range members {
+			result, err := tx.ExecContext(s.ctx, sremSQL, key, member)
+			if err != nil {
+				return fmt.Errorf("failed to remove from set %q in table %q: %w", key, s.table, err)
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			removed += int(n)
+		}
+		if removed == 0 {
+			return nil
+		}
+
+		// Drop the set with its last member, otherwise record the change on it
+		var n int
+		cardSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE key = ?;`, s.quoteSetTable())
+		if err := tx.QueryRowContext(s.ctx, cardSQL, key).Scan(&n); err != nil {
+			return fmt.Errorf("failed to count set %q in table %q: %w", key, s.table, err)
+		}
+		parentSQL := fmt.Sprintf(`UPDATE %s SET version = version + 1, updated_at = ?2 WHERE key = ?1;`, s.quoteTable())
+		if n == 0 {
+			parentSQL = fmt.Sprintf(`DELETE FROM %s WHERE key = ?1;`, s.quoteTable())
+		}
+		if _, err := tx.ExecContext(s.ctx, parentSQL, key, now); err != nil {
+			return fmt.Errorf("failed to update set %q in table %q: %w", key, s.table, err)
+		}
+		return nil
+	})
+	if err != nil || removed == 0 {
+		return 0, err
+	}
+	s.notify.publish(key, "srem")
+	return removed, nil
+}
+
+// SMembers returns the members of the set stored at key in ascending order,
+// or none if the key does not exist. Returns ErrWrongType if key holds
+// another type.
+func (s *Store) SMembers(key string) ([]string, error) {
+	defer s.observe("smembers", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+	if ok, err := s.liveKey(s.q(), key, "set", s.now().Unix()); !ok {
+		return nil, err
+	}
+	membersSQL := fmt.Sprintf(`SELECT member FROM %s WHERE key = ? ORDER BY member;`, s.quoteSetTable())
+	members, err := s.selectKeys(membersSQL, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read set %q in table %q: %w", key, s.table, err)
+	}
+	return members, nil
+}
+
+// SIsMember reports whether member is in the set stored at key. A missing key
+// is an empty set. Returns ErrWrongType if key holds another type.
+func (s *Store) SIsMember(key, member string) (bool, error) {
+	defer s.observe("sismember", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := s.Sync(); err != nil {
+		return false, err
+	}
+	if ok, err := s.liveKey(s.q(), key, "set", s.now().Unix()); !ok {
+		return false, err
+	}
+	var n int
+	memberSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE key = ? AND member = ?;`, s.quoteSetTable())
+	if err := s.queryRow(memberSQL, key, member).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to read set %q in table %q: %w", key, s.table, err)
+	}
+	return n > 0, nil
+}
+
+// SCard returns the number of members of the set stored at key, or 0 if the
+// key does not exist. Returns ErrWrongType if key holds another type.
+func (s *Store) SCard(key string) (int, error) {
+	defer s.observe("scard", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+	if ok, err := s.liveKey(s.q(), key, "set", s.now().Unix()); !ok {
+		return 0, err
+	}
+	var n int
+	cardSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE key = ?;`, s.quoteSetTable())
+	if err := s.queryRow(cardSQL, key).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count set %q in table %q: %w", key, s.table, err)
+	}
+	return n, nil
+}
+
+// SUnion returns the members of any of the sets stored at keys, in ascending
+// order. Missing keys are empty sets. Returns ErrWrongType if a key holds
+// another type.
+func (s *Store) SUnion(keys ...string) ([]string, error) {
+	defer s.observe("sunion", time.Now())
+
+	return s.setAlgebra("union", keys)
+}
+
+// SInter returns the members of all the sets stored at keys, in ascending
+// order. Missing keys are empty sets, so the result is then empty.
+// Returns ErrWrongType if a key holds another type.
+func (s *Store) SInter(keys ...string) ([]string, error) {
+	defer s.observe("sinter", time.Now())
+
+	return s.setAlgebra("intersect", keys)
+}
+
+// SDiff returns the members of the set stored at the first key that are in
+// none of the sets stored at the other keys, in ascending order. Missing keys
+// are empty sets. Returns ErrWrongType if a key holds another type.
+func (s *Store) SDiff(keys ...string) ([]string, error) {
+	defer s.observe("sdiff", time.Now())
+
+	return s.setAlgebra("diff", keys)
+}
+
+// setAlgebra combines the sets stored at keys with op, one of "union",
+// "intersect" or "diff", in a single query.
+func (s *Store) setAlgebra(op string, keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("failed to %s sets in table %q: no keys", op, s.table)
+	}
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+	now := s.now().Unix()
+
+	// Only the live sets take part; a missing first set leaves nothing to
+	// subtract from, and any missing set empties an intersection
+	var live []interface{}
+	for i, key := range keys {
+		key = s.canonicalKey(key)
+		ok, err := s.liveKey(s.q(), key, "set", now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read set %q in table %q: %w", key, s.table, err)
+		}
+		if !ok && (op == "intersect" || (op == "diff" && i == 0)) {
+			return nil, nil
+		}
+		if ok {
+			live = append(live, key)
+		}
+	}
+	if len(live) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(live)), ", ")
+	var algebraSQL string
+	switch op {
+	case "union":
+		algebraSQL = fmt.Sprintf(`SELECT DISTINCT member FROM %s WHERE key IN (%s) ORDER BY member;`, s.quoteSetTable(), placeholders)
+	case "intersect":
+		live = append(live, len(live))
+		algebraSQL = fmt.Sprintf(`
+		SELECT member FROM %s WHERE key IN (%s)
+		GROUP BY member HAVING COUNT(*) = ? ORDER BY member;`, s.quoteSetTable(), placeholders)
+	case "diff":
+		// The first key is live here; NULL keeps the list of the others valid when empty
+		algebraSQL = fmt.Sprintf(`
+		SELECT member FROM %s WHERE key = ?
+		AND member NOT IN (SELECT member FROM %s WHERE key IN (NULL%s))
+		ORDER BY member;`, s.quoteSetTable(), s.quoteSetTable(), strings.Repeat(", ?", len(live)-1))
+	}
+	members, err := s.selectKeys(algebraSQL, live...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s sets in table %q: %w", op, s.table, err)
+	}
+	return members, nil
+}
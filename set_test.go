@@ -0,0 +1,141 @@
+package mkvstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSet tests adding, removing and reading members of a set.
+func TestSet(t *testing.T) {
+	store := setupStore(t)
+	defer store.Close()
+
+	if n, err := store.SAdd("s", "b", "a", "b"); err != nil || n != 2 {
+		t.Fatalf("SAdd = %d, %v, expected 2", n, err)
+	}
+	if n, err := store.SAdd("s", "a", "c"); err != nil || n != 1 {
+		t.Errorf("SAdd of an existing member = %d, %v, expected 1", n, err)
+	}
+	if got, err := store.SMembers("s"); err != nil || !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("SMembers = %v, %v", got, err)
+	}
+	if ok, err := store.SIsMember("s", "b"); err != nil || !ok {
+		t.Errorf("SIsMember(b) = %v, %v", ok, err)
+	}
+	if ok, err := store.SIsMember("s", "z"); err != nil || ok {
+		t.Errorf("SIsMember(z) = %v, %v", ok, err)
+	}
+	if n, err := store.SCard("s"); err != nil || n != 3 {
+		t.Errorf("SCard = %d, %v", n, err)
+	}
+	if typ, err := store.Type("s"); err != nil || typ != "set" {
+		t.Errorf("Type = %q, %v", typ, err)
+	}
+
+	if n, err := store.SRem("s", "a", "z"); err != nil || n != 1 {
+		t.Errorf("SRem = %d, %v, expected 1", n, err)
+	}
+	if n, err := store.SRem("s", "b", "c"); err != nil || n != 2 {
+		t.Errorf("SRem of the last members = %d, %v, expected 2", n, err)
+	}
+	if _, err := store.Type("s"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected the empty set to be deleted, got %v", err)
+	}
+	if n, err := store.SCard("missing"); err != nil || n != 0 {
+		t.Errorf("SCard of a missing key = %d, %v", n, err)
+	}
+
+	store.Set("str", "value", 0)
+	if _, err := store.SAdd("str", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from SAdd on a string, got %v", err)
+	}
+	if _, err := store.SMembers("str"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from SMembers on a string, got %v", err)
+	}
+
+	// Overwriting the set drops its members
+	store.SAdd("s", "a")
+	store.Set("s", "value", 0)
+	store.SAdd("s2", "x")
+	if err := store.Del("s2"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	if _, err := store.SAdd("s", "x"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType after overwriting the set, got %v", err)
+	}
+	var rows int
+	if err := store.queryRow(`SELECT COUNT(*) FROM ` + store.quoteSetTable()).Scan(&rows); err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if rows != 0 {
+		t.Errorf("Expected no members left, got %d", rows)
+	}
+}
+
+// TestSetAlgebra tests SUnion, SInter and SDiff, with missing keys as empty
+// sets.
+func TestSetAlgebra(t *testing.T) {
+	store := setupStore(t)
+	defer store.Close()
+
+	store.SAdd("a", "1", "2", "3")
+	store.SAdd("b", "2", "3", "4")
+	store.SAdd("c", "3", "5")
+
+	tests := []struct {
+		name string
+		fn   func(keys ...string) ([]string, error)
+		keys []string
+		want []string
+	}{
+		{"SUnion", store.SUnion, []string{"a", "b", "c"}, []string{"1", "2", "3", "4", "5"}},
+		{"SUnion missing", store.SUnion, []string{"missing", "c"}, []string{"3", "5"}},
+		{"SInter", store.SInter, []string{"a", "b", "c"}, []string{"3"}},
+		{"SInter missing", store.SInter, []string{"a", "missing"}, nil},
+		{"SDiff", store.SDiff, []string{"a", "b"}, []string{"1"}},
+		{"SDiff alone", store.SDiff, []string{"a"}, []string{"1", "2", "3"}},
+		{"SDiff missing", store.SDiff, []string{"a", "missing", "c"}, []string{"1", "2"}},
+		{"SDiff missing first", store.SDiff, []string{"missing", "a"}, nil},
+	}
+	for _, tt := range tests {
+		got, err := tt.fn(tt.keys...)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s(%v) = %v, %v, expected %v", tt.name, tt.keys, got, err, tt.want)
+		}
+	}
+
+	store.Set("str", "value", 0)
+	if _, err := store.SUnion("a", "str"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+// TestSetCopyMirror tests that copies, renames and mirrors carry the
+// members of sets.
+func TestSetCopyMirror(t *testing.T) {
+	store := setupStore(t)
+	defer store.Close()
+
+	store.SAdd("s", "a", "b")
+	if _, err := store.Copy("s", "copy", false); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if err := store.Rename("copy", "renamed"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if got, err := store.SMembers("renamed"); err != nil || !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("SMembers of the renamed copy = %v, %v", got, err)
+	}
+
+	var buf bytes.Buffer
+	if err := store.MirrorTo(context.Background(), &buf, MirrorJSONL); err != nil {
+		t.Fatalf("MirrorTo failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), `{"key":"s","type":"set","members":["a","b"]}`) {
+		t.Errorf("Unexpected mirror %s", buf.String())
+	}
+}
@@ -0,0 +1,52 @@
+package mkvstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SetNX sets the string value of key like Set, but only if the key does not
+// exist or is expired, mirroring Redis SET NX. It reports whether the value
+// was written. The check and the write are one statement, so of concurrent
+// callers, even in other processes, exactly one wins.
+func (s *Store) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	defer s.observe("setnx", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return false, err
+	}
+
+	if err := s.Sync(); err != nil {
+		return false, err
+	}
+	ttl = s.effectiveTTL(key, ttl)
+	now := s.now()
+	var expiresAt interface{} // NULL for no expiration
+	if ttl > 0 {
+		expiresAt = now.Add(ttl).Unix()
+	}
+
+	enc, err := s.encodeValue(key, value)
+	if err != nil {
+		return false, fmt.Errorf("failed to set key %q in table %q: %w", key, s.table, err)
+	}
+	// An expired key counts as missing and is replaced as if it were new
+	setNXSQL := fmt.Sprintf(`
+	INSERT INTO %s (key, value, type, expires_at, version, created_at, updated_at, codec, transforms) VALUES (?1, ?2, 'string', ?3, %s, ?4, ?4, ?5, ?6)
+	ON CONFLICT(key) DO UPDATE SET
+		value = excluded.value, type = 'string', expires_at = excluded.expires_at, version = version + 1,
+		created_at = excluded.created_at, updated_at = excluded.updated_at, codec = excluded.codec, transforms = excluded.transforms, meta = NULL
+	WHERE expires_at IS NOT NULL AND expires_at < ?4;`, s.quoteTable(), firstVersionSQL(s.table))
+	result, err := s.exec(context.Background(), setNXSQL, key, enc.data, expiresAt, now.Unix(), enc.codec, enc.transforms)
+	if err != nil {
+		return false, fmt.Errorf("failed to set key %q in table %q: %w", key, s.table, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	s.trackExpiry(key, expiresAt)
+	s.notify.publish(key, "set")
+	return true, nil
+}
@@ -0,0 +1,38 @@
+package mkvstore
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSetNX tests that SetNX only writes missing or expired keys.
+func TestSetNX(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	if ok, err := store.SetNX("k", "first", time.Hour); err != nil || !ok {
+		t.Fatalf("SetNX of a missing key = %v, %v, expected true", ok, err)
+	}
+	if ttl, _ := store.TTL("k"); ttl <= 0 {
+		t.Errorf("TTL = %v, expected the TTL given to SetNX", ttl)
+	}
+	if ok, err := store.SetNX("k", "second", 0); err != nil || ok {
+		t.Errorf("SetNX of an existing key = %v, %v, expected false", ok, err)
+	}
+	if value, _ := store.Get("k"); value != "first" {
+		t.Errorf("Get = %q, expected first", value)
+	}
+
+	store.Set("expired", "old", time.Hour)
+	store.db.Exec(`UPDATE "test_kv_data_file" SET expires_at = ? WHERE key = 'expired';`, time.Now().Add(-time.Minute).Unix())
+	if ok, _ := store.SetNX("expired", "new", 0); !ok {
+		t.Error("Expected SetNX to replace an expired key")
+	}
+	if value, _ := store.Get("expired"); value != "new" {
+		t.Errorf("Get = %q, expected new", value)
+	}
+
+	store.HSet("h", "f", "v")
+	if ok, _ := store.SetNX("h", "new", 0); ok {
+		t.Error("Expected SetNX to leave a hash key alone")
+	}
+}
@@ -0,0 +1,48 @@
+package mkvstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SetXX sets the string value of key like Set, but only if the key already
+// exists and is not expired, mirroring Redis SET XX. It reports whether the
+// value was written. The TTL is replaced as with Set. Hash and list keys are
+// left alone and reported as not written.
+func (s *Store) SetXX(key, value string, ttl time.Duration) (bool, error) {
+	defer s.observe("setxx", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return false, err
+	}
+
+	if err := s.Sync(); err != nil {
+		return false, err
+	}
+	ttl = s.effectiveTTL(key, ttl)
+	now := s.now()
+	var expiresAt interface{} // NULL for no expiration
+	if ttl > 0 {
+		expiresAt = now.Add(ttl).Unix()
+	}
+
+	enc, err := s.encodeValue(key, value)
+	if err != nil {
+		return false, fmt.Errorf("failed to set key %q in table %q: %w", key, s.table, err)
+	}
+	setXXSQL := fmt.Sprintf(`
+	UPDATE %s SET value = ?2, type = 'string', expires_at = ?3, version = version + 1, updated_at = ?4, codec = ?5, transforms = ?6
+	WHERE key = ?1 AND type IN ('string', 'alias', 'archived') AND (expires_at IS NULL OR expires_at >= ?4);`, s.quoteTable())
+	result, err := s.exec(context.Background(), setXXSQL, key, enc.data, expiresAt, now.Unix(), enc.codec, enc.transforms)
+	if err != nil {
+		return false, fmt.Errorf("failed to set key %q in table %q: %w", key, s.table, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	s.trackExpiry(key, expiresAt)
+	s.notify.publish(key, "set")
+	return true, nil
+}
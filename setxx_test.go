@@ -0,0 +1,40 @@
+package mkvstore
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSetXX tests that SetXX only overwrites live existing keys.
+func TestSetXX(t *testing.T) {
+	store, _ := setupFileStore(t)
+
+	if ok, err := store.SetXX("missing", "v", 0); err != nil || ok {
+		t.Errorf("SetXX of a missing key = %v, %v, expected false", ok, err)
+	}
+	if exists, _ := store.Exists("missing"); exists {
+		t.Error("Expected SetXX not to create a missing key")
+	}
+
+	store.Set("k", "old", 0)
+	if ok, err := store.SetXX("k", "new", time.Hour); err != nil || !ok {
+		t.Fatalf("SetXX of an existing key = %v, %v, expected true", ok, err)
+	}
+	if value, _ := store.Get("k"); value != "new" {
+		t.Errorf("Get = %q, expected new", value)
+	}
+	if ttl, _ := store.TTL("k"); ttl <= 0 {
+		t.Errorf("TTL = %v, expected the TTL given to SetXX", ttl)
+	}
+
+	store.Set("expired", "old", time.Hour)
+	store.db.Exec(`UPDATE "test_kv_data_file" SET expires_at = ? WHERE key = 'expired';`, time.Now().Add(-time.Minute).Unix())
+	if ok, _ := store.SetXX("expired", "new", 0); ok {
+		t.Error("Expected SetXX of an expired key to report false")
+	}
+
+	store.HSet("h", "f", "v")
+	if ok, _ := store.SetXX("h", "new", 0); ok {
+		t.Error("Expected SetXX to leave a hash key alone")
+	}
+}
@@ -0,0 +1,356 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// snapshotStamp is the layout of the timestamp SnapshotPrefix appends to the
+// destination prefix. It sorts chronologically as a string.
+const snapshotStamp = "20060102T150405.000Z"
+
+// SnapshotPolicy configures WithPrefixSnapshots.
+type SnapshotPolicy struct {
+	// Prefix is the prefix of the keys to snapshot.
+	Prefix string
+
+	// DstPrefix is the prefix under which the timestamped snapshots are
+	// created (see SnapshotPrefix).
+	DstPrefix string
+
+	// Interval is how often a snapshot is taken.
+	Interval time.Duration
+
+	// Keep is how many snapshots to retain, the oldest being deleted after
+	// each new one. 0 keeps them all.
+	Keep int
+}
+
+// WithPrefixSnapshots schedules the "snapshot:<DstPrefix>" maintenance task,
+// which takes a snapshot of the keys under Prefix every Interval and prunes
+// all but the Keep most recent ones, as rollback points for RestorePrefix.
+// It can be given several times for different prefixes.
+func WithPrefixSnapshots(policy SnapshotPolicy) Option {
+	return func(o *options) {
+		o.snapshots = append(o.snapshots, policy)
+	}
+}
+
+// scheduleSnapshots schedules a maintenance task per WithPrefixSnapshots.
+func (s *Store) scheduleSnapshots() error {
+	for _, p := range s.opts.snapshots {
+		if p.DstPrefix == "" {
+			return errors.New("prefix snapshots need a destination prefix")
+		}
+		err := s.schedule(MaintenanceTask{Name: "snapshot:" + p.DstPrefix, Interval: p.Interval, Run: func(context.Context) error {
+			if _, err := s.SnapshotPrefix(p.Prefix, p.DstPrefix); err != nil {
+				return err
+			}
+			if p.Keep <= 0 {
+				return nil
+			}
+			_, err := s.PruneSnapshots(p.DstPrefix, p.Keep)
+			return err
+		}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SnapshotPrefix copies every live key under the prefix src, whatever its
+// type, to the same key under a new prefix made of dstPrefix, the current UTC
+// time and a colon, such as "snap:20261016T093000.000Z:", in one transaction,
+// and returns that prefix. Expiration times are copied as they are, so keys
+// about to expire do not outlive their originals in the snapshot. Archived
+// keys are copied with their archived value.
+//
+// Snapshots can be listed with Snapshots, pruned with PruneSnapshots and
+// restored with RestorePrefix. src and dstPrefix must not overlap, and
+// dstPrefix must not be empty nor reserved.
+func (s *Store) SnapshotPrefix(src, dstPrefix string) (string, error) {
+	defer s.observe("snapshot", time.Now())
+
+	src, dstPrefix = s.canonicalKey(src), s.canonicalKey(dstPrefix)
+	if dstPrefix == "" {
+		return "", errors.New("snapshot prefix must not be empty")
+	}
+	if err := checkReserved(dstPrefix); err != nil {
+		return "", err
+	}
+	if err := s.Sync(); err != nil {
+		return "", err
+	}
+
+	now := s.now()
+	snapshot := dstPrefix + now.UTC().Format(snapshotStamp) + ":"
+	var keys []string
+	err := s.update(func(tx *sql.Tx) error {
+		var err error
+		keys, err = s.copyPrefix(tx, src, snapshot, now.Unix())
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to snapshot prefix %q to %q in table %q: %w", src, snapshot, s.table, err)
+	}
+	for _, key := range keys {
+		s.notify.publish(key, "set")
+	}
+	return snapshot, nil
+}
+
+// Snapshots returns the prefixes of the snapshots SnapshotPrefix took under
+// dstPrefix, newest first. A snapshot of no keys leaves nothing to list.
+func (s *Store) Snapshots(dstPrefix string) ([]string, error) {
+	dstPrefix = s.canonicalKey(dstPrefix)
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+
+	listSQL := fmt.Sprintf(`SELECT DISTINCT substr(key, ?2, ?3) FROM %s WHERE key LIKE ?1 ESCAPE '\';`, s.quoteTable())
+	stamps, err := s.selectKeys(listSQL, prefixToSQLLike(dstPrefix), utf8.RuneCountInString(dstPrefix)+1, len(snapshotStamp)+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots %q in table %q: %w", dstPrefix, s.table, err)
+	}
+	var snapshots []string
+	for _, stamp := range stamps {
+		ts, ok := strings.CutSuffix(stamp, ":")
+		if !ok {
+			continue
+		}
+		if _, err := time.Parse(snapshotStamp, ts); err != nil {
+			continue // Another key sharing the prefix
+		}
+		snapshots = append(snapshots, dstPrefix+stamp)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(snapshots)))
+	return snapshots, nil
+}
+
+// PruneSnapshots deletes the keys of all but the keep most recent snapshots
+// under dstPrefix in one transaction and returns the prefixes of the
+// snapshots deleted.
+func (s *Store) PruneSnapshots(dstPrefix string, keep int) ([]string, error) {
+	snapshots, err := s.Snapshots(dstPrefix)
+	if err != nil || len(snapshots) <= keep {
+		return nil, err
+	}
+	pruned := snapshots[max(keep, 0):]
+
+	var keys []string
+	delSQL := fmt.Sprintf(`DELETE FROM %s WHERE key LIKE ? ESCAPE '\' RETURNING key;`, s.quoteTable())
+	err = s.update(func(tx *sql.Tx) error {
+		keys = keys[:0]
+		for _, snapshot := range pruned {
+			rows, err := tx.QueryContext(s.ctx, delSQL, prefixToSQLLike(snapshot))
+			if err != nil {
+				return err
+			}
+			for rows.Next() {
+				var key string
+				if err := rows.Scan(&key); err != nil {
+					rows.Close()
+					return err
+				}
+				keys = append(keys, key)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune snapshots %q in table %q: %w", dstPrefix, s.table, err)
+	}
+	for _, key := range keys {
+		s.notify.publish(key, "del")
+	}
+	return pruned, nil
+}
+
+// copyPrefix copies the live keys under from to the same keys under to within
+// tx, with their hash fields and list elements, and returns the keys written.
+// Keys already under to are replaced but keep counting their versions.
+func (s *Store) copyPrefix(tx *sql.Tx, from, to string, now int64) ([]string, error) {
+	if strings.HasPrefix(from, to) || strings.HasPrefix(to, from) {
+		return nil, fmt.Errorf("prefixes %q and %q overlap", from, to)
+	}
+
+	// ?1 source pattern, ?2 now, ?3 destination prefix, ?4 start of the key suffix
+	args := []interface{}{prefixToSQLLike(from), now, to, utf8.RuneCountInString(from) + 1}
+	source := `m.key LIKE ?1 ESCAPE '\' AND (m.expires_at IS NULL OR m.expires_at >= ?2)`
+	return s.copyKeys(tx, source, args)
+}
+
+// copyKeys copies the live keys selected by the condition source on the main
+// table m, with their fields or elements, to ?3 || substr(m.key, ?4),
+// replacing the destinations. args holds ?1 to ?4, ?2 being the current time.
+// It returns the destination keys.
+func (s *Store) copyKeys(tx *sql.Tx, source string, args []interface{}) ([]string, error) {
+	target := `?3 || substr(m.key, ?4)`
+
+	// Fields, elements, members and entries of replaced keys are dropped first
+	for _, child := range []string{s.quoteHashTable(), s.quoteListTable(), s.quoteSetTable(), s.quoteZSetTable(), s.quoteStreamTable()} {
+		clearSQL := fmt.Sprintf(`DELETE FROM %s WHERE key IN (SELECT %s FROM %s AS m WHERE %s);`,
+			child, target, s.quoteTable(), source)
+		if _, err := tx.ExecContext(s.ctx, clearSQL, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	upsert := `
+	ON CONFLICT(key) DO UPDATE SET value = excluded.value, type = excluded.type, expires_at = excluded.expires_at,
+		version = version + 1, updated_at = excluded.updated_at, codec = excluded.codec,
+		transforms = excluded.transforms, meta = excluded.meta
+	RETURNING key;`
+	copies := []string{fmt.Sprintf(`
+	INSERT INTO %s (key, value, type, expires_at, version, created_at, updated_at, codec, transforms, meta)
+	SELECT %s, m.value, m.type, m.expires_at, %s, ?2, ?2, m.codec, m.transforms, m.meta
+	FROM %s AS m WHERE %s AND m.type != 'archived'`, s.quoteTable(), target, firstVersionSQL(s.table), s.quoteTable(), source) + upsert}
+	// Archived keys take their value from the archive, stubs pointing nowhere
+	// once the original is restored or deleted
+	aliases := s.opts.attached.aliases()
+	for _, alias := range aliases {
+		copies = append(copies, fmt.Sprintf(`
+		INSERT INTO %s (key, value, type, expires_at, version, created_at, updated_at, codec, transforms, meta)
+		SELECT %s, a.value, 'string', m.expires_at, %s, ?2, ?2, a.codec, a.transforms, a.meta
+		FROM %s AS m JOIN %s AS a ON a.key = m.key
+		WHERE %s AND m.type = 'archived' AND m.value = ?5`,
+			s.quoteTable(), target, firstVersionSQL(s.table), s.quoteTable(), s.archiveTable(alias), source)+upsert)
+	}
+
+	var keys []string
+	for i, copySQL := range copies {
+		copyArgs := args
+		if i > 0 {
+			copyArgs = append(args[:4:4], aliases[i-1])
+		}
+		rows, err := tx.QueryContext(s.ctx, copySQL, copyArgs...)
+		if err != nil {
+			if isMissingTable(err) {
+				continue // Archive without this table
+			}
+			return nil, err
+		}
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	childSQL := []string{
+		fmt.Sprintf(`
+		INSERT INTO %s (key, field, value, codec, transforms, expires_at)
+		SELECT %s, h.field, h.value, h.codec, h.transforms, h.expires_at
+		FROM %s AS h JOIN %s AS m ON m.key = h.key WHERE %s AND m.type = 'hash';`,
+			s.quoteHashTable(), target, s.quoteHashTable(), s.quoteTable(), source),
+		fmt.Sprintf(`
+		INSERT INTO %s (key, seq, value, codec, transforms)
+		SELECT %s, l.seq, l.value, l.codec, l.transforms
+		FROM %s AS l JOIN %s AS m ON m.key = l.key WHERE %s AND m.type = 'list';`,
+			s.quoteListTable(), target, s.quoteListTable(), s.quoteTable(), source),
+		fmt.Sprintf(`
+		INSERT INTO %s (key, member)
+		SELECT %s, c.member
+		FROM %s AS c JOIN %s AS m ON m.key = c.key WHERE %s AND m.type = 'set';`,
+			s.quoteSetTable(), target, s.quoteSetTable(), s.quoteTable(), source),
+		fmt.Sprintf(`
+		INSERT INTO %s (key, member, score)
+		SELECT %s, z.member, z.score
+		FROM %s AS z JOIN %s AS m ON m.key = z.key WHERE %s AND m.type = 'zset';`,
+			s.quoteZSetTable(), target, s.quoteZSetTable(), s.quoteTable(), source),
+		fmt.Sprintf(`
+		INSERT INTO %s (key, ms, seq, fields)
+		SELECT %s, e.ms, e.seq, e.fields
+		FROM %s AS e JOIN %s AS m ON m.key = e.key WHERE %s AND m.type = 'stream';`,
+			s.quoteStreamTable(), target, s.quoteStreamTable(), s.quoteTable(), source),
+	}
+	for _, q := range childSQL {
+		if _, err := tx.ExecContext(s.ctx, q, args...); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// RestorePrefix makes the keys under livePrefix match the snapshot taken by
+// SnapshotPrefix under snapshotPrefix, in one transaction: every live key of
+// the snapshot is copied back under livePrefix, replacing the current one,
+// and with deleteExtra the keys under livePrefix absent from the snapshot are
+// deleted. Replaced keys keep counting their versions, so readers comparing
+// versions see the change. It returns the number of keys restored, not
+// counting those deleted.
+//
+// snapshotPrefix is the full prefix returned by SnapshotPrefix or Snapshots,
+// and must not overlap livePrefix.
+func (s *Store) RestorePrefix(snapshotPrefix, livePrefix string, deleteExtra bool) (int, error) {
+	defer s.observe("restore", time.Now())
+
+	snapshotPrefix, livePrefix = s.canonicalKey(snapshotPrefix), s.canonicalKey(livePrefix)
+	if err := checkReserved(livePrefix); err != nil {
+		return 0, err
+	}
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+
+	now := s.now().Unix()
+	var restored, deleted []string
+	err := s.update(func(tx *sql.Tx) error {
+		var err error
+		if restored, err = s.copyPrefix(tx, snapshotPrefix, livePrefix, now); err != nil {
+			return err
+		}
+		if !deleteExtra {
+			return nil
+		}
+
+		// Expired keys go too, as do keys whose snapshot copy has expired
+		extraSQL := fmt.Sprintf(`
+		DELETE FROM %s WHERE key LIKE ?1 ESCAPE '\' AND %s AND ?3 || substr(key, ?4) NOT IN (
+			SELECT key FROM %s WHERE key LIKE ?5 ESCAPE '\' AND (expires_at IS NULL OR expires_at >= ?2))
+		RETURNING key;`, s.quoteTable(), notReservedSQL, s.quoteTable())
+		rows, err := tx.QueryContext(s.ctx, extraSQL, prefixToSQLLike(livePrefix), now,
+			snapshotPrefix, utf8.RuneCountInString(livePrefix)+1, prefixToSQLLike(snapshotPrefix))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		deleted = deleted[:0]
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				return err
+			}
+			deleted = append(deleted, key)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to restore prefix %q from %q in table %q: %w", livePrefix, snapshotPrefix, s.table, err)
+	}
+	for _, key := range restored {
+		s.notify.publish(key, "set")
+	}
+	for _, key := range deleted {
+		s.notify.publish(key, "del")
+	}
+	return len(restored), nil
+}
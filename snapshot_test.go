@@ -0,0 +1,166 @@
+package mkvstore
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSnapshotPrefix tests copying every type of key under a prefix.
+func TestSnapshotPrefix(t *testing.T) {
+	store := setupStore(t)
+
+	if err := store.Set("config:a", "1", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := store.HSet("config:h", "f", "v"); err != nil {
+		t.Fatalf("HSet failed: %v", err)
+	}
+	if _, err := store.RPush("config:l", "x", "y"); err != nil {
+		t.Fatalf("RPush failed: %v", err)
+	}
+	if err := store.Set("other", "z", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	snap, err := store.SnapshotPrefix("config:", "snap:")
+	if err != nil {
+		t.Fatalf("SnapshotPrefix failed: %v", err)
+	}
+	if !strings.HasPrefix(snap, "snap:") || !strings.HasSuffix(snap, ":") {
+		t.Fatalf("Unexpected snapshot prefix %q", snap)
+	}
+
+	if v, err := store.Get(snap + "a"); err != nil || v != "1" {
+		t.Errorf("Expected snapshot of a to be 1, got %q, %v", v, err)
+	}
+	if v, err := store.HGet(snap+"h", "f"); err != nil || v != "v" {
+		t.Errorf("Expected snapshot of hash field to be v, got %q, %v", v, err)
+	}
+	if n, err := store.LLen(snap + "l"); err != nil || n != 2 {
+		t.Errorf("Expected snapshot list of length 2, got %d, %v", n, err)
+	}
+	if _, err := store.Get(snap + "other"); err != ErrKeyNotFound {
+		t.Errorf("Expected key outside the prefix not to be copied, got %v", err)
+	}
+
+	// Later changes leave the snapshot alone
+	if err := store.Set("config:a", "2", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if v, _ := store.Get(snap + "a"); v != "1" {
+		t.Errorf("Expected snapshot to keep 1, got %q", v)
+	}
+
+	if _, err := store.SnapshotPrefix("config:", "config:snap:"); err == nil {
+		t.Error("Expected an error for overlapping prefixes")
+	}
+	if _, err := store.SnapshotPrefix("config:", ReservedPrefix+"snap:"); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Expected ErrReservedKey, got %v", err)
+	}
+}
+
+// TestPruneSnapshots tests listing snapshots and keeping the most recent ones.
+func TestPruneSnapshots(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := setupWALStore(t, WithClock(func() time.Time { return now }))
+
+	if err := store.Set("config:a", "1", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	var taken []string
+	for range 3 {
+		snap, err := store.SnapshotPrefix("config:", "snap:")
+		if err != nil {
+			t.Fatalf("SnapshotPrefix failed: %v", err)
+		}
+		taken = append(taken, snap)
+		now = now.Add(time.Minute)
+	}
+
+	snapshots, err := store.Snapshots("snap:")
+	if err != nil {
+		t.Fatalf("Snapshots failed: %v", err)
+	}
+	if len(snapshots) != 3 || snapshots[0] != taken[2] {
+		t.Fatalf("Expected 3 snapshots newest first, got %v", snapshots)
+	}
+
+	pruned, err := store.PruneSnapshots("snap:", 1)
+	if err != nil {
+		t.Fatalf("PruneSnapshots failed: %v", err)
+	}
+	if len(pruned) != 2 {
+		t.Errorf("Expected 2 snapshots pruned, got %v", pruned)
+	}
+	if _, err := store.Get(taken[0] + "a"); err != ErrKeyNotFound {
+		t.Errorf("Expected oldest snapshot deleted, got %v", err)
+	}
+	if v, err := store.Get(taken[2] + "a"); err != nil || v != "1" {
+		t.Errorf("Expected newest snapshot kept, got %q, %v", v, err)
+	}
+}
+
+// TestRestorePrefix tests rolling a prefix back with and without deleting
+// keys absent from the snapshot.
+func TestRestorePrefix(t *testing.T) {
+	store := setupStore(t)
+
+	if err := store.Set("config:a", "1", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := store.HSet("config:h", "f", "v"); err != nil {
+		t.Fatalf("HSet failed: %v", err)
+	}
+	snap, err := store.SnapshotPrefix("config:", "snap:")
+	if err != nil {
+		t.Fatalf("SnapshotPrefix failed: %v", err)
+	}
+
+	// Break the live config
+	if err := store.Set("config:a", "bad", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := store.HSet("config:h", "extra", "x"); err != nil {
+		t.Fatalf("HSet failed: %v", err)
+	}
+	if err := store.Set("config:new", "n", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	_, before, _, err := store.GetIfChanged("config:a", 0)
+	if err != nil {
+		t.Fatalf("GetIfChanged failed: %v", err)
+	}
+
+	n, err := store.RestorePrefix(snap, "config:", false)
+	if err != nil {
+		t.Fatalf("RestorePrefix failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 keys restored, got %d", n)
+	}
+	value, after, _, err := store.GetIfChanged("config:a", 0)
+	if err != nil || value != "1" {
+		t.Errorf("Expected config:a restored to 1, got %q, %v", value, err)
+	}
+	if after <= before {
+		t.Errorf("Expected version to grow past %d, got %d", before, after)
+	}
+	if _, err := store.HGet("config:h", "extra"); err != ErrKeyNotFound {
+		t.Errorf("Expected field added after the snapshot to be gone, got %v", err)
+	}
+	if _, err := store.Get("config:new"); err != nil {
+		t.Errorf("Expected extra key kept without deleteExtra, got %v", err)
+	}
+
+	if _, err := store.RestorePrefix(snap, "config:", true); err != nil {
+		t.Fatalf("RestorePrefix failed: %v", err)
+	}
+	if _, err := store.Get("config:new"); err != ErrKeyNotFound {
+		t.Errorf("Expected extra key deleted, got %v", err)
+	}
+	if v, err := store.HGet("config:h", "f"); err != nil || v != "v" {
+		t.Errorf("Expected hash restored, got %q, %v", v, err)
+	}
+}
@@ -0,0 +1,56 @@
+package mkvstore
+
+import "fmt"
+
+// WithStatsView maintains a <table>_stats SQL view summarizing the table,
+// so external tools such as the sqlite3 shell or a Grafana SQLite data
+// source can monitor the store without Go access. The view has one row per
+// key type with the columns:
+//
+//	type           'string', 'hash', 'list', 'set', 'zset', 'stream', 'alias' or 'archived'
+//	live_keys      keys not expired
+//	expired_keys   expired keys not cleaned up yet
+//	live_bytes     value bytes of the live keys, fields, elements and members included
+//	expired_bytes  value bytes of the expired keys
+//
+// Expiry is judged by the database clock when the view is queried, not by
+// WithClock. The view is recreated at every Open, following schema changes,
+// and costs nothing until queried.
+func WithStatsView() Option {
+	return func(o *options) {
+		o.statsView = true
+	}
+}
+
+// statsViewName returns the name of the statistics view of table.
+func statsViewName(table string) string {
+	return table + "_stats"
+}
+
+// createStatsView (re)creates the statistics view of the table.
+func (s *Store) createStatsView() error {
+	view := quoteIdent(statsViewName(s.table))
+	statements := []string{
+		fmt.Sprintf(`DROP VIEW IF EXISTS %s;`, view),
+		fmt.Sprintf(`
+		CREATE VIEW %s AS
+		SELECT type,
+			COALESCE(SUM(live), 0) AS live_keys,
+			COALESCE(SUM(NOT live), 0) AS expired_keys,
+			COALESCE(SUM(CASE WHEN live THEN size END), 0) AS live_bytes,
+			COALESCE(SUM(CASE WHEN NOT live THEN size END), 0) AS expired_bytes
+		FROM (
+			SELECT m.type AS type,
+				m.expires_at IS NULL OR m.expires_at >= CAST(strftime('%%s', 'now') AS INTEGER) AS live,
+				%s AS size
+			FROM %s m
+		)
+		GROUP BY type;`, view, s.keySizeSQL(), s.quoteTable()),
+	}
+	for _, stmt := range statements {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create statistics view for table %q: %w", s.table, err)
+		}
+	}
+	return nil
+}
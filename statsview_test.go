@@ -0,0 +1,47 @@
+package mkvstore
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestStatsView tests the per-type summary of the statistics view.
+func TestStatsView(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "stats.db")
+	store, err := Open(dbPath, "test_kv_stats", WithStatsView())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	store.Set("a", "12345", 0)
+	store.Set("old", "xyz", time.Hour)
+	store.db.Exec(`UPDATE "test_kv_stats" SET expires_at = ? WHERE key = 'old';`, time.Now().Add(-time.Minute).Unix())
+	store.HSet("h", "f", "vv")
+	store.RPush("l", "1", "22")
+
+	rows, err := store.db.Query(`SELECT type, live_keys, expired_keys, live_bytes, expired_bytes FROM "test_kv_stats_stats" ORDER BY type;`)
+	if err != nil {
+		t.Fatalf("Querying the view failed: %v", err)
+	}
+	defer rows.Close()
+	got := make(map[string][4]int64)
+	for rows.Next() {
+		var keyType string
+		var v [4]int64
+		if err := rows.Scan(&keyType, &v[0], &v[1], &v[2], &v[3]); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		got[keyType] = v
+	}
+	expected := map[string][4]int64{
+		"string": {1, 1, 5, 3},
+		"hash":   {1, 0, 3, 0},
+		"list":   {1, 0, 3, 0},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Stats view = %v, expected %v", got, expected)
+	}
+}
@@ -0,0 +1,261 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Streams are stored as a row of type 'stream' in the store's table,
+// carrying the key's expiry and version, plus one row per entry in
+// <table>_stream keyed by its ID, whose primary key keeps entries in ID order.
+// The fields of an entry are stored as a JSON object, not through the value
+// codec, so that they can be inspected with SQLite's JSON functions.
+
+// streamTableName returns the name of the table holding the entries of streams in table.
+func streamTableName(table string) string {
+	return table + "_stream"
+}
+
+// quoteStreamTable returns the stream entry table name safely quoted for SQL.
+func (s *Store) quoteStreamTable() string {
+	return quoteIdent(streamTableName(s.table))
+}
+
+// StreamEntry is an entry of a stream.
+type StreamEntry struct {
+	ID     string            `json:"id"` // "<milliseconds>-<sequence>", as in Redis
+	Fields map[string]string `json:"fields"`
+}
+
+// streamID is a parsed stream entry ID: the Unix time in milliseconds it was
+// added and a sequence number among entries of the same millisecond.
+type streamID struct {
+	ms, seq int64
+}
+
+// String returns id in the "<ms>-<seq>" form.
+func (id streamID) String() string {
+	return strconv.FormatInt(id.ms, 10) + "-" + strconv.FormatInt(id.seq, 10)
+}
+
+// parseStreamID parses an ID in the "<ms>-<seq>" or "<ms>" form, the latter
+// taking seq as its sequence number.
+func parseStreamID(id string, seq int64) (streamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(id, "-")
+	ms, err := strconv.ParseInt(msPart, 10, 64)
+	if err == nil && hasSeq {
+		seq, err = strconv.ParseInt(seqPart, 10, 64)
+	}
+	if err != nil || ms < 0 || seq < 0 {
+		return streamID{}, fmt.Errorf("invalid stream ID %q", id)
+	}
+	return streamID{ms, seq}, nil
+}
+
+// XAdd appends an entry with fields to the stream stored at key, creating the
+// stream if needed, and returns its ID. IDs are generated from the store's
+// clock in milliseconds, like XADD with *, and always increase even if the
+// clock goes back. A maxLen greater than 0 then trims the stream to its
+// maxLen newest entries, like XADD MAXLEN, so an event log stays bounded.
+// Returns ErrWrongType if key holds another type.
+func (s *Store) XAdd(key string, fields map[string]string, maxLen int) (string, error) {
+	defer s.observe("xadd", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return "", err
+	}
+	if len(fields) == 0 {
+		return "", fmt.Errorf("failed to add to stream %q in table %q: no fields", key, s.table)
+	}
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("failed to add to stream %q in table %q: %w", key, s.table, err)
+	}
+	if err := s.Sync(); err != nil {
+		return "", err
+	}
+
+	var id streamID
+	err = s.update(func(tx *sql.Tx) error {
+		now := s.now()
+		if err := s.touchKey(tx, key, "stream", now.Unix()); err != nil {
+			return err
+		}
+		var last streamID
+		lastSQL := fmt.Sprintf(`SELECT ms, seq FROM %s WHERE key = ? ORDER BY ms DESC, seq DESC LIMIT 1;`, s.quoteStreamTable())
+		err := tx.QueryRowContext(s.ctx, lastSQL, key).Scan(&last.ms, &last.seq)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to read stream %q in table %q: %w", key, s.table, err)
+		}
+		id = streamID{ms: now.UnixMilli()}
+		if err == nil && id.ms <= last.ms {
+			if last.seq == math.MaxInt64 {
+				return fmt.Errorf("failed to add to stream %q in table %q: no ID left after %s", key, s.table, last)
+			}
+			id = streamID{last.ms, last.seq + 1}
+		}
+
+		xaddSQL := fmt.Sprintf(`INSERT INTO %s (key, ms, seq, fields) VALUES (?, ?, ?, ?);`, s.quoteStreamTable())
+		if _, err := tx.ExecContext(s.ctx, xaddSQL, key, id.ms, id.seq, string(encoded)); err != nil {
+			return fmt.Errorf("failed to add to stream %q in table %q: %w", key, s.table, err)
+		}
+		if maxLen > 0 {
+			if _, err := s.trimStream(tx, key, maxLen); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	s.notify.publish(key, "xadd")
+	return id.String(), nil
+}
+
+// XTrim trims the stream stored at key to its maxLen newest entries, like
+// Redis XTRIM MAXLEN, and returns the number of entries removed. The stream is
+// deleted if no entry is left. Returns ErrWrongType if key holds another type.
+func (s *Store) XTrim(key string, maxLen int) (int, error) {
+	defer s.observe("xtrim", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return 0, err
+	}
+	if maxLen < 0 {
+		return 0, fmt.Errorf("failed to trim stream %q in table %q: negative length %d", key, s.table, maxLen)
+	}
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+	now := s.now().Unix()
+
+	var removed int
+	err := s.update(func(tx *sql.Tx) error {
+		if ok, err := s.liveKey(tx, key, "stream", now); !ok {
+			return err
+		}
+		var err error
+		if removed, err = s.trimStream(tx, key, maxLen); err != nil || removed == 0 {
+			return err
+		}
+
+		// Drop the stream with its last entry, otherwise record the change on it
+		parentSQL := fmt.Sprintf(`UPDATE %s SET version = version + 1, updated_at = ?2 WHERE key = ?1;`, s.quoteTable())
+		if maxLen == 0 {
+			parentSQL = fmt.Sprintf(`DELETE FROM %s WHERE key = ?1;`, s.quoteTable())
+		}
+		if _, err := tx.ExecContext(s.ctx, parentSQL, key, now); err != nil {
+			return fmt.Errorf("failed to update stream %q in table %q: %w", key, s.table, err)
+		}
+		return nil
+	})
+	if err != nil || removed == 0 {
+		return 0, err
+	}
+	s.notify.publish(key, "xtrim")
+	return removed, nil
+}
+
+// trimStream deletes all but the maxLen newest entries of the stream stored
+// at key and returns the number deleted.
+func (s *Store) trimStream(tx *sql.Tx, key string, maxLen int) (int, error) {
+	trimSQL := fmt.Sprintf(`
+	DELETE FROM %[1]s WHERE rowid IN (
+		SELECT rowid FROM %[1]s WHERE key = ? ORDER BY ms DESC, seq DESC LIMIT -1 OFFSET ?
+	);`, s.quoteStreamTable())
+	result, err := tx.ExecContext(s.ctx, trimSQL, key, maxLen)
+	if err != nil {
+		return 0, fmt.Errorf("failed to trim stream %q in table %q: %w", key, s.table, err)
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// XLen returns the number of entries of the stream stored at key, or 0 if
+// the key does not exist. Returns ErrWrongType if key holds another type.
+func (s *Store) XLen(key string) (int, error) {
+	defer s.observe("xlen", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+	if ok, err := s.liveKey(s.q(), key, "stream", s.now().Unix()); !ok {
+		return 0, err
+	}
+	var n int
+	lenSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE key = ?;`, s.quoteStreamTable())
+	if err := s.queryRow(lenSQL, key).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count stream %q in table %q: %w", key, s.table, err)
+	}
+	return n, nil
+}
+
+// XRange returns the entries of the stream stored at key with an ID between
+// start and end inclusive, oldest first, like Redis XRANGE. IDs may be given
+// as "<ms>-<seq>" or just "<ms>", covering the whole millisecond, and "-" and
+// "+" stand for the first and last entry. A count greater than 0 caps the
+// number of entries returned; to page through a stream, start the next call
+// just after the last ID returned. A missing key is an empty stream.
+// Returns ErrWrongType if key holds another type.
+func (s *Store) XRange(key, start, end string, count int) ([]StreamEntry, error) {
+	defer s.observe("xrange", time.Now())
+
+	key = s.canonicalKey(key)
+	from, to := streamID{0, 0}, streamID{math.MaxInt64, math.MaxInt64}
+	var err error
+	if start != "-" {
+		if from, err = parseStreamID(start, 0); err != nil {
+			return nil, fmt.Errorf("failed to read stream %q in table %q: %w", key, s.table, err)
+		}
+	}
+	if end != "+" {
+		if to, err = parseStreamID(end, math.MaxInt64); err != nil {
+			return nil, fmt.Errorf("failed to read stream %q in table %q: %w", key, s.table, err)
+		}
+	}
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+	if ok, err := s.liveKey(s.q(), key, "stream", s.now().Unix()); !ok {
+		return nil, err
+	}
+	if count <= 0 {
+		count = -1 // No limit in SQLite
+	}
+
+	rangeSQL := fmt.Sprintf(`
+	SELECT ms, seq, fields FROM %s WHERE key = ? AND (ms, seq) >= (?, ?) AND (ms, seq) <= (?, ?)
+	ORDER BY ms, seq LIMIT ?;`, s.quoteStreamTable())
+	rows, err := s.query(rangeSQL, key, from.ms, from.seq, to.ms, to.seq, count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stream %q in table %q: %w", key, s.table, err)
+	}
+	defer rows.Close()
+
+	var entries []StreamEntry
+	for rows.Next() {
+		var id streamID
+		var fields string
+		if err := rows.Scan(&id.ms, &id.seq, &fields); err != nil {
+			return nil, fmt.Errorf("failed to scan stream %q in table %q: %w", key, s.table, err)
+		}
+		entry := StreamEntry{ID: id.String()}
+		if err := json.Unmarshal([]byte(fields), &entry.Fields); err != nil {
+			return nil, fmt.Errorf("failed to decode entry %s of stream %q in table %q: %w", id, key, s.table, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through stream %q in table %q: %w", key, s.table, err)
+	}
+	return entries, nil
+}
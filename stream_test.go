@@ -0,0 +1,133 @@
+package mkvstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStream tests adding entries with generated IDs, reading ranges and
+// trimming a stream.
+func TestStream(t *testing.T) {
+	now := time.UnixMilli(1700000000123)
+	store := setupWALStore(t, WithClock(func() time.Time { return now }))
+	defer store.Close()
+
+	var ids []string
+	for _, event := range []string{"boot", "online", "offline"} {
+		id, err := store.XAdd("events", map[string]string{"event": event}, 0)
+		if err != nil {
+			t.Fatalf("XAdd failed: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if want := []string{"1700000000123-0", "1700000000123-1", "1700000000123-2"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("XAdd IDs within one millisecond = %v, expected %v", ids, want)
+	}
+	now = now.Add(time.Second)
+	if id, err := store.XAdd("events", map[string]string{"event": "reboot", "reason": "update"}, 0); err != nil || id != "1700000001123-0" {
+		t.Errorf("XAdd a second later = %q, %v", id, err)
+	}
+	now = now.Add(-time.Minute)
+	if id, err := store.XAdd("events", map[string]string{"event": "skew"}, 0); err != nil || id != "1700000001123-1" {
+		t.Errorf("XAdd after the clock went back = %q, %v", id, err)
+	}
+	if _, err := store.XAdd("events", nil, 0); err == nil {
+		t.Error("Expected XAdd to reject an entry without fields")
+	}
+	if n, err := store.XLen("events"); err != nil || n != 5 {
+		t.Errorf("XLen = %d, %v, expected 5", n, err)
+	}
+	if typ, err := store.Type("events"); err != nil || typ != "stream" {
+		t.Errorf("Type = %q, %v", typ, err)
+	}
+
+	all, err := store.XRange("events", "-", "+", 0)
+	if err != nil || len(all) != 5 || all[3].Fields["reason"] != "update" {
+		t.Fatalf("XRange(-, +) = %v, %v", all, err)
+	}
+	if got, err := store.XRange("events", "1700000000123", "1700000000123", 0); err != nil || len(got) != 3 {
+		t.Errorf("XRange of one millisecond = %v, %v, expected 3 entries", got, err)
+	}
+	if got, err := store.XRange("events", "1700000000123-1", "+", 2); err != nil || len(got) != 2 || got[0].ID != "1700000000123-1" {
+		t.Errorf("XRange with count = %v, %v", got, err)
+	}
+	if _, err := store.XRange("events", "bogus", "+", 0); err == nil {
+		t.Error("Expected XRange to reject an invalid ID")
+	}
+	if got, err := store.XRange("missing", "-", "+", 0); err != nil || got != nil {
+		t.Errorf("XRange of a missing key = %v, %v", got, err)
+	}
+
+	if _, err := store.XAdd("events", map[string]string{"event": "last"}, 3); err != nil {
+		t.Fatalf("XAdd with maxLen failed: %v", err)
+	}
+	if got, err := store.XRange("events", "-", "+", 0); err != nil || len(got) != 3 || got[0].ID != "1700000001123-0" {
+		t.Errorf("XRange after trimming = %v, %v", got, err)
+	}
+	if n, err := store.XTrim("events", 1); err != nil || n != 2 {
+		t.Errorf("XTrim = %d, %v, expected 2", n, err)
+	}
+	if n, err := store.XTrim("events", 0); err != nil || n != 1 {
+		t.Errorf("XTrim to 0 = %d, %v, expected 1", n, err)
+	}
+	if _, err := store.Type("events"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected the empty stream to be deleted, got %v", err)
+	}
+
+	store.Set("str", "value", 0)
+	if _, err := store.XAdd("str", map[string]string{"a": "b"}, 0); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from XAdd on a string, got %v", err)
+	}
+	if _, err := store.XLen("str"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from XLen on a string, got %v", err)
+	}
+}
+
+// TestStreamCopyMirror tests that copies, mirrors and imports carry the
+// entries of streams.
+func TestStreamCopyMirror(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	store := setupWALStore(t, WithClock(func() time.Time { return now }))
+	defer store.Close()
+
+	store.XAdd("log", map[string]string{"level": "info", "msg": "up"}, 0)
+	if _, err := store.Copy("log", "copy", false); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	want := []StreamEntry{{"1700000000000-0", map[string]string{"level": "info", "msg": "up"}}}
+	if got, err := store.XRange("copy", "-", "+", 0); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("XRange of the copy = %v, %v", got, err)
+	}
+
+	var buf bytes.Buffer
+	if err := store.MirrorTo(context.Background(), &buf, MirrorJSONL); err != nil {
+		t.Fatalf("MirrorTo failed: %v", err)
+	}
+	record := `{"key":"log","type":"stream","entries":[{"id":"1700000000000-0","fields":{"level":"info","msg":"up"}}]}`
+	if !strings.Contains(buf.String(), record) {
+		t.Errorf("Unexpected mirror %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := store.MirrorTo(context.Background(), &buf, MirrorRESP); err != nil {
+		t.Fatalf("MirrorTo RESP failed: %v", err)
+	}
+	xadd := "*7\r\n$4\r\nXADD\r\n$3\r\nlog\r\n$15\r\n1700000000000-0\r\n$5\r\nlevel\r\n$4\r\ninfo\r\n$3\r\nmsg\r\n$2\r\nup\r\n"
+	if !strings.Contains(buf.String(), xadd) {
+		t.Errorf("Expected an XADD command in the RESP mirror, got %q", buf.String())
+	}
+
+	other := setupStore(t)
+	defer other.Close()
+	if _, err := other.Import(strings.NewReader(record+"\n"), ImportOptions{}); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if got, err := other.XRange("log", "-", "+", 0); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("XRange of the import = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,168 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultDeletionBatch is the number of rows a throttled deletion removes per
+// statement when DeletionThrottle.BatchSize is not set.
+const defaultDeletionBatch = 500
+
+// DeletionThrottle configures WithDeletionThrottle. A zero rate is not
+// limited.
+type DeletionThrottle struct {
+	RowsPerSecond  int   // Rows deleted per second
+	BytesPerSecond int64 // Value bytes deleted per second
+
+	// BatchSize is the number of rows deleted per statement. Defaults to 500,
+	// or RowsPerSecond if lower.
+	BatchSize int
+}
+
+// WithDeletionThrottle paces background and bulk deletions so reclaiming
+// space never saturates slow storage and starves foreground traffic: the
+// expired key cleanup, the deletion of expired keys found by reads,
+// DelPattern and TrimChangeLog delete in batches of BatchSize rows, waiting
+// between batches so the configured rates hold on average, and the retention
+// of Partitioned waits between dropped partitions by their rows and bytes. The
+// pace holds across concurrent deletions, which queue up. A throttled
+// DelPattern is no longer a single statement, so a failure part way leaves
+// the keys deleted until then. The throttle is shared by every table of the
+// database.
+func WithDeletionThrottle(t DeletionThrottle) Option {
+	return func(o *options) {
+		o.deletionThrottle = &t
+	}
+}
+
+// deletionPacer enforces a DeletionThrottle.
+type deletionPacer struct {
+	cfg DeletionThrottle
+
+	mu   sync.Mutex
+	next time.Time // Earliest start of the next batch
+}
+
+// newDeletionPacer returns the pacer of cfg, or nil if cfg is nil.
+func newDeletionPacer(cfg *DeletionThrottle) *deletionPacer {
+	if cfg == nil {
+		return nil
+	}
+	return &deletionPacer{cfg: *cfg}
+}
+
+// batch returns the number of rows to delete per statement.
+func (p *deletionPacer) batch() int {
+	n := p.cfg.BatchSize
+	if n <= 0 {
+		n = defaultDeletionBatch
+		if r := p.cfg.RowsPerSecond; r > 0 && r < n {
+			n = r
+		}
+	}
+	return n
+}
+
+// wait reserves the time rows are worth at the configured rates and blocks
+// until that reservation starts or ctx is done, so concurrent callers queue
+// up instead of starting together. done settles the reservation.
+func (p *deletionPacer) wait(ctx context.Context, rows int) error {
+	reserved := p.cost(rows, 0)
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	delay := p.next.Sub(now)
+	p.next = p.next.Add(reserved)
+	p.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		p.next = p.next.Add(-reserved)
+		p.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// done settles the reservation of wait for reserved rows once rows rows and
+// bytes bytes were actually deleted, pushing back or pulling in the next
+// batch by the difference.
+func (p *deletionPacer) done(reserved, rows int, bytes int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.next = p.next.Add(p.cost(rows, bytes) - p.cost(reserved, 0))
+}
+
+// cost returns the time rows rows and bytes bytes are worth at the
+// configured rates.
+func (p *deletionPacer) cost(rows int, bytes int64) time.Duration {
+	var cost time.Duration
+	if r := p.cfg.RowsPerSecond; r > 0 {
+		cost = time.Duration(rows) * time.Second / time.Duration(r)
+	}
+	if b := p.cfg.BytesPerSecond; b > 0 {
+		cost = max(cost, time.Duration(float64(bytes)/float64(b)*float64(time.Second)))
+	}
+	return cost
+}
+
+// valueSizeSQL is the size in bytes of the value of a row, for
+// deleteThrottled.
+const valueSizeSQL = `COALESCE(length(CAST(value AS BLOB)), 0)`
+
+// deleteThrottled deletes the rows of the table quoted as table matching
+// where, batch by batch at the pace of the deletion throttle, and returns the
+// keys of the rows deleted. size is the SQL expression counted as the bytes
+// of a row, such as valueSizeSQL. table must have a key column.
+func (s *Store) deleteThrottled(ctx context.Context, table, size, where string, args ...interface{}) ([]string, error) {
+	p := s.opts.pacer
+	batchSQL := fmt.Sprintf(`
+	DELETE FROM %s WHERE rowid IN (SELECT rowid FROM %s WHERE %s LIMIT %d)
+	RETURNING key, %s;`, table, table, where, p.batch(), size)
+	var keys []string
+	for {
+		if err := p.wait(ctx, p.batch()); err != nil {
+			return keys, err
+		}
+		var batch []string
+		var bytes int64
+		err := s.update(func(tx *sql.Tx) error {
+			batch, bytes = batch[:0], 0
+			rows, err := tx.QueryContext(ctx, batchSQL, args...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var key string
+				var size int64
+				if err := rows.Scan(&key, &size); err != nil {
+					return err
+				}
+				batch, bytes = append(batch, key), bytes+size
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			p.done(p.batch(), 0, 0) // Rolled back
+			return keys, err
+		}
+		keys = append(keys, batch...)
+		p.done(p.batch(), len(batch), bytes)
+		if len(batch) < p.batch() {
+			return keys, nil
+		}
+	}
+}
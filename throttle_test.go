@@ -0,0 +1,96 @@
+package mkvstore
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestDeletionThrottle tests that cleanup and DelPattern delete in batches
+// paced at the configured rate.
+func TestDeletionThrottle(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "throttle.db")
+	store, err := Open(dbPath, "test_kv_throttle", WithDeletionThrottle(DeletionThrottle{RowsPerSecond: 200, BatchSize: 10}))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	for i := range 30 {
+		store.Set(fmt.Sprintf("old:%d", i), "v", time.Hour)
+		store.Set(fmt.Sprintf("tmp:%d", i), "v", 0)
+	}
+	store.db.Exec(`UPDATE "test_kv_throttle" SET expires_at = ? WHERE key LIKE 'old:%';`, time.Now().Add(-time.Minute).Unix())
+
+	start := time.Now()
+	if n, err := store.sweepExpired(context.Background()); err != nil || n != 30 {
+		t.Fatalf("sweepExpired = %d, %v, expected 30", n, err)
+	}
+	// Three full batches of 10 rows at 200 rows/s hold the next one 150ms
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Sweep took %v, expected it paced", elapsed)
+	}
+
+	var keys []string
+	if n, err := store.DelPattern("tmp:*", AffectedKeys(&keys)); err != nil || n != 30 || len(keys) != 30 {
+		t.Errorf("DelPattern = %d, %v with %d keys, expected 30", n, err, len(keys))
+	}
+	if remaining, _ := store.Keys("*"); len(remaining) != 0 {
+		t.Errorf("Keys = %v, expected all deleted", remaining)
+	}
+}
+
+// TestDeletionPacerConcurrent tests that concurrent deletions queue up
+// behind each other instead of all starting at once.
+func TestDeletionPacerConcurrent(t *testing.T) {
+	p := newDeletionPacer(&DeletionThrottle{RowsPerSecond: 100})
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.wait(context.Background(), 10); err != nil {
+				t.Errorf("wait failed: %v", err)
+			}
+			p.done(10, 10, 0)
+		}()
+	}
+	wg.Wait()
+	// Four batches of 10 rows at 100 rows/s start 100ms apart
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("Four concurrent batches took %v, expected them paced", elapsed)
+	}
+}
+
+// TestDeletionThrottlePartitions tests that dropping expired partitions is
+// paced by their rows.
+func TestDeletionThrottlePartitions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := setupWALStore(t, WithClock(func() time.Time { return now }), WithDeletionThrottle(DeletionThrottle{RowsPerSecond: 100}))
+	p, err := store.Partitioned("telemetry", 1)
+	if err != nil {
+		t.Fatalf("Partitioned failed: %v", err)
+	}
+	defer p.Close()
+	for range 2 {
+		for i := range 10 {
+			p.Set(fmt.Sprintf("k:%d", i), "v", 0)
+		}
+		now = now.AddDate(0, 0, 1)
+	}
+
+	start := time.Now()
+	dropped, err := p.DropExpired()
+	if err != nil || len(dropped) != 2 {
+		t.Fatalf("DropExpired = %v, %v, expected 2 partitions", dropped, err)
+	}
+	// The second partition waits for the 10 rows of the first at 100 rows/s
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("DropExpired took %v, expected it paced", elapsed)
+	}
+}
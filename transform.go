@@ -0,0 +1,233 @@
+package mkvstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transformer is one stage of a value transformation pipeline. Encode is
+// applied on write and Decode on read, in reverse pipeline order.
+// Implementations must be safe for concurrent use.
+type Transformer interface {
+	// Name identifies the transformer. It is recorded with every value it
+	// encodes, so it must be stable and unique within a store.
+	Name() string
+	Encode(data []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+// prefixPipeline is a transformer pipeline applied to keys under prefix.
+type prefixPipeline struct {
+	prefix       string
+	transformers []Transformer
+}
+
+// WithTransformers applies the pipeline of transformers, in order, to every
+// value written by the store, e.g. compress, then encrypt, then checksum.
+// The names of the applied transformers are recorded on each row, so reads
+// decode correctly after the pipeline configuration changes, as long as every
+// transformer ever used is still configured somewhere on the store.
+func WithTransformers(transformers ...Transformer) Option {
+	return WithPrefixTransformers("", transformers...)
+}
+
+// WithPrefixTransformers applies a pipeline to keys starting with prefix. The
+// longest matching prefix wins; an empty prefix is the store-wide default.
+// Pass no transformers to exempt a prefix from the default pipeline.
+func WithPrefixTransformers(prefix string, transformers ...Transformer) Option {
+	return func(o *options) {
+		o.pipelines = append(o.pipelines, prefixPipeline{prefix: prefix, transformers: transformers})
+	}
+}
+
+// pipelineFor returns the transformers applied to key.
+func (s *Store) pipelineFor(key string) []Transformer {
+	var best *prefixPipeline
+	for i := range s.opts.pipelines {
+		p := &s.opts.pipelines[i]
+		if strings.HasPrefix(key, p.prefix) && (best == nil || len(p.prefix) >= len(best.prefix)) {
+			best = p
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.transformers
+}
+
+// lookupTransformer resolves a transformer name recorded on a row.
+func (s *Store) lookupTransformer(name string) (Transformer, error) {
+	for _, p := range s.opts.pipelines {
+		for _, t := range p.transformers {
+			if t.Name() == name {
+				return t, nil
+			}
+		}
+	}
+	// Stateless built-in stages can always be resolved
+	if name == (crc32Transformer{}).Name() {
+		return crc32Transformer{}, nil
+	}
+	if idStr, ok := strings.CutPrefix(name, "compress:"); ok {
+		if id, err := strconv.ParseUint(idStr, 10, 8); err == nil {
+			return CompressTransformer(byte(id)), nil
+		}
+	}
+	return nil, fmt.Errorf("transformer %q is not configured on this store", name)
+}
+
+// applyPipeline encodes data with the pipeline for key, returning the encoded
+// bytes and the comma-separated transformer names to record on the row.
+func (s *Store) applyPipeline(key string, data []byte) ([]byte, sql.NullString, error) {
+	pipeline := s.pipelineFor(key)
+	if len(pipeline) == 0 {
+		return data, sql.NullString{}, nil
+	}
+	names := make([]string, 0, len(pipeline))
+	for _, t := range pipeline {
+		start, in := time.Now(), len(data)
+		var err error
+		data, err = t.Encode(data)
+		s.codecs.encoded(t.Name(), start, in, len(data), err)
+		if err != nil {
+			return nil, sql.NullString{}, fmt.Errorf("transformer %q failed to encode value: %w", t.Name(), err)
+		}
+		names = append(names, t.Name())
+	}
+	return data, sql.NullString{String: strings.Join(names, ","), Valid: true}, nil
+}
+
+// reversePipeline decodes data encoded by the transformers recorded on the row.
+func (s *Store) reversePipeline(data []byte, transforms sql.NullString) ([]byte, error) {
+	if !transforms.Valid || transforms.String == "" {
+		return data, nil
+	}
+	names := strings.Split(transforms.String, ",")
+	for i := len(names) - 1; i >= 0; i-- {
+		t, err := s.lookupTransformer(names[i])
+		if err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		data, err = t.Decode(data)
+		s.codecs.decoded(names[i], start, err)
+		if err != nil {
+			return nil, fmt.Errorf("transformer %q failed to decode value: %w", names[i], err)
+		}
+	}
+	return data, nil
+}
+
+// compressTransformer adapts a registered Compressor to a pipeline stage.
+type compressTransformer struct {
+	id byte
+}
+
+// CompressTransformer returns a pipeline stage compressing with the
+// compressor registered under id (see RegisterCompressor).
+func CompressTransformer(id byte) Transformer {
+	return compressTransformer{id: id}
+}
+
+// Name implements Transformer.
+func (c compressTransformer) Name() string { return "compress:" + strconv.Itoa(int(c.id)) }
+
+// Encode implements Transformer.
+func (c compressTransformer) Encode(data []byte) ([]byte, error) {
+	comp, err := lookupCompressor(c.id)
+	if err != nil {
+		return nil, err
+	}
+	return comp.Compress(data)
+}
+
+// Decode implements Transformer.
+func (c compressTransformer) Decode(data []byte) ([]byte, error) {
+	comp, err := lookupCompressor(c.id)
+	if err != nil {
+		return nil, err
+	}
+	return comp.Decompress(data)
+}
+
+// aesGCMTransformer encrypts values with AES-GCM and a random nonce.
+type aesGCMTransformer struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCMTransformer returns a pipeline stage encrypting values with
+// AES-GCM. key must be 16, 24 or 32 bytes long (AES-128, -192 or -256).
+// Each value gets a random nonce, stored in front of the ciphertext.
+func NewAESGCMTransformer(key []byte) (Transformer, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return aesGCMTransformer{aead: aead}, nil
+}
+
+// Name implements Transformer.
+func (aesGCMTransformer) Name() string { return "aes-gcm" }
+
+// Encode implements Transformer.
+func (a aesGCMTransformer) Encode(data []byte) ([]byte, error) {
+	nonce := make([]byte, a.aead.NonceSize(), a.aead.NonceSize()+len(data)+a.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return a.aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// Decode implements Transformer.
+func (a aesGCMTransformer) Decode(data []byte) ([]byte, error) {
+	if len(data) < a.aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := data[:a.aead.NonceSize()], data[a.aead.NonceSize():]
+	return a.aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// crc32Transformer appends a CRC-32 (Castagnoli) checksum to values.
+type crc32Transformer struct{}
+
+// CRC32Transformer returns a pipeline stage that appends a CRC-32C checksum
+// on write and verifies it on read, returning ErrChecksumMismatch for
+// corrupted values. Place it last to cover the bytes actually stored.
+func CRC32Transformer() Transformer {
+	return crc32Transformer{}
+}
+
+var crc32Table = crc32.MakeTable(crc32.Castagnoli)
+
+// Name implements Transformer.
+func (crc32Transformer) Name() string { return "crc32c" }
+
+// Encode implements Transformer.
+func (crc32Transformer) Encode(data []byte) ([]byte, error) {
+	return binary.BigEndian.AppendUint32(append([]byte(nil), data...), crc32.Checksum(data, crc32Table)), nil
+}
+
+// Decode implements Transformer.
+func (crc32Transformer) Decode(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, ErrChecksumMismatch
+	}
+	payload, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.Checksum(payload, crc32Table) != sum {
+		return nil, ErrChecksumMismatch
+	}
+	return payload, nil
+}
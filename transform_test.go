@@ -0,0 +1,66 @@
+package mkvstore
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTransformerPipeline tests chained transformers, per-prefix pipelines and corruption detection.
+func TestTransformerPipeline(t *testing.T) {
+	aesGCM, err := NewAESGCMTransformer(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("NewAESGCMTransformer failed: %v", err)
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "pipeline.db")
+	store, err := Open(dbPath, "test_kv_pipeline",
+		WithTransformers(CompressTransformer(CompressionGzip), aesGCM, CRC32Transformer()),
+		WithPrefixTransformers("public:"), // Exempt from the default pipeline
+	)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	secret := strings.Repeat("secret config ", 20)
+	store.Set("config:1", secret, 0)
+	store.Set("public:1", "plain", 0)
+
+	if value, err := store.Get("config:1"); err != nil || value != secret {
+		t.Fatalf("Get through pipeline failed: %v", err)
+	}
+
+	var raw []byte
+	var transforms string
+	store.db.QueryRow(`SELECT value, transforms FROM "test_kv_pipeline" WHERE key = 'config:1';`).Scan(&raw, &transforms)
+	if transforms != "compress:1,aes-gcm,crc32c" || bytes.Contains(raw, []byte("secret")) {
+		t.Errorf("Value should be stored encrypted with recorded transforms, got transforms %q", transforms)
+	}
+
+	var publicTransforms *string
+	store.db.QueryRow(`SELECT transforms FROM "test_kv_pipeline" WHERE key = 'public:1';`).Scan(&publicTransforms)
+	if publicTransforms != nil {
+		t.Errorf("Exempt prefix should not be transformed, got %q", *publicTransforms)
+	}
+
+	// Flip a byte of the stored value to simulate corruption
+	raw[len(raw)/2] ^= 0xFF
+	store.db.Exec(`UPDATE "test_kv_pipeline" SET value = ? WHERE key = 'config:1';`, raw)
+	if _, err := store.Get("config:1"); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch for a corrupted value, got %v", err)
+	}
+
+	// A store without the encryption transformer cannot read encrypted rows
+	store.Set("config:2", "x", 0)
+	plain, err := Open(dbPath, "test_kv_pipeline")
+	if err != nil {
+		t.Fatalf("Open without pipeline failed: %v", err)
+	}
+	defer plain.Close()
+	if _, err := plain.Get("config:2"); err == nil || !strings.Contains(err.Error(), "aes-gcm") {
+		t.Errorf("Expected an error naming the missing transformer, got %v", err)
+	}
+}
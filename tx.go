@@ -0,0 +1,185 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Tx is a transaction on one store's table, handed to the callback of
+// WithTx or WithTwoStores. It must not be used after the callback returns.
+type Tx struct {
+	store        *Store
+	tx           *sql.Tx
+	compensators []func() error
+	changes      []Event // Published to subscribers once committed
+}
+
+// publish delivers the changes made in the transaction once it committed.
+func (t *Tx) publish() {
+	for _, ev := range t.changes {
+		t.store.notify.publish(ev.Key, ev.Op)
+	}
+}
+
+// Get retrieves the string value of key within the transaction.
+// Returns ErrKeyNotFound if the key does not exist, is expired, or is not a string.
+func (t *Tx) Get(key string) (string, error) {
+	key = t.store.canonicalKey(key)
+	return t.store.getString(t.tx, key)
+}
+
+// Set sets the string value of key within the transaction, like Store.Set.
+func (t *Tx) Set(key, value string, ttl time.Duration) error {
+	s := t.store
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return err
+	}
+	ttl = s.effectiveTTL(key, ttl)
+
+	var expiresAt interface{} // NULL for no expiration
+	if ttl > 0 {
+		expiresAt = s.now().Add(ttl).Unix()
+	}
+
+	enc, err := s.encodeValue(key, value)
+	if err != nil {
+		return fmt.Errorf("failed to set key %q in table %q: %w", key, s.table, err)
+	}
+	if _, err := t.tx.Exec(s.setSQL(), key, enc.data, expiresAt, s.now().Unix(), enc.codec, enc.transforms); err != nil {
+		return fmt.Errorf("failed to set key %q in table %q: %w", key, s.table, err)
+	}
+	s.trackExpiry(key, expiresAt)
+	t.changes = append(t.changes, Event{Key: key, Op: "set"})
+	return nil
+}
+
+// Del deletes key within the transaction. Deleting a missing key is not an error.
+func (t *Tx) Del(key string) error {
+	key = t.store.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return err
+	}
+	delSQL := fmt.Sprintf(`DELETE FROM %s WHERE key = ?;`, t.store.quoteTable())
+	if _, err := t.tx.Exec(delSQL, key); err != nil {
+		return fmt.Errorf("failed to delete key %q from table %q: %w", key, t.store.table, err)
+	}
+	t.changes = append(t.changes, Event{Key: key, Op: "del"})
+	return nil
+}
+
+// WithTx runs fn in a single transaction on the store's table, so the Gets,
+// Sets and Dels it makes commit together or, if fn returns an error, not at
+// all. The error is returned as is. Events reach subscribers once committed.
+func (s *Store) WithTx(fn func(tx *Tx) error) error {
+	if err := s.Sync(); err != nil {
+		return err
+	}
+	var t *Tx
+	err := s.update(func(tx *sql.Tx) error {
+		t = &Tx{store: s, tx: tx}
+		return fn(t)
+	})
+	if err != nil {
+		return err
+	}
+	t.publish()
+	return nil
+}
+
+// Compensate registers fn to undo the effects of this transaction. It only
+// runs when the stores live in different databases and this transaction
+// committed but the other one failed to; see WithTwoStores.
+func (t *Tx) Compensate(fn func() error) {
+	t.compensators = append(t.compensators, fn)
+}
+
+// sameDatabase reports whether a and b use the same database file.
+func sameDatabase(a, b *Store) bool {
+	pa, pb := a.filePath(), b.filePath()
+	if pa == "" || pb == "" {
+		return false // In-memory databases are private to each Store
+	}
+	absA, errA := filepath.Abs(pa)
+	absB, errB := filepath.Abs(pb)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// WithTwoStores runs fn with a transaction on each of a and b, e.g. to move a
+// key from a "pending" table to a "done" table without losing it on a crash.
+//
+// When both tables live in the same database file, txA and txB share a single
+// SQLite transaction, so the changes to both tables commit or roll back
+// together. Otherwise each store gets its own transaction and the commit is
+// best-effort: b is committed first, then a; if a fails to commit, the hooks
+// registered on txB with Compensate run to undo b's changes. Order changes so
+// that a crash between the two commits errs on the side of duplication, e.g.
+// insert into b and delete from a.
+//
+// If fn returns an error, both transactions are rolled back and the error is
+// returned.
+func WithTwoStores(a, b *Store, fn func(txA, txB *Tx) error) error {
+	if err := a.Sync(); err != nil {
+		return err
+	}
+	if err := b.Sync(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	if sameDatabase(a, b) {
+		tx, err := a.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback() // No-op after a successful Commit
+
+		txA, txB := &Tx{store: a, tx: tx}, &Tx{store: b, tx: tx}
+		if err := fn(txA, txB); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction on tables %q and %q: %w", a.table, b.table, err)
+		}
+		txA.publish()
+		txB.publish()
+		return nil
+	}
+
+	sqlTxA, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction on table %q: %w", a.table, err)
+	}
+	defer sqlTxA.Rollback() // No-op after a successful Commit
+
+	sqlTxB, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction on table %q: %w", b.table, err)
+	}
+	defer sqlTxB.Rollback() // No-op after a successful Commit
+
+	txA, txB := &Tx{store: a, tx: sqlTxA}, &Tx{store: b, tx: sqlTxB}
+	if err := fn(txA, txB); err != nil {
+		return err
+	}
+
+	if err := sqlTxB.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction on table %q: %w", b.table, err)
+	}
+	txB.publish()
+	if err := sqlTxA.Commit(); err != nil {
+		err = fmt.Errorf("failed to commit transaction on table %q after committing table %q: %w", a.table, b.table, err)
+		for i := len(txB.compensators) - 1; i >= 0; i-- {
+			if cerr := txB.compensators[i](); cerr != nil {
+				err = errors.Join(err, fmt.Errorf("compensation on table %q failed: %w", b.table, cerr))
+			}
+		}
+		return err
+	}
+	txA.publish()
+	return nil
+}
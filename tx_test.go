@@ -0,0 +1,131 @@
+package mkvstore
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// moveKey moves key from txA to txB, as done for pending/done tables.
+func moveKey(key string) func(txA, txB *Tx) error {
+	return func(txA, txB *Tx) error {
+		v, err := txA.Get(key)
+		if err != nil {
+			return err
+		}
+		if err := txB.Set(key, v, 0); err != nil {
+			return err
+		}
+		return txA.Del(key)
+	}
+}
+
+// TestWithTwoStoresSameDatabase tests a move between two tables of one file.
+func TestWithTwoStoresSameDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "two.db")
+	pending, err := Open(dbPath, "pending")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer pending.Close()
+	done, err := Open(dbPath, "done")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer done.Close()
+
+	if !sameDatabase(pending, done) {
+		t.Fatal("Expected stores to share a database")
+	}
+
+	pending.Set("job:1", "payload", 0)
+	if err := WithTwoStores(pending, done, moveKey("job:1")); err != nil {
+		t.Fatalf("WithTwoStores failed: %v", err)
+	}
+	if v, _ := done.Get("job:1"); v != "payload" {
+		t.Errorf("Expected job:1 in done, got %q", v)
+	}
+	if exists, _ := pending.Exists("job:1"); exists {
+		t.Error("Expected job:1 to be gone from pending")
+	}
+
+	// An error from fn rolls back both sides
+	pending.Set("job:2", "payload", 0)
+	boom := errors.New("boom")
+	err = WithTwoStores(pending, done, func(txA, txB *Tx) error {
+		txB.Set("job:2", "payload", 0)
+		txA.Del("job:2")
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Errorf("Expected fn error, got %v", err)
+	}
+	if exists, _ := done.Exists("job:2"); exists {
+		t.Error("Expected rolled back write to done")
+	}
+	if exists, _ := pending.Exists("job:2"); !exists {
+		t.Error("Expected rolled back delete from pending")
+	}
+}
+
+// TestWithTwoStoresSeparateDatabases tests a move between two database files.
+func TestWithTwoStoresSeparateDatabases(t *testing.T) {
+	dir := t.TempDir()
+	pending, err := Open(filepath.Join(dir, "pending.db"), "kv")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer pending.Close()
+	done, err := Open(filepath.Join(dir, "done.db"), "kv")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer done.Close()
+
+	pending.Set("job:1", "payload", 0)
+	if err := WithTwoStores(pending, done, moveKey("job:1")); err != nil {
+		t.Fatalf("WithTwoStores failed: %v", err)
+	}
+	if v, _ := done.Get("job:1"); v != "payload" {
+		t.Errorf("Expected job:1 in done, got %q", v)
+	}
+	if exists, _ := pending.Exists("job:1"); exists {
+		t.Error("Expected job:1 to be gone from pending")
+	}
+}
+
+// TestWithTx tests that the operations of a transaction commit together or
+// not at all.
+func TestWithTx(t *testing.T) {
+	store := setupStore(t)
+	store.Set("a", "1", 0)
+
+	err := store.WithTx(func(tx *Tx) error {
+		v, err := tx.Get("a")
+		if err != nil {
+			return err
+		}
+		if err := tx.Set("b", v+"0", 0); err != nil {
+			return err
+		}
+		return tx.Del("a")
+	})
+	if err != nil {
+		t.Fatalf("WithTx failed: %v", err)
+	}
+	if v, _ := store.Get("b"); v != "10" {
+		t.Errorf("Expected b = 10, got %q", v)
+	}
+
+	errAbort := errors.New("abort")
+	err = store.WithTx(func(tx *Tx) error {
+		tx.Set("c", "3", 0)
+		return errAbort
+	})
+	if err != errAbort {
+		t.Errorf("Expected the error of fn, got %v", err)
+	}
+	if _, err := store.Get("c"); err != ErrKeyNotFound {
+		t.Errorf("Expected the transaction rolled back, got %v", err)
+	}
+}
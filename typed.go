@@ -0,0 +1,77 @@
+package mkvstore
+
+import (
+	"fmt"
+	"time"
+)
+
+// codec returns the codec configured with WithCodec, or JSONCodec.
+func (s *Store) codec() Codec {
+	if s.opts.codec != nil {
+		return s.opts.codec
+	}
+	return JSONCodec{}
+}
+
+// SetAny serializes v with the store's codec (see WithCodec) and stores it
+// at key, like Set.
+func (s *Store) SetAny(key string, v interface{}, ttl time.Duration) error {
+	data, err := s.codec().Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode value for key %q: %w", key, err)
+	}
+	return s.Set(key, string(data), ttl)
+}
+
+// GetAny retrieves the value at key and deserializes it into out, which must
+// be a pointer, with the store's codec (see WithCodec).
+// Returns ErrKeyNotFound if the key does not exist or is expired.
+func (s *Store) GetAny(key string, out interface{}) error {
+	value, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+	if err := s.codec().Unmarshal([]byte(value), out); err != nil {
+		return fmt.Errorf("failed to decode value of key %q: %w", key, err)
+	}
+	return nil
+}
+
+// Typed is a view of a Store holding values of a single Go type T,
+// serialized with a Codec.
+type Typed[T any] struct {
+	store *Store
+	codec Codec
+}
+
+// NewTyped returns a typed view of s using codec. A nil codec uses the
+// store's codec (see WithCodec).
+func NewTyped[T any](s *Store, codec Codec) *Typed[T] {
+	if codec == nil {
+		codec = s.codec()
+	}
+	return &Typed[T]{store: s, codec: codec}
+}
+
+// Set serializes v and stores it at key, like Store.Set.
+func (t *Typed[T]) Set(key string, v T, ttl time.Duration) error {
+	data, err := t.codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode value for key %q: %w", key, err)
+	}
+	return t.store.Set(key, string(data), ttl)
+}
+
+// Get retrieves and deserializes the value at key.
+// Returns ErrKeyNotFound if the key does not exist or is expired.
+func (t *Typed[T]) Get(key string) (T, error) {
+	var v T
+	value, err := t.store.Get(key)
+	if err != nil {
+		return v, err
+	}
+	if err := t.codec.Unmarshal([]byte(value), &v); err != nil {
+		return v, fmt.Errorf("failed to decode value of key %q: %w", key, err)
+	}
+	return v, nil
+}
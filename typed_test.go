@@ -0,0 +1,58 @@
+package mkvstore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+type testReading struct {
+	Sensor string
+	Value  float64
+	Tags   []string
+}
+
+// TestTypedCodecs tests round-tripping structs through every built-in codec.
+func TestTypedCodecs(t *testing.T) {
+	store, _ := setupFileStore(t)
+	want := testReading{Sensor: "temp-1", Value: 21.5, Tags: []string{"lab"}}
+
+	for name, codec := range map[string]Codec{"json": JSONCodec{}, "gob": GobCodec{}, "msgpack": MsgpackCodec{}} {
+		t.Run(name, func(t *testing.T) {
+			typed := NewTyped[testReading](store, codec)
+			if err := typed.Set("reading:"+name, want, 0); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			got, err := typed.Get("reading:" + name)
+			if err != nil {
+				t.Fatalf("Get failed: %v", err)
+			}
+			if got.Sensor != want.Sensor || got.Value != want.Value || len(got.Tags) != 1 || got.Tags[0] != "lab" {
+				t.Errorf("Round trip mismatch: %+v", got)
+			}
+		})
+	}
+
+	if _, err := NewTyped[testReading](store, nil).Get("missing"); err != ErrKeyNotFound {
+		t.Errorf("Get of missing key should return ErrKeyNotFound, got %v", err)
+	}
+}
+
+// TestSetAnyGetAny tests the untyped helpers with a configured codec.
+func TestSetAnyGetAny(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "any.db"), "test_kv_any", WithCodec(MsgpackCodec{}))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.SetAny("counts", map[string]int{"a": 1, "b": 2}, 0); err != nil {
+		t.Fatalf("SetAny failed: %v", err)
+	}
+	var got map[string]int
+	if err := store.GetAny("counts", &got); err != nil {
+		t.Fatalf("GetAny failed: %v", err)
+	}
+	if got["a"] != 1 || got["b"] != 2 {
+		t.Errorf("GetAny returned %v", got)
+	}
+}
@@ -0,0 +1,179 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// prefixToSQLLike converts a literal key prefix to a SQL LIKE pattern matching
+// every key that starts with it. '%', '_' and '\' in the prefix are escaped so
+// they match literally; use with ESCAPE '\'.
+func prefixToSQLLike(prefix string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`, // Escape the escape character itself
+		`%`, `\%`, // Escape literal %
+		`_`, `\_`, // Escape literal _
+	)
+	return replacer.Replace(prefix) + "%"
+}
+
+// keySizeSQL returns an SQL expression of the bytes stored for the key of
+// the row aliased m: its value, plus the fields and values of a hash, the
+// elements of a list, the members of a set, those of a sorted set with 8
+// bytes per score and the entries of a stream with 16 bytes per ID.
+// length() of a BLOB is its byte count, regardless of the text encoding.
+func (s *Store) keySizeSQL() string {
+	return fmt.Sprintf(`COALESCE(length(CAST(m.value AS BLOB)), 0)
+		+ COALESCE((SELECT SUM(length(h.field) + length(CAST(h.value AS BLOB))) FROM %s h WHERE h.key = m.key), 0)
+		+ COALESCE((SELECT SUM(length(CAST(l.value AS BLOB))) FROM %s l WHERE l.key = m.key), 0)
+		+ COALESCE((SELECT SUM(length(CAST(c.member AS BLOB))) FROM %s c WHERE c.key = m.key), 0)
+		+ COALESCE((SELECT SUM(length(CAST(z.member AS BLOB)) + 8) FROM %s z WHERE z.key = m.key), 0)
+		+ COALESCE((SELECT SUM(length(CAST(e.fields AS BLOB)) + 16) FROM %s e WHERE e.key = m.key), 0)`,
+		s.quoteHashTable(), s.quoteListTable(), s.quoteSetTable(), s.quoteZSetTable(), s.quoteStreamTable())
+}
+
+// SizeOf returns the size in bytes stored for key: that of its value, or of
+// the contents of a hash, list, set, sorted set or stream.
+// Returns ErrKeyNotFound if the key does not exist or is expired.
+func (s *Store) SizeOf(key string) (int64, error) {
+	defer s.observe("sizeof", time.Now())
+
+	key = s.canonicalKey(key)
+	var size int64
+	var expiresAt sql.NullInt64
+
+	sizeSQL := fmt.Sprintf(`SELECT %s, m.expires_at FROM %s m WHERE m.key = ?;`, s.keySizeSQL(), s.quoteTable())
+
+	row := s.queryRow(sizeSQL, key)
+	err := row.Scan(&size, &expiresAt)
+
+	if err == sql.ErrNoRows {
+		return 0, ErrKeyNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get size of key %q in table %q: %w", key, s.table, err)
+	}
+
+	// Check for expiration
+	if expiresAt.Valid && s.now().Unix() > expiresAt.Int64 {
+		go s.purgeExpired(key) // Delete asynchronously, ignore error here
+		return 0, ErrKeyNotFound
+	}
+
+	return size, nil
+}
+
+// StrLen returns the length in bytes of the string value stored at key, or 0
+// if the key does not exist, like Redis STRLEN. Plain values are measured by
+// SQLite, so large blobs are not transferred; compressed or transformed values,
+// aliases and archived keys are read and decoded to be measured.
+// Returns ErrWrongType if key holds another type.
+func (s *Store) StrLen(key string) (int64, error) {
+	defer s.observe("strlen", time.Now())
+
+	key = s.canonicalKey(key)
+	if w, found, err := s.bufferedValue(key); found {
+		if err == ErrKeyNotFound {
+			return 0, nil
+		}
+		return int64(len(w.value)), err
+	}
+
+	var n int64
+	var keyType string
+	var codec byte
+	var transforms sql.NullString
+	var expiresAt sql.NullInt64
+	lenSQL := fmt.Sprintf(`SELECT COALESCE(length(CAST(value AS BLOB)), 0), type, codec, transforms, expires_at FROM %s WHERE key = ?;`, s.quoteTable())
+	err := s.queryRow(lenSQL, key).Scan(&n, &keyType, &codec, &transforms, &expiresAt)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to get length of key %q in table %q: %w", key, s.table, err)
+	}
+	if err == nil && expiresAt.Valid && s.now().Unix() > expiresAt.Int64 {
+		go s.purgeExpired(key) // Delete asynchronously, ignore error here
+		return 0, nil
+	}
+
+	switch {
+	case err == nil && keyType == "string" && codec == CompressionNone && !transforms.Valid:
+		return n, nil
+	case err == nil && keyType != "string" && keyType != "alias" && keyType != "archived":
+		return 0, ErrWrongType
+	}
+	// Encoded, indirect or possibly in an attached database
+	value, err := s.Get(key)
+	if err == ErrKeyNotFound {
+		return 0, nil
+	}
+	return int64(len(value)), err
+}
+
+// Usage reports how many live keys start with prefix and the total size in
+// bytes stored for them, containers included, as SizeOf reports it. An empty
+// prefix reports on the whole table.
+// Expired keys that have not been cleaned up yet and reserved keys are not
+// counted.
+func (s *Store) Usage(prefix string) (keys int64, bytes int64, err error) {
+	defer s.observe("usage", time.Now())
+
+	prefix = s.canonicalKey(prefix)
+	usageSQL := fmt.Sprintf(`
+	SELECT COUNT(*), COALESCE(SUM(%s), 0) FROM %s m
+	WHERE key LIKE ? ESCAPE '\' AND %s AND (expires_at IS NULL OR expires_at >= ?);`, s.keySizeSQL(), s.quoteTable(), notReservedSQL)
+
+	row := s.queryRow(usageSQL, prefixToSQLLike(prefix), s.now().Unix())
+	if err = row.Scan(&keys, &bytes); err != nil {
+		return 0, 0, fmt.Errorf("failed to compute usage for prefix %q in table %q: %w", prefix, s.table, err)
+	}
+	return keys, bytes, nil
+}
+
+// KeySize is a key with the size of its stored value, as reported by
+// TopKeysBySize.
+type KeySize struct {
+	Key  string
+	Type string // "string", "hash", "list", "set", "zset", "stream", "alias" or "archived"
+	Size int64  // Size in bytes stored for the key, containers included (see SizeOf)
+}
+
+// TopKeysBySize returns the n live keys matching pattern taking the most
+// bytes, largest first and ties ordered by key, to answer what is eating the
+// flash. Sizes are those stored, so after compression and transforms, and
+// include the contents of hashes, lists, sets, sorted sets and streams, as
+// SizeOf reports them. Reserved keys are not reported.
+func (s *Store) TopKeysBySize(n int, pattern string) ([]KeySize, error) {
+	defer s.observe("topkeysbysize", time.Now())
+
+	pattern = s.canonicalKey(pattern)
+	if n <= 0 {
+		return nil, nil
+	}
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+
+	topSQL := fmt.Sprintf(`
+	SELECT key, type, %s AS size FROM %s m
+	WHERE key LIKE ? ESCAPE '\' AND %s AND (expires_at IS NULL OR expires_at >= ?)
+	ORDER BY size DESC, key LIMIT ?;`, s.keySizeSQL(), s.quoteTable(), notReservedSQL)
+	rows, err := s.query(topSQL, globToSQLLike(pattern), s.now().Unix(), n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query largest keys with pattern %q from table %q: %w", pattern, s.table, err)
+	}
+	defer rows.Close()
+
+	var top []KeySize
+	for rows.Next() {
+		var k KeySize
+		if err := rows.Scan(&k.Key, &k.Type, &k.Size); err != nil {
+			return nil, fmt.Errorf("failed to scan largest keys in table %q: %w", s.table, err)
+		}
+		top = append(top, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through largest keys in table %q: %w", s.table, err)
+	}
+	return top, nil
+}
@@ -0,0 +1,175 @@
+package mkvstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// maxWriteBatch is the maximum number of queued mutations the writer commits
+// in one transaction.
+const maxWriteBatch = 256
+
+// WithSerializedWrites funnels every mutation of the store (Set, Del, hash and
+// list commands, renames, SetMeta, buffered flushes and background cleanup)
+// through a single writer goroutine, so concurrent writers in this process
+// never contend for the SQLite write lock and never see SQLITE_BUSY from each
+// other. Mutations queued while a transaction is running are committed
+// together in the next one, each under its own savepoint so a failing
+// mutation does not affect the others in its batch. Callers still block
+// until their mutation is committed.
+//
+// Transactions opened by WithTwoStores bypass the queue, as do writes from
+// other processes sharing the file, which can still cause SQLITE_BUSY.
+func WithSerializedWrites() Option {
+	return func(o *options) {
+		o.serializedWrites = true
+	}
+}
+
+// writeJob is a mutation queued for the writer goroutine.
+type writeJob struct {
+	fn   func(tx *sql.Tx) error
+	done chan error
+}
+
+// writeQueue runs queued mutations on a single goroutine, in batches.
+type writeQueue struct {
+	s    *Store
+	jobs chan writeJob // Unbuffered, so an accepted job is always run
+	quit chan struct{} // Closed to stop the writer
+	done chan struct{} // Closed when the writer goroutine has exited
+	once sync.Once
+}
+
+// startWriteQueue starts the writer goroutine.
+func (s *Store) startWriteQueue() {
+	wq := &writeQueue{
+		s:    s,
+		jobs: make(chan writeJob),
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	s.wq = wq
+	go wq.run()
+}
+
+// run receives jobs until the queue is closed, committing the jobs that are
+// waiting when a transaction starts together.
+func (wq *writeQueue) run() {
+	defer close(wq.done)
+	for {
+		var batch []writeJob
+		select {
+		case job := <-wq.jobs:
+			batch = append(batch, job)
+		case <-wq.quit:
+			return
+		}
+	collect:
+		for len(batch) < maxWriteBatch {
+			select {
+			case job := <-wq.jobs:
+				batch = append(batch, job)
+			default:
+				break collect
+			}
+		}
+		wq.commit(batch)
+	}
+}
+
+// commit runs a batch of jobs in one transaction and reports each job's
+// result to its caller.
+func (wq *writeQueue) commit(batch []writeJob) {
+	errs := make([]error, len(batch))
+	err := func() error {
+		ctx := context.Background()
+		tx, err := wq.s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction on table %q: %w", wq.s.table, err)
+		}
+		defer tx.Rollback() // No-op after a successful Commit
+
+		for i, job := range batch {
+			if _, err := tx.ExecContext(ctx, `SAVEPOINT job;`); err != nil {
+				return fmt.Errorf("failed to begin savepoint on table %q: %w", wq.s.table, err)
+			}
+			if errs[i] = job.fn(tx); errs[i] != nil {
+				if _, err := tx.ExecContext(ctx, `ROLLBACK TO job;`); err != nil {
+					return fmt.Errorf("failed to roll back savepoint on table %q: %w", wq.s.table, err)
+				}
+			}
+			if _, err := tx.ExecContext(ctx, `RELEASE job;`); err != nil {
+				return fmt.Errorf("failed to release savepoint on table %q: %w", wq.s.table, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction on table %q: %w", wq.s.table, err)
+		}
+		return nil
+	}()
+
+	for i, job := range batch {
+		if errs[i] == nil {
+			errs[i] = err // Nothing was committed
+		}
+		job.done <- errs[i]
+	}
+}
+
+// do queues fn and waits until it has run and its transaction is committed.
+func (wq *writeQueue) do(fn func(tx *sql.Tx) error) error {
+	job := writeJob{fn: fn, done: make(chan error, 1)}
+	select {
+	case wq.jobs <- job:
+		return <-job.done
+	case <-wq.quit:
+		return errStoreClosed
+	}
+}
+
+// close stops the writer once the batch in progress is committed.
+func (wq *writeQueue) close() {
+	wq.once.Do(func() { close(wq.quit) })
+	<-wq.done
+}
+
+// update runs fn in a write transaction and commits it, through the writer
+// goroutine when writes are serialized (see WithSerializedWrites).
+func (s *Store) update(fn func(tx *sql.Tx) error) error {
+	if s.wq != nil {
+		return s.checkCorrupt(s.wq.do(fn))
+	}
+
+	tx, err := s.beginTx(s.ctx, nil)
+	if err != nil {
+		return s.checkCorrupt(fmt.Errorf("failed to begin transaction on table %q: %w", s.table, err))
+	}
+	defer tx.Rollback() // No-op after a successful Commit
+
+	if err := fn(tx); err != nil {
+		return s.checkCorrupt(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return s.checkCorrupt(fmt.Errorf("failed to commit transaction on table %q: %w", s.table, err))
+	}
+	return nil
+}
+
+// exec runs a single write statement, through the writer goroutine when
+// writes are serialized (see WithSerializedWrites).
+func (s *Store) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if s.wq == nil {
+		result, err := s.q().ExecContext(ctx, query, args...)
+		return result, s.checkCorrupt(err)
+	}
+	var result sql.Result
+	err := s.wq.do(func(tx *sql.Tx) error {
+		var err error
+		result, err = tx.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, s.checkCorrupt(err)
+}
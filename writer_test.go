@@ -0,0 +1,99 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestSerializedWrites tests concurrent mutations through the writer goroutine.
+func TestSerializedWrites(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "serial.db"), "kv", WithSerializedWrites())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, 3*writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- store.Set(fmt.Sprintf("k%d", i), "v", 0)
+			errs <- store.HSet("h", fmt.Sprintf("f%d", i), "v")
+			_, err := store.RPush("q", "v")
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Concurrent write failed: %v", err)
+		}
+	}
+
+	if keys, _ := store.Keys("k*"); len(keys) != writers {
+		t.Errorf("Expected %d string keys, got %d", writers, len(keys))
+	}
+	if n, _ := store.HLen("h"); n != writers {
+		t.Errorf("Expected %d hash fields, got %d", writers, n)
+	}
+	if n, _ := store.LLen("q"); n != writers {
+		t.Errorf("Expected %d list elements, got %d", writers, n)
+	}
+
+	// A failing mutation leaves the rest of the store untouched
+	if err := store.HSet("k0", "f", "v"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	if v, err := store.Get("k0"); err != nil || v != "v" {
+		t.Errorf("Get(k0) = %q, %v; expected %q", v, err, "v")
+	}
+
+	store.Close()
+	if err := store.Set("k0", "v", 0); err == nil {
+		t.Error("Expected Set to fail after Close")
+	}
+}
+
+// TestWriteQueueBatchIsolation tests that a failing job in a batch rolls back
+// only its own changes.
+func TestWriteQueueBatchIsolation(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "serial.db"), "kv", WithSerializedWrites())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	failure := errors.New("job failed")
+	insert := func(key string, fail bool) writeJob {
+		return writeJob{done: make(chan error, 1), fn: func(tx *sql.Tx) error {
+			if _, err := tx.Exec(store.setSQL(), key, []byte("v"), nil, 0, 0, nil); err != nil {
+				return err
+			}
+			if fail {
+				return failure
+			}
+			return nil
+		}}
+	}
+	batch := []writeJob{insert("a", false), insert("b", true), insert("c", false)}
+	store.wq.commit(batch)
+
+	for i, expected := range []error{nil, failure, nil} {
+		if err := <-batch[i].done; !errors.Is(err, expected) {
+			t.Errorf("Job %d: expected %v, got %v", i, expected, err)
+		}
+	}
+	for key, expected := range map[string]bool{"a": true, "b": false, "c": true} {
+		if exists, _ := store.Exists(key); exists != expected {
+			t.Errorf("Exists(%q) = %v, expected %v", key, exists, expected)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package mkvstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Sorted sets are stored as a row of type 'zset' in the store's table,
+// carrying the key's expiry and version, plus one row per member in
+// <table>_zset with its score. An index on (key, score, member) turns ranges
+// by rank or score into SQL range scans. Like set members, sorted set members
+// are stored as is, not through the value codec.
+
+// zsetTableName returns the name of the table holding the members of sorted sets in table.
+func zsetTableName(table string) string {
+	return table + "_zset"
+}
+
+// quoteZSetTable returns the sorted set member table name safely quoted for SQL.
+func (s *Store) quoteZSetTable() string {
+	return quoteIdent(zsetTableName(s.table))
+}
+
+// ZMember is a member of a sorted set with its score.
+type ZMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// checkScore rejects NaN, which has no place in the order of scores.
+func checkScore(score float64) error {
+	if math.IsNaN(score) {
+		return errors.New("score is not a number")
+	}
+	return nil
+}
+
+// ZAdd adds members to the sorted set stored at key, or updates the score of
+// those already in it, creating the sorted set if needed. It returns the
+// number of members added, not counting updated ones.
+// Returns ErrWrongType if key holds another type.
+func (s *Store) ZAdd(key string, members ...ZMember) (int, error) {
+	defer s.observe("zadd", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return 0, err
+	}
+	if len(members) == 0 {
+		return 0, fmt.Errorf("failed to add to sorted set %q in table %q: no members", key, s.table)
+	}
+	for _, m := range members {
+		if err := checkScore(m.Score); err != nil {
+			return 0, fmt.Errorf("failed to add member %q to sorted set %q in table %q: %w", m.Member, key, s.table, err)
+		}
+	}
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+
+	var added int
+	err := s.update(func(tx *sql.Tx) error {
+		if err := s.touchKey(tx, key, "zset", s.now().Unix()); err != nil {
+			return err
+		}
+		existsSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE key = ? AND member = ?;`, s.quoteZSetTable())
+		zaddSQL := fmt.Sprintf(`
+		INSERT INTO %s (key, member, score) VALUES (?, ?, ?)
+		ON CONFLICT(key, member) DO UPDATE SET score = excluded.score;`, s.quoteZSetTable())
+		for _, m := range members {
+			var exists int
+			if err := tx.QueryRowContext(s.ctx, existsSQL, key, m.Member).Scan(&exists); err != nil {
+				return fmt.Errorf("failed to read sorted set %q in table %q: %w", key, s.table, err)
+			}
+			if _, err := tx.ExecContext(s.ctx, zaddSQL, key, m.Member, m.Score); err != nil {
+				return fmt.Errorf("failed to add member %q to sorted set %q in table %q: %w", m.Member, key, s.table, err)
+			}
+			if exists == 0 {
+				added++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.notify.publish(key, "zadd")
+	return added, nil
+}
+
+// ZIncrBy adds increment to the score of member in the sorted set stored at
+// key and returns the new score. A missing member starts from 0, and a
+// missing key is created. Returns ErrWrongType if key holds another type.
+func (s *Store) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	defer s.observe("zincrby", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return 0, err
+	}
+	if err := checkScore(increment); err != nil {
+		return 0, fmt.Errorf("failed to increment member %q of sorted set %q in table %q: %w", member, key, s.table, err)
+	}
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+
+	var score float64
+	err := s.update(func(tx *sql.Tx) error {
+		if err := s.touchKey(tx, key, "zset", s.now().Unix()); err != nil {
+			return err
+		}
+		incrSQL := fmt.Sprintf(`
+		INSERT INTO %s (key, member, score) VALUES (?, ?, ?)
+		ON CONFLICT(key, member) DO UPDATE SET score = score + excluded.score
+		RETURNING score;`, s.quoteZSetTable())
+		if err := tx.QueryRowContext(s.ctx, incrSQL, key, member, increment).Scan(&score); err != nil {
+			return fmt.Errorf("failed to increment member %q of sorted set %q in table %q: %w", member, key, s.table, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.notify.publish(key, "zincrby")
+	return score, nil
+}
+
+// ZRem removes members from the sorted set stored at key and returns the
+// number of members that were in it. The sorted set is deleted once its last
+// member is removed. Returns ErrWrongType if key holds another type.
+func (s *Store) ZRem(key string, members ...string) (int, error) {
+	defer s.observe("zrem", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := checkReserved(key); err != nil {
+		return 0, err
+	}
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+	now := s.now().Unix()
+
+	var removed int
+	err := s.update(func(tx *sql.Tx) error {
+		if ok, err := s.liveKey(tx, key, "zset", now); !ok {
+			return err
+		}
+		zremSQL := fmt.Sprintf(`DELETE FROM %s WHERE key = ? AND member = ?;`, s.quoteZSetTable())
+		for _, member := range members {
+			result, err := tx.ExecContext(s.ctx, zremSQL, key, member)
+			if err != nil {
+				return fmt.Errorf("failed to remove from sorted set %q in table %q: %w", key, s.table, err)
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			removed += int(n)
+		}
+		if removed == 0 {
+			return nil
+		}
+
+		// Drop the sorted set with its last member, otherwise record the change on it
+		var n int
+		cardSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE key = ?;`, s.quoteZSetTable())
+		if err := tx.QueryRowContext(s.ctx, cardSQL, key).Scan(&n); err != nil {
+			return fmt.Errorf("failed to count sorted set %q in table %q: %w", key, s.table, err)
+		}
+		parentSQL := fmt.Sprintf(`UPDATE %s SET version = version + 1, updated_at = ?2 WHERE key = ?1;`, s.quoteTable())
+		if n == 0 {
+			parentSQL = fmt.Sprintf(`DELETE FROM %s WHERE key = ?1;`, s.quoteTable())
+		}
+		if _, err := tx.ExecContext(s.ctx, parentSQL, key, now); err != nil {
+			return fmt.Errorf("failed to update sorted set %q in table %q: %w", key, s.table, err)
+		}
+		return nil
+	})
+	if err != nil || removed == 0 {
+		return 0, err
+	}
+	s.notify.publish(key, "zrem")
+	return removed, nil
+}
+
+// ZScore returns the score of member in the sorted set stored at key.
+// Returns ErrKeyNotFound if the key or member does not exist, and
+// ErrWrongType if key holds another type.
+func (s *Store) ZScore(key, member string) (float64, error) {
+	defer s.observe("zscore", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+	if ok, err := s.liveKey(s.q(), key, "zset", s.now().Unix()); !ok {
+		if err == nil {
+			err = ErrKeyNotFound
+		}
+		return 0, err
+	}
+	var score float64
+	scoreSQL := fmt.Sprintf(`SELECT score FROM %s WHERE key = ? AND member = ?;`, s.quoteZSetTable())
+	err := s.queryRow(scoreSQL, key, member).Scan(&score)
+	if err == sql.ErrNoRows {
+		return 0, ErrKeyNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read sorted set %q in table %q: %w", key, s.table, err)
+	}
+	return score, nil
+}
+
+// ZCard returns the number of members of the sorted set stored at key, or 0
+// if the key does not exist. Returns ErrWrongType if key holds another type.
+func (s *Store) ZCard(key string) (int, error) {
+	defer s.observe("zcard", time.Now())
+
+	return s.zcard(s.canonicalKey(key))
+}
+
+// zcard returns the number of members of the sorted set stored at the
+// canonical key, for ZCard and ZRange.
+func (s *Store) zcard(key string) (int, error) {
+	if err := s.Sync(); err != nil {
+		return 0, err
+	}
+	if ok, err := s.liveKey(s.q(), key, "zset", s.now().Unix()); !ok {
+		return 0, err
+	}
+	var n int
+	cardSQL := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE key = ?;`, s.quoteZSetTable())
+	if err := s.queryRow(cardSQL, key).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count sorted set %q in table %q: %w", key, s.table, err)
+	}
+	return n, nil
+}
+
+// ZRange returns the members of the sorted set stored at key from rank start
+// to stop inclusive, lowest score first and members with equal scores in
+// ascending order, like Redis ZRANGE. Negative ranks count from the highest
+// score, -1 being the last member, and out of range ranks are clamped. A
+// missing key is an empty sorted set.
+// Returns ErrWrongType if key holds another type.
+func (s *Store) ZRange(key string, start, stop int) ([]ZMember, error) {
+	defer s.observe("zrange", time.Now())
+
+	key = s.canonicalKey(key)
+	n, err := s.zcard(key)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	offset, count := listRange(n, start, stop)
+	if count == 0 {
+		return nil, nil
+	}
+	rangeSQL := fmt.Sprintf(`
+	SELECT member, score FROM %s WHERE key = ?
+	ORDER BY score, member LIMIT ? OFFSET ?;`, s.quoteZSetTable())
+	return s.zsetRange(key, rangeSQL, key, count, offset)
+}
+
+// ZRangeByScore returns the members of the sorted set stored at key with a
+// score between minScore and maxScore inclusive, lowest score first, like Redis
+// ZRANGEBYSCORE. Use math.Inf for an open end. A limit greater than 0 caps
+// the number of members returned, e.g. for the top of a leaderboard.
+// Returns ErrWrongType if key holds another type.
+func (s *Store) ZRangeByScore(key string, minScore, maxScore float64, limit int) ([]ZMember, error) {
+	defer s.observe("zrangebyscore", time.Now())
+
+	key = s.canonicalKey(key)
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+	if ok, err := s.liveKey(s.q(), key, "zset", s.now().Unix()); !ok {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = -1 // No limit in SQLite
+	}
+	rangeSQL := fmt.Sprintf(`
+	SELECT member, score FROM %s WHERE key = ? AND score >= ? AND score <= ?
+	ORDER BY score, member LIMIT ?;`, s.quoteZSetTable())
+	return s.zsetRange(key, rangeSQL, key, minScore, maxScore, limit)
+}
+
+// zsetRange runs rangeSQL, which selects member and score, for the sorted set
+// stored at key.
+func (s *Store) zsetRange(key, rangeSQL string, args ...interface{}) ([]ZMember, error) {
+	rows, err := s.query(rangeSQL, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sorted set %q in table %q: %w", key, s.table, err)
+	}
+	defer rows.Close()
+
+	var members []ZMember
+	for rows.Next() {
+		var m ZMember
+		if err := rows.Scan(&m.Member, &m.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan sorted set %q in table %q: %w", key, s.table, err)
+		}
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating through sorted set %q in table %q: %w", key, s.table, err)
+	}
+	return members, nil
+}
@@ -0,0 +1,122 @@
+package mkvstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestZSet tests adding, scoring, incrementing and removing members of a
+// sorted set.
+func TestZSet(t *testing.T) {
+	store := setupStore(t)
+	defer store.Close()
+
+	n, err := store.ZAdd("board", ZMember{"alice", 30}, ZMember{"bob", 10}, ZMember{"carol", 20})
+	if err != nil || n != 3 {
+		t.Fatalf("ZAdd = %d, %v, expected 3", n, err)
+	}
+	if n, err := store.ZAdd("board", ZMember{"bob", 40}, ZMember{"dave", 20}); err != nil || n != 1 {
+		t.Errorf("ZAdd updating bob = %d, %v, expected 1", n, err)
+	}
+	if score, err := store.ZScore("board", "bob"); err != nil || score != 40 {
+		t.Errorf("ZScore(bob) = %v, %v", score, err)
+	}
+	if _, err := store.ZScore("board", "nobody"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound for a missing member, got %v", err)
+	}
+	if score, err := store.ZIncrBy("board", 2.5, "carol"); err != nil || score != 22.5 {
+		t.Errorf("ZIncrBy(carol) = %v, %v", score, err)
+	}
+	if score, err := store.ZIncrBy("board", -1, "erin"); err != nil || score != -1 {
+		t.Errorf("ZIncrBy of a new member = %v, %v", score, err)
+	}
+	if _, err := store.ZAdd("board", ZMember{"nan", math.NaN()}); err == nil {
+		t.Error("Expected ZAdd to reject a NaN score")
+	}
+	if typ, err := store.Type("board"); err != nil || typ != "zset" {
+		t.Errorf("Type = %q, %v", typ, err)
+	}
+
+	if n, err := store.ZRem("board", "erin", "nobody"); err != nil || n != 1 {
+		t.Errorf("ZRem = %d, %v, expected 1", n, err)
+	}
+	if n, err := store.ZCard("board"); err != nil || n != 4 {
+		t.Errorf("ZCard = %d, %v", n, err)
+	}
+	if n, err := store.ZRem("board", "alice", "bob", "carol", "dave"); err != nil || n != 4 {
+		t.Errorf("ZRem of the last members = %d, %v", n, err)
+	}
+	if _, err := store.Type("board"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected the empty sorted set to be deleted, got %v", err)
+	}
+
+	store.Set("str", "value", 0)
+	if _, err := store.ZAdd("str", ZMember{"a", 1}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from ZAdd on a string, got %v", err)
+	}
+	if _, err := store.ZRange("str", 0, -1); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from ZRange on a string, got %v", err)
+	}
+}
+
+// TestZSetRange tests ranges by rank and by score, ties ordered by member.
+func TestZSetRange(t *testing.T) {
+	store := setupStore(t)
+	defer store.Close()
+
+	store.ZAdd("board", ZMember{"d", 3}, ZMember{"a", 1}, ZMember{"c", 2}, ZMember{"b", 2}, ZMember{"e", math.Inf(1)})
+
+	tests := []struct {
+		name string
+		fn   func() ([]ZMember, error)
+		want []ZMember
+	}{
+		{"ZRange all", func() ([]ZMember, error) { return store.ZRange("board", 0, -1) },
+			[]ZMember{{"a", 1}, {"b", 2}, {"c", 2}, {"d", 3}, {"e", math.Inf(1)}}},
+		{"ZRange tail", func() ([]ZMember, error) { return store.ZRange("board", -2, -1) },
+			[]ZMember{{"d", 3}, {"e", math.Inf(1)}}},
+		{"ZRange out of range", func() ([]ZMember, error) { return store.ZRange("board", 10, 20) }, nil},
+		{"ZRangeByScore", func() ([]ZMember, error) { return store.ZRangeByScore("board", 2, 3, 0) },
+			[]ZMember{{"b", 2}, {"c", 2}, {"d", 3}}},
+		{"ZRangeByScore limit", func() ([]ZMember, error) { return store.ZRangeByScore("board", math.Inf(-1), math.Inf(1), 2) },
+			[]ZMember{{"a", 1}, {"b", 2}}},
+		{"ZRangeByScore open", func() ([]ZMember, error) { return store.ZRangeByScore("board", 3, math.Inf(1), 0) },
+			[]ZMember{{"d", 3}, {"e", math.Inf(1)}}},
+		{"ZRange missing", func() ([]ZMember, error) { return store.ZRange("missing", 0, -1) }, nil},
+	}
+	for _, tt := range tests {
+		got, err := tt.fn()
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, %v, expected %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// TestZSetCopyMirror tests that copies and mirrors carry the scores of
+// sorted sets.
+func TestZSetCopyMirror(t *testing.T) {
+	store := setupStore(t)
+	defer store.Close()
+
+	store.ZAdd("z", ZMember{"a", 1.5}, ZMember{"b", -2})
+	if _, err := store.Copy("z", "copy", false); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if got, err := store.ZRange("copy", 0, -1); err != nil || !reflect.DeepEqual(got, []ZMember{{"b", -2}, {"a", 1.5}}) {
+		t.Errorf("ZRange of the copy = %v, %v", got, err)
+	}
+
+	var buf bytes.Buffer
+	if err := store.MirrorTo(context.Background(), &buf, MirrorJSONL); err != nil {
+		t.Fatalf("MirrorTo failed: %v", err)
+	}
+	want := `{"key":"z","type":"zset","scored":[{"member":"b","score":-2},{"member":"a","score":1.5}]}`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("Unexpected mirror %s", buf.String())
+	}
+}